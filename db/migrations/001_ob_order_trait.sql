@@ -0,0 +1,17 @@
+-- [user-026] trait出价订单与trait的关联关系
+-- 按链分表，每条支持的链各建一张，表名为 ob_order_trait_{chain}
+-- 订单表由indexer维护，trait出价在订单表中仍为collection出价，本表只记录出价意向
+CREATE TABLE IF NOT EXISTS `ob_order_trait_sepolia`
+(
+    `id`                 bigint       NOT NULL AUTO_INCREMENT,
+    `order_id`           varchar(66)  NOT NULL COMMENT '订单id',
+    `collection_address` varchar(42)  NOT NULL COMMENT '集合地址',
+    `trait`              varchar(255) NOT NULL COMMENT 'trait名称',
+    `trait_value`        varchar(255) NOT NULL COMMENT 'trait值',
+    `create_time`        bigint       NOT NULL DEFAULT 0 COMMENT '创建时间，毫秒',
+    `update_time`        bigint       NOT NULL DEFAULT 0 COMMENT '更新时间，毫秒',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_order_trait` (`order_id`, `trait`, `trait_value`),
+    KEY `idx_collection_trait` (`collection_address`, `trait`, `trait_value`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='trait出价订单';
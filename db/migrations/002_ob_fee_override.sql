@@ -0,0 +1,17 @@
+-- [user-027] 手续费覆盖配置
+-- 按链分表，每条支持的链各建一张，表名为 ob_fee_override_{chain}
+-- collection_address为空表示对所有集合生效，marketplace_id为-1表示对所有市场生效，费率为null表示不覆盖
+-- 服务按链缓存全部配置60秒，修改后最多60秒生效
+CREATE TABLE IF NOT EXISTS `ob_fee_override_sepolia`
+(
+    `id`                   bigint         NOT NULL AUTO_INCREMENT,
+    `collection_address`   varchar(42)    NOT NULL DEFAULT '' COMMENT '集合地址',
+    `marketplace_id`       int            NOT NULL DEFAULT -1 COMMENT '市场id',
+    `marketplace_fee_rate` decimal(10, 6) NULL COMMENT '市场手续费率',
+    `royalty_fee_rate`     decimal(10, 6) NULL COMMENT '版税费率',
+    `create_time`          bigint         NOT NULL DEFAULT 0,
+    `update_time`          bigint         NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_collection_marketplace` (`collection_address`, `marketplace_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='手续费覆盖配置';
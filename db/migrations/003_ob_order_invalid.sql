@@ -0,0 +1,20 @@
+-- [user-028] 链上校验不通过的挂单
+-- 按链分表，每条支持的链各建一张，表名为 ob_order_invalid_{chain}
+-- 地板价、上架数量和立即购买通过 order_id not in (select order_id ...) 排除本表中的订单
+-- 订单成交、取消或过期后，对应记录在下一轮校验时删除
+CREATE TABLE IF NOT EXISTS `ob_order_invalid_sepolia`
+(
+    `id`                 bigint       NOT NULL AUTO_INCREMENT,
+    `order_id`           varchar(66)  NOT NULL COMMENT '订单id',
+    `collection_address` varchar(42)  NOT NULL COMMENT '集合地址',
+    `token_id`           varchar(128) NOT NULL COMMENT 'token id',
+    `maker`              varchar(42)  NOT NULL COMMENT '挂单者',
+    `reason`             varchar(32)  NOT NULL COMMENT '无效原因 owner_changed/not_approved/token_burned',
+    `check_time`         bigint       NOT NULL DEFAULT 0 COMMENT '校验时间，秒',
+    `create_time`        bigint       NOT NULL DEFAULT 0,
+    `update_time`        bigint       NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_order_id` (`order_id`),
+    KEY `idx_collection` (`collection_address`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='无效挂单';
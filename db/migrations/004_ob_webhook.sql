@@ -0,0 +1,44 @@
+-- [user-033] webhook订阅和投递记录
+-- 过滤条件为逗号分隔的列表，为空表示不过滤
+CREATE TABLE IF NOT EXISTS `ob_webhook`
+(
+    `id`                   bigint        NOT NULL AUTO_INCREMENT,
+    `owner`                varchar(42)   NOT NULL COMMENT '注册用户地址',
+    `url`                  varchar(1024) NOT NULL COMMENT '投递地址，只允许公网地址',
+    `secret`               varchar(64)   NOT NULL COMMENT '签名秘钥',
+    `event_types`          varchar(512)  NOT NULL DEFAULT '' COMMENT '事件类型',
+    `chain_ids`            varchar(256)  NOT NULL DEFAULT '' COMMENT '链id',
+    `collection_addresses` text          NOT NULL COMMENT '集合地址',
+    `wallet_addresses`     text          NOT NULL COMMENT '钱包地址',
+    `status`               tinyint       NOT NULL DEFAULT 0 COMMENT '0-生效 1-停用',
+    `create_time`          bigint        NOT NULL DEFAULT 0,
+    `update_time`          bigint        NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_owner` (`owner`),
+    KEY `idx_status` (`status`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='webhook订阅';
+
+-- 投递前通过 UPDATE ... SET status=3, claim_token=? WHERE status in (0,3) AND next_retry_time<=now 认领，
+-- 认领期间next_retry_time为认领到期时间，投递进程中断时到期后可被重新认领
+CREATE TABLE IF NOT EXISTS `ob_webhook_delivery`
+(
+    `id`               bigint       NOT NULL AUTO_INCREMENT,
+    `webhook_id`       bigint       NOT NULL COMMENT 'webhook id',
+    `event_id`         varchar(64)  NOT NULL COMMENT '事件id <链id>-<activity id>',
+    `event_type`       varchar(32)  NOT NULL COMMENT '事件类型',
+    `payload`          text         NOT NULL COMMENT '投递内容',
+    `status`           tinyint      NOT NULL DEFAULT 0 COMMENT '0-待投递 1-成功 2-死信 3-投递中',
+    `attempts`         int          NOT NULL DEFAULT 0 COMMENT '已投递次数',
+    `next_retry_time`  bigint       NOT NULL DEFAULT 0 COMMENT '下次投递时间，投递中时为认领到期时间，秒',
+    `last_status_code` int          NOT NULL DEFAULT 0 COMMENT '最近一次响应状态码',
+    `last_error`       varchar(512) NOT NULL DEFAULT '' COMMENT '最近一次错误',
+    `claim_token`      varchar(32)  NOT NULL DEFAULT '' COMMENT '认领标识',
+    `create_time`      bigint       NOT NULL DEFAULT 0,
+    `update_time`      bigint       NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_webhook_event` (`webhook_id`, `event_id`),
+    KEY `idx_status_retry` (`status`, `next_retry_time`),
+    KEY `idx_claim_token` (`claim_token`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='webhook投递记录';
@@ -0,0 +1,25 @@
+-- [user-034] 用户站内通知
+-- (address, dedup_key)唯一，同一事件对同一用户只通知一次；
+-- 出价被超过的dedup_key为 outbid:<链id>:<订单类型>:<集合地址>:<token id>:<时间窗口序号>，按用户、item(或集合)和时间窗口合并
+CREATE TABLE IF NOT EXISTS `ob_notification`
+(
+    `id`                 bigint          NOT NULL AUTO_INCREMENT,
+    `address`            varchar(42)     NOT NULL COMMENT '接收通知的用户地址',
+    `chain_id`           int             NOT NULL COMMENT '链id',
+    `notify_type`        varchar(32)     NOT NULL COMMENT '通知类型 bid_received/outbid/item_sold/listing_expiring/price_alert',
+    `collection_address` varchar(42)     NOT NULL DEFAULT '' COMMENT '集合地址',
+    `token_id`           varchar(128)    NOT NULL DEFAULT '' COMMENT 'token id',
+    `order_id`           varchar(66)     NOT NULL DEFAULT '' COMMENT '订单id',
+    `price`              decimal(30, 18) NOT NULL DEFAULT 0 COMMENT '价格',
+    `counterparty`       varchar(42)     NOT NULL DEFAULT '' COMMENT '交易对手地址',
+    `dedup_key`          varchar(255)    NOT NULL COMMENT '去重key',
+    `is_read`            tinyint(1)      NOT NULL DEFAULT 0 COMMENT '是否已读',
+    `event_time`         bigint          NOT NULL DEFAULT 0 COMMENT '事件时间，秒',
+    `create_time`        bigint          NOT NULL DEFAULT 0,
+    `update_time`        bigint          NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_address_dedup` (`address`, `dedup_key`),
+    KEY `idx_address_read` (`address`, `is_read`),
+    KEY `idx_address_time` (`address`, `event_time`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='用户通知';
@@ -0,0 +1,23 @@
+-- [user-035] 用户价格提醒规则
+-- triggered记录当前是否处于已触发状态，与触发时生成的通知和webhook投递在同一事务中更新
+CREATE TABLE IF NOT EXISTS `ob_price_alert`
+(
+    `id`                 bigint          NOT NULL AUTO_INCREMENT,
+    `owner`              varchar(42)     NOT NULL COMMENT '用户地址',
+    `chain_id`           int             NOT NULL COMMENT '链id',
+    `collection_address` varchar(42)     NOT NULL COMMENT '集合地址',
+    `token_id`           varchar(128)    NOT NULL DEFAULT '' COMMENT 'token id，仅item_listed_below使用',
+    `alert_type`         varchar(32)     NOT NULL COMMENT '提醒类型 floor_above/floor_below/bid_above/bid_below/item_listed_below',
+    `threshold`          decimal(30, 18) NOT NULL COMMENT '阈值',
+    `webhook_id`         bigint          NOT NULL DEFAULT 0 COMMENT '同时推送到该webhook，0表示不推送',
+    `enable`             tinyint(1)      NOT NULL DEFAULT 1 COMMENT '是否启用',
+    `triggered`          tinyint(1)      NOT NULL DEFAULT 0 COMMENT '是否处于已触发状态',
+    `last_value`         decimal(30, 18) NOT NULL DEFAULT 0 COMMENT '最近一次检查的价格',
+    `last_trigger_time`  bigint          NOT NULL DEFAULT 0 COMMENT '最近一次触发时间，秒',
+    `create_time`        bigint          NOT NULL DEFAULT 0,
+    `update_time`        bigint          NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_owner` (`owner`),
+    KEY `idx_enable` (`enable`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='价格提醒';
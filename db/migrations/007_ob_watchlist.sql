@@ -0,0 +1,15 @@
+-- [user-036] 用户关注的集合和item
+-- token_id为空表示关注集合，(owner, chain_id, collection_address, token_id)唯一
+CREATE TABLE IF NOT EXISTS `ob_watchlist`
+(
+    `id`                 bigint       NOT NULL AUTO_INCREMENT,
+    `owner`              varchar(42)  NOT NULL COMMENT '用户地址',
+    `chain_id`           int          NOT NULL COMMENT '链id',
+    `collection_address` varchar(42)  NOT NULL COMMENT '集合地址',
+    `token_id`           varchar(128) NOT NULL DEFAULT '' COMMENT 'token id，为空表示关注集合',
+    `create_time`        bigint       NOT NULL DEFAULT 0,
+    `update_time`        bigint       NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_owner_target` (`owner`, `chain_id`, `collection_address`, `token_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='关注列表';
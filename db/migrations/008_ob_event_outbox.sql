@@ -0,0 +1,34 @@
+-- [user-037] 待发送给ordermanager的事件发件箱
+-- 与产生事件的数据变更在同一事务中写入，由relay异步发送；
+-- dedup_key唯一，未发送的相同事件只保留一条，发送成功或最终失败后dedup_key追加 #<id> 释放
+CREATE TABLE IF NOT EXISTS `ob_event_outbox`
+(
+    `id`                 bigint          NOT NULL AUTO_INCREMENT,
+    `chain`              varchar(32)     NOT NULL COMMENT '链名',
+    `event_type`         int             NOT NULL COMMENT 'ordermanager事件类型',
+    `collection_address` varchar(42)     NOT NULL COMMENT '集合地址',
+    `token_id`           varchar(128)    NOT NULL DEFAULT '' COMMENT 'token id',
+    `order_id`           varchar(66)     NOT NULL DEFAULT '' COMMENT '订单id',
+    `price`              decimal(30, 18) NOT NULL DEFAULT 0 COMMENT '价格',
+    `dedup_key`          varchar(255)    NOT NULL COMMENT '去重key',
+    `status`             tinyint         NOT NULL DEFAULT 0 COMMENT '0-待发送 1-已发送 2-失败',
+    `attempts`           int             NOT NULL DEFAULT 0 COMMENT '已发送次数',
+    `next_retry_time`    bigint          NOT NULL DEFAULT 0 COMMENT '下次发送时间，秒',
+    `last_error`         varchar(512)    NOT NULL DEFAULT '' COMMENT '最近一次错误',
+    `create_time`        bigint          NOT NULL DEFAULT 0,
+    `update_time`        bigint          NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_dedup_key` (`dedup_key`),
+    KEY `idx_status_retry` (`status`, `next_retry_time`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='事件发件箱';
+
+-- 各链已根据activity生成地板价事件的最大activity id，与写入的事件在同一事务中更新
+CREATE TABLE IF NOT EXISTS `ob_event_outbox_cursor`
+(
+    `chain`            varchar(32) NOT NULL COMMENT '链名',
+    `last_activity_id` bigint      NOT NULL DEFAULT 0 COMMENT '已处理的最大activity id',
+    `update_time`      bigint      NOT NULL DEFAULT 0,
+    PRIMARY KEY (`chain`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='发件箱activity游标';
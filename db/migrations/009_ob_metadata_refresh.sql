@@ -0,0 +1,34 @@
+-- [user-038] 集合元数据刷新任务和失败记录
+-- total为需要刷新的token数，skipped为防重入跳过的数量，processed和failed为已刷新成功和失败的数量
+CREATE TABLE IF NOT EXISTS `ob_metadata_refresh_job`
+(
+    `id`                 bigint       NOT NULL AUTO_INCREMENT,
+    `owner`              varchar(42)  NOT NULL COMMENT '创建任务的用户地址',
+    `chain_id`           int          NOT NULL COMMENT '链id',
+    `collection_address` varchar(42)  NOT NULL COMMENT '集合地址',
+    `token_ids`          mediumtext   NOT NULL COMMENT '逗号分隔的token id，为空表示集合中全部token',
+    `status`             varchar(16)  NOT NULL COMMENT 'queuing/queued/completed/failed/cancelled',
+    `total`              bigint       NOT NULL DEFAULT 0,
+    `queued`             bigint       NOT NULL DEFAULT 0,
+    `skipped`            bigint       NOT NULL DEFAULT 0,
+    `processed`          bigint       NOT NULL DEFAULT 0,
+    `failed`             bigint       NOT NULL DEFAULT 0,
+    `last_error`         varchar(512) NOT NULL DEFAULT '' COMMENT '任务失败原因',
+    `create_time`        bigint       NOT NULL DEFAULT 0,
+    `update_time`        bigint       NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_owner` (`owner`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='元数据刷新任务';
+
+CREATE TABLE IF NOT EXISTS `ob_metadata_refresh_failure`
+(
+    `id`          bigint       NOT NULL AUTO_INCREMENT,
+    `job_id`      bigint       NOT NULL COMMENT '任务id',
+    `token_id`    varchar(128) NOT NULL COMMENT 'token id',
+    `reason`      varchar(512) NOT NULL DEFAULT '' COMMENT '失败原因',
+    `create_time` bigint       NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_job_id` (`job_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='元数据刷新失败记录';
@@ -0,0 +1,17 @@
+-- [user-040] 所有者对账发现的不一致记录
+-- 各链共用一张表，通过 chain_id 区分
+CREATE TABLE IF NOT EXISTS `ob_owner_discrepancy`
+(
+    `id`                 bigint       NOT NULL AUTO_INCREMENT,
+    `chain_id`           int          NOT NULL COMMENT '链id',
+    `collection_address` varchar(42)  NOT NULL COMMENT '集合地址',
+    `token_id`           varchar(128) NOT NULL COMMENT 'token id',
+    `db_owner`           varchar(42)  NOT NULL COMMENT '数据库中的所有者',
+    `chain_owner`        varchar(42)  NOT NULL COMMENT '链上所有者',
+    `reason`             varchar(32)  NOT NULL COMMENT '不一致原因 owner_changed/token_burned',
+    `invalid_orders`     int          NOT NULL DEFAULT 0 COMMENT '因此失效的挂单数',
+    `create_time`        bigint       NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY `idx_chain_collection` (`chain_id`, `collection_address`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='所有者不一致记录';
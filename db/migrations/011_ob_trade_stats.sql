@@ -0,0 +1,33 @@
+-- [user-045] 成交统计时间桶和汇总位置
+-- 各链共用，通过 chain 区分；成交按集合、币种累加到5分钟时间桶，查询时换算为原生币后合并
+CREATE TABLE IF NOT EXISTS `ob_trade_stats_bucket`
+(
+    `id`                 bigint          NOT NULL AUTO_INCREMENT,
+    `chain`              varchar(32)     NOT NULL COMMENT '链名',
+    `collection_address` varchar(42)     NOT NULL COMMENT '集合地址',
+    `currency_address`   varchar(42)     NOT NULL COMMENT '币种地址',
+    `bucket_time`        bigint          NOT NULL COMMENT '时间桶开始时间，秒',
+    `item_count`         bigint          NOT NULL DEFAULT 0 COMMENT '成交数量',
+    `volume`             decimal(30, 18) NOT NULL DEFAULT 0 COMMENT '成交额',
+    `min_price`          decimal(30, 18) NOT NULL DEFAULT 0 COMMENT '最低成交价',
+    `max_price`          decimal(30, 18) NOT NULL DEFAULT 0 COMMENT '最高成交价',
+    `create_time`        bigint          NOT NULL DEFAULT 0,
+    `update_time`        bigint          NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_bucket` (`chain`, `collection_address`, `currency_address`, `bucket_time`),
+    KEY `idx_chain_bucket` (`chain`, `bucket_time`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='成交统计时间桶';
+
+-- 各链的汇总位置，与时间桶在同一事务中按读取时的 last_id、gaps 条件更新，已被其他实例推进时回滚
+-- gaps 为汇总位置之前尚未出现的activity id，每次汇总重新检查，超出窗口后丢弃
+CREATE TABLE IF NOT EXISTS `ob_trade_stats_cursor`
+(
+    `chain`       varchar(32) NOT NULL COMMENT '链名',
+    `last_id`     bigint      NOT NULL DEFAULT 0 COMMENT '已读取的最大activity id',
+    `gaps`        text        NOT NULL COMMENT '待重新检查的activity id，json数组',
+    `caught_up`   tinyint(1)  NOT NULL DEFAULT 0 COMMENT '是否已汇总到最新，之前统计直接读取activity表',
+    `update_time` bigint      NOT NULL DEFAULT 0,
+    PRIMARY KEY (`chain`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='成交统计汇总位置';
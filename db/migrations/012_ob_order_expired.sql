@@ -0,0 +1,16 @@
+-- [user-029] 过期清理任务已处理的订单
+-- 按链分表，每条支持的链各建一张，表名为 ob_order_expired_{chain}
+-- 订单表由indexer维护，清理任务不修改订单状态，只在本表记录已处理的过期订单，避免重复刷新地板价和上架数量
+-- 订单在订单表中不再是活跃状态后，对应记录在下一轮清理时删除
+CREATE TABLE IF NOT EXISTS `ob_order_expired_sepolia`
+(
+    `id`                 bigint      NOT NULL AUTO_INCREMENT,
+    `order_id`           varchar(66) NOT NULL COMMENT '订单id',
+    `collection_address` varchar(42) NOT NULL COMMENT '集合地址',
+    `order_type`         tinyint     NOT NULL COMMENT '订单类型',
+    `expire_time`        bigint      NOT NULL DEFAULT 0 COMMENT '订单过期时间，秒',
+    `create_time`        bigint      NOT NULL DEFAULT 0 COMMENT '清理时间，毫秒',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_order_id` (`order_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='已清理的过期订单';
@@ -0,0 +1,10 @@
+-- [user-037] 发件箱地板价事件按集合去重，发送时重新查询地板价
+-- dedup_key不再包含价格，每个集合只保留一条未发送事件；
+-- 已有未发送事件时写入只递增revision并提前下次发送时间，relay按读取时的revision更新发送结果，
+-- 发送期间被再次写入的事件保持待发送，下一轮以最新地板价重新发送
+ALTER TABLE `ob_event_outbox`
+    ADD COLUMN `revision` int NOT NULL DEFAULT 0 COMMENT '未发送期间被重复写入的次数' AFTER `dedup_key`;
+
+-- activity游标记录尚未出现的activity id，之后重新检查，避免较小id的activity晚于较大id提交时被跳过
+ALTER TABLE `ob_event_outbox_cursor`
+    ADD COLUMN `gaps` text NULL COMMENT '尚未出现的activity id，JSON数组' AFTER `last_activity_id`;
@@ -0,0 +1,5 @@
+-- [user-038] 元数据刷新任务记录入队进度，实例退出后由其他实例从进度处继续入队
+-- 指定token_ids时为已处理的token数量，否则为已处理的最大item id
+ALTER TABLE `ob_metadata_refresh_job`
+    ADD COLUMN `queue_cursor` bigint NOT NULL DEFAULT 0 COMMENT '入队进度' AFTER `failed`,
+    ADD KEY `idx_status_update_time` (`status`, `update_time`);
@@ -0,0 +1,4 @@
+-- [user-046] 集合item按挂单价格游标分页时，从游标之后查询的条件加在订单价格上，按订单价格索引范围扫描
+-- 订单表按链分表，每条支持的链各加一个索引，表名为 ob_order_{chain}
+ALTER TABLE `ob_order_sepolia`
+    ADD KEY `idx_collection_type_status_price` (`collection_address`, `order_type`, `order_status`, `price`);
@@ -10,10 +10,12 @@ require (
 	github.com/gin-gonic/gin v1.10.1
 	github.com/google/uuid v1.6.0
 	github.com/pkg/errors v0.9.1
+	github.com/redis/go-redis/v9 v9.10.0
 	github.com/shopspring/decimal v1.3.1
 	github.com/spf13/viper v1.20.1
 	github.com/zeromicro/go-zero v1.8.4
 	go.uber.org/zap v1.25.0
+	golang.org/x/sync v0.15.0
 	gorm.io/gorm v1.25.2
 )
 
@@ -66,7 +68,6 @@ require (
 	github.com/prometheus/client_model v0.6.1 // indirect
 	github.com/prometheus/common v0.62.0 // indirect
 	github.com/prometheus/procfs v0.15.1 // indirect
-	github.com/redis/go-redis/v9 v9.10.0 // indirect
 	github.com/sagikazarmark/locafero v0.7.0 // indirect
 	github.com/shirou/gopsutil v3.21.5+incompatible // indirect
 	github.com/sourcegraph/conc v0.3.0 // indirect
@@ -2,11 +2,19 @@ package app
 
 import (
 	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/service"
 	"EasySwapBackend-test/src/svc"
 	"context"
+	"errors"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type Platform struct {
@@ -23,10 +31,72 @@ func NewPlatform(config *config.Config, router *gin.Engine, serverCtx *svc.Serve
 	}
 }
 
+// 收到退出信号后等待http请求和后台任务结束的最长时间
+const shutdownTimeout = 30 * time.Second
+
 func (p *Platform) Start() {
+	// 应用生命周期，收到退出信号时取消，后台任务随之停止
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 启动后台任务，先读后写的任务使用主库，避免从库延迟导致重复处理
+	primaryCtx := dao.WithPrimary(ctx)
+	// 元数据任务退出时需要等待正在入队和刷新的item结束
+	var metadataWg sync.WaitGroup
+	metadataWg.Add(2)
+	go service.StartListingCheck(ctx, p.serverCtx)
+	go service.StartExpiredSweep(primaryCtx, p.serverCtx)
+	go service.StartActivityStream(ctx, p.serverCtx)
+	go service.StartCollectionStream(ctx, p.serverCtx)
+	go service.StartWebhook(primaryCtx, p.serverCtx)
+	go service.StartNotification(primaryCtx, p.serverCtx)
+	go service.StartPriceAlert(primaryCtx, p.serverCtx)
+	go service.StartOutboxRelay(primaryCtx, p.serverCtx)
+	go func() {
+		defer metadataWg.Done()
+		service.StartMetadataWorker(primaryCtx, p.serverCtx)
+	}()
+	go func() {
+		defer metadataWg.Done()
+		service.StartMetadataRefreshJobs(primaryCtx, p.serverCtx)
+	}()
+	go service.StartOwnerReconcile(primaryCtx, p.serverCtx)
+	go service.StartApiCachePurge(ctx, p.serverCtx)
+	go service.StartLocalCacheInvalidation(ctx, p.serverCtx)
+	go service.StartRankingSnapshot(ctx, p.serverCtx)
+	go service.StartTradeStatsRollup(primaryCtx, p.serverCtx)
+	go service.StartReplicaLagCheck(ctx, p.serverCtx)
+	if p.serverCtx.Broker != nil {
+		go p.serverCtx.Broker.Run(ctx)
+	}
+
+	server := &http.Server{Addr: p.config.Api.Port, Handler: p.router}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			xzap.WithContext(context.Background()).Error("failed on shutdown server", zap.Error(err))
+		}
+	}()
+
 	xzap.WithContext(context.Background()).Info("EasySwap-End run", zap.String("port", p.config.Api.Port))
-	err := p.router.Run(p.config.Api.Port)
-	if err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
+	<-shutdownDone
+
+	//等待元数据任务退出，超时后直接退出，未完成的任务由其他实例或重启后继续
+	done := make(chan struct{})
+	go func() {
+		metadataWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		xzap.WithContext(context.Background()).Warn("metadata jobs did not stop in time")
+	}
 }
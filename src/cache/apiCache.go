@@ -0,0 +1,60 @@
+package cached
+
+import (
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// 接口缓存tag集合的过期时间，单位秒，每次写入缓存时续期
+const apiCacheTagExpire = 24 * 60 * 60
+
+// 接口缓存tag，记录打了该tag的缓存key apicache:tag:<tag>
+func genApiCacheTagKey(tag string) string {
+	return "apicache:tag:" + tag
+}
+
+// 链tag chain:<链id>
+func ApiCacheChainTag(chainId string) string {
+	return fmt.Sprintf("chain:%s", chainId)
+}
+
+// 集合tag collection:<集合地址>
+func ApiCacheCollectionTag(collectionAddr string) string {
+	return fmt.Sprintf("collection:%s", strings.ToLower(collectionAddr))
+}
+
+// item tag token:<集合地址>:<tokenId>
+func ApiCacheTokenTag(collectionAddr, tokenId string) string {
+	return fmt.Sprintf("token:%s:%s", strings.ToLower(collectionAddr), tokenId)
+}
+
+// 记录缓存key所属的tag，按tag清除时一并删除
+func TagApiCache(store *xkv.Store, cacheKey string, tags []string) error {
+	for _, tag := range tags {
+		tagKey := genApiCacheTagKey(tag)
+		if _, err := store.Sadd(tagKey, cacheKey); err != nil {
+			return errors.Wrap(err, "failed on add api cache tag")
+		}
+		if err := store.Expire(tagKey, apiCacheTagExpire); err != nil {
+			return errors.Wrap(err, "failed on expire api cache tag")
+		}
+	}
+	return nil
+}
+
+// 清除打了指定tag的全部接口缓存
+func (cached *Cached) PurgeApiCache(tags ...string) error {
+	for _, tag := range tags {
+		tagKey := genApiCacheTagKey(tag)
+		keys, err := cached.KvStore.Smembers(tagKey)
+		if err != nil {
+			return errors.Wrap(err, "failed on get api cache tag members")
+		}
+		if _, err := cached.KvStore.Del(append(keys, tagKey)...); err != nil {
+			return errors.Wrap(err, "failed on delete api cache")
+		}
+	}
+	return nil
+}
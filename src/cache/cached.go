@@ -1,6 +1,7 @@
 package cached
 
 import (
+	"EasySwapBackend-test/src/localcache"
 	"context"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 )
@@ -8,6 +9,8 @@ import (
 type Cached struct {
 	ctx     context.Context
 	KvStore *xkv.Store
+	Local   *localcache.Cache // 进程内缓存，为空时只读写redis
+	Project string            // 项目名，用于缓存key前缀
 }
 
 func NewCache(ctx context.Context, kvStore *xkv.Store) *Cached {
@@ -5,20 +5,29 @@ import (
 	"github.com/pkg/errors"
 )
 
-// 缓存集合的上架数量
+// 缓存集合的上架数量，并使各实例的进程内缓存失效
 func (cached *Cached) CacheCollectionsListed(chain, collectionAddr string, listedCount int) error {
-	err := cached.KvStore.SetInt(ordermanager.GenCollectionListedKey(chain, collectionAddr), listedCount)
+	key := ordermanager.GenCollectionListedKey(chain, collectionAddr)
+	err := cached.KvStore.SetInt(key, listedCount)
 	if err != nil {
 		return errors.Wrap(err, "failed on set collection listed count")
 	}
+	if err := cached.Local.Invalidate(key); err != nil {
+		return errors.Wrap(err, "failed on invalidate local collection listed count")
+	}
 	return nil
 }
 
-// 获取缓存 集合的上架数量
+// 获取缓存 集合的上架数量，优先读取进程内缓存
 func (cached *Cached) GetCollectionsListed(chain, collectionAddr string) (int, error) {
-	listedCount, err := cached.KvStore.GetInt(ordermanager.GenCollectionListedKey(chain, collectionAddr))
+	key := ordermanager.GenCollectionListedKey(chain, collectionAddr)
+	if value, ok := cached.Local.Get(key); ok {
+		return value.(int), nil
+	}
+	listedCount, err := cached.KvStore.GetInt(key)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed on get collection listed count")
 	}
+	cached.Local.Set(key, listedCount)
 	return listedCount, nil
 }
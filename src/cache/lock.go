@@ -0,0 +1,50 @@
+package cached
+
+import (
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"math/rand"
+	"time"
+)
+
+// 仅当锁仍由自己持有时才删除
+const releaseLockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+else
+	return 0
+end`
+
+// RedisLock 基于SET NX EX的分布式锁，多副本部署时保证定时任务只在一个实例上执行
+type RedisLock struct {
+	store   *xkv.Store
+	key     string
+	id      string
+	seconds int
+}
+
+func NewRedisLock(store *xkv.Store, key string, seconds int) *RedisLock {
+	return &RedisLock{
+		store:   store,
+		key:     key,
+		id:      fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63()),
+		seconds: seconds,
+	}
+}
+
+// 尝试获取锁，锁被其他实例持有时返回false
+func (l *RedisLock) Acquire() (bool, error) {
+	ok, err := l.store.SetnxEx(l.key, l.id, l.seconds)
+	if err != nil {
+		return false, errors.Wrap(err, "failed on acquire lock")
+	}
+	return ok, nil
+}
+
+// 释放锁
+func (l *RedisLock) Release() error {
+	if _, err := l.store.Eval(releaseLockScript, l.key, l.id); err != nil {
+		return errors.Wrap(err, "failed on release lock")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package cached
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// 未读通知数缓存过期时间，单位秒
+// 统计未读数和写回缓存之间新增的通知会使缓存偏小，较短的过期时间限制误差持续的时间
+const notificationUnreadExpire = 30
+
+// 用户未读通知数 cache:<项目名>:notification:unread:<用户地址>
+func genNotificationUnreadKey(project, address string) string {
+	return fmt.Sprintf("cache:%s:notification:unread:%s", strings.ToLower(project), strings.ToLower(address))
+}
+
+// 获取缓存的用户未读通知数，未缓存时返回false
+func (cached *Cached) GetNotificationUnread(address string) (int64, bool, error) {
+	value, err := cached.KvStore.Get(genNotificationUnreadKey(cached.Project, address))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get notification unread count")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	return count, true, nil
+}
+
+// 缓存用户未读通知数
+func (cached *Cached) CacheNotificationUnread(address string, count int64) error {
+	err := cached.KvStore.Setex(genNotificationUnreadKey(cached.Project, address), strconv.FormatInt(count, 10), notificationUnreadExpire)
+	if err != nil {
+		return errors.Wrap(err, "failed on cache notification unread count")
+	}
+	return nil
+}
+
+// 通知新增或已读后删除缓存，下次查询时重新统计
+func (cached *Cached) DelNotificationUnread(addresses ...string) error {
+	if len(addresses) == 0 {
+		return nil
+	}
+	var keys []string
+	for _, address := range addresses {
+		keys = append(keys, genNotificationUnreadKey(cached.Project, address))
+	}
+	if _, err := cached.KvStore.Del(keys...); err != nil {
+		return errors.Wrap(err, "failed on delete notification unread count")
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/pkg/errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 批量查询所有者时每个JSON-RPC批量请求包含的最大调用数
+const ownersOfBatchSize = 100
+
+// ERC721的ERC165接口id
+const erc721InterfaceId = "80ac58cd"
+
+// ERC721方法选择器
+const (
+	supportsInterfaceSelector = "01ffc9a7" // supportsInterface(bytes4)，ERC165
+	ownerOfSelector           = "6352211e" // ownerOf(uint256)
+	isApprovedForAllSelector  = "e985e9c5" // isApprovedForAll(address,address)
+	tokenURISelector          = "c87b56dd" // tokenURI(uint256)，ERC721
+	uriSelector               = "0e89341c" // uri(uint256)，ERC1155
+)
+
+// 合约执行revert，如token不存在、已销毁或合约不支持该方法
+var ErrExecutionReverted = errors.New("execution reverted")
+
+// NftClient 链上NFT状态查询接口，校验挂单有效性时使用，测试时可替换为mock实现
+type NftClient interface {
+	// 查询合约是否为ERC721，只有ERC721合约可以通过ownerOf查询所有者
+	SupportsErc721(ctx context.Context, collectionAddr string) (bool, error)
+	// 查询NFT当前所有者
+	OwnerOf(ctx context.Context, collectionAddr, tokenId string) (string, error)
+	// 查询owner是否已将全部NFT授权给operator
+	IsApprovedForAll(ctx context.Context, collectionAddr, owner, operator string) (bool, error)
+	// 查询NFT的元数据地址
+	TokenURI(ctx context.Context, collectionAddr, tokenId string) (string, error)
+	// 批量查询同一集合中多个NFT的所有者，结果与tokenIds顺序一致
+	OwnersOf(ctx context.Context, collectionAddr string, tokenIds []string) ([]OwnerResult, error)
+}
+
+// 批量查询所有者的单个结果，Err为ErrExecutionReverted时表示合约执行revert，原因无法确定
+type OwnerResult struct {
+	Owner string
+	Err   error
+}
+
+// NodeClient 基于链节点服务(NodeSrvs)的NftClient实现
+// ownerOf通过节点服务查询，返回checksum格式的地址，与GetItemOwner写入的格式一致
+// 节点服务未提供的isApprovedForAll、tokenURI以及批量ownerOf通过同一节点的eth_call查询
+type NodeClient struct {
+	node   *nftchainservice.Service
+	rpc    *rpcClient
+	erc721 sync.Map // 合约是否为ERC721，key为小写的合约地址
+}
+
+func NewNodeClient(node *nftchainservice.Service, endpoint string, timeout time.Duration) *NodeClient {
+	return &NodeClient{
+		node: node,
+		rpc: &rpcClient{
+			endpoint: endpoint,
+			client:   &http.Client{Timeout: timeout},
+		},
+	}
+}
+
+// JSON-RPC eth_call，只用于节点服务未提供的合约方法和批量查询
+type rpcClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+type rpcRequest struct {
+	JsonRpc string        `json:"jsonrpc"`
+	Id      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Id     int    `json:"id"`
+	Result string `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// 通过ERC165 supportsInterface查询，结果按合约缓存
+// 未实现ERC165的合约调用时revert，视为不是ERC721
+func (c *NodeClient) SupportsErc721(ctx context.Context, collectionAddr string) (bool, error) {
+	key := strings.ToLower(collectionAddr)
+	if supported, ok := c.erc721.Load(key); ok {
+		return supported.(bool), nil
+	}
+	result, err := c.rpc.call(ctx, collectionAddr, supportsInterfaceSelector+erc721InterfaceId+strings.Repeat("0", 56))
+	supported := false
+	if err == nil {
+		supported = len(result) >= 32 && result[31] == 1
+	} else if !errors.Is(err, ErrExecutionReverted) {
+		return false, errors.Wrap(err, "failed on call supportsInterface")
+	}
+	c.erc721.Store(key, supported)
+	return supported, nil
+}
+
+func (c *NodeClient) OwnerOf(ctx context.Context, collectionAddr, tokenId string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	owner, err := c.node.FetchNftOwner(collectionAddr, tokenId)
+	if err != nil {
+		if isRevertMessage(err.Error()) {
+			return "", errors.Wrap(ErrExecutionReverted, err.Error())
+		}
+		return "", errors.Wrap(err, "failed on fetch nft owner")
+	}
+	return owner.String(), nil
+}
+
+func (c *NodeClient) IsApprovedForAll(ctx context.Context, collectionAddr, owner, operator string) (bool, error) {
+	ownerArg, err := encodeAddress(owner)
+	if err != nil {
+		return false, err
+	}
+	operatorArg, err := encodeAddress(operator)
+	if err != nil {
+		return false, err
+	}
+	result, err := c.rpc.call(ctx, collectionAddr, isApprovedForAllSelector+ownerArg+operatorArg)
+	if err != nil {
+		return false, errors.Wrap(err, "failed on call isApprovedForAll")
+	}
+	if len(result) < 32 {
+		return false, errors.New("invalid isApprovedForAll result")
+	}
+	return result[31] == 1, nil
+}
+
+// 先按ERC721查询tokenURI，合约不支持时按ERC1155查询uri，并替换其中的{id}
+func (c *NodeClient) TokenURI(ctx context.Context, collectionAddr, tokenId string) (string, error) {
+	id, ok := new(big.Int).SetString(tokenId, 10)
+	if !ok {
+		return "", errors.New("invalid token id")
+	}
+	result, err := c.rpc.call(ctx, collectionAddr, tokenURISelector+encodeUint256(id))
+	if err == nil {
+		return decodeString(result)
+	}
+	if !errors.Is(err, ErrExecutionReverted) {
+		return "", errors.Wrap(err, "failed on call tokenURI")
+	}
+	result, err = c.rpc.call(ctx, collectionAddr, uriSelector+encodeUint256(id))
+	if err != nil {
+		return "", errors.Wrap(err, "failed on call uri")
+	}
+	uri, err := decodeString(result)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(uri, "{id}", encodeUint256(id)), nil
+}
+
+// 通过JSON-RPC批量请求查询多个NFT的所有者，每个批量请求最多包含ownersOfBatchSize个eth_call
+// 返回小写的地址；单个调用失败不影响其他结果，批量请求本身失败时返回错误
+func (c *NodeClient) OwnersOf(ctx context.Context, collectionAddr string, tokenIds []string) ([]OwnerResult, error) {
+	results := make([]OwnerResult, len(tokenIds))
+	for start := 0; start < len(tokenIds); start += ownersOfBatchSize {
+		end := start + ownersOfBatchSize
+		if end > len(tokenIds) {
+			end = len(tokenIds)
+		}
+		//1、每个token一个eth_call，id为token在tokenIds中的下标
+		requests := make([]rpcRequest, 0, end-start)
+		for i := start; i < end; i++ {
+			id, ok := new(big.Int).SetString(tokenIds[i], 10)
+			if !ok {
+				results[i].Err = errors.New("invalid token id")
+				continue
+			}
+			requests = append(requests, newEthCallRequest(i, collectionAddr, ownerOfSelector+encodeUint256(id)))
+		}
+		if len(requests) == 0 {
+			continue
+		}
+		responses, err := c.rpc.batchCall(ctx, requests)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on batch call ownerOf")
+		}
+
+		//2、按id取回结果，节点返回的顺序不一定与请求一致
+		for _, req := range requests {
+			res, ok := responses[req.Id]
+			if !ok {
+				results[req.Id].Err = errors.New("missing ownerOf result")
+				continue
+			}
+			data, err := decodeRpcResponse(res)
+			if err != nil {
+				results[req.Id].Err = err
+				continue
+			}
+			results[req.Id].Owner, results[req.Id].Err = decodeAddress(data)
+		}
+	}
+	return results, nil
+}
+
+// 调用合约的只读方法，返回解码后的结果
+func (c *rpcClient) call(ctx context.Context, to, data string) ([]byte, error) {
+	var res rpcResponse
+	if err := c.post(ctx, newEthCallRequest(1, to, data), &res); err != nil {
+		return nil, err
+	}
+	return decodeRpcResponse(res)
+}
+
+// 在一个JSON-RPC批量请求中发送多个调用，返回按id索引的结果
+func (c *rpcClient) batchCall(ctx context.Context, requests []rpcRequest) (map[int]rpcResponse, error) {
+	var res []rpcResponse
+	if err := c.post(ctx, requests, &res); err != nil {
+		return nil, err
+	}
+	responses := make(map[int]rpcResponse, len(res))
+	for _, r := range res {
+		responses[r.Id] = r
+	}
+	return responses, nil
+}
+
+func newEthCallRequest(id int, to, data string) rpcRequest {
+	return rpcRequest{
+		JsonRpc: "2.0",
+		Id:      id,
+		Method:  "eth_call",
+		Params: []interface{}{
+			map[string]string{"to": to, "data": "0x" + data},
+			"latest",
+		},
+	}
+}
+
+// 发送JSON-RPC请求
+func (c *rpcClient) post(ctx context.Context, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal rpc request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed on create rpc request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed on send rpc request")
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "failed on decode rpc response")
+	}
+	return nil
+}
+
+// 节点返回的错误信息中包含revert时表示合约执行失败
+func isRevertMessage(msg string) bool {
+	return strings.Contains(strings.ToLower(msg), "revert")
+}
+
+func decodeRpcResponse(res rpcResponse) ([]byte, error) {
+	if res.Error != nil {
+		if isRevertMessage(res.Error.Message) {
+			return nil, errors.Wrap(ErrExecutionReverted, res.Error.Message)
+		}
+		return nil, fmt.Errorf("rpc error %d: %s", res.Error.Code, res.Error.Message)
+	}
+	return hex.DecodeString(strings.TrimPrefix(res.Result, "0x"))
+}
+
+func encodeUint256(v *big.Int) string {
+	return fmt.Sprintf("%064x", v)
+}
+
+func encodeAddress(addr string) (string, error) {
+	raw := strings.TrimPrefix(strings.ToLower(addr), "0x")
+	if len(raw) != 40 {
+		return "", errors.New("invalid address")
+	}
+	return strings.Repeat("0", 24) + raw, nil
+}
+
+// 解码ABI编码的address返回值，返回小写的地址
+func decodeAddress(data []byte) (string, error) {
+	if len(data) < 32 {
+		return "", errors.New("invalid address result")
+	}
+	return "0x" + hex.EncodeToString(data[12:32]), nil
+}
+
+// 解码ABI编码的string返回值：偏移量、长度、内容
+func decodeString(data []byte) (string, error) {
+	if len(data) < 64 {
+		return "", errors.New("invalid string result")
+	}
+	offset := new(big.Int).SetBytes(data[:32])
+	if !offset.IsInt64() || offset.Int64()+32 > int64(len(data)) {
+		return "", errors.New("invalid string offset")
+	}
+	start := offset.Int64() + 32
+	length := new(big.Int).SetBytes(data[start-32 : start])
+	if !length.IsInt64() || start+length.Int64() > int64(len(data)) {
+		return "", errors.New("invalid string length")
+	}
+	return string(data[start : start+length.Int64()]), nil
+}
@@ -0,0 +1,144 @@
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeString(t *testing.T) {
+	// abi.encode("ipfs://hash")
+	encoded := "0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000000b" +
+		"697066733a2f2f68617368000000000000000000000000000000000000000000"
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid string", data: encoded, want: "ipfs://hash"},
+		{name: "too short", data: encoded[:64], wantErr: true},
+		{name: "offset out of range", data: "00000000000000000000000000000000000000000000000000000000000000ff" + encoded[64:], wantErr: true},
+		{name: "length out of range", data: encoded[:64] + "00000000000000000000000000000000000000000000000000000000000000ff" + encoded[128:], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("invalid test data: %v", err)
+			}
+			got, err := decodeString(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: "0x00000000000000000000000000000000000000AB", want: "00000000000000000000000000000000000000000000000000000000000000ab"},
+		{addr: "00000000000000000000000000000000000000ab", want: "00000000000000000000000000000000000000000000000000000000000000ab"},
+		{addr: "", wantErr: true},
+		{addr: "0x1234", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := encodeAddress(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("encodeAddress(%q) err = %v, wantErr %v", tt.addr, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("encodeAddress(%q) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeUint256(t *testing.T) {
+	if got := encodeUint256(big.NewInt(255)); got != "00000000000000000000000000000000000000000000000000000000000000ff" {
+		t.Errorf("encodeUint256(255) = %s", got)
+	}
+}
+
+func TestIsRevertMessage(t *testing.T) {
+	tests := map[string]bool{
+		"execution reverted":                     true,
+		"execution reverted: ERC721: invalid id": true,
+		"VM Exception: Revert":                   true,
+		"header not found":                       false,
+		"":                                       false,
+	}
+	for msg, want := range tests {
+		if got := isRevertMessage(msg); got != want {
+			t.Errorf("isRevertMessage(%q) = %v, want %v", msg, got, want)
+		}
+	}
+}
+
+func TestOwnersOfBatch(t *testing.T) {
+	const owner = "0x00000000000000000000000000000000000000aa"
+	var batches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batches++
+		var requests []rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+			t.Errorf("request is not a batch: %v", err)
+			return
+		}
+		// 倒序返回，token 2 revert
+		responses := make([]map[string]interface{}, 0, len(requests))
+		for i := len(requests) - 1; i >= 0; i-- {
+			req := requests[i]
+			data := req.Params[0].(map[string]interface{})["data"].(string)
+			if !strings.HasPrefix(data, "0x"+ownerOfSelector) {
+				t.Errorf("unexpected call data %s", data)
+			}
+			res := map[string]interface{}{"jsonrpc": "2.0", "id": req.Id}
+			if strings.HasSuffix(data, "02") {
+				res["error"] = map[string]interface{}{"code": 3, "message": "execution reverted"}
+			} else {
+				res["result"] = "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(owner, "0x")
+			}
+			responses = append(responses, res)
+		}
+		_ = json.NewEncoder(w).Encode(responses)
+	}))
+	defer server.Close()
+
+	client := NewNodeClient(nil, server.URL, time.Second)
+	results, err := client.OwnersOf(context.Background(), "0x1", []string{"1", "2", "x", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 1 {
+		t.Errorf("batches = %d, want 1", batches)
+	}
+	if len(results) != 4 {
+		t.Fatalf("len(results) = %d, want 4", len(results))
+	}
+	for _, i := range []int{0, 3} {
+		if results[i].Err != nil || results[i].Owner != owner {
+			t.Errorf("results[%d] = %+v, want owner %s", i, results[i], owner)
+		}
+	}
+	if !errors.Is(results[1].Err, ErrExecutionReverted) {
+		t.Errorf("results[1].Err = %v, want execution reverted", results[1].Err)
+	}
+	if results[2].Err == nil {
+		t.Error("results[2] should fail for invalid token id")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/evm/erc"
 	logging "github.com/ProjectsTask/EasySwapBase/logger"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
 	"strings"
 )
@@ -17,6 +19,24 @@ type Config struct {
 	Evm            *erc.NftErc       `toml:"evm" mapstructure:"evm" json:"evm"`
 	MetadataParse  *MetadataParse    `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"`
 	ChainSupported []*ChainSupported `toml:"chain_supported" mapstructure:"chain_supported" json:"chain_supported"`
+	Fee            *FeeCfg           `toml:"fee" mapstructure:"fee" json:"fee"`
+	ListingCheck   *ListingCheckCfg  `toml:"listing_check" mapstructure:"listing_check" json:"listing_check"`
+	ExpiredSweep   *ExpiredSweepCfg  `toml:"expired_sweep" mapstructure:"expired_sweep" json:"expired_sweep"`
+	Currencies     []*CurrencyCfg    `toml:"currencies" mapstructure:"currencies" json:"currencies"`
+	PriceOracle    *PriceOracleCfg   `toml:"price_oracle" mapstructure:"price_oracle" json:"price_oracle"`
+	Stream         *StreamCfg        `toml:"stream" mapstructure:"stream" json:"stream"`
+	Webhook        *WebhookCfg       `toml:"webhook" mapstructure:"webhook" json:"webhook"`
+	Notification   *NotificationCfg  `toml:"notification" mapstructure:"notification" json:"notification"`
+	PriceAlert     *PriceAlertCfg    `toml:"price_alert" mapstructure:"price_alert" json:"price_alert"`
+	Outbox         *OutboxCfg        `toml:"outbox" mapstructure:"outbox" json:"outbox"`
+	Metadata       *MetadataCfg      `toml:"metadata" mapstructure:"metadata" json:"metadata"`
+	Reconcile      *ReconcileCfg     `toml:"reconcile" mapstructure:"reconcile" json:"reconcile"`
+	ApiCache       *ApiCacheCfg      `toml:"api_cache" mapstructure:"api_cache" json:"api_cache"`
+	LocalCache     *LocalCacheCfg    `toml:"local_cache" mapstructure:"local_cache" json:"local_cache"`
+	Ranking        *RankingCfg       `toml:"ranking" mapstructure:"ranking" json:"ranking"`
+	TradeStats     *TradeStatsCfg    `toml:"trade_stats" mapstructure:"trade_stats" json:"trade_stats"`
+	Replica        *ReplicaCfg       `toml:"replica" mapstructure:"replica" json:"replica"`
+	Timeout        *TimeoutCfg       `toml:"timeout" mapstructure:"timeout" json:"timeout"`
 	//ImageCfg       *image.Config     `toml:"image_cfg" mapstructure:"image_cfg" json:"image_cfg"`
 }
 
@@ -26,7 +46,8 @@ type Api struct {
 }
 
 type ProjectCfg struct {
-	Name string `toml:"name" mapstructure:"name" json:"name"`
+	Name   string   `toml:"name" mapstructure:"name" json:"name"`
+	Admins []string `toml:"admins" mapstructure:"admins" json:"admins"` // 管理员钱包地址
 }
 
 type KvConfig struct {
@@ -49,9 +70,236 @@ type MetadataParse struct {
 }
 
 type ChainSupported struct {
-	Name     string `toml:"name" mapstructure:"name" json:"name"`
-	ChainId  int    `toml:"chain_id" mapstructure:"chain_id" json:"chain_id"`
-	Endpoint string `toml:"endpoint" mapstructure:"endpoint" json:"endpoint"`
+	Name         string `toml:"name" mapstructure:"name" json:"name"`
+	ChainId      int    `toml:"chain_id" mapstructure:"chain_id" json:"chain_id"`
+	Endpoint     string `toml:"endpoint" mapstructure:"endpoint" json:"endpoint"`
+	VaultAddress string `toml:"vault_address" mapstructure:"vault_address" json:"vault_address"` // 挂单需授权的合约地址
+}
+
+// 挂单有效性校验配置
+type ListingCheckCfg struct {
+	Enable     bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval   int  `toml:"interval" mapstructure:"interval" json:"interval"`          // 校验间隔，单位秒
+	SampleSize int  `toml:"sample_size" mapstructure:"sample_size" json:"sample_size"` // 每次抽样的挂单数量
+	Timeout    int  `toml:"timeout" mapstructure:"timeout" json:"timeout"`             // 链上查询超时，单位秒
+}
+
+// 手续费配置，费率为小数形式，如 0.025 表示 2.5%
+type FeeCfg struct {
+	DefaultRoyaltyFeeRate string            `toml:"default_royalty_fee_rate" mapstructure:"default_royalty_fee_rate" json:"default_royalty_fee_rate"`
+	Marketplaces          []*MarketplaceFee `toml:"marketplaces" mapstructure:"marketplaces" json:"marketplaces"`
+	Collections           []*CollectionFee  `toml:"collections" mapstructure:"collections" json:"collections"`
+}
+
+// 校验手续费配置，费率需满足 0 <= rate < 1，为空的集合费率不校验
+func (c *FeeCfg) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.DefaultRoyaltyFeeRate != "" {
+		if err := validateFeeRate(c.DefaultRoyaltyFeeRate); err != nil {
+			return errors.Wrap(err, "invalid default_royalty_fee_rate")
+		}
+	}
+	for _, market := range c.Marketplaces {
+		if err := validateFeeRate(market.FeeRate); err != nil {
+			return errors.Wrapf(err, "invalid fee_rate of marketplace %d", market.MarketplaceId)
+		}
+	}
+	for _, collection := range c.Collections {
+		if collection.MarketplaceFeeRate != "" {
+			if err := validateFeeRate(collection.MarketplaceFeeRate); err != nil {
+				return errors.Wrapf(err, "invalid marketplace_fee_rate of collection %s", collection.Address)
+			}
+		}
+		if collection.RoyaltyFeeRate != "" {
+			if err := validateFeeRate(collection.RoyaltyFeeRate); err != nil {
+				return errors.Wrapf(err, "invalid royalty_fee_rate of collection %s", collection.Address)
+			}
+		}
+	}
+	return nil
+}
+
+func validateFeeRate(value string) error {
+	rate, err := decimal.NewFromString(value)
+	if err != nil {
+		return err
+	}
+	if rate.IsNegative() || rate.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return errors.Errorf("fee rate %s out of range [0, 1)", value)
+	}
+	return nil
+}
+
+// 市场手续费配置
+type MarketplaceFee struct {
+	MarketplaceId int    `toml:"marketplace_id" mapstructure:"marketplace_id" json:"marketplace_id"`
+	FeeRate       string `toml:"fee_rate" mapstructure:"fee_rate" json:"fee_rate"`
+}
+
+// 集合手续费配置，为空的费率不覆盖
+// 市场费率只覆盖marketplace_id指定的市场，版税对所有市场生效
+type CollectionFee struct {
+	ChainId            int    `toml:"chain_id" mapstructure:"chain_id" json:"chain_id"`
+	Address            string `toml:"address" mapstructure:"address" json:"address"`
+	MarketplaceId      int    `toml:"marketplace_id" mapstructure:"marketplace_id" json:"marketplace_id"`
+	MarketplaceFeeRate string `toml:"marketplace_fee_rate" mapstructure:"marketplace_fee_rate" json:"marketplace_fee_rate"`
+	RoyaltyFeeRate     string `toml:"royalty_fee_rate" mapstructure:"royalty_fee_rate" json:"royalty_fee_rate"`
+}
+
+// 过期订单清理配置
+type ExpiredSweepCfg struct {
+	Enable     bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval   int  `toml:"interval" mapstructure:"interval" json:"interval"`          // 清理间隔，单位秒
+	BatchSize  int  `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`    // 每批更新的订单数量
+	MaxBatches int  `toml:"max_batches" mapstructure:"max_batches" json:"max_batches"` // 每次清理的最大批次
+}
+
+// 币种配置
+type CurrencyCfg struct {
+	ChainId int    `toml:"chain_id" mapstructure:"chain_id" json:"chain_id"`
+	Address string `toml:"address" mapstructure:"address" json:"address"`
+	Symbol  string `toml:"symbol" mapstructure:"symbol" json:"symbol"`
+	Native  bool   `toml:"native" mapstructure:"native" json:"native"`
+}
+
+// 价格Oracle配置
+type PriceOracleCfg struct {
+	Type   string            `toml:"type" mapstructure:"type" json:"type"`       // static: 使用prices配置 file: 从file读取
+	File   string            `toml:"file" mapstructure:"file" json:"file"`       // 价格文件路径，json格式
+	Prices map[string]string `toml:"prices" mapstructure:"prices" json:"prices"` // 币种符号 -> 美元价格
+}
+
+// 实时推送配置
+type StreamCfg struct {
+	PollInterval int `toml:"poll_interval" mapstructure:"poll_interval" json:"poll_interval"` // 拉取新activity的间隔，单位秒
+	Heartbeat    int `toml:"heartbeat" mapstructure:"heartbeat" json:"heartbeat"`             // 心跳间隔，单位秒
+	Buffer       int `toml:"buffer" mapstructure:"buffer" json:"buffer"`                      // 每个连接的消息缓冲数量
+	MaxDropped   int `toml:"max_dropped" mapstructure:"max_dropped" json:"max_dropped"`       // 连接连续丢弃消息数超过该值时断开
+	Debounce     int `toml:"debounce" mapstructure:"debounce" json:"debounce"`                // 集合实时数据合并推送的间隔，单位毫秒
+}
+
+// Webhook推送配置
+type WebhookCfg struct {
+	Enable      bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval    int  `toml:"interval" mapstructure:"interval" json:"interval"`             // 拉取新activity和投递的间隔，单位秒
+	BatchSize   int  `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`       // 每次投递的最大数量
+	Workers     int  `toml:"workers" mapstructure:"workers" json:"workers"`                // 并发投递数
+	Timeout     int  `toml:"timeout" mapstructure:"timeout" json:"timeout"`                // 单次请求超时，单位秒
+	MaxAttempts int  `toml:"max_attempts" mapstructure:"max_attempts" json:"max_attempts"` // 最大投递次数，超过后进入死信
+	BaseBackoff int  `toml:"base_backoff" mapstructure:"base_backoff" json:"base_backoff"` // 首次重试间隔，单位秒，之后按2的指数增长
+	MaxBackoff  int  `toml:"max_backoff" mapstructure:"max_backoff" json:"max_backoff"`    // 最大重试间隔，单位秒
+}
+
+// 站内通知配置
+type NotificationCfg struct {
+	Enable         bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval       int  `toml:"interval" mapstructure:"interval" json:"interval"`                      // 生成通知的间隔，单位秒
+	ExpiringWindow int  `toml:"expiring_window" mapstructure:"expiring_window" json:"expiring_window"` // 挂单过期前多久提醒，单位秒
+	BatchSize      int  `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`                // 每次扫描即将过期挂单的数量
+	OutbidWindow   int  `toml:"outbid_window" mapstructure:"outbid_window" json:"outbid_window"`       // 同一用户在同一item或集合上出价被超过的通知合并间隔，单位秒
+}
+
+// 价格提醒配置
+type PriceAlertCfg struct {
+	Enable     bool   `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval   int    `toml:"interval" mapstructure:"interval" json:"interval"`       // 检查间隔，单位秒
+	Hysteresis string `toml:"hysteresis" mapstructure:"hysteresis" json:"hysteresis"` // 触发后价格需回到阈值另一侧的比例才重新生效，如 0.02 表示 2%
+	MaxPerUser int    `toml:"max_per_user" mapstructure:"max_per_user" json:"max_per_user"`
+}
+
+// 事件发件箱配置
+type OutboxCfg struct {
+	Enable      bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval    int  `toml:"interval" mapstructure:"interval" json:"interval"`             // 发送间隔，单位秒
+	BatchSize   int  `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`       // 每次发送的最大数量
+	MaxAttempts int  `toml:"max_attempts" mapstructure:"max_attempts" json:"max_attempts"` // 最大发送次数，超过后标记为失败
+	BaseBackoff int  `toml:"base_backoff" mapstructure:"base_backoff" json:"base_backoff"` // 首次重试间隔，单位秒，之后按2的指数增长
+	MaxBackoff  int  `toml:"max_backoff" mapstructure:"max_backoff" json:"max_backoff"`    // 最大重试间隔，单位秒
+}
+
+// 元数据刷新配置
+type MetadataCfg struct {
+	UserCooldown       int `toml:"user_cooldown" mapstructure:"user_cooldown" json:"user_cooldown"`                   // 同一用户两次刷新集合的最小间隔，单位秒
+	CollectionCooldown int `toml:"collection_cooldown" mapstructure:"collection_cooldown" json:"collection_cooldown"` // 同一集合两次刷新的最小间隔，单位秒
+	BatchSize          int `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"`                            // 每批加入刷新队列的token数量
+	MaxTokens          int `toml:"max_tokens" mapstructure:"max_tokens" json:"max_tokens"`                            // 指定token_ids时的最大数量
+
+	// 内置刷新worker，默认关闭，由其他服务消费刷新队列
+	WorkerEnable bool     `toml:"worker_enable" mapstructure:"worker_enable" json:"worker_enable"`
+	Workers      int      `toml:"workers" mapstructure:"workers" json:"workers"`                // 每条链的并发刷新数
+	Interval     int      `toml:"interval" mapstructure:"interval" json:"interval"`             // 队列为空时的等待间隔，单位秒
+	Timeout      int      `toml:"timeout" mapstructure:"timeout" json:"timeout"`                // 拉取元数据的请求超时，单位秒
+	MaxAttempts  int      `toml:"max_attempts" mapstructure:"max_attempts" json:"max_attempts"` // 单个token的最大尝试次数
+	IpfsGateways []string `toml:"ipfs_gateways" mapstructure:"ipfs_gateways" json:"ipfs_gateways"`
+}
+
+// NFT所有者对账配置
+type ReconcileCfg struct {
+	Enable    bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval  int  `toml:"interval" mapstructure:"interval" json:"interval"`       // 对账间隔，单位秒
+	BatchSize int  `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"` // 每批对账的item数量，同一集合的item合并为一次批量查询
+	Batches   int  `toml:"batches" mapstructure:"batches" json:"batches"`          // 每次对账的批数
+}
+
+// 接口响应缓存配置
+type ApiCacheCfg struct {
+	Enable      bool             `toml:"enable" mapstructure:"enable" json:"enable"`
+	Debounce    int              `toml:"debounce" mapstructure:"debounce" json:"debounce"`             // 收到订单、activity事件后合并清除缓存的间隔，单位毫秒
+	Stale       int              `toml:"stale" mapstructure:"stale" json:"stale"`                      // 缓存过期后仍返回旧数据并在后台刷新的时间，单位秒
+	NegativeTtl int              `toml:"negative_ttl" mapstructure:"negative_ttl" json:"negative_ttl"` // 404结果的缓存时间，单位秒
+	Routes      []*ApiCacheRoute `toml:"routes" mapstructure:"routes" json:"routes"`
+}
+
+// 单个路由的缓存配置
+type ApiCacheRoute struct {
+	Method string `toml:"method" mapstructure:"method" json:"method"`
+	Path   string `toml:"path" mapstructure:"path" json:"path"` // 注册的完整路由，如 /api/v1/collections/:address
+	Ttl    int    `toml:"ttl" mapstructure:"ttl" json:"ttl"`    // 缓存时间，单位秒
+}
+
+// 进程内缓存配置
+type LocalCacheCfg struct {
+	Enable     bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	MaxEntries int  `toml:"max_entries" mapstructure:"max_entries" json:"max_entries"` // 最大条目数，超过时淘汰最久未访问的条目
+	Ttl        int  `toml:"ttl" mapstructure:"ttl" json:"ttl"`                         // 条目有效时间，单位毫秒
+}
+
+// 排行榜快照配置
+type RankingCfg struct {
+	Enable   bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval int  `toml:"interval" mapstructure:"interval" json:"interval"` // 快照生成间隔，单位秒
+}
+
+// 成交统计汇总配置
+type TradeStatsCfg struct {
+	Enable    bool `toml:"enable" mapstructure:"enable" json:"enable"`
+	Interval  int  `toml:"interval" mapstructure:"interval" json:"interval"`       // 汇总间隔，单位秒
+	BatchSize int  `toml:"batch_size" mapstructure:"batch_size" json:"batch_size"` // 每批汇总的activity数量
+	Batches   int  `toml:"batches" mapstructure:"batches" json:"batches"`          // 每次汇总的最大批数
+	GapWindow int  `toml:"gap_window" mapstructure:"gap_window" json:"gap_window"` // 未提交的activity id重新检查的窗口，按id数量计
+}
+
+// 只读从库配置，查询分配到复制延迟不超过max_lag的从库
+type ReplicaCfg struct {
+	Nodes    []gdb.Config `toml:"nodes" mapstructure:"nodes" json:"nodes"`
+	MaxLag   int64        `toml:"max_lag" mapstructure:"max_lag" json:"max_lag"`    // 允许的最大复制延迟，单位秒
+	Interval int          `toml:"interval" mapstructure:"interval" json:"interval"` // 延迟检查间隔，单位秒
+}
+
+// 接口超时配置，超时后取消进行中的数据库查询并返回超时错误
+type TimeoutCfg struct {
+	Enable  bool            `toml:"enable" mapstructure:"enable" json:"enable"`
+	Default int             `toml:"default" mapstructure:"default" json:"default"` // 未单独配置的接口的超时，单位毫秒
+	Routes  []*TimeoutRoute `toml:"routes" mapstructure:"routes" json:"routes"`
+}
+
+// 单个路由的超时配置
+type TimeoutRoute struct {
+	Method  string `toml:"method" mapstructure:"method" json:"method"`
+	Path    string `toml:"path" mapstructure:"path" json:"path"`          // 注册的完整路由，如 /api/v1/collections/:address
+	Timeout int    `toml:"timeout" mapstructure:"timeout" json:"timeout"` // 超时，单位毫秒，小于0表示不限制
 }
 
 // 解析配置文件到Config对象
@@ -73,6 +321,9 @@ func UnmarshalConfig(configFilePath string) (*Config, error) {
 	if err := viper.Unmarshal(config); err != nil {
 		return nil, err
 	}
+	if err := config.Fee.Validate(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
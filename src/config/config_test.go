@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestFeeCfgValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *FeeCfg
+		wantErr bool
+	}{
+		{name: "nil", cfg: nil},
+		{
+			name: "valid",
+			cfg: &FeeCfg{
+				DefaultRoyaltyFeeRate: "0.05",
+				Marketplaces:          []*MarketplaceFee{{MarketplaceId: 0, FeeRate: "0"}},
+				Collections:           []*CollectionFee{{Address: "0x1", MarketplaceFeeRate: "0.999"}},
+			},
+		},
+		{name: "negative royalty", cfg: &FeeCfg{DefaultRoyaltyFeeRate: "-0.01"}, wantErr: true},
+		{name: "marketplace rate one", cfg: &FeeCfg{Marketplaces: []*MarketplaceFee{{FeeRate: "1"}}}, wantErr: true},
+		{name: "marketplace rate empty", cfg: &FeeCfg{Marketplaces: []*MarketplaceFee{{FeeRate: ""}}}, wantErr: true},
+		{name: "collection royalty percent", cfg: &FeeCfg{Collections: []*CollectionFee{{RoyaltyFeeRate: "2.5"}}}, wantErr: true},
+		{name: "collection rate not number", cfg: &FeeCfg{Collections: []*CollectionFee{{MarketplaceFeeRate: "abc"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
+	"io"
+	"time"
 )
 
 // 批量获取activity信息
@@ -31,6 +33,12 @@ func ActivityMultiChainHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 			xhttp.Error(c, errcode.NewCustomErr("Filter param is nil."))
 			return
 		}
+		if filter.Cursor != "" {
+			if err := utils.DecodeCursor(filter.Cursor, &entity.ActivityCursor{}); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
 		//解析chain
 		var chains []string
 		for _, chainId := range filter.ChainID {
@@ -46,3 +54,55 @@ func ActivityMultiChainHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 		xhttp.OkJson(c, res)
 	}
 }
+
+// 实时activity推送(SSE)
+// 1. 按chain_id、collection_address、token_id、user_address订阅
+// 2. 新activity以activity事件推送，结构与/activities返回的activity一致
+// 3. 定时推送heartbeat事件保持连接
+func ActivityStreamHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、解析订阅条件
+		var filter entity.ActivityStreamFilter
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		if filter.ChainID != 0 {
+			if _, ok := utils.ChainIdToChain[filter.ChainID]; !ok {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		heartbeat := 15
+		if serverCtx.C.Stream != nil && serverCtx.C.Stream.Heartbeat > 0 {
+			heartbeat = serverCtx.C.Stream.Heartbeat
+		}
+
+		//2、注册订阅
+		sub := service.SubscribeActivities(filter)
+		defer service.UnsubscribeActivities(sub)
+		ticker := time.NewTicker(time.Duration(heartbeat) * time.Second)
+		defer ticker.Stop()
+
+		//3、推送消息直到客户端断开
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-sub.Done:
+				// 客户端消费过慢被断开
+				return false
+			case activity := <-sub.C:
+				c.SSEvent("activity", activity)
+				return true
+			case t := <-ticker.C:
+				c.SSEvent("heartbeat", t.Unix())
+				return true
+			}
+		})
+	}
+}
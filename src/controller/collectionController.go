@@ -11,7 +11,9 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"io"
 	"strconv"
+	"time"
 )
 
 /*
@@ -40,6 +42,10 @@ func CollectionDetailHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 		}
 		//4、调用service
 		res, err := service.GetCollectionDetail(c.Request.Context(), serverCtx, chain, address)
+		if err == entity.ErrCollectionNotFound || err == entity.ErrItemNotFound {
+			xhttp.Error(c, err)
+			return
+		}
 		if err != nil {
 			xhttp.Error(c, errcode.ErrUnexpected)
 			return
@@ -158,6 +164,12 @@ func CollectionItemsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 			xhttp.Error(c, errcode.ErrInvalidParams)
 			return
 		}
+		if filter.Cursor != "" {
+			if err := utils.DecodeCursor(filter.Cursor, &entity.ItemCursor{}); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
 		//4、将chainId转换为chain
 		chain, ok := utils.ChainIdToChain[filter.ChainID]
 		if !ok {
@@ -204,6 +216,10 @@ func ItemDetailHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 		}
 		//4、调用service
 		res, err := service.GetItemDetail(c.Request.Context(), serverCtx, chain, int(chainId), collectionAddr, tokenId)
+		if err == entity.ErrCollectionNotFound || err == entity.ErrItemNotFound {
+			xhttp.Error(c, err)
+			return
+		}
 		if err != nil {
 			xhttp.Error(c, errcode.ErrUnexpected)
 			return
@@ -454,3 +470,65 @@ func RefreshItemMetadataHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 		xhttp.OkJson(c, entity.CommonResp{Result: successStr})
 	}
 }
+
+// 集合实时数据推送(SSE)
+// 1. 连接建立后先推送一次当前数据
+// 2. 挂单、出价或成交变化时以stats事件推送地板价、最高出价、上架数量和24小时交易额
+// 3. 定时推送heartbeat事件保持连接
+func CollectionStreamHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参chain_id和address
+		chainId, err := strconv.ParseInt(c.Query("chain_id"), 10, 32)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		chain, ok := utils.ChainIdToChain[int(chainId)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		address := c.Params.ByName("address")
+		if address == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		heartbeat := 15
+		if serverCtx.C.Stream != nil && serverCtx.C.Stream.Heartbeat > 0 {
+			heartbeat = serverCtx.C.Stream.Heartbeat
+		}
+
+		//2、注册订阅后查询当前数据，避免查询期间的变化丢失
+		sub := service.SubscribeCollection(chain, int(chainId), address)
+		defer service.UnsubscribeCollection(sub)
+		stats, err := service.GetCollectionLiveStats(c.Request.Context(), serverCtx, chain, int(chainId), address)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		ticker := time.NewTicker(time.Duration(heartbeat) * time.Second)
+		defer ticker.Stop()
+
+		//3、推送消息直到客户端断开
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.SSEvent("stats", stats)
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-sub.Done:
+				// 客户端消费过慢被断开
+				return false
+			case stats := <-sub.C:
+				c.SSEvent("stats", stats)
+				return true
+			case t := <-ticker.C:
+				c.SSEvent("heartbeat", t.Unix())
+				return true
+			}
+		})
+	}
+}
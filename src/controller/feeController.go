@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// 挂单手续费预览：市场手续费、创作者版税和到手金额
+func FeePreviewHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、绑定请求参数
+		var req entity.FeePreviewParam
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		if req.CollectionAddress == "" || req.Price.IsNegative() {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、将chainId转换为chain
+		chain, ok := utils.ChainIdToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//3、调用service
+		res, err := service.PreviewFees(c.Request.Context(), serverCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, entity.FeePreviewRes{Result: res})
+	}
+}
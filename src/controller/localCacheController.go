@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// 查询本实例进程内缓存的命中统计，仅管理员可用
+func LocalCacheStatsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		xhttp.OkJson(c, service.GetLocalCacheStats(serverCtx))
+	}
+}
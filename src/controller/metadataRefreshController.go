@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/middleware"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// 刷新集合的元数据
+// 1. token_ids为空时刷新集合中的全部token，否则只刷新指定的token
+// 2. 返回任务id，通过 /jobs/:id 查询进度和失败记录
+func RefreshCollectionMetadataHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参集合address
+		collectionAddr := c.Params.ByName("address")
+		if collectionAddr == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、绑定请求参数
+		var req entity.MetadataRefreshParam
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//3、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil || len(userAddrs) == 0 {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//4、调用service
+		res, err := service.RefreshCollectionMetadata(c.Request.Context(), serverCtx, userAddrs[0], collectionAddr, req)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 查询元数据刷新任务的进度
+func MetadataRefreshJobHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参id
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		res, err := service.GetMetadataRefreshJob(c.Request.Context(), serverCtx, userAddrs, id)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 取消元数据刷新任务
+func CancelMetadataRefreshJobHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参id
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		if err := service.CancelMetadataRefreshJob(c.Request.Context(), serverCtx, userAddrs, id); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
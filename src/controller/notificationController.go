@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/middleware"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// 分页查询登录用户的通知
+// 1. 按session中的所有地址查询
+// 2. 同时返回未读数
+func NotificationsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、解析过滤参数，为空时查询全部
+		var filter entity.NotificationFilterParam
+		if filterParam := c.Query("filters"); filterParam != "" {
+			if err := json.Unmarshal([]byte(filterParam), &filter); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		res, err := service.GetNotifications(c.Request.Context(), serverCtx, userAddrs, filter)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 查询登录用户的未读通知数
+func NotificationUnreadCountHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		count, err := service.GetUnreadNotificationCount(c.Request.Context(), serverCtx, userAddrs)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, count)
+	}
+}
+
+// 将指定通知标记为已读
+func ReadNotificationHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参id
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil || id <= 0 {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		if err := service.MarkNotificationsRead(c.Request.Context(), serverCtx, userAddrs, id); err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
+
+// 将登录用户的所有通知标记为已读
+func ReadAllNotificationsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		if err := service.MarkNotificationsRead(c.Request.Context(), serverCtx, userAddrs, 0); err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/middleware"
 	"EasySwapBackend-test/src/service"
 	"EasySwapBackend-test/src/svc"
 	"EasySwapBackend-test/src/utils"
@@ -44,3 +45,37 @@ func OrderInfosHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 		}{Result: res})
 	}
 }
+
+// 保存trait出价：为已创建的collection出价记录trait意向
+func AddTraitBidHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、绑定请求参数
+		var req entity.TraitBidParam
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		if req.OrderId == "" || req.Trait == "" || req.TraitValue == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、将chainId转换为chain
+		chain, ok := utils.ChainIdToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//3、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//4、调用service
+		if err := service.AddTraitBid(c.Request.Context(), serverCtx, chain, userAddrs, req); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
@@ -60,6 +60,12 @@ func UserMultiChainItemsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 			xhttp.Error(c, errcode.NewCustomErr("Filter param is nil."))
 			return
 		}
+		if filter.Cursor != "" {
+			if err := utils.DecodeCursor(filter.Cursor, &entity.PortfolioItemCursor{}); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
 		//3、解析封装chain信息
 		if len(filter.ChainID) == 0 {
 			for _, chain := range serverCtx.C.ChainSupported {
@@ -103,6 +109,12 @@ func UserMultiChainListingsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 			xhttp.Error(c, errcode.NewCustomErr("Filter param is nil."))
 			return
 		}
+		if filter.Cursor != "" {
+			if err := utils.DecodeCursor(filter.Cursor, &entity.PortfolioItemCursor{}); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
 		//3、解析封装chain信息
 		if len(filter.ChainID) == 0 {
 			for _, chain := range serverCtx.C.ChainSupported {
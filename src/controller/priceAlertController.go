@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/middleware"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// 新增价格提醒
+func CreatePriceAlertHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、绑定请求参数
+		var req entity.PriceAlertParam
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil || len(userAddrs) == 0 {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		res, err := service.CreatePriceAlert(c.Request.Context(), serverCtx, userAddrs, req)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 查询登录用户的价格提醒
+func UserPriceAlertsHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		res, err := service.GetUserPriceAlerts(c.Request.Context(), serverCtx, userAddrs)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 修改价格提醒
+func UpdatePriceAlertHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参id和请求参数
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		var req entity.PriceAlertParam
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		if err := service.UpdatePriceAlert(c.Request.Context(), serverCtx, userAddrs, id, req); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
+
+// 删除价格提醒
+func DeletePriceAlertHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		if err := service.DeletePriceAlert(c.Request.Context(), serverCtx, userAddrs, id); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"EasySwapBackend-test/src/entity"
 	"EasySwapBackend-test/src/service"
 	"EasySwapBackend-test/src/svc"
 	"github.com/ProjectsTask/EasySwapBase/errcode"
@@ -9,9 +8,7 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"sort"
 	"strconv"
-	"sync"
 )
 
 // 获取NFT集合排名信息
@@ -42,36 +39,33 @@ func TopRankingHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
 		} else {
 			period = "1d"
 		}
-		//3、使用WaitGroup和Mutex来保证并发安全
-		var allResult []*entity.CollectionRankingInfo
-		var wg sync.WaitGroup
-		var mu sync.Mutex
-		// 并发获取每条链的排名数据
+		//3、获取分页和排序指标，默认按成交额排序
+		page := 1
+		if pageParam := c.Query("page"); pageParam != "" {
+			page, err = strconv.Atoi(pageParam)
+			if err != nil || page <= 0 || page > service.MaxRankingPage {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		sortBy := c.DefaultQuery("sort", "volume")
+		if limit <= 0 || !service.IsValidRankingSort(sortBy) {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		if limit > service.MaxRankingLimit {
+			limit = service.MaxRankingLimit
+		}
+		//4、调用service，优先读取排行榜快照，合并所有链的排名
+		var chains []string
 		for _, chain := range serverCtx.C.ChainSupported {
-			wg.Add(1)
-			go func(chain string) {
-				defer wg.Done()
-				//调用service,获取指定链上的排名信息
-				result, err := service.GetTopRanking(c.Request.Context(), serverCtx, chain, period, limit)
-				if err != nil {
-					xhttp.Error(c, err)
-					return
-				}
-				//将结果追加到总结果中
-				mu.Lock()
-				allResult = append(allResult, result...)
-				mu.Unlock()
-			}(chain.Name)
+			chains = append(chains, chain.Name)
+		}
+		res, err := service.GetCollectionRanking(c.Request.Context(), serverCtx, chains, period, sortBy, page, int(limit))
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
 		}
-		//等待所有查询完成
-		wg.Wait()
-		//根据交易量对集合进行降序排序
-		sort.SliceStable(allResult, func(i, j int) bool {
-			return allResult[i].Volume.GreaterThan(allResult[j].Volume)
-		})
-		//包装返回参数
-		xhttp.OkJson(c, entity.CommonResp{
-			Result: allResult,
-		})
+		xhttp.OkJson(c, res)
 	}
 }
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// 分页查询NFT所有者对账发现的不一致记录，仅管理员可用
+func OwnerDiscrepanciesHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、解析过滤参数，为空时查询全部
+		var filter entity.OwnerDiscrepancyFilterParam
+		if filterParam := c.Query("filters"); filterParam != "" {
+			if err := json.Unmarshal([]byte(filterParam), &filter); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		//2、调用service
+		res, err := service.GetOwnerDiscrepancies(c.Request.Context(), serverCtx, filter)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// 查询本实例从库的复制延迟，仅管理员可用
+func ReplicaStatusHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		xhttp.OkJson(c, service.GetReplicaStatus(serverCtx))
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/middleware"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// 查询登录用户的关注列表
+// 1. 可按chain_ids过滤，为空时返回所有链
+// 2. 集合返回排行榜信息，item返回详情信息
+func WatchlistHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、解析过滤参数
+		var filter entity.WatchlistFilterParam
+		if filterParam := c.Query("filters"); filterParam != "" {
+			if err := json.Unmarshal([]byte(filterParam), &filter); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		res, err := service.GetWatchlist(c.Request.Context(), serverCtx, userAddrs, filter)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 关注集合或item
+func AddWatchlistHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req entity.WatchlistParam
+		if err := c.BindJSON(&req); err != nil || req.CollectionAddress == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil || len(userAddrs) == 0 {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		if err := service.AddWatchlist(c.Request.Context(), serverCtx, userAddrs, req); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
+
+// 取消关注集合或item
+func RemoveWatchlistHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req entity.WatchlistParam
+		if err := c.BindJSON(&req); err != nil || req.CollectionAddress == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		if err := service.RemoveWatchlist(c.Request.Context(), serverCtx, userAddrs, req); err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/middleware"
+	"EasySwapBackend-test/src/service"
+	"EasySwapBackend-test/src/svc"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+// 注册webhook
+// 1. 过滤条件包括事件类型、链、集合地址和钱包地址
+// 2. 返回的secret用于校验X-Webhook-Signature签名，仅返回一次
+func RegisterWebhookHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、绑定请求参数
+		var req entity.WebhookParam
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil || len(userAddrs) == 0 {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		res, err := service.RegisterWebhook(c.Request.Context(), serverCtx, userAddrs[0], req)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 查询登录用户的webhook
+func UserWebhooksHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		res, err := service.GetUserWebhooks(c.Request.Context(), serverCtx, userAddrs)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
+// 删除webhook
+func DeleteWebhookHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参id
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//3、调用service
+		if err := service.DeleteWebhook(c.Request.Context(), serverCtx, userAddrs, id); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, nil)
+	}
+}
+
+// 查询webhook投递记录，可按状态过滤死信
+func WebhookDeliveriesHandler(serverCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//1、获取入参id
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		//2、解析过滤参数，为空时查询全部
+		var filter entity.WebhookDeliveryFilterParam
+		if filterParam := c.Query("filters"); filterParam != "" {
+			if err := json.Unmarshal([]byte(filterParam), &filter); err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+		//3、获取登录用户地址
+		userAddrs, err := middleware.GetAuthUserAddress(c, serverCtx.KvStore)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			return
+		}
+		//4、调用service
+		res, err := service.GetWebhookDeliveries(c.Request.Context(), serverCtx, userAddrs, id, filter)
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
@@ -8,11 +8,13 @@ import (
 	"fmt"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
+	goredis "github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var eventTypesToID = map[string]int{
@@ -53,12 +55,140 @@ type ActivityMultiChainInfo struct {
 // 计数缓存key前缀
 const CacheActivityNumPrefix = "cache:es:activity:count:"
 
+const (
+	activityCountCacheExpire       = 30        // 计数缓存时间，单位秒，新增activity时通过版本号提前失效
+	activityCountVersionExpire     = 24 * 3600 // 版本号保留时间，单位秒，需远大于计数缓存时间
+	activityApproximateCacheExpire = 60        // 估算总数的缓存时间，单位秒
+)
+
 type ActivityCountCache struct {
 	Chain             string   `json:"chain"`
 	ContractAddresses []string `json:"contract_addresses"`
 	TokenId           string   `json:"token_id"`
 	UserAddress       string   `json:"user_address"`
 	EventTypes        []string `json:"event_types"`
+	Versions          []string `json:"versions"` // 相关链或集合的版本号，新增activity后版本号变化，旧的计数不再命中
+}
+
+// 计数版本号key，collectionAddr为空时为链级别
+// 使用相同的hash tag，集群模式下所有版本号在同一slot，可以一次MGET读取
+// cache:es:activity:count:{version}:<链名>[:<集合地址>]
+func genActivityCountVersionKey(chain, collectionAddr string) string {
+	if collectionAddr == "" {
+		return CacheActivityNumPrefix + "{version}:" + chain
+	}
+	return CacheActivityNumPrefix + "{version}:" + chain + ":" + strings.ToLower(collectionAddr)
+}
+
+// 估算总数缓存key cache:es:activity:count:approximate:<链名,...>
+func genActivityApproximateCountKey(chains []string) string {
+	return CacheActivityNumPrefix + "approximate:" + strings.Join(chains, ",")
+}
+
+// 查询计数相关的版本号，指定集合时为链和集合级别，否则为链级别
+func (dao *Dao) queryActivityCountVersions(ctx context.Context, chains, collectionAddrs []string) ([]string, error) {
+	var keys []string
+	for _, chain := range chains {
+		if len(collectionAddrs) == 0 {
+			keys = append(keys, genActivityCountVersionKey(chain, ""))
+			continue
+		}
+		for _, collectionAddr := range collectionAddrs {
+			keys = append(keys, genActivityCountVersionKey(chain, collectionAddr))
+		}
+	}
+	versions := make([]string, 0, len(keys))
+	if dao.Redis == nil {
+		for _, key := range keys {
+			version, err := dao.KvStore.GetCtx(ctx, key)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed on get activity count version")
+			}
+			versions = append(versions, version)
+		}
+		return versions, nil
+	}
+	values, err := dao.Redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get activity count versions")
+	}
+	for _, value := range values {
+		version, _ := value.(string) // 不存在的key为nil
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// IncrActivityCountVersions 新增activity后递增链和集合的计数版本号，使相关的计数缓存失效
+func (dao *Dao) IncrActivityCountVersions(ctx context.Context, chain string, collectionAddrs []string) error {
+	keys := []string{genActivityCountVersionKey(chain, "")}
+	seen := make(map[string]struct{})
+	for _, collectionAddr := range collectionAddrs {
+		key := genActivityCountVersionKey(chain, collectionAddr)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	if dao.Redis == nil {
+		for _, key := range keys {
+			if _, err := dao.KvStore.IncrCtx(ctx, key); err != nil {
+				return errors.Wrap(err, "failed on incr activity count version")
+			}
+			if err := dao.KvStore.ExpireCtx(ctx, key, activityCountVersionExpire); err != nil {
+				return errors.Wrap(err, "failed on expire activity count version")
+			}
+		}
+		return nil
+	}
+	_, err := dao.Redis.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Incr(ctx, key)
+			pipe.Expire(ctx, key, activityCountVersionExpire*time.Second)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on incr activity count versions")
+	}
+	return nil
+}
+
+// IsApproximateActivityCount 是否按表统计信息估算总数，仅对不带过滤条件的查询生效
+func IsApproximateActivityCount(filter entity.ActivityMultiChainFilterParams) bool {
+	return filter.Approximate && len(filter.CollectionAddresses) == 0 && filter.TokenID == "" &&
+		len(filter.UserAddresses) == 0 && len(filter.EventTypes) == 0
+}
+
+// 按表统计信息估算多条链的activity总数，InnoDB的统计行数与实际行数存在偏差
+func (dao *Dao) queryApproximateActivityCount(ctx context.Context, chains []string) (int64, error) {
+	cacheKey := genActivityApproximateCountKey(chains)
+	value, err := dao.KvStore.Get(cacheKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get approximate activity count from cache")
+	}
+	if value != "" {
+		total, _ := strconv.ParseInt(value, 10, 64)
+		return total, nil
+	}
+
+	var tables []string
+	for _, chain := range chains {
+		tables = append(tables, multi.ActivityTableName(chain))
+	}
+	var total int64
+	err = dao.DB.WithContext(ctx).
+		Raw("SELECT COALESCE(SUM(TABLE_ROWS), 0) FROM information_schema.TABLES "+
+			"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME IN (?)", tables).
+		Scan(&total).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on query activity table rows")
+	}
+	if err := dao.KvStore.Setex(cacheKey, strconv.FormatInt(total, 10), activityApproximateCacheExpire); err != nil {
+		return 0, errors.Wrap(err, "failed on cache approximate activity count")
+	}
+	return total, nil
 }
 
 // 获取计数缓存key
@@ -71,6 +201,8 @@ func getActivityCountCacheKey(activity *ActivityCountCache) (string, error) {
 }
 
 // 查询多链上的活动信息
+// 1. 按(event_time, id, chain_name)倒序，filter.Cursor为空时按page分页，不为空时从游标之后查询
+// 2. 使用游标或指定skip_count时不统计总数，返回entity.CountSkipped
 func (dao *Dao) QueryMultiChainActivities(ctx context.Context, chains []string, filter entity.ActivityMultiChainFilterParams) ([]ActivityMultiChainInfo, int64, error) {
 	//解析入参
 	collectionAddrs := filter.CollectionAddresses
@@ -93,98 +225,101 @@ func (dao *Dao) QueryMultiChainActivities(ctx context.Context, chains []string,
 		}
 	}
 	//2、构建查询sql
-	//2.1、构建sql头部
-	sqlHead := "select * from ("
-
-	//2.2、构建SQL中间部分 - 使用UNION ALL合并多个链的查询
-	sqlMid := ""
+	//2.1、构建SQL中间部分 - 使用UNION ALL合并多个链的查询
+	var lowerUserAddrs []string
+	for _, address := range userAddrs {
+		lowerUserAddrs = append(lowerUserAddrs, strings.ToLower(address))
+	}
+	var sqlMids []string
+	var args []interface{}
 	for _, chain := range chains {
 		//为每个链构建子查询
-		if sqlMid != "" {
-			sqlMid += " union all "
-		}
-		sqlMid += fmt.Sprintf("(select '%s' as chain_name,id,collection_address,token_id,currency_address,"+
-			"activity_type,maker,taker,price,tx_hash,event_time,marketplace_id from %s ",
+		sqlMid := fmt.Sprintf("(select '%s' as chain_name,id,collection_address,token_id,currency_address,"+
+			"activity_type,maker,taker,price,tx_hash,event_time,marketplace_id from %s",
 			chain, multi.ActivityTableName(chain))
 		//添加用户地址过滤条件
-		if len(userAddrs) == 1 {
-			sqlMid += fmt.Sprintf("where maker = '%s' or taker = '%s'",
-				strings.ToLower(userAddrs[0]), strings.ToLower(userAddrs[0]))
-		} else if len(userAddrs) > 1 {
-			var userAddrParam string
-			for i, address := range userAddrs {
-				userAddrParam += fmt.Sprintf("`%s`", address)
-				if i < len(userAddrs)-1 {
-					userAddrParam += ","
-				}
-			}
-			sqlMid += fmt.Sprintf("where maker in (%s) or taker in (%s)", userAddrParam, userAddrParam)
+		if len(lowerUserAddrs) > 0 {
+			sqlMid += " where maker in (?) or taker in (?)"
+			args = append(args, lowerUserAddrs, lowerUserAddrs)
 		}
-		sqlMid += ") "
+		sqlMids = append(sqlMids, sqlMid+")")
 	}
-	//2.3、构建sql尾部--添加过滤条件
-	sqlTail := ") as combind"
-	firstFlag := true
+	sqlMid := "select * from (" + strings.Join(sqlMids, " union all ") + ") as combined"
+
+	//2.2、构建sql尾部--添加过滤条件
+	var conditions []string
 	//添加合约地址过滤条件
-	if len(collectionAddrs) == 1 {
-		sqlTail += fmt.Sprintf("WHERE collection_address = '%s' ", collectionAddrs[0])
-		firstFlag = false
-	} else if len(collectionAddrs) > 1 {
-		var collectionAddrParam string
-		for i, address := range collectionAddrs {
-			collectionAddrParam += fmt.Sprintf("`%s`", address)
-			if i < len(userAddrs)-1 {
-				collectionAddrParam += ","
-			}
-		}
-		sqlTail += fmt.Sprintf("WHERE collection_address in (%s) ", collectionAddrParam)
-		firstFlag = false
+	if len(collectionAddrs) > 0 {
+		conditions = append(conditions, "collection_address in (?)")
+		args = append(args, collectionAddrs)
 	}
 	//添加tokenId过滤条件
 	if tokenId != "" {
-		if firstFlag {
-			sqlTail += fmt.Sprintf("where token_id = '%s' ", tokenId)
-			firstFlag = false
-		} else {
-			sqlTail += fmt.Sprintf("and token_id = '%s' ", tokenId)
-		}
+		conditions = append(conditions, "token_id = ?")
+		args = append(args, tokenId)
 	}
 	//添加事件类型过滤条件
 	if len(events) > 0 {
-		if firstFlag {
-			sqlTail += fmt.Sprintf("where activity_type in ('%d'", events[0])
-			for i := 1; i < len(events); i++ {
-				sqlTail += fmt.Sprintf(",`%d`", events[i])
-			}
-			sqlTail += ") "
-			firstFlag = false
+		conditions = append(conditions, "activity_type in (?)")
+		args = append(args, events)
+	}
+	sqlWhere := ""
+	if len(conditions) > 0 {
+		sqlWhere = " where " + strings.Join(conditions, " and ")
+	}
+
+	//2.3、添加分页，有游标时从游标之后查询
+	sql := sqlMid + sqlWhere
+	queryArgs := append([]interface{}{}, args...)
+	if filter.Cursor != "" {
+		var cursor entity.ActivityCursor
+		if err := utils.DecodeCursor(filter.Cursor, &cursor); err != nil {
+			return nil, 0, errors.Wrap(err, "invalid activity cursor")
+		}
+		if sqlWhere == "" {
+			sql += " where "
 		} else {
-			sqlTail += fmt.Sprintf("and activity_type in ('%d'", events[0])
-			for i := 1; i < len(events); i++ {
-				sqlTail += fmt.Sprintf(",`%d`", events[i])
-			}
-			sqlTail += ") "
+			sql += " and "
 		}
+		sql += "(event_time < ? or (event_time = ? and id < ?) or (event_time = ? and id = ? and chain_name < ?))"
+		queryArgs = append(queryArgs, cursor.EventTime, cursor.EventTime, cursor.Id,
+			cursor.EventTime, cursor.Id, cursor.Chain)
+		sql += " order by combined.event_time desc, combined.id desc, combined.chain_name desc limit ?"
+		queryArgs = append(queryArgs, pageSize)
+	} else {
+		sql += " order by combined.event_time desc, combined.id desc, combined.chain_name desc limit ? offset ?"
+		queryArgs = append(queryArgs, pageSize, pageSize*(page-1))
 	}
-	//添加分页
-	sqlTail += fmt.Sprintf("order by combined.event_time DESC, "+
-		"combined.id DESC limit %d offset %d", pageSize, pageSize*(page-1))
-	//2.4、组合完整sql
-	sql := sqlHead + sqlMid + sqlTail
-	//2.5、执行sql
-	err := dao.DB.Raw(sql).Scan(&activities).Error
+	//2.4、执行sql
+	err := dao.DB.WithContext(ctx).Raw(sql, queryArgs...).Scan(&activities).Error
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed on query activity")
 	}
 
-	//3、获取记录数
-	//3.1、从redis中获取
+	//3、获取记录数，使用游标或指定不统计时跳过
+	if filter.Cursor != "" || filter.SkipCount {
+		return activities, entity.CountSkipped, nil
+	}
+	//3.1、不带过滤条件且允许估算时，按表统计信息估算
+	if IsApproximateActivityCount(filter) {
+		total, err = dao.queryApproximateActivityCount(ctx, chains)
+		if err != nil {
+			return nil, 0, err
+		}
+		return activities, total, nil
+	}
+	//3.2、从redis中获取，key中包含相关链或集合的版本号
+	versions, err := dao.queryActivityCountVersions(ctx, chains, collectionAddrs)
+	if err != nil {
+		return nil, 0, err
+	}
 	cacheKey, err := getActivityCountCacheKey(&ActivityCountCache{
-		Chain:             "MultiChain",
+		Chain:             strings.Join(chains, ","),
 		ContractAddresses: collectionAddrs,
 		TokenId:           tokenId,
 		UserAddress:       strings.ToLower(strings.Join(userAddrs, ",")),
 		EventTypes:        eventTypes,
+		Versions:          versions,
 	})
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed on get activity number cache key")
@@ -196,16 +331,16 @@ func (dao *Dao) QueryMultiChainActivities(ctx context.Context, chains []string,
 	if strNum != "" {
 		total, _ = strconv.ParseInt(strNum, 10, 64)
 	} else {
-		//3.2、查数据库
+		//3.3、查数据库
 		//构建计数sql
-		sqlCnt := "select count(*) from (" + sqlMid + sqlTail
+		sqlCnt := "select count(*) from (" + sqlMid + sqlWhere + ") as counted"
 		//执行计数sql
-		err := dao.DB.Raw(sqlCnt).Scan(&total).Error
+		err := dao.DB.WithContext(ctx).Raw(sqlCnt, args...).Scan(&total).Error
 		if err != nil {
 			return nil, 0, errors.Wrap(err, "failed on count activity")
 		}
 		//将total写入redis
-		err = dao.KvStore.Setex(cacheKey, strconv.FormatInt(total, 10), 30)
+		err = dao.KvStore.Setex(cacheKey, strconv.FormatInt(total, 10), activityCountCacheExpire)
 		if err != nil {
 			return nil, 0, errors.Wrap(err, "failed on cache activities number")
 		}
@@ -213,6 +348,19 @@ func (dao *Dao) QueryMultiChainActivities(ctx context.Context, chains []string,
 	return activities, total, nil
 }
 
+// 下一页activity的游标，本页不足pageSize时没有下一页
+func NextActivityCursor(activities []ActivityMultiChainInfo, pageSize int) string {
+	if len(activities) == 0 || len(activities) < pageSize {
+		return ""
+	}
+	last := activities[len(activities)-1]
+	return utils.EncodeCursor(entity.ActivityCursor{
+		EventTime: last.EventTime,
+		Id:        last.Id,
+		Chain:     last.ChainName,
+	})
+}
+
 // 查询多链活动的外部信息
 // 包括: 用户地址、NFT信息、合约信息等
 func (dao *Dao) QueryMultiChainActivityExternalInfo(ctx context.Context, chainID []int, chains []string, activities []ActivityMultiChainInfo) ([]entity.ActivityInfo, error) {
@@ -360,3 +508,49 @@ func (dao *Dao) QueryMultiChainActivityExternalInfo(ctx context.Context, chainID
 	}
 	return result, nil
 }
+
+// 查询指定链上id大于lastId的activity，按id升序
+func (dao *Dao) QueryActivitiesAfter(ctx context.Context, chain string, lastId int64, limit int) ([]ActivityMultiChainInfo, error) {
+	var activities []ActivityMultiChainInfo
+	err := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
+		Select("? as chain_name, id, collection_address, token_id, currency_address, "+
+			"activity_type, maker, taker, price, tx_hash, event_time, marketplace_id", chain).
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Scan(&activities).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query new activities")
+	}
+	return activities, nil
+}
+
+// 按id查询指定链上的activity，用于重新检查之前读取时的空缺id
+func (dao *Dao) QueryActivitiesByIds(ctx context.Context, chain string, ids []int64) ([]ActivityMultiChainInfo, error) {
+	var activities []ActivityMultiChainInfo
+	if len(ids) == 0 {
+		return activities, nil
+	}
+	err := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
+		Select("? as chain_name, id, collection_address, token_id, currency_address, "+
+			"activity_type, maker, taker, price, tx_hash, event_time, marketplace_id", chain).
+		Where("id in (?)", ids).
+		Order("id asc").
+		Scan(&activities).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query activities by ids")
+	}
+	return activities, nil
+}
+
+// 查询指定链上最大的activity id
+func (dao *Dao) QueryMaxActivityId(ctx context.Context, chain string) (int64, error) {
+	var maxId int64
+	err := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
+		Select("COALESCE(MAX(id), 0)").
+		Row().Scan(&maxId)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on query max activity id")
+	}
+	return maxId, nil
+}
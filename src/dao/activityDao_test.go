@@ -0,0 +1,69 @@
+package dao
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/utils"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"strings"
+	"testing"
+)
+
+// 集群模式下MGET要求所有key在同一slot，按redis的规则取第一个{}中的内容作为hash tag
+func TestActivityCountVersionKeyHashTag(t *testing.T) {
+	hashTag := func(key string) string {
+		start := strings.Index(key, "{")
+		end := strings.Index(key[start+1:], "}")
+		if start < 0 || end <= 0 {
+			return key
+		}
+		return key[start+1 : start+1+end]
+	}
+	keys := []string{
+		genActivityCountVersionKey("sepolia", ""),
+		genActivityCountVersionKey("sepolia", "0xABC"),
+		genActivityCountVersionKey("mainnet", "0xdef"),
+	}
+	for _, key := range keys {
+		if got := hashTag(key); got != "version" {
+			t.Errorf("hash tag of %s = %s, want version", key, got)
+		}
+	}
+	if keys[1] != CacheActivityNumPrefix+"{version}:sepolia:0xabc" {
+		t.Errorf("collection version key = %s", keys[1])
+	}
+}
+
+func TestNextActivityCursor(t *testing.T) {
+	activity := func(id, eventTime int64, chain string) ActivityMultiChainInfo {
+		return ActivityMultiChainInfo{Activity: multi.Activity{Id: id, EventTime: eventTime}, ChainName: chain}
+	}
+	page := []ActivityMultiChainInfo{activity(9, 200, "sepolia"), activity(3, 100, "mainnet")}
+	tests := []struct {
+		name       string
+		activities []ActivityMultiChainInfo
+		pageSize   int
+		want       *entity.ActivityCursor
+	}{
+		{name: "full page", activities: page, pageSize: 2, want: &entity.ActivityCursor{EventTime: 100, Id: 3, Chain: "mainnet"}},
+		{name: "short page has no next", activities: page, pageSize: 3},
+		{name: "empty page has no next", pageSize: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextActivityCursor(tt.activities, tt.pageSize)
+			if tt.want == nil {
+				if got != "" {
+					t.Errorf("cursor = %s, want empty", got)
+				}
+				return
+			}
+			var cursor entity.ActivityCursor
+			if err := utils.DecodeCursor(got, &cursor); err != nil {
+				t.Fatalf("decode %q: %v", got, err)
+			}
+			if cursor != *tt.want {
+				t.Errorf("cursor = %+v, want %+v", cursor, *tt.want)
+			}
+		})
+	}
+}
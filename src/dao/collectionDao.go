@@ -72,8 +72,21 @@ func (dao *Dao) QueryAllCollectionInfo(ctx context.Context, chain string) ([]mul
 	return allCollections, nil
 }
 
+// 集合信息的进程内缓存key localcache:collection:<链名>:<集合地址>
+func GenCollectionInfoLocalKey(chain, address string) string {
+	return fmt.Sprintf("localcache:collection:%s:%s", chain, strings.ToLower(address))
+}
+
 // 查询指定链上的NFT集合信息
 func (dao *Dao) QueryCollectionInfo(ctx context.Context, chain, address string) (*multi.Collection, error) {
+	//1、优先读取进程内缓存，返回副本避免调用方修改缓存
+	localKey := GenCollectionInfoLocalKey(chain, address)
+	if value, ok := dao.Local.Get(localKey); ok {
+		collection := value.(multi.Collection)
+		return &collection, nil
+	}
+
+	//2、查询数据库并写入进程内缓存
 	var collection multi.Collection
 	err := dao.DB.WithContext(ctx).Table(multi.CollectionTableName(chain)).
 		Select(collectionDetailFields).
@@ -83,11 +96,13 @@ func (dao *Dao) QueryCollectionInfo(ctx context.Context, chain, address string)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get collection info")
 	}
+	dao.Local.Set(localKey, collection)
 	return &collection, nil
 }
 
-// 查询NFT集合的地板价
-func (dao *Dao) QueryFloorPrice(ctx context.Context, chain, collectionAddr string) (decimal.Decimal, error) {
+// 查询NFT集合的地板价，不同币种的挂单换算为原生币后比较
+// 无法换算的币种不参与比较，与没有挂单时一样返回0，跳过的币种一并返回
+func (dao *Dao) QueryFloorPrice(ctx context.Context, chain, collectionAddr string) (decimal.Decimal, []string, error) {
 	// SQL解释:
 	// 1. 从Item表(ci)和订单表(co)联表查询
 	// 2. 选择字段:co.price作为地板价
@@ -98,9 +113,11 @@ func (dao *Dao) QueryFloorPrice(ctx context.Context, chain, collectionAddr strin
 	//    - 订单状态为active(OrderStatus=0)
 	//    - 卖家是NFT当前所有者
 	//    - 排除marketplace_id=1的订单
-	// 5. 按价格升序排序,取第一条记录(即最低价)
+	//    - 排除链上校验无效的订单
+	// 5. 按币种分组取最低价,换算为原生币后取最小值
 	sql := fmt.Sprintf(`SELECT
-	co.price AS price 
+	co.currency_address AS currency_address,
+	MIN( co.price ) AS price 
 FROM
 	%s AS ci
 	JOIN %s co ON ci.collection_address = co.collection_address 
@@ -112,22 +129,46 @@ WHERE
 	AND co.order_status =? 
 	AND ci.OWNER = co.maker 
 	AND co.marketplace_id != ? 
+	AND %s
 	) 
-ORDER BY
-	co.price ASC 
-	LIMIT 1`, multi.ItemTableName(chain), multi.OrderTableName(chain))
+GROUP BY
+	co.currency_address`, multi.ItemTableName(chain), multi.OrderTableName(chain), validOrderCondition(chain, "co"))
 
-	var price decimal.Decimal
-	err := dao.DB.WithContext(ctx).Raw(sql, collectionAddr, OrderType, OrderStatus, 1).Scan(&price).Error
+	var prices []struct {
+		CurrencyAddress string
+		Price           decimal.Decimal
+	}
+	err := dao.DB.WithContext(ctx).Raw(sql, collectionAddr, OrderType, OrderStatus, 1).Scan(&prices).Error
 	if err != nil {
-		return decimal.Zero, errors.Wrap(err, "failed on get collection floor price")
+		return decimal.Zero, nil, errors.Wrap(err, "failed on get collection floor price")
+	}
+	// 价格为0的挂单也是有效的地板价，是否已有地板价单独记录
+	var floorPrice decimal.Decimal
+	found := false
+	var skipped []string
+	for _, p := range prices {
+		price, err := dao.Converter.ToNative(ctx, chain, p.CurrencyAddress, p.Price)
+		if err != nil {
+			skipped = dao.skipCurrency(ctx, chain, skipped, p.CurrencyAddress, err)
+			continue
+		}
+		if !found || price.LessThan(floorPrice) {
+			floorPrice = price
+			found = true
+		}
 	}
-	return price, nil
+	return floorPrice, skipped, nil
 }
 
-// 查询所有集合的最高卖单价格
-func (dao *Dao) QueryCollectionsSellPrice(ctx context.Context, chain string) ([]multi.Collection, error) {
+// 查询集合的最高卖单价格，collectionAddrs为空时查询所有集合
+func (dao *Dao) QueryCollectionsSellPrice(ctx context.Context, chain string, collectionAddrs []string) ([]multi.Collection, error) {
 	var collections []multi.Collection
+	args := []interface{}{multi.OrderStatusActive, multi.CollectionBidOrder, time.Now().Unix()}
+	collectionCondition := ""
+	if len(collectionAddrs) > 0 {
+		collectionCondition = "AND co.collection_address IN (?) "
+		args = append(args, collectionAddrs)
+	}
 	sql := fmt.Sprintf(`SELECT
 	co.collection_address AS address,
 	max(co.price) AS sale_price 
@@ -137,13 +178,10 @@ WHERE
 	order_status = ? 
 	AND co.order_type = ? 
 	AND co.expire_time > ? 
-group by collection_address`, multi.OrderTableName(chain))
+	%s
+group by collection_address`, multi.OrderTableName(chain), collectionCondition)
 
-	err := dao.DB.WithContext(ctx).Raw(
-		sql,
-		multi.OrderStatusActive,
-		multi.CollectionBidOrder,
-		time.Now().Unix()).
+	err := dao.DB.WithContext(ctx).Raw(sql, args...).
 		Scan(&collections).Error
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get collection sell price")
@@ -200,7 +238,8 @@ func (dao *Dao) QueryHistorySalesPriceInfo(ctx context.Context, chain, collectio
 }
 
 // 查询集合地板价变化情况
-func (dao *Dao) QueryCollectionFloorChange(chain string, timeDiff int64) (map[string]float64, error) {
+// collectionAddrs为空时查询所有集合
+func (dao *Dao) QueryCollectionFloorChange(ctx context.Context, chain string, collectionAddrs []string, timeDiff int64) (map[string]float64, error) {
 	collectionFloorChange := make(map[string]float64)
 	var collectionPrices []multi.CollectionFloorPrice
 	// 这个SQL语句用于查询NFT集合的地板价变化情况:
@@ -209,24 +248,36 @@ func (dao *Dao) QueryCollectionFloorChange(chain string, timeDiff int64) (map[st
 	//    a) 查询每个集合的最新地板价记录(通过GROUP BY和MAX(event_time)获取)
 	//    b) 查询每个集合在指定时间段之前的最新地板价记录(通过WHERE event_time <= UNIX_TIMESTAMP() - ? 筛选)
 	// 3. 最后按集合地址和时间降序排序,这样可以方便计算价格变化率
+	// 4. 指定了集合时两个子查询都只统计这些集合
+	collectionCondition := "1 = 1"
+	if len(collectionAddrs) > 0 {
+		collectionCondition = "collection_address IN (?)"
+	}
 	rawSql := fmt.Sprintf(`SELECT collection_address, price, event_time 
 		FROM %s 
 		WHERE (collection_address, event_time) IN (
 			SELECT collection_address, MAX(event_time)
 			FROM %s
+			WHERE %s
 			GROUP BY collection_address
 		) OR (collection_address, event_time) IN (
 			SELECT collection_address, MAX(event_time)
 			FROM %s 
-			WHERE event_time <= UNIX_TIMESTAMP() - ? 
+			WHERE event_time <= UNIX_TIMESTAMP() - ? AND %s
 			GROUP BY collection_address
 		) 
 		ORDER BY collection_address,event_time DESC`,
 		multi.CollectionFloorPriceTableName(chain),
-		multi.CollectionFloorPriceTableName(chain),
-		multi.CollectionFloorPriceTableName(chain))
-
-	err := dao.DB.Raw(rawSql, timeDiff).Scan(&collectionPrices).Error
+		multi.CollectionFloorPriceTableName(chain), collectionCondition,
+		multi.CollectionFloorPriceTableName(chain), collectionCondition)
+
+	var args []interface{}
+	if len(collectionAddrs) > 0 {
+		args = append(args, collectionAddrs, timeDiff, collectionAddrs)
+	} else {
+		args = append(args, timeDiff)
+	}
+	err := dao.DB.WithContext(ctx).Raw(rawSql, args...).Scan(&collectionPrices).Error
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get collection floor change")
 	}
@@ -259,19 +310,26 @@ func (dao *Dao) QueryCollectionFloorChange(chain string, timeDiff int64) (map[st
 }
 
 // 查询集合上架数量
-func (dao *Dao) QueryCollectionsListed(chain string, collectionAddrs []string) ([]entity.CollectionListed, error) {
+func (dao *Dao) QueryCollectionsListed(ctx context.Context, chain string, collectionAddrs []string) ([]entity.CollectionListed, error) {
 	var collectionListed []entity.CollectionListed
 	if len(collectionAddrs) == 0 {
 		return collectionListed, nil
 	}
 	for _, address := range collectionAddrs {
-		count, err := dao.KvStore.GetInt(ordermanager.GenCollectionListedKey(chain, address))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed on set collection listed count")
+		//优先读取进程内缓存，未命中时读取redis
+		key := ordermanager.GenCollectionListedKey(chain, address)
+		value, ok := dao.Local.Get(key)
+		if !ok {
+			count, err := dao.KvStore.GetInt(key)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed on set collection listed count")
+			}
+			dao.Local.Set(key, count)
+			value = count
 		}
 		collectionListed = append(collectionListed, entity.CollectionListed{
 			CollectionAddr: address,
-			Count:          count,
+			Count:          value.(int),
 		})
 	}
 	return collectionListed, nil
@@ -316,7 +374,7 @@ func (dao *Dao) QueryMultiChainUserCollectionInfos(ctx context.Context, chainIds
 	//4、组合查询sql
 	sql := sqlHead + sqlMid + sqlTail
 	//5、执行sql
-	err := dao.DB.Raw(sql).Scan(&userCollections).Error
+	err := dao.DB.WithContext(ctx).Raw(sql).Scan(&userCollections).Error
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get user multi chain collection infos")
 	}
@@ -324,87 +382,116 @@ func (dao *Dao) QueryMultiChainUserCollectionInfos(ctx context.Context, chainIds
 }
 
 // 查询用户拥有nft的Item基本信息，list信息和bid信息，从Item表和Activity表中查询
+// 按持有时间倒序，cursor为空时按page分页，使用游标或skipCount为true时不统计总数
 func (dao *Dao) QueryMultiChainUserItemInfos(ctx context.Context, chains, userAddrs, collectionAddrs []string,
-	page, pageSize int) ([]entity.PortfolioItemInfo, int64, error) {
-	var total int64
-	var items []entity.PortfolioItemInfo
+	page, pageSize int, cursor string, skipCount bool) ([]entity.PortfolioItemInfo, int64, error) {
+	sqlMids, args := buildUserItemsSql(chains, userAddrs, collectionAddrs, "left join")
+	return dao.queryUserItemsPage(ctx, sqlMids, args, page, pageSize, cursor, skipCount)
+}
 
-	//1、构建列表查询sql
-	//1.1 构建查询sql头部
-	sqlHead := "select * from ("
-	//1.2 构建查询sql中部 - 使用UNION ALL合并多个链的查询
-	sqlMid := ""
+// 构建每条链查询用户持有item及最后成交时间的子查询
+// subJoin为子查询中item表与activity表的连接方式
+func buildUserItemsSql(chains, userAddrs, collectionAddrs []string, subJoin string) ([]string, []interface{}) {
+	var sqlMids []string
+	var args []interface{}
 	for _, chain := range chains {
-		//为每个链构建子查询
-		if sqlMid == "" {
-			sqlMid += " union all "
-		}
 		//查询字段：chain_id, collection_address, token_id, name, owner, owned_time
-		sqlMid += "(select gi.chain_id as chain_id, " +
+		sqlMid := "(select gi.chain_id as chain_id, " +
 			"gi.collection_address as collection_address, " +
 			"gi.token_id as token_id, " +
 			"gi.name as name, " +
 			"gi.owner as owner, " +
 			"sub.last_event_time as owned_time "
 		sqlMid += fmt.Sprintf("from %s as gi ", multi.ItemTableName(chain))
-		//左连接查询
+		//左连接查询每个Item最后的成交时间
 		sqlMid += "left join (select sgi.collection_address, sgi.token_id, max(sga.event_time) as last_event_time "
-		sqlMid += fmt.Sprintf("from %s as sgi left join %s as sga ", multi.ItemTableName(chain), multi.ActivityTableName(chain))
+		sqlMid += fmt.Sprintf("from %s as sgi %s %s as sga ", multi.ItemTableName(chain), subJoin, multi.ActivityTableName(chain))
 		sqlMid += "on sgi.collection_address = sga.collection_address and sgi.token_id = sga.token_id "
-		sqlMid += fmt.Sprintf("where sgi.owner in (%s) and sga.activity_type = %d ", userAddrs, multi.Sale)
+		sqlMid += "where sgi.owner in (?) and sga.activity_type = ? "
+		args = append(args, userAddrs, multi.Sale)
 		// 如果指定了合约地址,添加合约地址过滤条件
 		if len(collectionAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and sgi.collection_address in ('%s'", collectionAddrs[0])
-			for i := 1; i < len(collectionAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", collectionAddrs[i])
-			}
-			sqlMid += ")"
+			sqlMid += "and sgi.collection_address in (?) "
+			args = append(args, collectionAddrs)
 		}
 		sqlMid += "group by sgi.collection_address, sgi.token_id) sub " +
 			"on gi.collection_address = sub.collection_address and gi.token_id = sub.token_id "
 		//过滤指定用户持有的Item
-		sqlMid += fmt.Sprintf("where gi.owner in ('%s'", userAddrs[0])
-		for i := 1; i < len(userAddrs); i++ {
-			sqlMid += fmt.Sprintf(",'%s'", userAddrs[i])
-		}
-		sqlMid += ")"
+		sqlMid += "where gi.owner in (?)"
+		args = append(args, userAddrs)
 		if len(collectionAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and gi.collection_address in ('%s'", collectionAddrs[0])
-			for i := 1; i < len(collectionAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", collectionAddrs[i])
-			}
-			sqlMid += ")"
+			sqlMid += " and gi.collection_address in (?)"
+			args = append(args, collectionAddrs)
 		}
-		sqlMid += ")"
+		sqlMids = append(sqlMids, sqlMid+")")
 	}
-	//1.3 构建查询sql尾部
-	sqlTail := fmt.Sprintf(") as combined ORDER BY combined.owned_time DESC LIMIT %d OFFSET %d", pageSize, pageSize*(page-1))
-	//1.4 组合查询sql
-	sql := sqlHead + sqlMid + sqlTail
+	return sqlMids, args
+}
+
+// 合并各条链的子查询，按(owned_time, chain_id, collection_address, token_id)倒序分页查询
+// 没有成交记录的item owned_time为空，排在最后
+func (dao *Dao) queryUserItemsPage(ctx context.Context, sqlMids []string, args []interface{},
+	page, pageSize int, cursor string, skipCount bool) ([]entity.PortfolioItemInfo, int64, error) {
+	var total int64
+	var items []entity.PortfolioItemInfo
+	sqlUnion := "select * from (" + strings.Join(sqlMids, " union all ") + ") as combined"
 
-	//2、构建计数sql
-	//2.1、构建计数sql头部
-	sqlCntHead := "select count(*) from ("
-	//2.2、构建计数sql中部
-	sqlCntMid := sqlMid
-	//2.3、构建计数sql尾部
-	sqlCntTail := ") as combined"
-	//2.4 组合计数sql
-	sqlCnt := sqlCntHead + sqlCntMid + sqlCntTail
+	//1、统计总数，使用游标或指定不统计时跳过
+	if cursor != "" || skipCount {
+		total = entity.CountSkipped
+	} else {
+		err := dao.DB.WithContext(ctx).Raw("select count(*) from ("+sqlUnion+") as counted", args...).Scan(&total).Error
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed on count user multi chain items")
+		}
+	}
 
-	//3、执行计数sql
-	err := dao.DB.WithContext(ctx).Raw(sqlCnt).Scan(&total).Error
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed on count user multi chain items")
+	//2、分页查询，有游标时从游标之后查询
+	sql := sqlUnion
+	queryArgs := append([]interface{}{}, args...)
+	if cursor != "" {
+		var position entity.PortfolioItemCursor
+		if err := utils.DecodeCursor(cursor, &position); err != nil {
+			return nil, 0, errors.Wrap(err, "invalid portfolio item cursor")
+		}
+		if position.HasOwnedTime {
+			sql += " where (owned_time < ? or owned_time is null or " +
+				"(owned_time = ? and (chain_id, collection_address, token_id) < (?, ?, ?)))"
+			queryArgs = append(queryArgs, position.OwnedTime, position.OwnedTime,
+				position.ChainID, position.CollectionAddress, position.TokenID)
+		} else {
+			sql += " where owned_time is null and (chain_id, collection_address, token_id) < (?, ?, ?)"
+			queryArgs = append(queryArgs, position.ChainID, position.CollectionAddress, position.TokenID)
+		}
 	}
-	//4、执行查询sql
-	err = dao.DB.WithContext(ctx).Raw(sql).Scan(&items).Error
-	if err != nil {
+	sql += " order by combined.owned_time desc, combined.chain_id desc, " +
+		"combined.collection_address desc, combined.token_id desc limit ?"
+	queryArgs = append(queryArgs, pageSize)
+	if cursor == "" {
+		sql += " offset ?"
+		queryArgs = append(queryArgs, pageSize*(page-1))
+	}
+	if err := dao.DB.WithContext(ctx).Raw(sql, queryArgs...).Scan(&items).Error; err != nil {
 		return nil, 0, errors.Wrap(err, "failed on get user multi chain items")
 	}
 	return items, total, nil
 }
 
+// 下一页用户item的游标，本页不足pageSize时没有下一页
+func NextPortfolioItemCursor(items []entity.PortfolioItemInfo, pageSize int) string {
+	if len(items) == 0 || len(items) < pageSize {
+		return ""
+	}
+	last := items[len(items)-1]
+	return utils.EncodeCursor(entity.PortfolioItemCursor{
+		HasOwnedTime:      last.OwnedTime != 0,
+		OwnedTime:         last.OwnedTime,
+		ChainID:           last.ChainID,
+		CollectionAddress: last.CollectionAddress,
+		TokenID:           last.TokenID,
+	})
+}
+
 /*
 *
 批量查询多条链上的NFT集合信息
@@ -431,97 +518,11 @@ func (dao *Dao) QueryMultiChainCollectionsInfo(ctx context.Context, collectionAd
 }
 
 // 查询多链上用户挂单Item信息
+// 按持有时间倒序，cursor为空时按page分页，使用游标或skipCount为true时不统计总数
 func (dao *Dao) QueryMultiChainUserListingItemInfos(ctx context.Context, chain []string, userAddrs []string,
-	contractAddrs []string, page, pageSize int) ([]entity.PortfolioItemInfo, int64, error) {
-	var count int64
-	var items []entity.PortfolioItemInfo
-
-	// 构建用户地址参数字符串
-	var userAddrsParam string
-	for i, addr := range userAddrs {
-		userAddrsParam += fmt.Sprintf(`'%s'`, addr)
-		if i < len(userAddrs)-1 {
-			userAddrsParam += ","
-		}
-	}
-
-	// SQL语句头部
-	sqlCntHead := "SELECT COUNT(*) FROM ("
-	sqlHead := "SELECT * FROM ("
-	// 分页SQL
-	sqlTail := fmt.Sprintf(") as combined ORDER BY combined.owned_time DESC LIMIT %d OFFSET %d",
-		pageSize, page-1)
-	var sqlMids []string
-
-	// 遍历每条链构建SQL
-	for _, chainName := range chain {
-		sqlMid := "("
-		// 查询Item基本信息和最后交易时间
-		sqlMid += "select gi.chain_id as chain_id, gi.collection_address as collection_address, " +
-			"gi.token_id as token_id, gi.name as name, gi.owner as owner, " +
-			"sub.last_event_time as owned_time "
-		sqlMid += fmt.Sprintf("from %s gi ", multi.ItemTableName(chainName))
-		sqlMid += "left join "
-		// 子查询获取每个Item最后的交易时间
-		sqlMid += "(select sgi.collection_address, sgi.token_id, " +
-			"max(sga.event_time) as last_event_time "
-		sqlMid += fmt.Sprintf("from %s sgi join %s sga ",
-			multi.ItemTableName(chainName), multi.ActivityTableName(chainName))
-		sqlMid += "on sgi.collection_address = sga.collection_address " +
-			"and sgi.token_id = sga.token_id "
-		// 过滤条件:指定用户和Sale类型活动
-		sqlMid += fmt.Sprintf("where sgi.owner in (%s) and sga.activity_type = %d ",
-			userAddrsParam, multi.Sale)
-
-		// 添加合约地址过滤
-		if len(contractAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and sgi.collection_address in ('%s'", contractAddrs[0])
-			for i := 1; i < len(contractAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", contractAddrs[i])
-			}
-			sqlMid += ") "
-		}
-		sqlMid += "group by sgi.collection_address, sgi.token_id) sub "
-		sqlMid += "on gi.collection_address = sub.collection_address " +
-			"and gi.token_id = sub.token_id "
-
-		// 主查询过滤条件
-		sqlMid += fmt.Sprintf("where gi.owner in (%s) ", userAddrsParam)
-		if len(contractAddrs) > 0 {
-			sqlMid += fmt.Sprintf("and gi.collection_address in ('%s'", contractAddrs[0])
-			for i := 1; i < len(contractAddrs); i++ {
-				sqlMid += fmt.Sprintf(",'%s'", contractAddrs[i])
-			}
-			sqlMid += ")"
-		}
-		sqlMid += ")"
-
-		sqlMids = append(sqlMids, sqlMid)
-	}
-
-	// 使用UNION ALL合并多链结果
-	sqlCnt := sqlCntHead
-	sql := sqlHead
-	for i := 0; i < len(sqlMids); i++ {
-		if i != 0 {
-			sql += " UNION ALL "
-			sqlCnt += " UNION ALL "
-		}
-		sql += sqlMids[i]
-		sqlCnt += sqlMids[i]
-	}
-	sql += sqlTail
-	sqlCnt += ") as combined"
-
-	// 执行SQL查询
-	if err := dao.DB.WithContext(ctx).Raw(sqlCnt).Scan(&count).Error; err != nil {
-		return nil, 0, errors.Wrap(err, "failed on count user multi chain items")
-	}
-	if err := dao.DB.WithContext(ctx).Raw(sql).Scan(&items).Error; err != nil {
-		return nil, 0, errors.Wrap(err, "failed on get user multi chain items")
-	}
-
-	return items, count, nil
+	contractAddrs []string, page, pageSize int, cursor string, skipCount bool) ([]entity.PortfolioItemInfo, int64, error) {
+	sqlMids, args := buildUserItemsSql(chain, userAddrs, contractAddrs, "join")
+	return dao.queryUserItemsPage(ctx, sqlMids, args, page, pageSize, cursor, skipCount)
 }
 
 // 批量查询指定链上的NFT集合信息
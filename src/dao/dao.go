@@ -1,21 +1,37 @@
 package dao
 
 import (
-	"context"
+	"EasySwapBackend-test/src/localcache"
+	"EasySwapBackend-test/src/price"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	goredis "github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 type Dao struct {
-	ctx     context.Context
 	DB      *gorm.DB
 	KvStore *xkv.Store
+	// 多币种价格换算，为空时按原价格统计
+	Converter *price.Converter
+	// 进程内缓存，为空时不缓存
+	Local *localcache.Cache
+	// 读写分离，未配置从库时为空
+	Replicas *ReplicaResolver
+	// go-redis客户端，用于kv.Store不支持的批量命令，为空时逐个读取
+	Redis goredis.UniversalClient
 }
 
-func New(ctx context.Context, db *gorm.DB, kvStore *xkv.Store) *Dao {
+func New(db *gorm.DB, kvStore *xkv.Store) *Dao {
 	return &Dao{
-		ctx:     ctx,
 		DB:      db,
 		KvStore: kvStore,
 	}
 }
+
+// WithTx 返回使用指定事务的Dao，用于在同一事务中调用多个Dao方法
+func (dao *Dao) WithTx(tx *gorm.DB) *Dao {
+	d := *dao
+	d.DB = tx
+	d.Local = nil // 事务内读取不使用进程内缓存
+	return &d
+}
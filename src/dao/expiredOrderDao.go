@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// 过期清理任务已处理的订单，订单表由indexer维护，清理任务不修改订单状态
+type ExpiredOrder struct {
+	Id                int64  `gorm:"column:id" json:"id"`
+	OrderID           string `gorm:"column:order_id" json:"order_id"`
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`
+	OrderType         int64  `gorm:"column:order_type" json:"order_type"`
+	ExpireTime        int64  `gorm:"column:expire_time" json:"expire_time"`
+	CreateTime        int64  `gorm:"column:create_time" json:"create_time"`
+}
+
+func ExpiredOrderTableName(chain string) string {
+	return fmt.Sprintf("ob_order_expired_%s", chain)
+}
+
+// 查询已过期、仍为活跃状态且未被清理任务处理的订单
+func (dao *Dao) QueryExpiredOrders(ctx context.Context, chain string, limit int) ([]multi.Order, error) {
+	var orders []multi.Order
+	err := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("id, order_id, collection_address, token_id, order_type, maker, price, expire_time").
+		Where("order_status = ? and expire_time <= ?", multi.OrderStatusActive, time.Now().Unix()).
+		Where(fmt.Sprintf("order_id not in (select order_id from %s)", ExpiredOrderTableName(chain))).
+		Order("id asc").
+		Limit(limit).
+		Scan(&orders).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query expired orders")
+	}
+	return orders, nil
+}
+
+// 记录已处理的过期订单，已存在的忽略
+func (dao *Dao) MarkOrdersExpired(ctx context.Context, chain string, orders []multi.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	records := make([]ExpiredOrder, 0, len(orders))
+	for _, order := range orders {
+		records = append(records, ExpiredOrder{
+			OrderID:           order.OrderID,
+			CollectionAddress: order.CollectionAddress,
+			OrderType:         order.OrderType,
+			ExpireTime:        order.ExpireTime,
+			CreateTime:        now,
+		})
+	}
+	err := dao.DB.WithContext(ctx).Table(ExpiredOrderTableName(chain)).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&records).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on mark orders expired")
+	}
+	return nil
+}
+
+// 移除订单表中已不是活跃状态的订单记录，indexer已更新其状态，无需继续保留
+func (dao *Dao) RemoveClosedExpiredOrders(ctx context.Context, chain string) error {
+	sql := fmt.Sprintf(`DELETE eo FROM %s AS eo
+	LEFT JOIN %s AS co ON co.order_id = eo.order_id
+WHERE
+	co.order_id IS NULL 
+	OR co.order_status != ?`, ExpiredOrderTableName(chain), multi.OrderTableName(chain))
+	err := dao.DB.WithContext(ctx).Exec(sql, multi.OrderStatusActive).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on remove closed expired orders")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// 所有市场通用的手续费覆盖
+const AllMarketplaces = -1
+
+// 手续费覆盖配置
+// collection_address为空表示对所有集合生效，marketplace_id为-1表示对所有市场生效，费率为null表示不覆盖
+type FeeOverride struct {
+	Id                 int64               `gorm:"column:id" json:"id"`
+	CollectionAddress  string              `gorm:"column:collection_address" json:"collection_address"`
+	MarketplaceId      int                 `gorm:"column:marketplace_id" json:"marketplace_id"`
+	MarketplaceFeeRate decimal.NullDecimal `gorm:"column:marketplace_fee_rate" json:"marketplace_fee_rate"`
+	RoyaltyFeeRate     decimal.NullDecimal `gorm:"column:royalty_fee_rate" json:"royalty_fee_rate"`
+	CreateTime         int64               `gorm:"column:create_time" json:"create_time"`
+	UpdateTime         int64               `gorm:"column:update_time" json:"update_time"`
+}
+
+func FeeOverrideTableName(chain string) string {
+	return fmt.Sprintf("ob_fee_override_%s", chain)
+}
+
+// 查询指定链的全部手续费覆盖配置，(collection_address, marketplace_id)唯一
+func (dao *Dao) QueryFeeOverrides(ctx context.Context, chain string) ([]FeeOverride, error) {
+	var overrides []FeeOverride
+	err := dao.DB.WithContext(ctx).Table(FeeOverrideTableName(chain)).
+		Select("id, collection_address, marketplace_id, marketplace_fee_rate, royalty_fee_rate").
+		Scan(&overrides).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query fee overrides")
+	}
+	return overrides, nil
+}
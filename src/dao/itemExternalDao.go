@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"strings"
 )
 
@@ -76,3 +78,23 @@ func (dao *Dao) QueryMultiChainCollectionsItemsImage(ctx context.Context, itemIn
 	}
 	return itemExternal, nil
 }
+
+// 刷新元数据时写入item的元数据地址和图片，图片变化时重置oss上传状态
+func (dao *Dao) UpsertItemExternal(ctx context.Context, chain string, external *multi.ItemExternal) error {
+	err := dao.DB.WithContext(ctx).Table(multi.ItemExternalTableName(chain)).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			// 按顺序执行，先比较旧的image_uri再覆盖
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "is_uploaded_oss"}, Value: gorm.Expr("if(image_uri = values(image_uri), is_uploaded_oss, false)")},
+				{Column: clause.Column{Name: "oss_uri"}, Value: gorm.Expr("if(image_uri = values(image_uri), oss_uri, '')")},
+				{Column: clause.Column{Name: "meta_data_uri"}, Value: gorm.Expr("values(meta_data_uri)")},
+				{Column: clause.Column{Name: "image_uri"}, Value: gorm.Expr("values(image_uri)")},
+			},
+		}).
+		Create(external).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on upsert item external")
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package dao
 
 import (
 	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/utils"
 	"context"
 	"fmt"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"strings"
@@ -54,6 +56,7 @@ func (dao *Dao) QueryListedAmount(ctx context.Context, chain, collectionAddr str
 	//   - 订单状态为active(OrderStatus=0)
 	//   - 卖家是NFT当前所有者
 	//   - 排除marketplace_id=1的订单
+	//   - 排除链上校验无效的订单
 	sql := fmt.Sprintf(`SELECT
 	count( DISTINCT ( co.token_id ) ) AS counts 
 FROM
@@ -67,7 +70,8 @@ WHERE
 	AND co.order_status =?
 	AND ci.owner = co.maker 
 	AND co.marketplace_id != ?
-	)`, multi.ItemTableName(chain), multi.OrderTableName(chain))
+	AND %s
+	)`, multi.ItemTableName(chain), multi.OrderTableName(chain), validOrderCondition(chain, "co"))
 
 	var counts int64
 	err := dao.DB.WithContext(ctx).Raw(sql, collectionAddr, OrderType, OrderStatus, 1).Scan(&counts).Error
@@ -85,7 +89,7 @@ func (dao *Dao) QueryCollectionBids(ctx context.Context, chain, collectionAddr s
 	// 条件:1.指定集合地址 2.订单类型为出价单 3.订单状态为活跃 4.未过期
 	// 按价格分组统计不同价格的出价数量
 	var count int64
-	err := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+	err := dao.DB.WithContext(ctx).Table(fmt.Sprintf("%s as co", multi.OrderTableName(chain))).
 		Where("collection_address = ? and order_type = ? and order_status = ? and expire_time > ?",
 			collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
 		Group("price").
@@ -95,7 +99,7 @@ func (dao *Dao) QueryCollectionBids(ctx context.Context, chain, collectionAddr s
 	}
 	//2、分页查询出价详情
 	var bids []entity.CollectionBids
-	err = dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+	err = dao.DB.WithContext(ctx).Table(fmt.Sprintf("%s as co", multi.OrderTableName(chain))).
 		Select(`
 			sum(quantity_remaining) AS size, 
 			price,
@@ -118,6 +122,7 @@ func (dao *Dao) QueryItemBids(ctx context.Context, chain, collectionAddr, tokenI
 	// 构建SQL查询
 	// 查询字段包括:市场ID、集合地址、代币ID、订单ID、盐值、事件时间、过期时间、 价格、出价人、订单类型、未成交数量、出价总量
 	// 查询条件1:集合级别的出价 - 匹配集合地址,订单类型为集合出价,状态为活跃,未过期且有剩余数量
+	// trait出价在合约中仍是collection出价，任意item都可以成交，因此同样按集合级别的出价返回
 	// 查询条件2:Item级别的出价 - 匹配集合地址和代币ID,订单类型为Item出价,其他条件同上
 	db := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
 		Select("marketplace_id, collection_address, token_id, order_id, salt, "+
@@ -164,6 +169,15 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 	//2、初始化数据库查询
 	db := dao.DB.WithContext(ctx).Table(fmt.Sprintf("%s as ci", multi.ItemTableName(chain)))
 	coTableName := multi.OrderTableName(chain)
+	//2.1、有游标时从游标之后查询，仅支持按挂单价格排序
+	if filter.Sort == 0 {
+		filter.Sort = listPriceAsc
+	}
+	asc := filter.Sort == listPriceAsc
+	cursor, err := decodeItemCursor(filter)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	//3、根据状态过滤查询 组装sql
 	// status: 1-buy now(立即购买), 2-has offer(有报价), 3-all(所有)
@@ -183,7 +197,8 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 		if filter.Status[0] == BuyNow {
 			// 2. 条件:集合地址匹配、订单类型为listing、订单状态active、卖家是Item所有者
 			db.Where("co.collection_address = ? and co.order_type = ? and co.order_status=? and co.maker = ci.owner",
-				collectionAddr, multi.ListingOrder, multi.OrderStatusActive)
+				collectionAddr, multi.ListingOrder, multi.OrderStatusActive).
+				Where(validOrderCondition(chain, "co"))
 
 		} else if filter.Status[0] == HasOffer { //处理立即购买状态
 			// 2. 条件:集合地址匹配、订单类型为offer、订单状态active
@@ -205,6 +220,10 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 		if filter.UserAddress != "" {
 			db.Where("ci.owner = ?", filter.UserAddress)
 		}
+		//从游标之后查询
+		if cursor != nil {
+			dao.seekItemOrders(ctx, db, chain, collectionAddr, "co", "ci", filter, *cursor, asc)
+		}
 		//分组条件
 		db.Group("co.token_id")
 
@@ -224,7 +243,8 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 				coTableName)).
 			Where(
 				"co.collection_address = ? and co.order_status=? and co.maker = ci.owner",
-				collectionAddr, multi.OrderStatusActive)
+				collectionAddr, multi.OrderStatusActive).
+			Where(validOrderCondition(chain, "co"))
 		//根据市场id过滤
 		if len(filter.Markets) == 1 {
 			db.Where("co.marketplace_id = ?", filter.Markets[0])
@@ -239,9 +259,31 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 		if filter.UserAddress != "" {
 			db.Where("ci.owner = ?", filter.UserAddress)
 		}
-		//分组条件
-		db.Group("co.token_id").
-			Having("min(co.order_type) = ? and max(co.order_type) = ?", multi.ListingOrder, multi.OfferOrder)
+		//从游标之后查询
+		if cursor != nil {
+			dao.seekItemOrders(ctx, db, chain, collectionAddr, "co", "ci", filter, *cursor, asc)
+		}
+		//分组条件，降序从游标之后查询时只关联了部分订单，订单类型在seekItemOrders中判断
+		db.Group("co.token_id")
+		if cursor == nil || asc {
+			db.Having("min(co.order_type) = ? and max(co.order_type) = ?", multi.ListingOrder, multi.OfferOrder)
+		}
+	} else if nullsLast := !asc || len(filter.Status) == 0; cursor != nil && !cursor.Listed && nullsLast {
+		// 游标在未挂单的item中且未挂单的item排在最后，之后只有未挂单的item，不再关联挂单
+		db.Select("ci.id as id, ci.chain_id as chain_id,"+
+			"ci.collection_address as collection_address, ci.token_id as token_id, "+
+			"ci.name as name, ci.owner as owner, "+
+			"null as list_price, null as market_id, null as listing").
+			Where("ci.collection_address = ? and ci.id > ?", collectionAddr, cursor.Id).
+			Where("not exists (?)", dao.itemOrderSubQuery(ctx, chain, collectionAddr, "ci", filter.Status, filter.Markets))
+		//根据tokenId过滤
+		if filter.TokenID != "" {
+			db.Where("ci.token_id = ?", filter.TokenID)
+		}
+		//根据用户地址过滤
+		if filter.UserAddress != "" {
+			db.Where("ci.owner = ?", filter.UserAddress)
+		}
 	} else { // 处理所有状态 即 filter.Status=[3]
 		// 1. 子查询获取每个token的最低listing价格
 		// 2. 左连接子查询结果到Item表
@@ -260,13 +302,18 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 			Where(
 				"cos.collection_address = ? and cos.order_type = ? and cos.order_status=? "+
 					"and cos.maker = cis.owner",
-				collectionAddr, multi.ListingOrder, multi.OrderStatusActive)
+				collectionAddr, multi.ListingOrder, multi.OrderStatusActive).
+			Where(validOrderCondition(chain, "cos"))
 
 		if len(filter.Markets) == 1 {
 			subQuery.Where("cos.marketplace_id = ?", filter.Markets[0])
 		} else if len(filter.Markets) != 5 {
 			subQuery.Where("cos.marketplace_id in (?)", filter.Markets)
 		}
+		//游标在已挂单的item中时子查询只保留游标之后的挂单
+		if cursor != nil && cursor.Listed {
+			dao.seekItemOrders(ctx, subQuery, chain, collectionAddr, "cos", "cis", filter, *cursor, asc)
+		}
 		subQuery.Group("cos.token_id")
 
 		db.Select("ci.id as id, ci.chain_id as chain_id,"+
@@ -283,22 +330,35 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 		if filter.UserAddress != "" {
 			db.Where("ci.owner = ?", filter.UserAddress)
 		}
+		//从游标之后查询：
+		//游标在已挂单的item中时，子查询中没有游标之前的挂单，没有关联到挂单的item要确认确实未挂单
+		//游标在未挂单的item中时(未挂单的排在最前)，之后是id更大的未挂单item和所有已挂单的item
+		if cursor != nil {
+			switch {
+			case cursor.Listed && nullsLast:
+				db.Where("co.item_id is not null or not exists (?)",
+					dao.itemOrderSubQuery(ctx, chain, collectionAddr, "ci", filter.Status, filter.Markets))
+			case cursor.Listed:
+				db.Where("co.item_id is not null")
+			default:
+				db.Where("co.item_id is not null or ci.id > ?", cursor.Id)
+			}
+		}
 	}
-	//4、统计总记录数
-	var count int64
-	countSessionTx := db.Session(&gorm.Session{})
-	err := countSessionTx.Count(&count).Error
-	if err != nil {
-		return nil, 0, errors.Wrap(db.Error, "failed on count items")
+	//4、统计总记录数，使用游标或指定不统计时跳过
+	count := entity.CountSkipped
+	if filter.Cursor == "" && !filter.SkipCount {
+		countSessionTx := db.Session(&gorm.Session{})
+		err := countSessionTx.Count(&count).Error
+		if err != nil {
+			return nil, 0, errors.Wrap(db.Error, "failed on count items")
+		}
 	}
 
 	//5、处理排序
 	if len(filter.Status) == 0 {
 		db.Order("listing desc")
 	}
-	if filter.Sort == 0 {
-		filter.Sort = listPriceAsc
-	}
 	//5.1、根据不同排序条件设置ORDER BY
 	switch filter.Sort {
 	case listTime:
@@ -315,15 +375,113 @@ func (dao *Dao) QueryCollectionItemOrder(ctx context.Context, chain, collectionA
 
 	//6、分页查询
 	var items []*CollectionItem
-	err = db.Limit(filter.PageSize).
-		Offset(filter.PageSize * (filter.Page - 1)).
-		Scan(&items).Error
+	db.Limit(filter.PageSize)
+	if cursor == nil {
+		db.Offset(filter.PageSize * (filter.Page - 1))
+	}
+	err = db.Scan(&items).Error
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "failed on get query items info")
 	}
 	return items, count, nil
 }
 
+// 解析item游标，没有游标时返回nil
+func decodeItemCursor(filter entity.CollectionItemFilterParam) (*entity.ItemCursor, error) {
+	if filter.Cursor == "" {
+		return nil, nil
+	}
+	if filter.Sort != listPriceAsc && filter.Sort != listPriceDesc {
+		return nil, errors.New("cursor only supported when sorting by list price")
+	}
+	var cursor entity.ItemCursor
+	if err := utils.DecodeCursor(filter.Cursor, &cursor); err != nil {
+		return nil, errors.Wrap(err, "invalid item cursor")
+	}
+	if cursor.Listed {
+		if _, err := decimal.NewFromString(cursor.Price); err != nil {
+			return nil, errors.Wrap(err, "invalid item cursor price")
+		}
+	}
+	return &cursor, nil
+}
+
+// 挂单价格排序时从游标之后查询，条件加在订单表的价格上，可以按订单价格索引范围扫描，不在分组后按计算的价格过滤
+// item的挂单价格为关联订单的最低价格，从游标之后查询时要保证分组后的最低价格不变：
+// 1. 降序时游标之前的订单价格更高，只关联游标之后的订单不影响最低价格；同时有挂单和报价时按item的全部订单判断订单类型
+// 2. 升序时排除有订单在游标之前的item，剩下item的订单都在游标之后
+func (dao *Dao) seekItemOrders(ctx context.Context, db *gorm.DB, chain, collectionAddr, orderAlias, itemAlias string,
+	filter entity.CollectionItemFilterParam, cursor entity.ItemCursor, asc bool) {
+	after, _, args := itemCursorCondition(cursor, orderAlias+".price", itemAlias+".id", asc)
+	db.Where(after, args...)
+	if asc {
+		_, before, args := itemCursorCondition(cursor, "cop.price", itemAlias+".id", asc)
+		db.Where("not exists (?)",
+			dao.itemOrderSubQuery(ctx, chain, collectionAddr, itemAlias, filter.Status, filter.Markets).Where(before, args...))
+		return
+	}
+	if len(filter.Status) == 2 {
+		db.Where("exists (?)", dao.itemOrderSubQuery(ctx, chain, collectionAddr, itemAlias, filter.Status, filter.Markets).
+			Where("cop.order_type = ?", multi.ListingOrder)).
+			Where("exists (?)", dao.itemOrderSubQuery(ctx, chain, collectionAddr, itemAlias, filter.Status, filter.Markets).
+				Where("cop.order_type = ?", multi.OfferOrder)).
+			Where("not exists (?)", dao.itemOrderSubQuery(ctx, chain, collectionAddr, itemAlias, filter.Status, filter.Markets).
+				Where("cop.order_type > ?", multi.OfferOrder))
+	}
+}
+
+// item关联订单的子查询，过滤条件与按状态查询item时关联订单表的条件一致，itemAlias为外层item表的别名
+func (dao *Dao) itemOrderSubQuery(ctx context.Context, chain, collectionAddr, itemAlias string, status, markets []int) *gorm.DB {
+	db := dao.DB.WithContext(ctx).Table(fmt.Sprintf("%s as cop", multi.OrderTableName(chain))).
+		Select("1").
+		Where(fmt.Sprintf("cop.collection_address = ? and cop.token_id = %s.token_id", itemAlias), collectionAddr)
+	switch {
+	case len(status) == 1 && status[0] == HasOffer:
+		db.Where("cop.order_type = ? and cop.order_status = ?", multi.OfferOrder, multi.OrderStatusActive)
+	case len(status) == 2:
+		db.Where(fmt.Sprintf("cop.order_status = ? and cop.maker = %s.owner", itemAlias), multi.OrderStatusActive).
+			Where(validOrderCondition(chain, "cop"))
+	default:
+		db.Where(fmt.Sprintf("cop.order_type = ? and cop.order_status = ? and cop.maker = %s.owner", itemAlias),
+			multi.ListingOrder, multi.OrderStatusActive).
+			Where(validOrderCondition(chain, "cop"))
+	}
+	if len(markets) == 1 {
+		db.Where("cop.marketplace_id = ?", markets[0])
+	} else if len(markets) != 5 {
+		db.Where("cop.marketplace_id in (?)", markets)
+	}
+	return db
+}
+
+// 按(价格, item id)比较游标之后和之前的条件：升序时价格更高的在后，降序时价格更低的在后，价格相同时item id更大的在后
+func itemCursorCondition(cursor entity.ItemCursor, priceColumn, idColumn string, asc bool) (string, string, []interface{}) {
+	afterOp, beforeOp := "<", ">"
+	if asc {
+		afterOp, beforeOp = ">", "<"
+	}
+	after := fmt.Sprintf("(%s %s ? or (%s = ? and %s > ?))", priceColumn, afterOp, priceColumn, idColumn)
+	before := fmt.Sprintf("(%s %s ? or (%s = ? and %s <= ?))", priceColumn, beforeOp, priceColumn, idColumn)
+	return after, before, []interface{}{cursor.Price, cursor.Price, cursor.Id}
+}
+
+// 下一页item的游标，本页不足pageSize或不是按挂单价格排序时没有下一页
+func NextItemCursor(items []*CollectionItem, filter entity.CollectionItemFilterParam) string {
+	if filter.Sort != 0 && filter.Sort != listPriceAsc && filter.Sort != listPriceDesc {
+		return ""
+	}
+	if len(items) == 0 || len(items) < filter.PageSize {
+		return ""
+	}
+	//按状态过滤时关联订单表，item都有价格
+	last := items[len(items)-1]
+	return utils.EncodeCursor(entity.ItemCursor{
+		Listed: last.Listing || len(filter.Status) == 1 || len(filter.Status) == 2,
+		Price:  last.ListPrice.String(),
+		Id:     last.Id,
+	})
+}
+
 // QueryListingInfo 查询订单上架信息
 // 该函数主要功能:
 // 1、根据传入的价格信息列表查询对应的订单信息
@@ -401,7 +559,7 @@ func (dao *Dao) QueryLastSalePrice(ctx context.Context, chain, collectionAddr st
 		AND a.activity_type = ?`,
 		multi.ActivityTableName(chain),
 		multi.ActivityTableName(chain))
-	err := dao.DB.Raw(sql, collectionAddr, owners, multi.Sale, multi.Sale).
+	err := dao.DB.WithContext(ctx).Raw(sql, collectionAddr, owners, multi.Sale, multi.Sale).
 		Scan(&lastSales).Error
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get item last sale price")
@@ -453,7 +611,7 @@ func (dao *Dao) QueryBestBids(ctx context.Context, chain, collectionAddr, userAd
 				AND maker != '%s'
 		`, multi.OrderTableName(chain), userAddr)
 	}
-	err := dao.DB.Raw(sql, collectionAddr, tokenIds, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix()).
+	err := dao.DB.WithContext(ctx).Raw(sql, collectionAddr, tokenIds, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix()).
 		Scan(&bestBids).Error
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get item best bids")
@@ -497,7 +655,7 @@ func (dao *Dao) QueryCollectionBestBid(ctx context.Context, chain, collectionAdd
 			multi.OrderTableName(chain),
 			userAddr)
 	}
-	err := dao.DB.Raw(sql, collectionAddr, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix()).
+	err := dao.DB.WithContext(ctx).Raw(sql, collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
 		Scan(&bestBid).Error
 	if err != nil {
 		return bestBid, errors.Wrap(err, "failed on get item best bids")
@@ -549,6 +707,7 @@ func (dao *Dao) QueryItemListInfo(ctx context.Context, chain, collectionAddr, to
 			"and co.token_id=ci.token_id", coTableName)).
 		Where("ci.collection_address =? and ci.token_id = ? and co.order_type = ? and co.order_status=? "+
 			"and co.maker = ci.owner", collectionAddr, tokenId, multi.ListingOrder, multi.OrderStatusActive).
+		Where(validOrderCondition(chain, "co")).
 		Group("ci.collection_address,ci.token_id").
 		Scan(&collectionItem).Error
 	if err != nil {
@@ -617,11 +776,44 @@ func (dao *Dao) QueryTraitPrice(ctx context.Context, chain, collectionAddr strin
 func (dao *Dao) UpdateItemOwner(ctx context.Context, chain, collectionAddr, tokenId, owner string) error {
 	err := dao.DB.WithContext(ctx).
 		Table(multi.ItemTableName(chain)).
-		Update("owner", owner).
 		Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).
+		Updates(map[string]interface{}{
+			"owner":       owner,
+			"update_time": time.Now().Unix(),
+		}).
 		Error
 	if err != nil {
-		return errors.Wrap(err, "failed on get user item count")
+		return errors.Wrap(err, "failed on update item owner")
+	}
+	return nil
+}
+
+// 所有者仍为oldOwner时更新NFT所有者，返回是否更新
+// 对账期间indexer已更新所有者时不覆盖
+func (dao *Dao) UpdateItemOwnerIfMatch(ctx context.Context, chain, collectionAddr, tokenId, oldOwner, owner string) (bool, error) {
+	result := dao.DB.WithContext(ctx).
+		Table(multi.ItemTableName(chain)).
+		Where("collection_address = ? and token_id = ? and owner = ?", collectionAddr, tokenId, oldOwner).
+		Updates(map[string]interface{}{
+			"owner":       owner,
+			"update_time": time.Now().Unix(),
+		})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on update item owner")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// 刷新元数据时写入item名称，item不存在时新增
+func (dao *Dao) UpsertItemName(ctx context.Context, chain string, item *multi.Item) error {
+	err := dao.DB.WithContext(ctx).Table(multi.ItemTableName(chain)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "update_time"}),
+		}).
+		Create(item).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on upsert item name")
 	}
 	return nil
 }
@@ -642,13 +834,14 @@ func (dao *Dao) QueryListedAmountEachCollection(ctx context.Context, chain strin
 	//    - 订单状态为active(OrderStatus=0)
 	//    - 卖家是NFT当前所有者
 	//    - 排除marketplace_id=1的订单
+	//    - 排除链上校验无效的订单
 	// 5. 按集合地址分组,获取每个集合的统计结果
 	sql := fmt.Sprintf(`SELECT  ci.collection_address as address, count(distinct (co.token_id)) as list_amount
 			FROM %s as ci
 					join %s co on co.collection_address = ci.collection_address and co.token_id = ci.token_id
 			WHERE (co.collection_address in (?) and ci.owner in (?) and co.order_type = ? and
-				co.order_status = ? and co.maker = ci.owner and co.marketplace_id != ?) group by ci.collection_address`,
-		multi.ItemTableName(chain), multi.CollectionTableName(chain))
+				co.order_status = ? and co.maker = ci.owner and co.marketplace_id != ? and %s) group by ci.collection_address`,
+		multi.ItemTableName(chain), multi.CollectionTableName(chain), validOrderCondition(chain, "co"))
 	err := dao.DB.WithContext(ctx).
 		Raw(sql, collectionAddrs, userAddrs, OrderType, OrderStatus, 1).
 		Scan(&counts).Error
@@ -737,7 +930,7 @@ SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_ty
 	  AND quantity_remaining > 0
       AND expire_time > ?
 	  AND maker != '%s'
-`, multi.OrderTableName(chain))
+`, multi.OrderTableName(chain), userAddr)
 	}
 	//执行sql查询
 	err := dao.DB.WithContext(ctx).
@@ -0,0 +1,169 @@
+package dao
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/utils"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/shopspring/decimal"
+	"reflect"
+	"testing"
+)
+
+func TestItemCursorCondition(t *testing.T) {
+	cursor := entity.ItemCursor{Listed: true, Price: "1.5", Id: 7}
+	tests := []struct {
+		name       string
+		asc        bool
+		wantAfter  string
+		wantBefore string
+	}{
+		{
+			name:       "ascending",
+			asc:        true,
+			wantAfter:  "(co.price > ? or (co.price = ? and ci.id > ?))",
+			wantBefore: "(co.price < ? or (co.price = ? and ci.id <= ?))",
+		},
+		{
+			name:       "descending",
+			asc:        false,
+			wantAfter:  "(co.price < ? or (co.price = ? and ci.id > ?))",
+			wantBefore: "(co.price > ? or (co.price = ? and ci.id <= ?))",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, before, args := itemCursorCondition(cursor, "co.price", "ci.id", tt.asc)
+			if after != tt.wantAfter {
+				t.Errorf("after = %s, want %s", after, tt.wantAfter)
+			}
+			if before != tt.wantBefore {
+				t.Errorf("before = %s, want %s", before, tt.wantBefore)
+			}
+			if want := []interface{}{"1.5", "1.5", int64(7)}; !reflect.DeepEqual(args, want) {
+				t.Errorf("args = %v, want %v", args, want)
+			}
+		})
+	}
+}
+
+func TestNextItemCursor(t *testing.T) {
+	item := func(id int64, price string, listing bool) *CollectionItem {
+		return &CollectionItem{
+			Item:    multi.Item{Id: id, ListPrice: decimal.RequireFromString(price)},
+			Listing: listing,
+		}
+	}
+	page := []*CollectionItem{item(1, "1", true), item(2, "2.5", true)}
+	tests := []struct {
+		name   string
+		items  []*CollectionItem
+		filter entity.CollectionItemFilterParam
+		want   *entity.ItemCursor
+	}{
+		{
+			name:   "full page default sort",
+			items:  page,
+			filter: entity.CollectionItemFilterParam{PageSize: 2},
+			want:   &entity.ItemCursor{Listed: true, Price: "2.5", Id: 2},
+		},
+		{
+			name:   "full page price desc",
+			items:  page,
+			filter: entity.CollectionItemFilterParam{PageSize: 2, Sort: listPriceDesc},
+			want:   &entity.ItemCursor{Listed: true, Price: "2.5", Id: 2},
+		},
+		{
+			name:   "short page has no next",
+			items:  page,
+			filter: entity.CollectionItemFilterParam{PageSize: 3},
+		},
+		{
+			name:   "empty page has no next",
+			filter: entity.CollectionItemFilterParam{PageSize: 2},
+		},
+		{
+			name:   "sale price sort not supported",
+			items:  page,
+			filter: entity.CollectionItemFilterParam{PageSize: 2, Sort: salePriceDesc},
+		},
+		{
+			name:   "last item unlisted",
+			items:  []*CollectionItem{item(1, "1", true), item(5, "0", false)},
+			filter: entity.CollectionItemFilterParam{PageSize: 2},
+			want:   &entity.ItemCursor{Listed: false, Price: "0", Id: 5},
+		},
+		{
+			name:   "status filter always listed",
+			items:  []*CollectionItem{item(1, "1", true), item(5, "3", false)},
+			filter: entity.CollectionItemFilterParam{PageSize: 2, Status: []int{HasOffer}},
+			want:   &entity.ItemCursor{Listed: true, Price: "3", Id: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextItemCursor(tt.items, tt.filter)
+			if tt.want == nil {
+				if got != "" {
+					t.Errorf("cursor = %s, want empty", got)
+				}
+				return
+			}
+			var cursor entity.ItemCursor
+			if err := utils.DecodeCursor(got, &cursor); err != nil {
+				t.Fatalf("decode %q: %v", got, err)
+			}
+			if cursor != *tt.want {
+				t.Errorf("cursor = %+v, want %+v", cursor, *tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeItemCursor(t *testing.T) {
+	valid := entity.ItemCursor{Listed: true, Price: "0.25", Id: 42}
+	tests := []struct {
+		name    string
+		filter  entity.CollectionItemFilterParam
+		want    *entity.ItemCursor
+		wantErr bool
+	}{
+		{name: "no cursor", filter: entity.CollectionItemFilterParam{Sort: listTime}},
+		{
+			name:   "round trip",
+			filter: entity.CollectionItemFilterParam{Sort: listPriceAsc, Cursor: utils.EncodeCursor(valid)},
+			want:   &valid,
+		},
+		{
+			name:   "unlisted ignores price",
+			filter: entity.CollectionItemFilterParam{Sort: listPriceDesc, Cursor: utils.EncodeCursor(entity.ItemCursor{Id: 3})},
+			want:   &entity.ItemCursor{Id: 3},
+		},
+		{
+			name:    "unsupported sort",
+			filter:  entity.CollectionItemFilterParam{Sort: listTime, Cursor: utils.EncodeCursor(valid)},
+			wantErr: true,
+		},
+		{
+			name:    "malformed cursor",
+			filter:  entity.CollectionItemFilterParam{Sort: listPriceAsc, Cursor: "not base64!"},
+			wantErr: true,
+		},
+		{
+			name: "invalid price",
+			filter: entity.CollectionItemFilterParam{Sort: listPriceAsc,
+				Cursor: utils.EncodeCursor(entity.ItemCursor{Listed: true, Price: "1 or 1=1", Id: 1})},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeItemCursor(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cursor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package dao
+
+import (
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 元数据刷新任务状态
+const (
+	MetadataRefreshQueuing   = "queuing"   // 正在将item加入刷新队列，实例退出后由其他实例继续
+	MetadataRefreshQueued    = "queued"    // 已全部加入队列，等待刷新
+	MetadataRefreshCompleted = "completed" // 全部处理完成
+	MetadataRefreshFailed    = "failed"    // 入队过程中出错，last_error记录原因
+	MetadataRefreshCancelled = "cancelled" // 用户取消，已加入队列的token仍会刷新
+)
+
+// 集合元数据刷新任务
+// total为需要刷新的token数，skipped为防重入跳过的数量，processed和failed为已刷新成功和失败的数量
+// 未指定token时total在入队过程中累加；queue_cursor为入队进度，指定token时为已处理的token数量，否则为已处理的最大item id
+type MetadataRefreshJob struct {
+	Id                int64  `gorm:"column:id" json:"id"`
+	Owner             string `gorm:"column:owner" json:"owner"`
+	ChainId           int    `gorm:"column:chain_id" json:"chain_id"`
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`
+	TokenIds          string `gorm:"column:token_ids" json:"token_ids"` // 逗号分隔，为空表示集合中全部token
+	Status            string `gorm:"column:status" json:"status"`
+	Total             int64  `gorm:"column:total" json:"total"`
+	Queued            int64  `gorm:"column:queued" json:"queued"`
+	Skipped           int64  `gorm:"column:skipped" json:"skipped"`
+	Processed         int64  `gorm:"column:processed" json:"processed"`
+	Failed            int64  `gorm:"column:failed" json:"failed"`
+	QueueCursor       int64  `gorm:"column:queue_cursor" json:"queue_cursor"`
+	LastError         string `gorm:"column:last_error" json:"last_error"`
+	CreateTime        int64  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func MetadataRefreshJobTableName() string {
+	return "ob_metadata_refresh_job"
+}
+
+// 刷新失败的token
+type MetadataRefreshFailure struct {
+	Id         int64  `gorm:"column:id" json:"id"`
+	JobId      int64  `gorm:"column:job_id" json:"job_id"`
+	TokenId    string `gorm:"column:token_id" json:"token_id"`
+	Reason     string `gorm:"column:reason" json:"reason"`
+	CreateTime int64  `gorm:"column:create_time" json:"create_time"`
+}
+
+func MetadataRefreshFailureTableName() string {
+	return "ob_metadata_refresh_failure"
+}
+
+// 新增刷新任务
+func (dao *Dao) AddMetadataRefreshJob(ctx context.Context, job *MetadataRefreshJob) error {
+	if err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).Create(job).Error; err != nil {
+		return errors.Wrap(err, "failed on create metadata refresh job")
+	}
+	return nil
+}
+
+// 查询用户的刷新任务，不存在时返回nil
+func (dao *Dao) QueryUserMetadataRefreshJob(ctx context.Context, owners []string, id int64) (*MetadataRefreshJob, error) {
+	var jobs []MetadataRefreshJob
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ? and owner in (?)", id, owners).
+		Limit(1).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query metadata refresh job")
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+// 累加刷新任务的入队进度并记录入队位置，entered为累加到total的数量
+func (dao *Dao) IncrMetadataRefreshJobQueued(ctx context.Context, id, queued, skipped, failed, entered, cursor int64) error {
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"queued":       gorm.Expr("queued + ?", queued),
+			"skipped":      gorm.Expr("skipped + ?", skipped),
+			"failed":       gorm.Expr("failed + ?", failed),
+			"total":        gorm.Expr("total + ?", entered),
+			"queue_cursor": cursor,
+			"update_time":  time.Now().Unix(),
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on update metadata refresh job")
+	}
+	return nil
+}
+
+// 入队结束后更新任务总数和状态，没有需要刷新的token时直接完成，任务已取消时不更新
+func (dao *Dao) FinishMetadataRefreshJobQueuing(ctx context.Context, id, total int64) error {
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ? and status = ?", id, MetadataRefreshQueuing).
+		Updates(map[string]interface{}{
+			"total": total,
+			"status": gorm.Expr("case when skipped + processed + failed >= ? then ? else ? end",
+				total, MetadataRefreshCompleted, MetadataRefreshQueued),
+			"update_time": time.Now().Unix(),
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on finish metadata refresh job queuing")
+	}
+	return nil
+}
+
+// 入队过程中出错时标记任务失败，total为已入队处理的数量
+func (dao *Dao) FailMetadataRefreshJob(ctx context.Context, id, total int64, reason string) error {
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ? and status = ?", id, MetadataRefreshQueuing).
+		Updates(map[string]interface{}{
+			"total":       total,
+			"status":      MetadataRefreshFailed,
+			"last_error":  reason,
+			"update_time": time.Now().Unix(),
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on fail metadata refresh job")
+	}
+	return nil
+}
+
+// 查询入队中且在before之前没有进度的任务，这些任务所在的实例已退出
+func (dao *Dao) QueryStaleMetadataRefreshJobs(ctx context.Context, before int64, limit int) ([]MetadataRefreshJob, error) {
+	var jobs []MetadataRefreshJob
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("status = ? and update_time < ?", MetadataRefreshQueuing, before).
+		Order("id asc").
+		Limit(limit).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query stale metadata refresh jobs")
+	}
+	return jobs, nil
+}
+
+// 认领没有进度的入队任务，update_time与查询时一致才认领成功，多个实例只有一个能认领
+func (dao *Dao) ClaimMetadataRefreshJob(ctx context.Context, job *MetadataRefreshJob) (bool, error) {
+	now := time.Now().Unix()
+	result := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ? and status = ? and update_time = ?", job.Id, MetadataRefreshQueuing, job.UpdateTime).
+		Update("update_time", now)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on claim metadata refresh job")
+	}
+	job.UpdateTime = now
+	return result.RowsAffected > 0, nil
+}
+
+// 取消未完成的刷新任务，返回是否取消成功
+func (dao *Dao) CancelMetadataRefreshJob(ctx context.Context, id int64) (bool, error) {
+	result := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ? and status in (?)", id, []string{MetadataRefreshQueuing, MetadataRefreshQueued}).
+		Updates(map[string]interface{}{
+			"status":      MetadataRefreshCancelled,
+			"update_time": time.Now().Unix(),
+		})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on cancel metadata refresh job")
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// 查询刷新任务当前状态
+func (dao *Dao) QueryMetadataRefreshJobStatus(ctx context.Context, id int64) (string, error) {
+	var jobs []MetadataRefreshJob
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Select("status").
+		Where("id = ?", id).
+		Limit(1).
+		Find(&jobs).Error
+	if err != nil {
+		return "", errors.Wrap(err, "failed on query metadata refresh job status")
+	}
+	if len(jobs) == 0 {
+		return "", nil
+	}
+	return jobs[0].Status, nil
+}
+
+// 累加刷新任务的处理结果，入队已结束且全部处理完成时标记完成
+// 更新时按字段名顺序赋值，status在failed、processed之后计算，使用的是累加后的值
+func (dao *Dao) IncrMetadataRefreshJobProgress(ctx context.Context, id, processed, failed int64) error {
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshJobTableName()).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"processed": gorm.Expr("processed + ?", processed),
+			"failed":    gorm.Expr("failed + ?", failed),
+			"status": gorm.Expr("case when status = ? and skipped + processed + failed >= total then ? else status end",
+				MetadataRefreshQueued, MetadataRefreshCompleted),
+			"update_time": time.Now().Unix(),
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on update metadata refresh job progress")
+	}
+	return nil
+}
+
+// 记录刷新失败的token
+func (dao *Dao) AddMetadataRefreshFailures(ctx context.Context, failures []MetadataRefreshFailure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	if err := dao.DB.WithContext(ctx).Table(MetadataRefreshFailureTableName()).Create(&failures).Error; err != nil {
+		return errors.Wrap(err, "failed on create metadata refresh failures")
+	}
+	return nil
+}
+
+// 查询任务最近的失败记录
+func (dao *Dao) QueryMetadataRefreshFailures(ctx context.Context, jobId int64, limit int) ([]MetadataRefreshFailure, error) {
+	var failures []MetadataRefreshFailure
+	err := dao.DB.WithContext(ctx).Table(MetadataRefreshFailureTableName()).
+		Where("job_id = ?", jobId).
+		Order("id desc").
+		Limit(limit).
+		Find(&failures).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query metadata refresh failures")
+	}
+	return failures, nil
+}
+
+// 按id分批查询集合中的token
+func (dao *Dao) QueryCollectionTokenIds(ctx context.Context, chain, collectionAddr string, lastId int64, limit int) ([]multi.Item, error) {
+	var items []multi.Item
+	err := dao.DB.WithContext(ctx).Table(multi.ItemTableName(chain)).
+		Select("id, token_id").
+		Where("collection_address = ? and id > ?", collectionAddr, lastId).
+		Order("id asc").
+		Limit(limit).
+		Scan(&items).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection token ids")
+	}
+	return items, nil
+}
@@ -0,0 +1,183 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// 通知类型
+const (
+	NotificationBidReceived     = "bid_received"     // 持有的item收到出价
+	NotificationOutbid          = "outbid"           // 出价被更高的出价超过
+	NotificationItemSold        = "item_sold"        // 挂单的item已售出
+	NotificationListingExpiring = "listing_expiring" // 挂单即将过期
+	NotificationPriceAlert      = "price_alert"      // 价格提醒触发
+)
+
+// 用户通知，(address, dedup_key)唯一，同一事件对同一用户只通知一次
+type Notification struct {
+	Id                int64           `gorm:"column:id" json:"id"`
+	Address           string          `gorm:"column:address" json:"address"`
+	ChainId           int             `gorm:"column:chain_id" json:"chain_id"`
+	NotifyType        string          `gorm:"column:notify_type" json:"notify_type"`
+	CollectionAddress string          `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string          `gorm:"column:token_id" json:"token_id"`
+	OrderId           string          `gorm:"column:order_id" json:"order_id"`
+	Price             decimal.Decimal `gorm:"column:price" json:"price"`
+	Counterparty      string          `gorm:"column:counterparty" json:"counterparty"`
+	DedupKey          string          `gorm:"column:dedup_key" json:"dedup_key"`
+	IsRead            bool            `gorm:"column:is_read" json:"is_read"`
+	EventTime         int64           `gorm:"column:event_time" json:"event_time"`
+	CreateTime        int64           `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64           `gorm:"column:update_time" json:"update_time"`
+}
+
+func NotificationTableName() string {
+	return "ob_notification"
+}
+
+// 批量新增通知，已存在的通知忽略
+func (dao *Dao) AddNotifications(ctx context.Context, notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	err := dao.DB.WithContext(ctx).Table(NotificationTableName()).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}, {Name: "dedup_key"}},
+			DoNothing: true,
+		}).
+		Create(&notifications).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create notifications")
+	}
+	return nil
+}
+
+// 查询已存在的通知，返回 <address>:<dedup_key> 集合，用于只保存新增的通知
+func (dao *Dao) QueryExistingNotificationKeys(ctx context.Context, notifications []Notification) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(notifications) == 0 {
+		return existing, nil
+	}
+	var conditions [][]interface{}
+	for _, n := range notifications {
+		conditions = append(conditions, []interface{}{n.Address, n.DedupKey})
+	}
+	var rows []Notification
+	err := dao.DB.WithContext(ctx).Table(NotificationTableName()).
+		Select("address, dedup_key").
+		Where("(address, dedup_key) in ?", conditions).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query existing notifications")
+	}
+	for _, n := range rows {
+		existing[NotificationKey(n.Address, n.DedupKey)] = true
+	}
+	return existing, nil
+}
+
+// 通知的唯一key
+func NotificationKey(address, dedupKey string) string {
+	return address + ":" + dedupKey
+}
+
+// 挂单即将过期通知的去重key前缀 listing_expiring:<链id>:，后接订单id
+func ListingExpiringDedupPrefix(chainId int) string {
+	return fmt.Sprintf("%s:%d:", NotificationListingExpiring, chainId)
+}
+
+// 分页查询用户通知
+func (dao *Dao) QueryNotifications(ctx context.Context, addresses []string, unreadOnly bool, page, pageSize int) ([]Notification, int64, error) {
+	var notifications []Notification
+	var count int64
+	db := dao.DB.WithContext(ctx).Table(NotificationTableName()).
+		Where("address in (?)", addresses)
+	if unreadOnly {
+		db = db.Where("is_read = ?", false)
+	}
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count notifications")
+	}
+	err := db.Order("event_time desc, id desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&notifications).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query notifications")
+	}
+	return notifications, count, nil
+}
+
+// 统计用户未读通知数
+func (dao *Dao) CountUnreadNotifications(ctx context.Context, address string) (int64, error) {
+	var count int64
+	err := dao.DB.WithContext(ctx).Table(NotificationTableName()).
+		Where("address = ? and is_read = ?", address, false).
+		Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on count unread notifications")
+	}
+	return count, nil
+}
+
+// 将用户的指定通知标记为已读，id为0时标记全部
+func (dao *Dao) MarkNotificationsRead(ctx context.Context, addresses []string, id int64) (int64, error) {
+	db := dao.DB.WithContext(ctx).Table(NotificationTableName()).
+		Where("address in (?) and is_read = ?", addresses, false)
+	if id > 0 {
+		db = db.Where("id = ?", id)
+	}
+	result := db.Updates(map[string]interface{}{
+		"is_read":     true,
+		"update_time": time.Now().Unix(),
+	})
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "failed on mark notifications read")
+	}
+	return result.RowsAffected, nil
+}
+
+// 查询被新出价超过的其他出价者的有效出价
+// item出价比较同一item的item出价，集合出价比较同一集合的集合出价
+func (dao *Dao) QueryOutbidOrders(ctx context.Context, chain string, order *multi.Order, limit int) ([]multi.Order, error) {
+	var orders []multi.Order
+	db := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("order_id, collection_address, token_id, maker, price, order_type").
+		Where("collection_address = ? and order_type = ? and order_status = ? and quantity_remaining > 0",
+			order.CollectionAddress, order.OrderType, multi.OrderStatusActive).
+		Where("maker != ? and price < ? and expire_time > ?", order.Maker, order.Price, time.Now().Unix())
+	if order.OrderType == multi.ItemBidOrder {
+		db = db.Where("token_id = ?", order.TokenId)
+	}
+	err := db.Order("price desc").Limit(limit).Scan(&orders).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query outbid orders")
+	}
+	return orders, nil
+}
+
+// 按id游标分页查询即将过期、还未通知挂单者的有效挂单，返回id大于afterId的记录
+// 已通知的挂单通过通知表的唯一索引(address, dedup_key)排除，已通知过的挂单不会被重复读取
+func (dao *Dao) QueryExpiringListings(ctx context.Context, chain string, chainId int, before, afterId int64, limit int) ([]multi.Order, error) {
+	var orders []multi.Order
+	err := dao.DB.WithContext(ctx).Table(fmt.Sprintf("%s as co", multi.OrderTableName(chain))).
+		Select("co.id, co.order_id, co.collection_address, co.token_id, co.maker, co.price, co.expire_time").
+		Where("co.order_type = ? and co.order_status = ? and co.expire_time > ? and co.expire_time <= ?",
+			multi.ListingOrder, multi.OrderStatusActive, time.Now().Unix(), before).
+		Where("co.id > ?", afterId).
+		Where(fmt.Sprintf("not exists (select 1 from %s n where n.address = lower(co.maker) "+
+			"and n.dedup_key = concat(?, co.order_id))", NotificationTableName()), ListingExpiringDedupPrefix(chainId)).
+		Order("co.id asc").
+		Limit(limit).
+		Scan(&orders).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query expiring listings")
+	}
+	return orders, nil
+}
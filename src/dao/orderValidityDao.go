@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// 挂单无效原因
+const (
+	InvalidReasonOwnerChanged = "owner_changed" // NFT所有者已不是挂单者
+	InvalidReasonNotApproved  = "not_approved"  // 挂单者已撤销对合约的授权
+	InvalidReasonTokenBurned  = "token_burned"  // NFT已销毁，ownerOf返回零地址
+)
+
+// 链上校验不通过的挂单
+type InvalidOrder struct {
+	Id                int64  `gorm:"column:id" json:"id"`
+	OrderID           string `gorm:"column:order_id" json:"order_id"`
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string `gorm:"column:token_id" json:"token_id"`
+	Maker             string `gorm:"column:maker" json:"maker"`
+	Reason            string `gorm:"column:reason" json:"reason"`
+	CheckTime         int64  `gorm:"column:check_time" json:"check_time"`
+	CreateTime        int64  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func InvalidOrderTableName(chain string) string {
+	return fmt.Sprintf("ob_order_invalid_%s", chain)
+}
+
+// 排除无效挂单的查询条件，alias为订单表别名
+func validOrderCondition(chain, alias string) string {
+	return fmt.Sprintf("%s.order_id not in (select order_id from %s)", alias, InvalidOrderTableName(chain))
+}
+
+// 随机抽样活跃的挂单
+// 1. 只读取活跃挂单的id并order by rand()，每个挂单被抽中的概率相同，不受id空洞的影响
+// 2. 再按抽中的id读取挂单详情
+func (dao *Dao) QuerySampleListings(ctx context.Context, chain string, size int) ([]multi.Order, error) {
+	var ids []int64
+	err := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("id").
+		Where("order_type = ? and order_status = ? and expire_time > ?",
+			multi.ListingOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Order("rand()").
+		Limit(size).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on sample listing ids")
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var orders []multi.Order
+	err = dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("id, order_id, collection_address, token_id, maker, marketplace_id, price").
+		Where("id in (?)", ids).
+		Scan(&orders).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query sample listings")
+	}
+	return orders, nil
+}
+
+// 记录无效挂单，已存在的更新原因和校验时间
+func (dao *Dao) MarkOrdersInvalid(ctx context.Context, chain string, orders []InvalidOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	err := dao.DB.WithContext(ctx).Table(InvalidOrderTableName(chain)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "order_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reason", "check_time", "update_time"}),
+		}).
+		Create(&orders).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on mark orders invalid")
+	}
+	return nil
+}
+
+// 查询指定订单中已被标记为无效的记录
+func (dao *Dao) QueryInvalidOrders(ctx context.Context, chain string, orderIds []string) ([]InvalidOrder, error) {
+	var orders []InvalidOrder
+	if len(orderIds) == 0 {
+		return orders, nil
+	}
+	err := dao.DB.WithContext(ctx).Table(InvalidOrderTableName(chain)).
+		Select("id, order_id, collection_address, token_id, maker, reason, check_time").
+		Where("order_id in (?)", orderIds).
+		Scan(&orders).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query invalid orders")
+	}
+	return orders, nil
+}
+
+// 移除已恢复有效的挂单记录
+func (dao *Dao) RemoveInvalidOrders(ctx context.Context, chain string, orderIds []string) error {
+	if len(orderIds) == 0 {
+		return nil
+	}
+	err := dao.DB.WithContext(ctx).Table(InvalidOrderTableName(chain)).
+		Where("order_id in (?)", orderIds).
+		Delete(&InvalidOrder{}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on remove invalid orders")
+	}
+	return nil
+}
+
+// 移除已成交、已取消或已过期挂单的无效记录
+// 这些订单不再参与地板价和上架数量的计算，无需继续保留
+func (dao *Dao) RemoveClosedInvalidOrders(ctx context.Context, chain string) error {
+	sql := fmt.Sprintf(`DELETE io FROM %s AS io
+	LEFT JOIN %s AS co ON co.order_id = io.order_id
+WHERE
+	co.order_id IS NULL 
+	OR co.order_status != ? 
+	OR co.expire_time <= ?`, InvalidOrderTableName(chain), multi.OrderTableName(chain))
+	err := dao.DB.WithContext(ctx).Exec(sql, multi.OrderStatusActive, time.Now().Unix()).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on remove closed invalid orders")
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package dao
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// 发件箱事件状态
+const (
+	OutboxPending = 0
+	OutboxSent    = 1
+	OutboxFailed  = 2
+)
+
+// 待发送给ordermanager的事件
+// 与产生事件的数据变更在同一事务中写入，由relay异步发送。dedup_key唯一，
+// 未发送的相同事件只保留一条，重复写入时递增revision，发送后dedup_key追加id释放，之后相同事件可再次写入
+type OutboxEvent struct {
+	Id                int64           `gorm:"column:id" json:"id"`
+	Chain             string          `gorm:"column:chain" json:"chain"`
+	EventType         int             `gorm:"column:event_type" json:"event_type"`
+	CollectionAddress string          `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string          `gorm:"column:token_id" json:"token_id"`
+	OrderId           string          `gorm:"column:order_id" json:"order_id"`
+	Price             decimal.Decimal `gorm:"column:price" json:"price"`
+	DedupKey          string          `gorm:"column:dedup_key" json:"dedup_key"`
+	Revision          int             `gorm:"column:revision" json:"revision"`
+	Status            int             `gorm:"column:status" json:"status"`
+	Attempts          int             `gorm:"column:attempts" json:"attempts"`
+	NextRetryTime     int64           `gorm:"column:next_retry_time" json:"next_retry_time"`
+	LastError         string          `gorm:"column:last_error" json:"last_error"`
+	CreateTime        int64           `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64           `gorm:"column:update_time" json:"update_time"`
+}
+
+func OutboxEventTableName() string {
+	return "ob_event_outbox"
+}
+
+// 各链已生成地板价事件的最大activity id，与写入的发件箱事件在同一事务中更新
+// Gaps为尚未出现的activity id的JSON数组
+type OutboxCursor struct {
+	Chain          string `gorm:"column:chain" json:"chain"`
+	LastActivityId int64  `gorm:"column:last_activity_id" json:"last_activity_id"`
+	Gaps           string `gorm:"column:gaps" json:"gaps"`
+	UpdateTime     int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func OutboxCursorTableName() string {
+	return "ob_event_outbox_cursor"
+}
+
+// 查询链的activity游标，不存在时返回nil
+func (dao *Dao) QueryOutboxCursor(ctx context.Context, chain string) (*OutboxCursor, error) {
+	var cursors []OutboxCursor
+	err := dao.DB.WithContext(ctx).Table(OutboxCursorTableName()).
+		Where("chain = ?", chain).
+		Limit(1).
+		Find(&cursors).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query outbox cursor")
+	}
+	if len(cursors) == 0 {
+		return nil, nil
+	}
+	return &cursors[0], nil
+}
+
+// 保存链的activity游标
+func (dao *Dao) SaveOutboxCursor(ctx context.Context, chain string, lastActivityId int64, gaps string) error {
+	err := dao.DB.WithContext(ctx).Table(OutboxCursorTableName()).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain"}},
+			DoUpdates: clause.AssignmentColumns([]string{"last_activity_id", "gaps", "update_time"}),
+		}).
+		Create(&OutboxCursor{Chain: chain, LastActivityId: lastActivityId, Gaps: gaps, UpdateTime: time.Now().Unix()}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on save outbox cursor")
+	}
+	return nil
+}
+
+// 写入发件箱事件，已有相同的未发送事件时递增revision，并将下次发送时间提前到本次写入的时间
+func (dao *Dao) AddOutboxEvents(ctx context.Context, events []OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	err := dao.DB.WithContext(ctx).Table(OutboxEventTableName()).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "dedup_key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"revision":        gorm.Expr("revision + 1"),
+				"next_retry_time": gorm.Expr("LEAST(next_retry_time, VALUES(next_retry_time))"),
+				"update_time":     gorm.Expr("VALUES(update_time)"),
+			}),
+		}).
+		Create(&events).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create outbox events")
+	}
+	return nil
+}
+
+// 查询到期待发送的事件
+func (dao *Dao) QueryPendingOutboxEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := dao.DB.WithContext(ctx).Table(OutboxEventTableName()).
+		Where("status = ? and next_retry_time <= ?", OutboxPending, time.Now().Unix()).
+		Order("id asc").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query pending outbox events")
+	}
+	return events, nil
+}
+
+// 更新事件发送结果，发送成功或最终失败后释放dedup_key
+// 只在revision与读取时一致时更新，发送期间事件被再次写入时返回false，事件保持待发送
+func (dao *Dao) UpdateOutboxEvent(ctx context.Context, event *OutboxEvent) (bool, error) {
+	updates := map[string]interface{}{
+		"price":           event.Price,
+		"status":          event.Status,
+		"attempts":        event.Attempts,
+		"next_retry_time": event.NextRetryTime,
+		"last_error":      event.LastError,
+		"update_time":     event.UpdateTime,
+	}
+	if event.Status != OutboxPending {
+		updates["dedup_key"] = gorm.Expr("concat(dedup_key, '#', id)")
+	}
+	result := dao.DB.WithContext(ctx).Table(OutboxEventTableName()).
+		Where("id = ? and status = ? and revision = ?", event.Id, OutboxPending, event.Revision).
+		Updates(updates)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on update outbox event")
+	}
+	return result.RowsAffected > 0, nil
+}
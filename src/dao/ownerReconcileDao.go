@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// 所有者不一致原因
+const (
+	DiscrepancyOwnerChanged = "owner_changed" // 数据库中的所有者与链上不一致
+	DiscrepancyTokenBurned  = "token_burned"  // 链上ownerOf返回零地址，token已销毁
+)
+
+// 所有者对账发现的不一致记录
+type OwnerDiscrepancy struct {
+	Id                int64  `gorm:"column:id" json:"id"`
+	ChainId           int    `gorm:"column:chain_id" json:"chain_id"`
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string `gorm:"column:token_id" json:"token_id"`
+	DbOwner           string `gorm:"column:db_owner" json:"db_owner"`
+	ChainOwner        string `gorm:"column:chain_owner" json:"chain_owner"`
+	Reason            string `gorm:"column:reason" json:"reason"`
+	InvalidOrders     int    `gorm:"column:invalid_orders" json:"invalid_orders"` // 因此失效的挂单数
+	CreateTime        int64  `gorm:"column:create_time" json:"create_time"`
+}
+
+func OwnerDiscrepancyTableName() string {
+	return "ob_owner_discrepancy"
+}
+
+// 按id顺序分批查询item
+func (dao *Dao) QueryItemsAfter(ctx context.Context, chain string, lastId int64, limit int) ([]multi.Item, error) {
+	var items []multi.Item
+	err := dao.DB.WithContext(ctx).Table(multi.ItemTableName(chain)).
+		Select("id, collection_address, token_id, owner").
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Scan(&items).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query items")
+	}
+	return items, nil
+}
+
+// 查询指定token的有效挂单
+func (dao *Dao) QueryActiveListingsByTokens(ctx context.Context, chain, collectionAddr string, tokenIds []string) ([]multi.Order, error) {
+	var orders []multi.Order
+	if len(tokenIds) == 0 {
+		return orders, nil
+	}
+	err := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("order_id, collection_address, token_id, maker").
+		Where("collection_address = ? and token_id in (?) and order_type = ? and order_status = ? and expire_time > ?",
+			collectionAddr, tokenIds, multi.ListingOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Scan(&orders).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query active listings")
+	}
+	return orders, nil
+}
+
+// 记录不一致
+func (dao *Dao) AddOwnerDiscrepancies(ctx context.Context, discrepancies []OwnerDiscrepancy) error {
+	if len(discrepancies) == 0 {
+		return nil
+	}
+	if err := dao.DB.WithContext(ctx).Table(OwnerDiscrepancyTableName()).Create(&discrepancies).Error; err != nil {
+		return errors.Wrap(err, "failed on create owner discrepancies")
+	}
+	return nil
+}
+
+// 分页查询不一致记录，chainId为0、collectionAddr为空时不过滤
+func (dao *Dao) QueryOwnerDiscrepancies(ctx context.Context, chainId int, collectionAddr string, page, pageSize int) ([]OwnerDiscrepancy, int64, error) {
+	var discrepancies []OwnerDiscrepancy
+	var count int64
+	db := dao.DB.WithContext(ctx).Table(OwnerDiscrepancyTableName())
+	if chainId > 0 {
+		db = db.Where("chain_id = ?", chainId)
+	}
+	if collectionAddr != "" {
+		db = db.Where("collection_address = ?", collectionAddr)
+	}
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count owner discrepancies")
+	}
+	err := db.Order("id desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&discrepancies).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query owner discrepancies")
+	}
+	return discrepancies, count, nil
+}
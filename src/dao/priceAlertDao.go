@@ -0,0 +1,145 @@
+package dao
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// 价格提醒类型
+const (
+	PriceAlertFloorAbove      = "floor_above"       // 地板价高于阈值
+	PriceAlertFloorBelow      = "floor_below"       // 地板价低于阈值
+	PriceAlertBidAbove        = "bid_above"         // 集合最高出价高于阈值
+	PriceAlertBidBelow        = "bid_below"         // 集合最高出价低于阈值
+	PriceAlertItemListedBelow = "item_listed_below" // 指定item挂单价低于阈值
+)
+
+// 用户价格提醒规则
+// triggered记录当前是否处于已触发状态，价格回到阈值另一侧超过回差后才重新生效，避免价格在阈值附近波动时重复提醒
+type PriceAlert struct {
+	Id                int64           `gorm:"column:id" json:"id"`
+	Owner             string          `gorm:"column:owner" json:"owner"`
+	ChainId           int             `gorm:"column:chain_id" json:"chain_id"`
+	CollectionAddress string          `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string          `gorm:"column:token_id" json:"token_id"`
+	AlertType         string          `gorm:"column:alert_type" json:"alert_type"`
+	Threshold         decimal.Decimal `gorm:"column:threshold" json:"threshold"`
+	WebhookId         int64           `gorm:"column:webhook_id" json:"webhook_id"` // 同时推送到该webhook，0表示不推送
+	Enable            bool            `gorm:"column:enable" json:"enable"`
+	Triggered         bool            `gorm:"column:triggered" json:"triggered"`
+	LastValue         decimal.Decimal `gorm:"column:last_value" json:"last_value"`
+	LastTriggerTime   int64           `gorm:"column:last_trigger_time" json:"last_trigger_time"`
+	CreateTime        int64           `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64           `gorm:"column:update_time" json:"update_time"`
+}
+
+func PriceAlertTableName() string {
+	return "ob_price_alert"
+}
+
+// 新增价格提醒
+func (dao *Dao) AddPriceAlert(ctx context.Context, alert *PriceAlert) error {
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).Create(alert).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create price alert")
+	}
+	return nil
+}
+
+// 查询用户的价格提醒
+func (dao *Dao) QueryUserPriceAlerts(ctx context.Context, owners []string) ([]PriceAlert, error) {
+	var alerts []PriceAlert
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("owner in (?)", owners).
+		Order("id desc").
+		Find(&alerts).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query user price alerts")
+	}
+	return alerts, nil
+}
+
+// 统计用户的价格提醒数量
+func (dao *Dao) CountUserPriceAlerts(ctx context.Context, owners []string) (int64, error) {
+	var count int64
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("owner in (?)", owners).
+		Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on count user price alerts")
+	}
+	return count, nil
+}
+
+// 查询用户的指定价格提醒，不存在时返回nil
+func (dao *Dao) QueryUserPriceAlert(ctx context.Context, owners []string, id int64) (*PriceAlert, error) {
+	var alerts []PriceAlert
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("id = ? and owner in (?)", id, owners).
+		Limit(1).
+		Find(&alerts).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query price alert")
+	}
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+	return &alerts[0], nil
+}
+
+// 更新价格提醒规则，规则变化后重置触发状态
+func (dao *Dao) UpdatePriceAlert(ctx context.Context, alert *PriceAlert) error {
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("id = ?", alert.Id).
+		Updates(map[string]interface{}{
+			"alert_type":  alert.AlertType,
+			"threshold":   alert.Threshold,
+			"webhook_id":  alert.WebhookId,
+			"enable":      alert.Enable,
+			"triggered":   false,
+			"update_time": alert.UpdateTime,
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on update price alert")
+	}
+	return nil
+}
+
+// 删除价格提醒
+func (dao *Dao) DeletePriceAlert(ctx context.Context, id int64) error {
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("id = ?", id).
+		Delete(&PriceAlert{}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on delete price alert")
+	}
+	return nil
+}
+
+// 查询所有生效的价格提醒
+func (dao *Dao) QueryEnabledPriceAlerts(ctx context.Context) ([]PriceAlert, error) {
+	var alerts []PriceAlert
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("enable = ?", true).
+		Find(&alerts).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query enabled price alerts")
+	}
+	return alerts, nil
+}
+
+// 更新价格提醒的触发状态
+func (dao *Dao) UpdatePriceAlertState(ctx context.Context, alert *PriceAlert) error {
+	err := dao.DB.WithContext(ctx).Table(PriceAlertTableName()).
+		Where("id = ?", alert.Id).
+		Updates(map[string]interface{}{
+			"triggered":         alert.Triggered,
+			"last_value":        alert.LastValue,
+			"last_trigger_time": alert.LastTriggerTime,
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on update price alert state")
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package dao
 
 import (
 	"context"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"strings"
 	"time"
 )
 
@@ -15,16 +18,35 @@ type CollectionTrade struct {
 	VolumeChange    int             `json:"volume_change"`
 	PreFlooPrice    decimal.Decimal `json:"pre_fool_price"`
 	FlooChange      int             `json:"fool_change"`
+	MaxPrice        decimal.Decimal `json:"max_price"` // 最高成交价
+	// 无法换算为原生币、未计入统计的币种
+	SkippedCurrencies []string `json:"skipped_currencies,omitempty"`
 }
 type TradeStats struct {
 	CollectionAddress string
 	ItemCount         int64
 	Volume            decimal.Decimal
 	FloorPrice        decimal.Decimal
+	MaxPrice          decimal.Decimal
+	SkippedCurrencies []string
+	hasFloor          bool
+}
+
+// 记录无法换算为原生币的币种，同一币种只记录一次
+func (dao *Dao) skipCurrency(ctx context.Context, chain string, skipped []string, currencyAddr string, err error) []string {
+	xzap.WithContext(ctx).Warn("skip unconvertible currency", zap.String("chain", chain),
+		zap.String("currency", currencyAddr), zap.Error(err))
+	for _, addr := range skipped {
+		if strings.EqualFold(addr, currencyAddr) {
+			return skipped
+		}
+	}
+	return append(skipped, strings.ToLower(currencyAddr))
 }
 
 type periodEpochMap map[string]int
 
+// 时间段对应的5分钟时间桶数量
 var periodToEpoch = periodEpochMap{
 	"15m": 3,
 	"1h":  12,
@@ -35,161 +57,232 @@ var periodToEpoch = periodEpochMap{
 	"30d": 8640,
 }
 
-// 获取指定时间段内集合的交易统计信息
-func (dao *Dao) GetTradeInfoByCollection(chain, collectionAddr, period string) (*CollectionTrade, error) {
-	//查询当前时间段的交易信息
-	var tradeCount int64
-	var totalVolume decimal.Decimal
-	var flooPrice decimal.Decimal
-
-	//获取时间段对应的epoch值
+// 时间段对应的时间桶范围，当前时间段为(start, end]，上一个时间段为(prevStart, start]
+// end为当前未结束的时间桶，时间段按时间桶对齐
+func periodBucketRange(period string) (prevStart, start, end int64, err error) {
 	epoch, ok := periodToEpoch[period]
 	if !ok {
-		return nil, errors.Errorf("invalid period: %s", period)
-	}
-	//计算查询的时间范围
-	startTime := time.Now().Add(-time.Duration(epoch) * time.Minute)
-	endTime := time.Now()
-
-	//统计当前时间段内的交易数量和交易总额
-	err := dao.DB.WithContext(dao.ctx).Table(multi.ActivityTableName(chain)).
-		Select("COUNT(*) as trade_count,COALESCE(SUM(price),0) as total_volume").
-		Where("collection_address = ? and activity_type = ? and event_time >= ? and event_time <= ?",
-			collectionAddr, multi.Sale, startTime, endTime).
-		Row().Scan(&tradeCount, &totalVolume)
+		return 0, 0, 0, errors.Errorf("invalid period: %s", period)
+	}
+	end = TradeStatsBucketOf(time.Now().Unix())
+	start = end - int64(epoch)*TradeStatsBucketSeconds
+	prevStart = start - int64(epoch)*TradeStatsBucketSeconds
+	return prevStart, start, end, nil
+}
+
+// 按币种分组的成交统计
+type currencyTradeStats struct {
+	CollectionAddress string
+	CurrencyAddress   string
+	ItemCount         int64
+	Volume            decimal.Decimal
+	FloorPrice        decimal.Decimal
+	MaxPrice          decimal.Decimal
+}
+
+// 汇总时间桶(startBucket, endBucket]内的成交数量、成交额、最低和最高成交价，按集合和币种分组
+// collectionAddr为空时统计所有集合；时间桶未汇总到最新时直接统计activity表
+func (dao *Dao) queryCurrencyTradeStats(ctx context.Context, chain, collectionAddr string, startBucket, endBucket int64) ([]currencyTradeStats, error) {
+	ready, err := dao.tradeStatsReady(ctx, chain)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get trade count and volume")
+		return nil, errors.Wrap(err, "failed on check trade stats cursor")
+	}
+	if !ready {
+		return dao.queryActivityTradeStats(ctx, chain, collectionAddr, startBucket, endBucket)
 	}
-	//获取当前时间段内的地板价（交易最低价）
-	err = dao.DB.WithContext(dao.ctx).Table(multi.ActivityTableName(chain)).
-		Select("COALESCE(MIN(price),0)").
-		Where("collection_address = ? and activity_type = ? and event_time >= ? and event_time <= ?",
-			collectionAddr, multi.Sale, startTime, endTime).
-		Row().Scan(&flooPrice)
+	var stats []currencyTradeStats
+	db := dao.DB.WithContext(ctx).Table(TradeStatsBucketTableName()).
+		Select("collection_address, currency_address, COALESCE(SUM(item_count), 0) as item_count, "+
+			"COALESCE(SUM(volume), 0) as volume, COALESCE(MIN(min_price), 0) as floor_price, "+
+			"COALESCE(MAX(max_price), 0) as max_price").
+		Where("chain = ? AND bucket_time > ? AND bucket_time <= ?", chain, startBucket, endBucket)
+	if collectionAddr != "" {
+		db = db.Where("collection_address = ?", collectionAddr)
+	}
+	err = db.Group("collection_address, currency_address").Find(&stats).Error
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get floor price")
-	}
-
-	//计算上一个时间段的时间范围
-	prevStartTime := startTime.Add(-time.Duration(epoch) * time.Minute)
-	prevEndTime := startTime
-	//上一个时间段的交易总额
-	var prevVolume decimal.Decimal
-	//上一个时间段的地板价
-	var prevFlooPrice decimal.Decimal
-	//获取上一个时间段内的交易总额
-	err = dao.DB.WithContext(dao.ctx).Table(multi.ActivityTableName(chain)).
-		Select("COALESCE(SUM(price),0)").
-		Where("collection_address = ? and activity_type = ? and event_time >= ? and event_time <= ?",
-			collectionAddr, multi.Sale, prevStartTime, prevEndTime).
-		Row().Scan(&prevVolume)
+		return nil, errors.Wrap(err, "failed on get trade stats")
+	}
+	return stats, nil
+}
+
+// 直接由activity表统计时间桶(startBucket, endBucket]内的成交，即event_time在[startBucket+桶长, endBucket+桶长)内
+func (dao *Dao) queryActivityTradeStats(ctx context.Context, chain, collectionAddr string, startBucket, endBucket int64) ([]currencyTradeStats, error) {
+	var stats []currencyTradeStats
+	db := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
+		Select("collection_address, currency_address, COUNT(*) as item_count, "+
+			"COALESCE(SUM(price), 0) as volume, COALESCE(MIN(price), 0) as floor_price, "+
+			"COALESCE(MAX(price), 0) as max_price").
+		Where("activity_type = ? AND event_time >= ? AND event_time < ?", multi.Sale,
+			startBucket+TradeStatsBucketSeconds, endBucket+TradeStatsBucketSeconds)
+	if collectionAddr != "" {
+		db = db.Where("collection_address = ?", collectionAddr)
+	}
+	err := db.Group("collection_address, currency_address").Scan(&stats).Error
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get previous volume")
+		return nil, errors.Wrap(err, "failed on get activity trade stats")
 	}
-	//获取上一个时间段内的地板价
-	err = dao.DB.WithContext(dao.ctx).Table(multi.ActivityTableName(chain)).
-		Select("COALESCE(MIN(price),0)").
-		Where("collection_address = ? and activity_type = ? and event_time >= ? and event_time <= ?",
-			collectionAddr, multi.Sale, prevStartTime, prevEndTime).
-		Row().Scan(&prevFlooPrice)
+	return stats, nil
+}
+
+// 将各币种的统计换算为原生币后按集合合并
+// 无法换算的币种整行跳过，成交数量、成交额、地板价和最高成交价均不计入，跳过的币种记录在SkippedCurrencies中
+func (dao *Dao) mergeTradeStats(ctx context.Context, chain string, stats []currencyTradeStats) map[string]*TradeStats {
+	merged := make(map[string]*TradeStats)
+	for _, stat := range stats {
+		key := strings.ToLower(stat.CollectionAddress)
+		m, ok := merged[key]
+		if !ok {
+			m = &TradeStats{CollectionAddress: stat.CollectionAddress}
+			merged[key] = m
+		}
+
+		volume, err := dao.Converter.ToNative(ctx, chain, stat.CurrencyAddress, stat.Volume)
+		if err != nil {
+			m.SkippedCurrencies = dao.skipCurrency(ctx, chain, m.SkippedCurrencies, stat.CurrencyAddress, err)
+			continue
+		}
+		floorPrice, err := dao.Converter.ToNative(ctx, chain, stat.CurrencyAddress, stat.FloorPrice)
+		if err != nil {
+			m.SkippedCurrencies = dao.skipCurrency(ctx, chain, m.SkippedCurrencies, stat.CurrencyAddress, err)
+			continue
+		}
+		maxPrice, err := dao.Converter.ToNative(ctx, chain, stat.CurrencyAddress, stat.MaxPrice)
+		if err != nil {
+			m.SkippedCurrencies = dao.skipCurrency(ctx, chain, m.SkippedCurrencies, stat.CurrencyAddress, err)
+			continue
+		}
+		m.ItemCount += stat.ItemCount
+		m.Volume = m.Volume.Add(volume)
+		if maxPrice.GreaterThan(m.MaxPrice) {
+			m.MaxPrice = maxPrice
+		}
+		if !m.hasFloor || floorPrice.LessThan(m.FloorPrice) {
+			m.FloorPrice = floorPrice
+			m.hasFloor = true
+		}
+	}
+	return merged
+}
+
+// 获取指定时间段内集合的交易统计信息，由5分钟时间桶汇总，成交额和地板价均换算为原生币
+func (dao *Dao) GetTradeInfoByCollection(ctx context.Context, chain, collectionAddr, period string) (*CollectionTrade, error) {
+	//获取当前和上一个时间段的时间桶范围
+	prevStart, start, end, err := periodBucketRange(period)
+	if err != nil {
+		return nil, err
+	}
+
+	//统计当前时间段内的交易数量、交易总额和地板价（交易最低价）
+	stats, err := dao.queryCurrencyTradeStats(ctx, chain, collectionAddr, start, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get trade count and volume")
+	}
+	var current TradeStats
+	if m, ok := dao.mergeTradeStats(ctx, chain, stats)[strings.ToLower(collectionAddr)]; ok {
+		current = *m
+	}
+
+	//统计上一个时间段内的交易总额和地板价
+	prevStats, err := dao.queryCurrencyTradeStats(ctx, chain, collectionAddr, prevStart, start)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get previous floor price")
+		return nil, errors.Wrap(err, "failed to get previous volume")
+	}
+	var prev TradeStats
+	if m, ok := dao.mergeTradeStats(ctx, chain, prevStats)[strings.ToLower(collectionAddr)]; ok {
+		prev = *m
 	}
 
 	//计算交易总额和地板价的变化百分比
 	volumeChange := 0
 	flooPriceChange := 0
 	//如果上一个时间段交易总额不为0
-	if !prevVolume.IsZero() {
-		volumeChangeDecimal := totalVolume.Sub(prevVolume).Div(prevVolume).Mul(decimal.NewFromInt(100))
+	if !prev.Volume.IsZero() {
+		volumeChangeDecimal := current.Volume.Sub(prev.Volume).Div(prev.Volume).Mul(decimal.NewFromInt(100))
 		volumeChange = int(volumeChangeDecimal.IntPart())
 	}
 	//如果上一个时间段地板价不为0
-	if !prevVolume.IsZero() {
-		flooChangeDecimal := flooPrice.Sub(prevFlooPrice).Div(prevFlooPrice).Mul(decimal.NewFromInt(100))
+	if !prev.FloorPrice.IsZero() {
+		flooChangeDecimal := current.FloorPrice.Sub(prev.FloorPrice).Div(prev.FloorPrice).Mul(decimal.NewFromInt(100))
 		flooPriceChange = int(flooChangeDecimal.IntPart())
 	}
 
 	// 返回集合交易统计信息
 	return &CollectionTrade{
-		ContractAddress: collectionAddr,
-		ItemCount:       tradeCount,
-		Volume:          totalVolume,
-		VolumeChange:    volumeChange,
-		PreFlooPrice:    prevFlooPrice,
-		FlooChange:      flooPriceChange,
+		ContractAddress:   collectionAddr,
+		ItemCount:         current.ItemCount,
+		Volume:            current.Volume,
+		VolumeChange:      volumeChange,
+		PreFlooPrice:      prev.FloorPrice,
+		FlooChange:        flooPriceChange,
+		MaxPrice:          current.MaxPrice,
+		SkippedCurrencies: current.SkippedCurrencies,
 	}, nil
 }
 
-// 获取指定集合的总交易量
-func (dao *Dao) QueryCollectionVolume(ctx context.Context, chain, collectionAddr string) (decimal.Decimal, error) {
-	var volume decimal.Decimal
+// 获取指定集合的总交易量，换算为原生币，无法换算的币种不计入，并返回跳过的币种
+func (dao *Dao) QueryCollectionVolume(ctx context.Context, chain, collectionAddr string) (decimal.Decimal, []string, error) {
+	var volumes []struct {
+		CurrencyAddress string
+		Volume          decimal.Decimal
+	}
 	err := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
-		Select("COALESCE(SUM(price), 0)").
+		Select("currency_address, COALESCE(SUM(price), 0) as volume").
 		Where("collection_address = ? AND activity_type = ?", collectionAddr, multi.Sale).
-		Row().Scan(&volume)
+		Group("currency_address").
+		Scan(&volumes).Error
 	if err != nil {
-		return decimal.Zero, errors.Wrap(err, "failed to get collection volume")
+		return decimal.Zero, nil, errors.Wrap(err, "failed to get collection volume")
+	}
+	volume := decimal.Zero
+	var skipped []string
+	for _, v := range volumes {
+		native, err := dao.Converter.ToNative(ctx, chain, v.CurrencyAddress, v.Volume)
+		if err != nil {
+			skipped = dao.skipCurrency(ctx, chain, skipped, v.CurrencyAddress, err)
+			continue
+		}
+		volume = volume.Add(native)
 	}
-	return volume, nil
+	return volume, skipped, nil
 }
 
-// 根据Activity获取集合排行榜信息
-func (dao *Dao) GetCollectionRankingByActivity(chain, period string) ([]*CollectionTrade, error) {
-	//1、解析时间段，获取时间对应的epoch
-	epoch, ok := periodToEpoch[period]
-	if !ok {
-		return nil, errors.Errorf("invalid period: %s", period)
-	}
-	//计算当前查询时间段
-	startTime := time.Now().Add(-time.Duration(epoch) * time.Minute)
-	endTime := time.Now()
-	//计算上一个时间段
-	prevStartTime := startTime.Add(-time.Duration(epoch) * time.Minute)
-	prevEndTime := startTime
-
-	//2、获取当前时间段的交易统计
-	var currentStats []TradeStats
-	err := dao.DB.WithContext(dao.ctx).
-		Table(multi.ActivityTableName(chain)).
-		Select("collection_address, COUNT(*) as item_count, COALESCE(SUM(price), 0) as volume, COALESCE(MIN(price), 0) as floor_price").
-		Where("activity_type = ? AND event_time >= ? AND event_time <= ?", multi.Sale, startTime, endTime).
-		Group("collection_address").
-		Find(&currentStats).Error
+// 根据成交统计时间桶获取集合排行榜信息
+func (dao *Dao) GetCollectionRankingByActivity(ctx context.Context, chain, period string) ([]*CollectionTrade, error) {
+	//1、解析时间段，获取当前和上一个时间段的时间桶范围
+	prevStart, start, end, err := periodBucketRange(period)
+	if err != nil {
+		return nil, err
+	}
+
+	//2、获取当前时间段的交易统计，各币种换算为原生币
+	stats, err := dao.queryCurrencyTradeStats(ctx, chain, "", start, end)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get current stats")
 	}
+	currentStats := dao.mergeTradeStats(ctx, chain, stats)
 
 	//3、获取上一个时间段的交易统计
-	var prevStats []TradeStats
-	err = dao.DB.WithContext(dao.ctx).
-		Table(multi.ActivityTableName(chain)).
-		Select("collection_address, COUNT(*) as item_count, COALESCE(SUM(price), 0) as volume, COALESCE(MIN(price), 0) as floor_price").
-		Where("activity_type = ? AND event_time >= ? AND event_time <= ?", multi.Sale, prevStartTime, prevEndTime).
-		Group("collection_address").
-		Find(&prevStats).Error
+	prevStats, err := dao.queryCurrencyTradeStats(ctx, chain, "", prevStart, start)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get prev stats")
 	}
-	//将数据构建成map结构
-	prevStatsMap := make(map[string]TradeStats)
-	for _, stat := range prevStats {
-		prevStatsMap[stat.CollectionAddress] = stat
-	}
+	prevStatsMap := dao.mergeTradeStats(ctx, chain, prevStats)
 
 	//4、构建返回参数
 	var result []*CollectionTrade
 	for _, curr := range currentStats {
 		trade := &CollectionTrade{
-			ContractAddress: curr.CollectionAddress,
-			ItemCount:       curr.ItemCount,
-			Volume:          curr.Volume,
-			VolumeChange:    0,
-			PreFlooPrice:    decimal.Zero,
-			FlooChange:      0,
+			ContractAddress:   curr.CollectionAddress,
+			ItemCount:         curr.ItemCount,
+			Volume:            curr.Volume,
+			VolumeChange:      0,
+			PreFlooPrice:      decimal.Zero,
+			FlooChange:        0,
+			SkippedCurrencies: curr.SkippedCurrencies,
 		}
 		//计算变化率，(当前-上个)/上个
-		if prev, ok := prevStatsMap[curr.CollectionAddress]; ok {
+		if prev, ok := prevStatsMap[strings.ToLower(curr.CollectionAddress)]; ok {
 			trade.PreFlooPrice = prev.FloorPrice
 
 			if !prev.Volume.IsZero() {
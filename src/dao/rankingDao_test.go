@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/price"
+	"context"
+	"github.com/shopspring/decimal"
+	"reflect"
+	"testing"
+)
+
+func TestMergeTradeStats(t *testing.T) {
+	const (
+		chain   = "sepolia"
+		weth    = "0xfff9976782d46cc05630d1f6ebab18b2324d6b14"
+		unknown = "0x00000000000000000000000000000000000000FF"
+	)
+	registry := price.NewRegistry([]*config.CurrencyCfg{
+		{ChainId: 11155111, Address: price.ZeroAddress, Symbol: "ETH", Native: true},
+		{ChainId: 11155111, Address: weth, Symbol: "WETH"},
+	})
+	oracle, err := price.NewStaticOracle(map[string]string{"ETH": "2000", "WETH": "2000"})
+	if err != nil {
+		t.Fatalf("NewStaticOracle: %v", err)
+	}
+	d := &Dao{Converter: price.NewConverter(registry, oracle)}
+	dec := decimal.RequireFromString
+
+	stats := []currencyTradeStats{
+		{CollectionAddress: "0xA", CurrencyAddress: price.ZeroAddress, ItemCount: 2, Volume: dec("3"), FloorPrice: dec("1"), MaxPrice: dec("2")},
+		{CollectionAddress: "0xa", CurrencyAddress: weth, ItemCount: 1, Volume: dec("0"), FloorPrice: dec("0"), MaxPrice: dec("0")},
+		{CollectionAddress: "0xa", CurrencyAddress: unknown, ItemCount: 5, Volume: dec("10"), FloorPrice: dec("2"), MaxPrice: dec("8")},
+		{CollectionAddress: "0xb", CurrencyAddress: unknown, ItemCount: 1, Volume: dec("1"), FloorPrice: dec("1"), MaxPrice: dec("1")},
+	}
+	merged := d.mergeTradeStats(context.Background(), chain, stats)
+
+	a := merged["0xa"]
+	if a == nil {
+		t.Fatalf("collection 0xa missing")
+	}
+	// 无法换算的币种整行跳过，价格为0的成交也是有效的地板价
+	if a.ItemCount != 3 || !a.Volume.Equal(dec("3")) || !a.FloorPrice.Equal(dec("0")) || !a.MaxPrice.Equal(dec("2")) {
+		t.Errorf("0xa = count %d volume %s floor %s max %s, want 3 3 0 2", a.ItemCount, a.Volume, a.FloorPrice, a.MaxPrice)
+	}
+	if want := []string{"0x00000000000000000000000000000000000000ff"}; !reflect.DeepEqual(a.SkippedCurrencies, want) {
+		t.Errorf("0xa skipped = %v, want %v", a.SkippedCurrencies, want)
+	}
+	b := merged["0xb"]
+	if b == nil || b.ItemCount != 0 || !b.Volume.IsZero() || len(b.SkippedCurrencies) != 1 {
+		t.Errorf("0xb = %+v, want empty stats with one skipped currency", b)
+	}
+}
@@ -0,0 +1,198 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 从库不可用时的复制延迟
+const replicaLagUnknown = -1
+
+type primaryCtxKey struct{}
+
+// WithPrimary 返回强制读主库的ctx，用于写入后立即读取的场景
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// IsPrimaryForced ctx是否强制读主库
+func IsPrimaryForced(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	forced, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return forced
+}
+
+// ReplicaStatus 从库复制状态
+type ReplicaStatus struct {
+	Name      string `json:"name"`
+	Lag       int64  `json:"lag"` // 复制延迟，单位秒，-1表示不可用
+	Available bool   `json:"available"`
+	CheckTime int64  `json:"check_time"`
+}
+
+type replica struct {
+	name      string
+	db        *gorm.DB
+	pool      gorm.ConnPool
+	lag       int64 // 最近一次检查的复制延迟
+	checkTime int64
+}
+
+// ReplicaResolver 读写分离
+// 1. 查询(Find/Scan/Row)轮询分配到复制延迟不超过maxLag的从库
+// 2. 写入、事务内的查询、加锁的查询和强制读主库的ctx使用主库
+// 3. 从库延迟由CheckLag定时更新，未检查或检查失败的从库不参与分配，没有可用从库时使用主库
+type ReplicaResolver struct {
+	primary  gorm.ConnPool
+	replicas []*replica
+	maxLag   int64
+	next     uint64
+	mu       sync.RWMutex
+}
+
+// NewReplicaResolver 在主库上注册查询路由，names与replicas一一对应
+func NewReplicaResolver(primary *gorm.DB, names []string, replicas []*gorm.DB, maxLag int64) (*ReplicaResolver, error) {
+	r := &ReplicaResolver{
+		primary: primary.ConnPool,
+		maxLag:  maxLag,
+	}
+	for i, db := range replicas {
+		r.replicas = append(r.replicas, &replica{
+			name: names[i],
+			db:   db,
+			pool: db.ConnPool,
+			lag:  replicaLagUnknown,
+		})
+	}
+	if err := primary.Callback().Query().Before("gorm:query").Register("dao:replica_query", r.route); err != nil {
+		return nil, errors.Wrap(err, "failed on register replica query callback")
+	}
+	if err := primary.Callback().Row().Before("gorm:row").Register("dao:replica_row", r.route); err != nil {
+		return nil, errors.Wrap(err, "failed on register replica row callback")
+	}
+	return r, nil
+}
+
+// 为查询选择连接，只替换主库连接，事务和已指定的连接保持不变
+func (r *ReplicaResolver) route(db *gorm.DB) {
+	if db.Statement.ConnPool != r.primary {
+		return
+	}
+	if IsPrimaryForced(db.Statement.Context) {
+		return
+	}
+	if _, ok := db.Statement.Clauses["FOR"]; ok {
+		return
+	}
+	if pool := r.pick(); pool != nil {
+		db.Statement.ConnPool = pool
+	}
+}
+
+// 轮询选择可用的从库
+func (r *ReplicaResolver) pick() gorm.ConnPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var available []*replica
+	for _, rep := range r.replicas {
+		if rep.lag != replicaLagUnknown && rep.lag <= r.maxLag {
+			available = append(available, rep)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&r.next, 1)
+	return available[n%uint64(len(available))].pool
+}
+
+// CheckLag 检查所有从库的复制延迟，返回检查失败的第一个错误
+func (r *ReplicaResolver) CheckLag(ctx context.Context) error {
+	var firstErr error
+	for _, rep := range r.replicas {
+		lag, err := queryReplicaLag(ctx, rep.db)
+		if err != nil {
+			lag = replicaLagUnknown
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "failed on check replica %s", rep.name)
+			}
+		}
+		r.mu.Lock()
+		rep.lag = lag
+		rep.checkTime = time.Now().Unix()
+		r.mu.Unlock()
+	}
+	return firstErr
+}
+
+// Status 返回所有从库的复制状态
+func (r *ReplicaResolver) Status() []ReplicaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var status []ReplicaStatus
+	for _, rep := range r.replicas {
+		status = append(status, ReplicaStatus{
+			Name:      rep.name,
+			Lag:       rep.lag,
+			Available: rep.lag != replicaLagUnknown && rep.lag <= r.maxLag,
+			CheckTime: rep.checkTime,
+		})
+	}
+	return status
+}
+
+// 查询从库的复制延迟，MySQL 8.0.22之前不支持SHOW REPLICA STATUS
+func queryReplicaLag(ctx context.Context, db *gorm.DB) (int64, error) {
+	rows, err := db.WithContext(ctx).Raw("SHOW REPLICA STATUS").Rows()
+	if err != nil {
+		rows, err = db.WithContext(ctx).Raw("SHOW SLAVE STATUS").Rows()
+		if err != nil {
+			return replicaLagUnknown, errors.Wrap(err, "failed on show replica status")
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return replicaLagUnknown, errors.Wrap(err, "failed on get replica status columns")
+	}
+	if !rows.Next() {
+		return replicaLagUnknown, errors.New("replication is not configured")
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return replicaLagUnknown, errors.Wrap(err, "failed on scan replica status")
+	}
+	return parseReplicaLag(columns, values)
+}
+
+// 从复制状态中解析复制延迟，MySQL 8.0.22之后列名为Seconds_Behind_Source
+func parseReplicaLag(columns []string, values []sql.RawBytes) (int64, error) {
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		// 复制线程未运行时为NULL
+		if values[i] == nil {
+			return replicaLagUnknown, errors.New("replication is not running")
+		}
+		lag, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return replicaLagUnknown, errors.Wrap(err, "failed on parse replica lag")
+		}
+		return lag, nil
+	}
+	return replicaLagUnknown, errors.New("replica lag column not found")
+}
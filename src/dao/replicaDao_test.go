@@ -0,0 +1,312 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errFakeConn = errors.New("fake connection")
+
+// 记录执行次数的连接，所有操作都返回错误，只用于判断查询路由到哪个库
+type fakeConnPool struct {
+	mu      sync.Mutex
+	queries int
+	execs   int
+}
+
+func (p *fakeConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errFakeConn
+}
+
+func (p *fakeConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.execs++
+	return nil, errFakeConn
+}
+
+func (p *fakeConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queries++
+	return nil, errFakeConn
+}
+
+func (p *fakeConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p *fakeConnPool) counts() (int, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queries, p.execs
+}
+
+// 只生成sql的方言，连接由fakeConnPool提供
+type fakeDialector struct {
+	pool *fakeConnPool
+}
+
+func (d fakeDialector) Name() string { return "fake" }
+
+func (d fakeDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d fakeDialector) Migrator(db *gorm.DB) gorm.Migrator { return nil }
+
+func (d fakeDialector) DataTypeOf(*schema.Field) string { return "" }
+
+func (d fakeDialector) DefaultValueOf(*schema.Field) clause.Expression { return nil }
+
+func (d fakeDialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	writer.WriteByte('?')
+}
+
+func (d fakeDialector) QuoteTo(writer clause.Writer, str string) { writer.WriteString(str) }
+
+func (d fakeDialector) Explain(sql string, vars ...interface{}) string { return sql }
+
+func openFakeDB(t *testing.T) (*gorm.DB, *fakeConnPool) {
+	pool := &fakeConnPool{}
+	db, err := gorm.Open(fakeDialector{pool: pool}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, pool
+}
+
+// 主库和len(lags)个从库，从库延迟分别为lags
+func newTestReplicaResolver(t *testing.T, maxLag int64, lags ...int64) (*gorm.DB, *fakeConnPool, []*fakeConnPool, *ReplicaResolver) {
+	primary, primaryPool := openFakeDB(t)
+	var names []string
+	var replicaDBs []*gorm.DB
+	var replicaPools []*fakeConnPool
+	for i := range lags {
+		db, pool := openFakeDB(t)
+		names = append(names, fmt.Sprintf("replica%d", i))
+		replicaDBs = append(replicaDBs, db)
+		replicaPools = append(replicaPools, pool)
+	}
+	r, err := NewReplicaResolver(primary, names, replicaDBs, maxLag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, lag := range lags {
+		r.replicas[i].lag = lag
+	}
+	return primary, primaryPool, replicaPools, r
+}
+
+func TestReplicaRouting(t *testing.T) {
+	primary, primaryPool, replicaPools, _ := newTestReplicaResolver(t, 5, 1)
+	replicaPool := replicaPools[0]
+	ctx := context.Background()
+	var dest []map[string]interface{}
+
+	tests := []struct {
+		name        string
+		run         func()
+		wantPrimary int // 主库执行次数
+		wantReplica int // 从库执行次数
+	}{
+		{
+			name:        "find reads replica",
+			run:         func() { primary.WithContext(ctx).Table("t").Find(&dest) },
+			wantReplica: 1,
+		},
+		{
+			name:        "raw scan reads replica",
+			run:         func() { primary.WithContext(ctx).Raw("select 1").Scan(&dest) },
+			wantReplica: 1,
+		},
+		{
+			name:        "forced primary",
+			run:         func() { primary.WithContext(WithPrimary(ctx)).Table("t").Find(&dest) },
+			wantPrimary: 1,
+		},
+		{
+			name: "locking read uses primary",
+			run: func() {
+				primary.WithContext(ctx).Table("t").Clauses(clause.Locking{Strength: "UPDATE"}).Find(&dest)
+			},
+			wantPrimary: 1,
+		},
+		{
+			name:        "write uses primary",
+			run:         func() { primary.WithContext(ctx).Exec("update t set a = 1") },
+			wantPrimary: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primaryQueries, primaryExecs := primaryPool.counts()
+			replicaQueries, replicaExecs := replicaPool.counts()
+			tt.run()
+			q, e := primaryPool.counts()
+			if got := q + e - primaryQueries - primaryExecs; got != tt.wantPrimary {
+				t.Errorf("primary executed %d times, want %d", got, tt.wantPrimary)
+			}
+			q, e = replicaPool.counts()
+			if got := q + e - replicaQueries - replicaExecs; got != tt.wantReplica {
+				t.Errorf("replica executed %d times, want %d", got, tt.wantReplica)
+			}
+		})
+	}
+}
+
+// 事务和已指定的连接不替换
+func TestReplicaRouteKeepsOtherConnPool(t *testing.T) {
+	primary, _, _, r := newTestReplicaResolver(t, 5, 1)
+	tx := &fakeConnPool{}
+	db := primary.Session(&gorm.Session{NewDB: true})
+	db.Statement.ConnPool = tx
+	r.route(db)
+	if db.Statement.ConnPool != tx {
+		t.Error("route should keep non-primary conn pool")
+	}
+}
+
+func TestReplicaPick(t *testing.T) {
+	tests := []struct {
+		name   string
+		lags   []int64
+		maxLag int64
+		want   []int // 连续选择的从库下标，-1表示使用主库
+	}{
+		{name: "round robin", lags: []int64{0, 3}, maxLag: 5, want: []int{1, 0, 1, 0}},
+		{name: "skip lagging replica", lags: []int64{10, 2}, maxLag: 5, want: []int{1, 1, 1}},
+		{name: "lag equal to threshold available", lags: []int64{5}, maxLag: 5, want: []int{0, 0}},
+		{name: "skip unchecked replica", lags: []int64{replicaLagUnknown, 0}, maxLag: 5, want: []int{1, 1}},
+		{name: "fallback to primary", lags: []int64{6, replicaLagUnknown}, maxLag: 5, want: []int{-1, -1}},
+		{name: "no replicas", maxLag: 5, want: []int{-1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, pools, r := newTestReplicaResolver(t, tt.maxLag, tt.lags...)
+			for i, want := range tt.want {
+				got := r.pick()
+				if want < 0 {
+					if got != nil {
+						t.Errorf("pick %d = %v, want primary", i, got)
+					}
+					continue
+				}
+				if got != gorm.ConnPool(pools[want]) {
+					t.Errorf("pick %d did not return replica %d", i, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplicaCheckLagFailure(t *testing.T) {
+	primary, primaryPool, replicaPools, r := newTestReplicaResolver(t, 5, 1)
+	err := r.CheckLag(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "replica0") {
+		t.Fatalf("CheckLag() = %v, want error with replica name", err)
+	}
+	status := r.Status()
+	if len(status) != 1 || status[0].Lag != replicaLagUnknown || status[0].Available || status[0].CheckTime == 0 {
+		t.Errorf("status = %+v, want unavailable replica with check time", status)
+	}
+	// 检查失败后查询回到主库
+	replicaQueries, _ := replicaPools[0].counts()
+	var dest []map[string]interface{}
+	primary.Table("t").Find(&dest)
+	if q, _ := primaryPool.counts(); q != 1 {
+		t.Errorf("primary queries = %d, want 1", q)
+	}
+	if q, _ := replicaPools[0].counts(); q != replicaQueries {
+		t.Errorf("replica queried after failed check")
+	}
+}
+
+func TestReplicaStatus(t *testing.T) {
+	_, _, _, r := newTestReplicaResolver(t, 5, 2, 8, replicaLagUnknown)
+	want := []struct {
+		name      string
+		lag       int64
+		available bool
+	}{
+		{"replica0", 2, true},
+		{"replica1", 8, false},
+		{"replica2", replicaLagUnknown, false},
+	}
+	status := r.Status()
+	if len(status) != len(want) {
+		t.Fatalf("status = %+v", status)
+	}
+	for i, w := range want {
+		if status[i].Name != w.name || status[i].Lag != w.lag || status[i].Available != w.available {
+			t.Errorf("status[%d] = %+v, want %+v", i, status[i], w)
+		}
+	}
+}
+
+func TestParseReplicaLag(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		values  []sql.RawBytes
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:    "source column",
+			columns: []string{"Replica_IO_State", "Seconds_Behind_Source"},
+			values:  []sql.RawBytes{sql.RawBytes("Waiting"), sql.RawBytes("3")},
+			want:    3,
+		},
+		{
+			name:    "master column",
+			columns: []string{"Slave_IO_State", "Seconds_Behind_Master"},
+			values:  []sql.RawBytes{sql.RawBytes("Waiting"), sql.RawBytes("0")},
+			want:    0,
+		},
+		{
+			name:    "replication stopped",
+			columns: []string{"Seconds_Behind_Source"},
+			values:  []sql.RawBytes{nil},
+			want:    replicaLagUnknown,
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			columns: []string{"Seconds_Behind_Source"},
+			values:  []sql.RawBytes{sql.RawBytes("abc")},
+			want:    replicaLagUnknown,
+			wantErr: true,
+		},
+		{
+			name:    "column missing",
+			columns: []string{"Replica_IO_State"},
+			values:  []sql.RawBytes{sql.RawBytes("Waiting")},
+			want:    replicaLagUnknown,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReplicaLag(tt.columns, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lag = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
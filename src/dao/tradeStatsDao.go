@@ -0,0 +1,177 @@
+package dao
+
+import (
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// 成交统计时间桶的长度，单位秒
+const TradeStatsBucketSeconds = 5 * 60
+
+// 集合每5分钟的成交统计，按币种分开统计，查询时换算为原生币后合并
+// (chain, collection_address, currency_address, bucket_time)唯一，bucket_time为时间桶的开始时间
+type TradeStatsBucket struct {
+	Id                int64           `gorm:"column:id" json:"id"`
+	Chain             string          `gorm:"column:chain" json:"chain"`
+	CollectionAddress string          `gorm:"column:collection_address" json:"collection_address"`
+	CurrencyAddress   string          `gorm:"column:currency_address" json:"currency_address"`
+	BucketTime        int64           `gorm:"column:bucket_time" json:"bucket_time"`
+	ItemCount         int64           `gorm:"column:item_count" json:"item_count"`
+	Volume            decimal.Decimal `gorm:"column:volume" json:"volume"`
+	MinPrice          decimal.Decimal `gorm:"column:min_price" json:"min_price"`
+	MaxPrice          decimal.Decimal `gorm:"column:max_price" json:"max_price"`
+	CreateTime        int64           `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64           `gorm:"column:update_time" json:"update_time"`
+}
+
+func TradeStatsBucketTableName() string {
+	return "ob_trade_stats_bucket"
+}
+
+// 每条链的汇总位置，chain唯一，与时间桶在同一事务中更新
+// LastId之前未出现的id(事务未提交或已回滚)记录在Gaps中，之后每次汇总重新检查，超出窗口后丢弃
+type TradeStatsCursor struct {
+	Chain      string `gorm:"column:chain" json:"chain"`
+	LastId     int64  `gorm:"column:last_id" json:"last_id"`
+	Gaps       string `gorm:"column:gaps" json:"gaps"`           // 待重新检查的id，json数组
+	CaughtUp   bool   `gorm:"column:caught_up" json:"caught_up"` // 是否已汇总到最新的activity
+	UpdateTime int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func TradeStatsCursorTableName() string {
+	return "ob_trade_stats_cursor"
+}
+
+// 汇总位置超过该时间未更新时视为汇总停止，单位秒
+const tradeStatsCursorStaleSeconds = 300
+
+// 时间所在时间桶的开始时间
+func TradeStatsBucketOf(t int64) int64 {
+	return t - t%TradeStatsBucketSeconds
+}
+
+// 查询链的汇总位置，未汇总过时返回零值
+func (dao *Dao) QueryTradeStatsCursor(ctx context.Context, chain string) (*TradeStatsCursor, error) {
+	var cursors []TradeStatsCursor
+	err := dao.DB.WithContext(ctx).Table(TradeStatsCursorTableName()).
+		Where("chain = ?", chain).
+		Limit(1).
+		Find(&cursors).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query trade stats cursor")
+	}
+	if len(cursors) == 0 {
+		return &TradeStatsCursor{Chain: chain}, nil
+	}
+	return &cursors[0], nil
+}
+
+// 汇总位置仍为读取时的prev时保存为next，返回是否保存成功
+// 其他实例已推进汇总位置时返回false，调用方需回滚同一事务中累加的时间桶，避免重复累加
+func (dao *Dao) CompareAndSaveTradeStatsCursor(ctx context.Context, prev, next *TradeStatsCursor) (bool, error) {
+	next.UpdateTime = time.Now().Unix()
+	result := dao.DB.WithContext(ctx).Table(TradeStatsCursorTableName()).
+		Where("chain = ? AND last_id = ? AND gaps = ?", next.Chain, prev.LastId, prev.Gaps).
+		Updates(map[string]interface{}{
+			"last_id":     next.LastId,
+			"gaps":        next.Gaps,
+			"caught_up":   next.CaughtUp,
+			"update_time": next.UpdateTime,
+		})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on save trade stats cursor")
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	//没有更新的行时区分：首次汇总尚无记录、内容与原值相同，或已被其他实例推进
+	var cursors []TradeStatsCursor
+	err := dao.DB.WithContext(ctx).Table(TradeStatsCursorTableName()).
+		Where("chain = ?", next.Chain).
+		Limit(1).
+		Find(&cursors).Error
+	if err != nil {
+		return false, errors.Wrap(err, "failed on query trade stats cursor")
+	}
+	if len(cursors) == 0 {
+		// 并发首次写入时主键冲突，事务回滚
+		if err := dao.DB.WithContext(ctx).Table(TradeStatsCursorTableName()).Create(next).Error; err != nil {
+			return false, errors.Wrap(err, "failed on create trade stats cursor")
+		}
+		return true, nil
+	}
+	return cursors[0].LastId == prev.LastId && cursors[0].Gaps == prev.Gaps, nil
+}
+
+// 时间桶是否可用：已汇总到最新且汇总未停止，否则统计直接读取activity表
+func (dao *Dao) tradeStatsReady(ctx context.Context, chain string) (bool, error) {
+	cursor, err := dao.QueryTradeStatsCursor(ctx, chain)
+	if err != nil {
+		return false, err
+	}
+	return cursor.CaughtUp && time.Now().Unix()-cursor.UpdateTime <= tradeStatsCursorStaleSeconds, nil
+}
+
+// 汇总读取的activity字段，包含所有类型，用于发现id的空缺
+const tradeStatsActivityFields = "id, activity_type, collection_address, currency_address, price, event_time"
+
+// 按id升序查询指定id之后的activity
+func (dao *Dao) QueryTradeStatsActivitiesAfter(ctx context.Context, chain string, lastId int64, limit int) ([]multi.Activity, error) {
+	var activities []multi.Activity
+	err := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
+		Select(tradeStatsActivityFields).
+		Where("id > ?", lastId).
+		Order("id asc").
+		Limit(limit).
+		Scan(&activities).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query activities")
+	}
+	return activities, nil
+}
+
+// 按id查询之前空缺的activity
+func (dao *Dao) QueryTradeStatsActivitiesByIds(ctx context.Context, chain string, ids []int64) ([]multi.Activity, error) {
+	var activities []multi.Activity
+	if len(ids) == 0 {
+		return activities, nil
+	}
+	err := dao.DB.WithContext(ctx).Table(multi.ActivityTableName(chain)).
+		Select(tradeStatsActivityFields).
+		Where("id in (?)", ids).
+		Scan(&activities).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query activities by ids")
+	}
+	return activities, nil
+}
+
+// 将成交统计累加到时间桶，时间桶不存在时新增
+func (dao *Dao) AddTradeStatsBuckets(ctx context.Context, buckets []TradeStatsBucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+	err := dao.DB.WithContext(ctx).Table(TradeStatsBucketTableName()).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "chain"}, {Name: "collection_address"},
+				{Name: "currency_address"}, {Name: "bucket_time"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"item_count":  gorm.Expr("item_count + VALUES(item_count)"),
+				"volume":      gorm.Expr("volume + VALUES(volume)"),
+				"min_price":   gorm.Expr("LEAST(min_price, VALUES(min_price))"),
+				"max_price":   gorm.Expr("GREATEST(max_price, VALUES(max_price))"),
+				"update_time": gorm.Expr("VALUES(update_time)"),
+			}),
+		}).
+		Create(&buckets).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on add trade stats buckets")
+	}
+	return nil
+}
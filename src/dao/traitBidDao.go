@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// trait出价订单与trait的关联关系，(order_id, trait, trait_value)唯一
+// 订单表由indexer维护，trait出价在订单表中仍为collection出价，在所有collection出价的查询中照常返回
+type OrderTrait struct {
+	Id                int64  `gorm:"column:id" json:"id"`
+	OrderID           string `gorm:"column:order_id" json:"order_id"`
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`
+	Trait             string `gorm:"column:trait" json:"trait"`
+	TraitValue        string `gorm:"column:trait_value" json:"trait_value"`
+	CreateTime        int64  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func OrderTraitTableName(chain string) string {
+	return fmt.Sprintf("ob_order_trait_%s", chain)
+}
+
+// 查询单个订单信息
+func (dao *Dao) QueryOrderInfo(ctx context.Context, chain, orderId string) (*multi.Order, error) {
+	var order multi.Order
+	err := dao.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("id, collection_address, token_id, order_id, order_type, order_status, maker, "+
+			"price, quantity_remaining, size, expire_time, event_time, salt, marketplace_id").
+		Where("order_id = ?", orderId).
+		Find(&order).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query order info")
+	}
+	return &order, nil
+}
+
+// 查询集合中是否存在拥有指定trait的item
+func (dao *Dao) QueryTraitExists(ctx context.Context, chain, collectionAddr, trait, traitValue string) (bool, error) {
+	var count int64
+	err := dao.DB.WithContext(ctx).Table(multi.ItemTraitTableName(chain)).
+		Where("collection_address = ? and trait = ? and trait_value = ?", collectionAddr, trait, traitValue).
+		Limit(1).
+		Count(&count).Error
+	if err != nil {
+		return false, errors.Wrap(err, "failed on query item trait")
+	}
+	return count > 0, nil
+}
+
+// 保存trait出价：只记录订单对应的trait，不修改订单表
+// 合约不校验trait，订单仍是collection出价，任意item都可以成交，trait只作为出价人的意向展示
+// 重复保存同一个trait时忽略，重试不会产生重复记录
+func (dao *Dao) AddTraitBid(ctx context.Context, chain string, order *multi.Order, trait, traitValue string) error {
+	now := time.Now().UnixMilli()
+	err := dao.DB.WithContext(ctx).Table(OrderTraitTableName(chain)).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&OrderTrait{
+			OrderID:           order.OrderID,
+			CollectionAddress: order.CollectionAddress,
+			Trait:             trait,
+			TraitValue:        traitValue,
+			CreateTime:        now,
+			UpdateTime:        now,
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create order trait")
+	}
+	return nil
+}
+
+// 查询集合的trait出价信息，按trait和价格分组
+func (dao *Dao) QueryCollectionTraitBids(ctx context.Context, chain, collectionAddr string) ([]entity.CollectionTraitBid, error) {
+	var bids []entity.CollectionTraitBid
+	// SQL解释:
+	// 1. 订单表(co)关联订单trait表(cot)
+	// 2. 条件:指定集合、订单类型为collection出价、订单状态为活跃、未过期且有剩余数量
+	// 3. 按trait、trait值、价格分组统计数量、总价值和出价人数
+	err := dao.DB.WithContext(ctx).
+		Table(fmt.Sprintf("%s as co", multi.OrderTableName(chain))).
+		Select(`
+			cot.trait as trait,
+			cot.trait_value as trait_value,
+			co.price as price,
+			sum(co.quantity_remaining) AS size,
+			sum(co.quantity_remaining)*co.price as total,
+			COUNT(DISTINCT co.maker) AS bidders`).
+		Joins(fmt.Sprintf("join %s cot on cot.order_id = co.order_id", OrderTraitTableName(chain))).
+		Where("co.collection_address = ? and co.order_type = ? and co.order_status = ? "+
+			"and co.expire_time > ? and co.quantity_remaining > 0",
+			collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Group("cot.trait, cot.trait_value, co.price").
+		Order("cot.trait, cot.trait_value, co.price desc").
+		Scan(&bids).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection trait bids")
+	}
+	return bids, nil
+}
@@ -49,3 +49,20 @@ func (dao *Dao) QueryCollectionTraitCount(ctx context.Context, chain, collection
 	}
 	return traitCount, nil
 }
+
+// 刷新元数据时用新的trait替换item原有的trait，需在事务中调用
+func (dao *Dao) ReplaceItemTraits(ctx context.Context, chain, collectionAddr, tokenId string, traits []multi.ItemTrait) error {
+	err := dao.DB.WithContext(ctx).Table(multi.ItemTraitTableName(chain)).
+		Where("collection_address = ? and token_id = ?", collectionAddr, tokenId).
+		Delete(&multi.ItemTrait{}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on delete item traits")
+	}
+	if len(traits) == 0 {
+		return nil
+	}
+	if err := dao.DB.WithContext(ctx).Table(multi.ItemTraitTableName(chain)).Create(&traits).Error; err != nil {
+		return errors.Wrap(err, "failed on create item traits")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package dao
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// 用户关注的集合或item，token_id为空表示关注集合
+// (owner, chain_id, collection_address, token_id)唯一
+type Watchlist struct {
+	Id                int64  `gorm:"column:id" json:"id"`
+	Owner             string `gorm:"column:owner" json:"owner"`
+	ChainId           int    `gorm:"column:chain_id" json:"chain_id"`
+	CollectionAddress string `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string `gorm:"column:token_id" json:"token_id"`
+	CreateTime        int64  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime        int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func WatchlistTableName() string {
+	return "ob_watchlist"
+}
+
+// 新增关注，已关注时忽略
+func (dao *Dao) AddWatchlist(ctx context.Context, watch *Watchlist) error {
+	err := dao.DB.WithContext(ctx).Table(WatchlistTableName()).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "owner"}, {Name: "chain_id"}, {Name: "collection_address"}, {Name: "token_id"}},
+			DoNothing: true,
+		}).
+		Create(watch).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create watchlist")
+	}
+	return nil
+}
+
+// 取消关注
+func (dao *Dao) RemoveWatchlist(ctx context.Context, owners []string, chainId int, collectionAddr, tokenId string) (int64, error) {
+	result := dao.DB.WithContext(ctx).Table(WatchlistTableName()).
+		Where("owner in (?) and chain_id = ? and collection_address = ? and token_id = ?",
+			owners, chainId, collectionAddr, tokenId).
+		Delete(&Watchlist{})
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "failed on delete watchlist")
+	}
+	return result.RowsAffected, nil
+}
+
+// 统计用户的关注数量
+func (dao *Dao) CountUserWatchlist(ctx context.Context, owners []string) (int64, error) {
+	var count int64
+	err := dao.DB.WithContext(ctx).Table(WatchlistTableName()).
+		Where("owner in (?)", owners).
+		Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on count watchlist")
+	}
+	return count, nil
+}
+
+// 查询用户的关注列表，chainIds为空时查询所有链
+func (dao *Dao) QueryUserWatchlist(ctx context.Context, owners []string, chainIds []int) ([]Watchlist, error) {
+	var watchlist []Watchlist
+	db := dao.DB.WithContext(ctx).Table(WatchlistTableName()).
+		Where("owner in (?)", owners)
+	if len(chainIds) > 0 {
+		db = db.Where("chain_id in (?)", chainIds)
+	}
+	err := db.Order("id desc").Find(&watchlist).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query watchlist")
+	}
+	return watchlist, nil
+}
@@ -0,0 +1,226 @@
+package dao
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// webhook订阅状态
+const (
+	WebhookStatusActive   = 0
+	WebhookStatusDisabled = 1
+)
+
+// webhook投递状态
+// 投递前先将记录认领为sending，next_retry_time改为认领到期时间，投递进程中断时到期后可被重新认领
+const (
+	WebhookDeliveryPending   = 0
+	WebhookDeliverySucceeded = 1
+	WebhookDeliveryDead      = 2
+	WebhookDeliverySending   = 3
+)
+
+// webhook订阅
+// 过滤条件为逗号分隔的列表，为空表示不过滤
+type Webhook struct {
+	Id                  int64  `gorm:"column:id" json:"id"`
+	Owner               string `gorm:"column:owner" json:"owner"`
+	Url                 string `gorm:"column:url" json:"url"`
+	Secret              string `gorm:"column:secret" json:"-"`
+	EventTypes          string `gorm:"column:event_types" json:"event_types"`
+	ChainIds            string `gorm:"column:chain_ids" json:"chain_ids"`
+	CollectionAddresses string `gorm:"column:collection_addresses" json:"collection_addresses"`
+	WalletAddresses     string `gorm:"column:wallet_addresses" json:"wallet_addresses"`
+	Status              int    `gorm:"column:status" json:"status"`
+	CreateTime          int64  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime          int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func WebhookTableName() string {
+	return "ob_webhook"
+}
+
+// webhook投递记录，(webhook_id, event_id)唯一
+type WebhookDelivery struct {
+	Id             int64  `gorm:"column:id" json:"id"`
+	WebhookId      int64  `gorm:"column:webhook_id" json:"webhook_id"`
+	EventId        string `gorm:"column:event_id" json:"event_id"`
+	EventType      string `gorm:"column:event_type" json:"event_type"`
+	Payload        string `gorm:"column:payload" json:"payload"`
+	Status         int    `gorm:"column:status" json:"status"`
+	Attempts       int    `gorm:"column:attempts" json:"attempts"`
+	NextRetryTime  int64  `gorm:"column:next_retry_time" json:"next_retry_time"`
+	LastStatusCode int    `gorm:"column:last_status_code" json:"last_status_code"`
+	LastError      string `gorm:"column:last_error" json:"last_error"`
+	ClaimToken     string `gorm:"column:claim_token" json:"-"`
+	CreateTime     int64  `gorm:"column:create_time" json:"create_time"`
+	UpdateTime     int64  `gorm:"column:update_time" json:"update_time"`
+}
+
+func WebhookDeliveryTableName() string {
+	return "ob_webhook_delivery"
+}
+
+// 校验是否为支持的activity事件类型
+func IsActivityEventType(eventType string) bool {
+	_, ok := eventTypesToID[eventType]
+	return ok
+}
+
+// 新增webhook订阅
+func (dao *Dao) AddWebhook(ctx context.Context, webhook *Webhook) error {
+	err := dao.DB.WithContext(ctx).Table(WebhookTableName()).Create(webhook).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create webhook")
+	}
+	return nil
+}
+
+// 查询用户的webhook订阅
+func (dao *Dao) QueryUserWebhooks(ctx context.Context, owners []string) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := dao.DB.WithContext(ctx).Table(WebhookTableName()).
+		Where("owner in (?)", owners).
+		Order("id desc").
+		Find(&webhooks).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query user webhooks")
+	}
+	return webhooks, nil
+}
+
+// 查询用户的指定webhook订阅，不存在时返回nil
+func (dao *Dao) QueryUserWebhook(ctx context.Context, owners []string, id int64) (*Webhook, error) {
+	var webhooks []Webhook
+	err := dao.DB.WithContext(ctx).Table(WebhookTableName()).
+		Where("id = ? and owner in (?)", id, owners).
+		Limit(1).
+		Find(&webhooks).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query webhook")
+	}
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	return &webhooks[0], nil
+}
+
+// 删除webhook订阅及其投递记录
+func (dao *Dao) DeleteWebhook(ctx context.Context, id int64) error {
+	err := dao.DB.WithContext(ctx).Table(WebhookDeliveryTableName()).
+		Where("webhook_id = ?", id).
+		Delete(&WebhookDelivery{}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on delete webhook deliveries")
+	}
+	err = dao.DB.WithContext(ctx).Table(WebhookTableName()).
+		Where("id = ?", id).
+		Delete(&Webhook{}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on delete webhook")
+	}
+	return nil
+}
+
+// 查询所有生效的webhook订阅
+func (dao *Dao) QueryActiveWebhooks(ctx context.Context) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := dao.DB.WithContext(ctx).Table(WebhookTableName()).
+		Where("status = ?", WebhookStatusActive).
+		Find(&webhooks).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query active webhooks")
+	}
+	return webhooks, nil
+}
+
+// 批量新增投递记录，同一webhook的同一事件只投递一次
+func (dao *Dao) AddWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	err := dao.DB.WithContext(ctx).Table(WebhookDeliveryTableName()).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "webhook_id"}, {Name: "event_id"}},
+			DoNothing: true,
+		}).
+		Create(&deliveries).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on create webhook deliveries")
+	}
+	return nil
+}
+
+// 认领到期待投递的记录，包括认领已过期的sending记录，返回本次认领到的记录
+// 认领通过单条UPDATE完成，多个实例同时认领时每条记录只会被一个实例认领；订阅已停用的记录不认领
+func (dao *Dao) ClaimDueWebhookDeliveries(ctx context.Context, claimToken string, lease int64, limit int) ([]WebhookDelivery, error) {
+	now := time.Now().Unix()
+	activeWebhooks := dao.DB.Table(WebhookTableName()).Select("id").Where("status = ?", WebhookStatusActive)
+	err := dao.DB.WithContext(ctx).Table(WebhookDeliveryTableName()).
+		Where("status in (?) and next_retry_time <= ?", []int{WebhookDeliveryPending, WebhookDeliverySending}, now).
+		Where("webhook_id in (?)", activeWebhooks).
+		Order("next_retry_time asc, id asc").
+		Limit(limit).
+		Updates(map[string]interface{}{
+			"status":          WebhookDeliverySending,
+			"claim_token":     claimToken,
+			"next_retry_time": now + lease,
+			"update_time":     now,
+		}).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on claim webhook deliveries")
+	}
+
+	var deliveries []WebhookDelivery
+	err = dao.DB.WithContext(ctx).Table(WebhookDeliveryTableName()).
+		Where("claim_token = ? and status = ?", claimToken, WebhookDeliverySending).
+		Order("id asc").
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query claimed webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// 更新投递结果，认领已过期并被其他实例重新认领时不更新
+func (dao *Dao) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	err := dao.DB.WithContext(ctx).Table(WebhookDeliveryTableName()).
+		Where("id = ? and claim_token = ? and status = ?", delivery.Id, delivery.ClaimToken, WebhookDeliverySending).
+		Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_retry_time":  delivery.NextRetryTime,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"claim_token":      "",
+			"update_time":      delivery.UpdateTime,
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed on update webhook delivery")
+	}
+	return nil
+}
+
+// 分页查询webhook的投递记录，status小于0时不过滤状态
+func (dao *Dao) QueryWebhookDeliveries(ctx context.Context, webhookId int64, status, page, pageSize int) ([]WebhookDelivery, int64, error) {
+	var deliveries []WebhookDelivery
+	var count int64
+	db := dao.DB.WithContext(ctx).Table(WebhookDeliveryTableName()).
+		Where("webhook_id = ?", webhookId)
+	if status >= 0 {
+		db = db.Where("status = ?", status)
+	}
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count webhook deliveries")
+	}
+	err := db.Order("id desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query webhook deliveries")
+	}
+	return deliveries, count, nil
+}
@@ -11,6 +11,11 @@ type ActivityMultiChainFilterParams struct {
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	// 游标分页，为空时按page分页，不为空时忽略page
+	Cursor    string `json:"cursor"`
+	SkipCount bool   `json:"skip_count"` // 不统计总数，使用游标时总是不统计
+	// 不带过滤条件时按表统计信息估算总数
+	Approximate bool `json:"approximate"`
 }
 
 type ActivityInfo struct {
@@ -32,6 +37,17 @@ type ActivityInfo struct {
 }
 
 type ActivityResp struct {
-	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	Result     interface{} `json:"result"`
+	Count      int64       `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"` // 下一页的游标，没有下一页时为空
+	// 总数为估算值
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// 实时activity订阅条件，为空的条件不过滤
+type ActivityStreamFilter struct {
+	ChainID           int    `form:"chain_id" json:"chain_id"`
+	CollectionAddress string `form:"collection_address" json:"collection_address"`
+	TokenID           string `form:"token_id" json:"token_id"`
+	UserAddress       string `form:"user_address" json:"user_address"`
 }
@@ -17,4 +17,29 @@ type ItemBid struct {
 	BidUnfilled       int64           `json:"bid_unfilled"`       //未成交数量
 	Bidder            string          `json:"bidder"`             //出价人
 	OrderType         int64           `json:"order_type"`         //订单类型
+	Fee               *FeeBreakdown   `json:"fee,omitempty"`      //接受出价时的手续费明细(即时卖出)
+}
+
+// 按trait分组的出价信息
+type CollectionTraitBid struct {
+	Trait      string          `json:"trait"`
+	TraitValue string          `json:"trait_value"`
+	Price      decimal.Decimal `json:"price"`
+	Size       int             `json:"size"`
+	Total      decimal.Decimal `json:"total"`
+	Bidders    int             `json:"bidders"`
+}
+
+type TraitBids struct {
+	Trait      string           `json:"trait"`
+	TraitValue string           `json:"trait_value"`
+	Bids       []CollectionBids `json:"bids"`
+}
+
+// trait出价保存参数
+type TraitBidParam struct {
+	ChainID    int    `json:"chain_id"`
+	OrderId    string `json:"order_id"`
+	Trait      string `json:"trait"`
+	TraitValue string `json:"trait_value"`
 }
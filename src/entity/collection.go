@@ -18,10 +18,29 @@ type CollectionDetail struct {
 	VolumeTotal    decimal.Decimal `json:"volume_total"`
 	Volume24h      decimal.Decimal `json:"volume_24h"`
 	Sold24h        int64           `json:"sold_24h"`
+	MaxPrice24h    decimal.Decimal `json:"max_price_24h"` // 24小时最高成交价
 	ListAmount     int64           `json:"list_amount"`
 	TotalSupply    int64           `json:"total_supply"`
 	OwnerAmount    int64           `json:"owner_amount"`
 	RoyaltyFeeRate string          `json:"royalty_fee_rate"`
+	// 无法换算为原生币、未计入地板价和交易量的币种
+	SkippedCurrencies []string `json:"skipped_currencies,omitempty"`
+
+	// 美元价格，未配置价格Oracle时不返回
+	FloorPriceUsd  *decimal.Decimal `json:"floor_price_usd,omitempty"`
+	VolumeTotalUsd *decimal.Decimal `json:"volume_total_usd,omitempty"`
+	Volume24hUsd   *decimal.Decimal `json:"volume_24h_usd,omitempty"`
+}
+
+// 集合实时数据，挂单、出价或成交变化时推送
+type CollectionLiveStats struct {
+	ChainID           int             `json:"chain_id"`
+	CollectionAddress string          `json:"collection_address"`
+	FloorPrice        decimal.Decimal `json:"floor_price"`
+	BestBid           decimal.Decimal `json:"best_bid"`
+	ListedCount       int64           `json:"listed_count"`
+	Volume24h         decimal.Decimal `json:"volume_24h"`
+	UpdateTime        int64           `json:"update_time"`
 }
 
 // CollectionBid查询参数
@@ -33,8 +52,9 @@ type CollectionBidFilterParam struct {
 
 // CollectionBid返回参数
 type CollectionBidsRes struct {
-	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	Result    interface{} `json:"result"`
+	Count     int64       `json:"count"`
+	TraitBids []TraitBids `json:"trait_bids,omitempty"`
 }
 
 // CollectionBid
@@ -55,12 +75,16 @@ type CollectionItemFilterParam struct {
 	ChainID     int    `json:"chain_id"`
 	Page        int    `json:"page"`
 	PageSize    int    `json:"page_size"`
+	// 游标分页，仅支持按挂单价格排序，为空时按page分页
+	Cursor    string `json:"cursor"`
+	SkipCount bool   `json:"skip_count"` // 不统计总数，使用游标时总是不统计
 }
 
 // NFT返回参数
 type NFTListInfoRes struct {
-	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	Result     interface{} `json:"result"`
+	Count      int64       `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"` // 下一页的游标，没有下一页或不支持游标时为空
 }
 
 // NFTListInfo
@@ -95,6 +119,10 @@ type NFTListInfo struct {
 
 	LastSellPrice    decimal.Decimal `json:"last_sell_price"`
 	OwnerOwnedAmount int64           `json:"owner_owned_amount"`
+
+	ListFee *FeeBreakdown `json:"list_fee,omitempty"` // 挂单成交时的手续费明细(扫货)
+
+	Incomplete bool `json:"incomplete,omitempty"` // 挂单订单、图片、最近成交价格或出价查询失败时为true
 }
 type ItemTrait struct {
 	Key   string `json:"key"`
@@ -119,6 +147,7 @@ type RefreshItem struct {
 	ChainId           int64  `json:"chain_id"`
 	CollectionAddress string `json:"collection_address"`
 	TokenId           string `json:"token_id"`
+	JobId             int64  `json:"job_id,omitempty"` // 集合批量刷新时所属的任务id
 }
 
 // 集合排名信息
@@ -135,6 +164,16 @@ type CollectionRankingInfo struct {
 	ItemSold    int64           `json:"item_sold"`
 	ListAmount  int             `json:"list_amount"`
 	ChainID     int             `json:"chain_id"`
+
+	// 美元价格，未配置价格Oracle时不返回
+	FloorPriceUsd *decimal.Decimal `json:"floor_price_usd,omitempty"`
+	VolumeUsd     *decimal.Decimal `json:"volume_usd,omitempty"`
+}
+
+// 集合排行榜
+type CollectionRankingResp struct {
+	Result    interface{} `json:"result"`
+	UpdatedAt int64       `json:"updated_at"` // 排行榜快照的生成时间，多条链时为最早的快照时间，实时计算时为0
 }
 
 // 集合上架数量
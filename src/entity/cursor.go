@@ -0,0 +1,28 @@
+package entity
+
+// 使用游标分页或指定skip_count时不统计总数，返回的count为-1
+const CountSkipped int64 = -1
+
+// activity分页位置，多条链合并后按(event_time, id, chain)倒序
+type ActivityCursor struct {
+	EventTime int64  `json:"t"`
+	Id        int64  `json:"i"`
+	Chain     string `json:"c"`
+}
+
+// 集合item分页位置，按挂单价格和item id排序，未挂单的item价格为空
+type ItemCursor struct {
+	Listed bool   `json:"l"`
+	Price  string `json:"p"`
+	Id     int64  `json:"i"`
+}
+
+// 用户持有item分页位置，按(owned_time, chain_id, collection_address, token_id)倒序，
+// 没有成交记录的item owned_time为空，排在最后
+type PortfolioItemCursor struct {
+	HasOwnedTime      bool   `json:"h"`
+	OwnedTime         int64  `json:"t"`
+	ChainID           int    `json:"c"`
+	CollectionAddress string `json:"a"`
+	TokenID           string `json:"i"`
+}
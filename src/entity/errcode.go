@@ -0,0 +1,14 @@
+package entity
+
+import "github.com/ProjectsTask/EasySwapBase/errcode"
+
+// 资源不存在的错误码，接口缓存按这些错误码对结果做短暂的负缓存
+var (
+	ErrCollectionNotFound = &errcode.Err{Code: 40401, Msg: "collection not found"}
+	ErrItemNotFound       = &errcode.Err{Code: 40402, Msg: "item not found"}
+)
+
+// IsNotFoundCode 是否为资源不存在的错误码
+func IsNotFoundCode(code int) bool {
+	return code == ErrCollectionNotFound.Code || code == ErrItemNotFound.Code
+}
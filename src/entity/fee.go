@@ -0,0 +1,27 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+// 手续费预览参数
+type FeePreviewParam struct {
+	ChainID           int             `json:"chain_id"`
+	CollectionAddress string          `json:"collection_address"`
+	Price             decimal.Decimal `json:"price"`
+	Markets           []int           `json:"markets"` // 0:ns 1:os 2:looksrare 3:x2y2，为空默认0
+}
+
+// 手续费预览返回参数
+type FeePreviewRes struct {
+	Result interface{} `json:"result"`
+}
+
+// 手续费及到手金额明细
+type FeeBreakdown struct {
+	MarketplaceId      int             `json:"marketplace_id"`
+	Price              decimal.Decimal `json:"price"`
+	MarketplaceFeeRate decimal.Decimal `json:"marketplace_fee_rate"`
+	MarketplaceFee     decimal.Decimal `json:"marketplace_fee"`
+	RoyaltyFeeRate     decimal.Decimal `json:"royalty_fee_rate"`
+	RoyaltyFee         decimal.Decimal `json:"royalty_fee"`
+	NetProceeds        decimal.Decimal `json:"net_proceeds"`
+}
@@ -47,6 +47,8 @@ type ItemDetailInfo struct {
 	BidType       int64           `json:"bid_type"`
 	BidSize       int64           `json:"bid_size"`
 	BidUnfilled   int64           `json:"bid_unfilled"`
+
+	Incomplete bool `json:"incomplete,omitempty"` // 图片、最近成交价格或出价查询失败时为true，对应字段为空
 }
 
 // TopTrait过滤条件
@@ -0,0 +1,32 @@
+package entity
+
+// 集合元数据刷新参数，token_ids为空时刷新集合中全部token
+type MetadataRefreshParam struct {
+	ChainID  int      `json:"chain_id"`
+	TokenIds []string `json:"token_ids"`
+}
+
+// 元数据刷新任务进度
+type MetadataRefreshJobInfo struct {
+	Id                int64                    `json:"id"`
+	ChainID           int                      `json:"chain_id"`
+	CollectionAddress string                   `json:"collection_address"`
+	Status            string                   `json:"status"`
+	Total             int64                    `json:"total"`
+	Queued            int64                    `json:"queued"`
+	Skipped           int64                    `json:"skipped"` // 短时间内已在刷新队列中而跳过的数量
+	Processed         int64                    `json:"processed"`
+	Failed            int64                    `json:"failed"`
+	Progress          float64                  `json:"progress"`   // 已完成比例，0~1
+	LastError         string                   `json:"last_error"` // 任务失败原因
+	Failures          []MetadataRefreshFailure `json:"failures"`   // 最近的失败记录
+	CreateTime        int64                    `json:"create_time"`
+	UpdateTime        int64                    `json:"update_time"`
+}
+
+// 刷新失败的token及原因
+type MetadataRefreshFailure struct {
+	TokenId    string `json:"token_id"`
+	Reason     string `json:"reason"`
+	CreateTime int64  `json:"create_time"`
+}
@@ -0,0 +1,31 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+// 通知查询参数
+type NotificationFilterParam struct {
+	UnreadOnly bool `json:"unread_only"`
+	Page       int  `json:"page"`
+	PageSize   int  `json:"page_size"`
+}
+
+// 通知信息
+type NotificationInfo struct {
+	Id                int64           `json:"id"`
+	Address           string          `json:"address"`
+	ChainID           int             `json:"chain_id"`
+	NotifyType        string          `json:"notify_type"` // bid_received、outbid、item_sold、listing_expiring、price_alert
+	CollectionAddress string          `json:"collection_address"`
+	TokenID           string          `json:"token_id"`
+	OrderID           string          `json:"order_id"`
+	Price             decimal.Decimal `json:"price"`
+	Counterparty      string          `json:"counterparty"`
+	IsRead            bool            `json:"is_read"`
+	EventTime         int64           `json:"event_time"`
+}
+
+type NotificationResp struct {
+	Result interface{} `json:"result"`
+	Count  int64       `json:"count"`
+	Unread int64       `json:"unread"`
+}
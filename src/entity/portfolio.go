@@ -39,6 +39,8 @@ type ChainInfo struct {
 	ChainID   int             `json:"chain_id"`
 	ItemOwned int64           `json:"item_owned"`
 	ItemValue decimal.Decimal `json:"item_value"`
+	// 美元价值，未配置价格Oracle时不返回
+	ItemValueUsd *decimal.Decimal `json:"item_value_usd,omitempty"`
 }
 type UserCollectionsData struct {
 	CollectionInfos []CollectionInfo `json:"collection_info"`
@@ -56,10 +58,14 @@ type PortfolioMultiChainItemFilterParams struct {
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	// 游标分页，为空时按page分页，不为空时忽略page
+	Cursor    string `json:"cursor"`
+	SkipCount bool   `json:"skip_count"` // 不统计总数，使用游标时总是不统计
 }
 type UserItemsResp struct {
-	Result interface{} `json:"result"`
-	Count  int64       `json:"count"`
+	Result     interface{} `json:"result"`
+	Count      int64       `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"` // 下一页的游标，没有下一页时为空
 }
 type PortfolioItemInfo struct {
 	ChainID            int    `json:"chain_id"`
@@ -93,6 +99,8 @@ type PortfolioItemInfo struct {
 	BidType       int64           `json:"bid_type"`
 	BidSize       int64           `json:"bid_size"`
 	BidUnfilled   int64           `json:"bid_unfilled"`
+
+	Incomplete bool `json:"incomplete,omitempty"` // 挂单订单、图片或出价查询失败时为true
 }
 
 type MultichainCollection struct {
@@ -116,10 +124,14 @@ type PortfolioMultiChainListingFilterParams struct {
 
 	Page     int `json:"page"`
 	PageSize int `json:"page_size"`
+	// 游标分页，为空时按page分页，不为空时忽略page
+	Cursor    string `json:"cursor"`
+	SkipCount bool   `json:"skip_count"` // 不统计总数，使用游标时总是不统计
 }
 type UserListingsResp struct {
-	Count  int64     `json:"count"`
-	Result []Listing `json:"result"`
+	Count      int64     `json:"count"`
+	Result     []Listing `json:"result"`
+	NextCursor string    `json:"next_cursor,omitempty"` // 下一页的游标，没有下一页时为空
 }
 
 type Listing struct {
@@ -149,6 +161,8 @@ type Listing struct {
 	BidSize       int64           `json:"bid_size"`
 	BidUnfilled   int64           `json:"bid_unfilled"`
 	FloorPrice    decimal.Decimal `json:"floor_price"`
+
+	Incomplete bool `json:"incomplete,omitempty"` // 挂单订单、图片或出价查询失败时为true
 }
 
 /*
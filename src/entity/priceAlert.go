@@ -0,0 +1,42 @@
+package entity
+
+import "github.com/shopspring/decimal"
+
+// 价格提醒参数
+// alert_type: floor_above、floor_below、bid_above、bid_below、item_listed_below，item_listed_below需指定token_id
+type PriceAlertParam struct {
+	ChainID           int             `json:"chain_id"`
+	CollectionAddress string          `json:"collection_address"`
+	TokenID           string          `json:"token_id"`
+	AlertType         string          `json:"alert_type"`
+	Threshold         decimal.Decimal `json:"threshold"`
+	WebhookId         int64           `json:"webhook_id"`
+	Enable            *bool           `json:"enable"`
+}
+
+// 价格提醒信息
+type PriceAlertInfo struct {
+	Id                int64           `json:"id"`
+	ChainID           int             `json:"chain_id"`
+	CollectionAddress string          `json:"collection_address"`
+	TokenID           string          `json:"token_id"`
+	AlertType         string          `json:"alert_type"`
+	Threshold         decimal.Decimal `json:"threshold"`
+	WebhookId         int64           `json:"webhook_id"`
+	Enable            bool            `json:"enable"`
+	Triggered         bool            `json:"triggered"`
+	LastValue         decimal.Decimal `json:"last_value"`
+	LastTriggerTime   int64           `json:"last_trigger_time"`
+	CreateTime        int64           `json:"create_time"`
+}
+
+// 价格提醒触发时推送的内容
+type PriceAlertEvent struct {
+	AlertId           int64           `json:"alert_id"`
+	AlertType         string          `json:"alert_type"`
+	ChainID           int             `json:"chain_id"`
+	CollectionAddress string          `json:"collection_address"`
+	TokenID           string          `json:"token_id"`
+	Threshold         decimal.Decimal `json:"threshold"`
+	Value             decimal.Decimal `json:"value"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+// 所有者不一致记录查询参数，为空时不过滤
+type OwnerDiscrepancyFilterParam struct {
+	ChainID           int    `json:"chain_id"`
+	CollectionAddress string `json:"collection_address"`
+	Page              int    `json:"page"`
+	PageSize          int    `json:"page_size"`
+}
+
+type OwnerDiscrepancyResp struct {
+	Result interface{} `json:"result"`
+	Count  int64       `json:"count"`
+}
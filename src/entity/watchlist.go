@@ -0,0 +1,31 @@
+package entity
+
+// 关注参数，token_id为空表示关注集合
+type WatchlistParam struct {
+	ChainID           int    `json:"chain_id"`
+	CollectionAddress string `json:"collection_address"`
+	TokenID           string `json:"token_id"`
+}
+
+// 关注列表查询参数，chain_ids为空时查询所有支持的链
+type WatchlistFilterParam struct {
+	ChainIDs []int `json:"chain_ids"`
+}
+
+// 关注列表中的一项
+// 关注集合时返回collection，内容与排行榜一致；关注item时返回item，内容与item详情一致
+type WatchlistEntry struct {
+	Id                int64                  `json:"id"`
+	ChainID           int                    `json:"chain_id"`
+	CollectionAddress string                 `json:"collection_address"`
+	TokenID           string                 `json:"token_id"`
+	CreateTime        int64                  `json:"create_time"`
+	Collection        *CollectionRankingInfo `json:"collection,omitempty"`
+	Item              *ItemDetailInfo        `json:"item,omitempty"`
+	// 详细信息查询失败时为true，此时Collection、Item为空
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+type WatchlistResp struct {
+	Result interface{} `json:"result"`
+}
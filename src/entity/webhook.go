@@ -0,0 +1,60 @@
+package entity
+
+// 注册webhook参数，为空的过滤条件不过滤
+type WebhookParam struct {
+	Url                 string   `json:"url"`
+	EventTypes          []string `json:"event_types"` // activity事件类型，如 sale、list、item_bid
+	ChainIDs            []int    `json:"chain_ids"`
+	CollectionAddresses []string `json:"collection_addresses"`
+	WalletAddresses     []string `json:"wallet_addresses"` // 匹配activity的maker或taker
+}
+
+// webhook订阅信息，secret仅在注册时返回
+type WebhookInfo struct {
+	Id                  int64    `json:"id"`
+	Owner               string   `json:"owner"`
+	Url                 string   `json:"url"`
+	Secret              string   `json:"secret,omitempty"`
+	EventTypes          []string `json:"event_types"`
+	ChainIDs            []int    `json:"chain_ids"`
+	CollectionAddresses []string `json:"collection_addresses"`
+	WalletAddresses     []string `json:"wallet_addresses"`
+	Status              int      `json:"status"`
+	CreateTime          int64    `json:"create_time"`
+}
+
+// 推送给webhook的事件
+type WebhookEvent struct {
+	Id        string      `json:"id"` // 事件id，重试时不变，可用于接收方去重
+	EventType string      `json:"event_type"`
+	ChainID   int         `json:"chain_id"`
+	EventTime int64       `json:"event_time"`
+	Data      interface{} `json:"data"` // activity事件为ActivityInfo，价格提醒为PriceAlertEvent
+}
+
+// webhook投递记录查询参数，status为空时不过滤：0-待投递 1-成功 2-死信 3-投递中
+type WebhookDeliveryFilterParam struct {
+	Status   *int `json:"status"`
+	Page     int  `json:"page"`
+	PageSize int  `json:"page_size"`
+}
+
+// webhook投递记录
+type WebhookDeliveryInfo struct {
+	Id             int64  `json:"id"`
+	EventId        string `json:"event_id"`
+	EventType      string `json:"event_type"`
+	Payload        string `json:"payload"`
+	Status         int    `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextRetryTime  int64  `json:"next_retry_time"`
+	LastStatusCode int    `json:"last_status_code"`
+	LastError      string `json:"last_error"`
+	CreateTime     int64  `json:"create_time"`
+	UpdateTime     int64  `json:"update_time"`
+}
+
+type WebhookDeliveryResp struct {
+	Result interface{} `json:"result"`
+	Count  int64       `json:"count"`
+}
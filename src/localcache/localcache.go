@@ -0,0 +1,160 @@
+package localcache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache 进程内的LRU缓存，放在Redis、MySQL之前，减少同一时间内对相同数据的重复查询
+// 1. 条目超过最大数量时淘汰最久未访问的条目
+// 2. 条目写入后ttl时间内有效，过期后下次访问时删除
+// 3. 数据变更时通过Invalidate删除本实例的条目，并通知其他实例删除
+// nil的Cache表示未启用，所有方法都可以直接调用
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	ll         *list.List
+	items      map[string]*list.Element
+	publish    func(keys []string) error // 通知其他实例删除条目
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type entry struct {
+	key      string
+	value    interface{}
+	expireAt time.Time
+}
+
+// Stats 缓存命中统计
+type Stats struct {
+	Entries    int     `json:"entries"`
+	MaxEntries int     `json:"max_entries"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	Evictions  uint64  `json:"evictions"`
+	HitRate    float64 `json:"hit_rate"`
+}
+
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// SetPublisher 设置跨实例失效通知，需在使用前设置
+func (c *Cache) SetPublisher(publish func(keys []string) error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.publish = publish
+	c.mu.Unlock()
+}
+
+// Get 获取未过期的条目
+func (c *Cache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if time.Now().After(e.expireAt) {
+		c.removeElement(elem)
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	atomic.AddUint64(&c.hits, 1)
+	return e.value, true
+}
+
+// Set 写入条目，超过最大数量时淘汰最久未访问的条目
+func (c *Cache) Set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.value, e.expireAt = value, expireAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, expireAt: expireAt})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// Remove 仅删除本实例的条目，用于处理其他实例的失效通知
+func (c *Cache) Remove(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.removeElement(elem)
+		}
+	}
+}
+
+// Invalidate 删除本实例的条目并通知其他实例删除
+func (c *Cache) Invalidate(keys ...string) error {
+	if c == nil || len(keys) == 0 {
+		return nil
+	}
+	c.Remove(keys...)
+	c.mu.Lock()
+	publish := c.publish
+	c.mu.Unlock()
+	if publish == nil {
+		return nil
+	}
+	return publish(keys)
+}
+
+// Stats 返回当前条目数和命中统计
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	entries := c.ll.Len()
+	c.mu.Unlock()
+	stats := Stats{
+		Entries:    entries,
+		MaxEntries: c.maxEntries,
+		Hits:       atomic.LoadUint64(&c.hits),
+		Misses:     atomic.LoadUint64(&c.misses),
+		Evictions:  atomic.LoadUint64(&c.evictions),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+func (c *Cache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*entry).key)
+}
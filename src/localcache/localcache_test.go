@@ -0,0 +1,225 @@
+package localcache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 按从新到旧的顺序返回缓存中的key
+func keys(c *Cache) []string {
+	var result []string
+	for elem := c.ll.Front(); elem != nil; elem = elem.Next() {
+		result = append(result, elem.Value.(*entry).key)
+	}
+	return result
+}
+
+func TestLRUEvictionOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(c *Cache)
+		want []string
+	}{
+		{
+			name: "oldest entry evicted",
+			ops: func(c *Cache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("c", 3)
+				c.Set("d", 4)
+			},
+			want: []string{"d", "c", "b"},
+		},
+		{
+			name: "get refreshes recency",
+			ops: func(c *Cache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("c", 3)
+				c.Get("a")
+				c.Set("d", 4)
+			},
+			want: []string{"d", "a", "c"},
+		},
+		{
+			name: "overwrite refreshes recency without eviction",
+			ops: func(c *Cache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("c", 3)
+				c.Set("a", 10)
+				c.Set("d", 4)
+			},
+			want: []string{"d", "a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(3, time.Minute)
+			tt.ops(c)
+			if got := keys(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+			if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 3 {
+				t.Errorf("stats = %+v, want 1 eviction and 3 entries", stats)
+			}
+		})
+	}
+}
+
+func TestSetOverwritesValue(t *testing.T) {
+	c := New(3, time.Minute)
+	c.Set("a", 1)
+	c.Set("a", 2)
+	if value, ok := c.Get("a"); !ok || value != 2 {
+		t.Errorf("Get(a) = %v, %v, want 2, true", value, ok)
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	c := New(10, 20*time.Millisecond)
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("entry should be valid before ttl")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("entry should expire after ttl")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want expired entry removed, 1 hit and 1 miss", stats)
+	}
+
+	// 重新写入后重新计算过期时间
+	c.Set("a", 2)
+	if value, ok := c.Get("a"); !ok || value != 2 {
+		t.Errorf("Get(a) = %v, %v, want 2, true", value, ok)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := New(10, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	var published [][]string
+	c.SetPublisher(func(keys []string) error {
+		published = append(published, keys)
+		return nil
+	})
+	if err := c.Invalidate("a", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("invalidated entry should be removed")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("other entries should be kept")
+	}
+	// 本实例没有的key也要通知其他实例
+	if want := [][]string{{"a", "missing"}}; !reflect.DeepEqual(published, want) {
+		t.Errorf("published = %v, want %v", published, want)
+	}
+
+	// 没有key时不通知
+	if err := c.Invalidate(); err != nil || len(published) != 1 {
+		t.Errorf("Invalidate() = %v, published %d times, want no publish", err, len(published))
+	}
+}
+
+func TestInvalidateWithoutPublisher(t *testing.T) {
+	c := New(10, time.Minute)
+	c.Set("a", 1)
+	if err := c.Invalidate("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("invalidated entry should be removed")
+	}
+}
+
+func TestInvalidatePublishError(t *testing.T) {
+	c := New(10, time.Minute)
+	c.Set("a", 1)
+	publishErr := errors.New("publish failed")
+	c.SetPublisher(func(keys []string) error {
+		return publishErr
+	})
+	if err := c.Invalidate("a"); !errors.Is(err, publishErr) {
+		t.Errorf("Invalidate() = %v, want %v", err, publishErr)
+	}
+	// 通知失败时本实例的条目仍然删除
+	if _, ok := c.Get("a"); ok {
+		t.Error("entry should be removed even if publish fails")
+	}
+}
+
+func TestCrossInstanceInvalidation(t *testing.T) {
+	// 模拟pub/sub：一个实例发布的失效通知发送给所有实例，包括自己
+	instances := []*Cache{New(10, time.Minute), New(10, time.Minute), New(10, time.Minute)}
+	for _, c := range instances {
+		c.SetPublisher(func(keys []string) error {
+			for _, subscriber := range instances {
+				subscriber.Remove(keys...)
+			}
+			return nil
+		})
+		c.Set("collection", "info")
+		c.Set("listed", 5)
+	}
+
+	if err := instances[0].Invalidate("collection"); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range instances {
+		if _, ok := c.Get("collection"); ok {
+			t.Errorf("instance %d should remove invalidated entry", i)
+		}
+		if _, ok := c.Get("listed"); !ok {
+			t.Errorf("instance %d should keep other entries", i)
+		}
+	}
+}
+
+func TestRemoveDoesNotPublish(t *testing.T) {
+	c := New(10, time.Minute)
+	c.Set("a", 1)
+	c.SetPublisher(func(keys []string) error {
+		t.Errorf("Remove should not publish %v", keys)
+		return nil
+	})
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("removed entry should be gone")
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	c.Set("a", 1)
+	c.SetPublisher(func(keys []string) error { return nil })
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("nil cache should always miss")
+	}
+	if err := c.Invalidate("a"); err != nil {
+		t.Errorf("Invalidate() = %v, want nil", err)
+	}
+	if stats := c.Stats(); stats != (Stats{}) {
+		t.Errorf("Stats() = %+v, want zero", stats)
+	}
+}
+
+func TestStatsHitRate(t *testing.T) {
+	c := New(10, time.Minute)
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.HitRate != 0.75 || stats.MaxEntries != 10 {
+		t.Errorf("stats = %+v, want 3 hits, 1 miss, hit rate 0.75", stats)
+	}
+}
@@ -27,6 +27,10 @@ func main() {
 		if chain.ChainId == 0 || chain.Name == "" {
 			panic("invalid chain_suffix config")
 		}
+		// 挂单校验需要检查对vault合约的授权
+		if c.ListingCheck != nil && c.ListingCheck.Enable && chain.VaultAddress == "" {
+			panic("vault_address is required when listing_check is enabled")
+		}
 	}
 	// 启动 pprof 服务器
 	go func() {
@@ -68,6 +68,29 @@ func AuthMiddleWare(ctx *xkv.Store) gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleWare 管理员校验中间件，需在AuthMiddleWare之后使用
+// 登录的地址中有一个在管理员列表中即可通过
+func AdminMiddleWare(ctx *xkv.Store, admins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addrs, err := GetAuthUserAddress(c, ctx)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrTokenVerify)
+			c.Abort()
+			return
+		}
+		for _, addr := range addrs {
+			for _, admin := range admins {
+				if strings.EqualFold(addr, admin) {
+					c.Next()
+					return
+				}
+			}
+		}
+		xhttp.Error(c, errcode.NewCustomErr("permission denied"))
+		c.Abort()
+	}
+}
+
 func GetAuthUserAddress(c *gin.Context, ctx *xkv.Store) ([]string, error) {
 	values := c.Request.Header.Get("session_id")
 	if values == "" {
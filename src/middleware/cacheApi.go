@@ -1,7 +1,12 @@
 package middleware
 
 import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
 	"bytes"
+	"context"
 	"crypto/sha512"
 	"encoding/gob"
 	"encoding/json"
@@ -10,17 +15,66 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 	"github.com/gin-gonic/gin"
-	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 const CacheApiPrefix = "apicache:"
 
+const (
+	defaultApiCacheStale       = 30 // 过期后仍可返回旧数据的时间，单位秒
+	defaultApiCacheNegativeTtl = 5  // 资源不存在结果的缓存时间，单位秒
+	apiCacheLockExpire         = 10 // 跨实例计算锁的过期时间，单位秒
+	apiCacheRevalidateTimeout  = 30 * time.Second
+	apiCacheWaitInterval       = 50 * time.Millisecond
+	apiCacheWaitTimeout        = 3 * time.Second
+	apiCacheCoalesceTimeout    = 5 * time.Second // 等待本实例内同一key计算结果的超时，超时后自行处理
+)
+
 type responseCache struct {
-	Status int
-	Header http.Header
-	Data   []byte
+	Status     int
+	Header     http.Header
+	Data       []byte
+	FreshUntil int64 // 此时间之前为新鲜数据，之后到redis过期前作为旧数据返回并触发刷新
+}
+
+// 单个路由的缓存参数
+type apiCacheOptions struct {
+	ttl         int
+	stale       int
+	negativeTtl int
+}
+
+// 同一key正在进行的计算，其他请求等待其结果
+type apiCacheCall struct {
+	done  chan struct{}
+	cache *responseCache // 结果不可缓存时为nil
+}
+
+// 后台刷新请求的context标记
+type revalidateCtxKey struct{}
+
+// 接口缓存
+// 1. 同一key在本实例内只有一个请求计算，跨实例通过Redis锁保证只有一个实例计算
+// 2. 缓存过期后在stale时间内继续返回旧数据，同时在后台刷新一次
+// 3. 资源不存在(HTTP 404或entity.IsNotFoundCode)的结果按negativeTtl短暂缓存
+type apiCacher struct {
+	store   *xkv.Store
+	handler http.Handler // 后台刷新时重新执行请求，为nil时由获得锁的请求同步刷新
+	mu      sync.Mutex
+	calls   map[string]*apiCacheCall
+}
+
+func newApiCacher(store *xkv.Store, handler http.Handler) *apiCacher {
+	return &apiCacher{
+		store:   store,
+		handler: handler,
+		calls:   make(map[string]*apiCacheCall),
+	}
 }
 
 // 一个缓存中间件函数,用于缓存API响应数据
@@ -29,80 +83,310 @@ type responseCache struct {
 // 3. 如果没有缓存,则继续处理请求
 // 4. 请求处理完成后,如果响应状态码为200,则将响应数据缓存起来
 func CacheApi(store *xkv.Store, expireSeconds int) gin.HandlerFunc {
+	cacher := newApiCacher(store, nil)
+	opts := apiCacheOptions{ttl: expireSeconds, stale: defaultApiCacheStale, negativeTtl: defaultApiCacheNegativeTtl}
 	return func(c *gin.Context) {
-		var data xhttp.Response
-		//创建响应体写入器，用于获取相应内容
-		bodyLogWrite := &BodyLogWrite{ResponseWriter: c.Writer, body: bytes.NewBufferString("")}
-		c.Writer = bodyLogWrite
-
-		//生成缓存key
-		cacheKey := CreateKey(c)
-		if cacheKey == "" {
-			xhttp.Error(c, errcode.NewCustomErr("cache error:no cache"))
-			c.Abort() //中断请求
+		cacher.handle(c, opts)
+	}
+}
+
+// 按配置对路由的响应做缓存，在路由组上使用，未配置的路由直接跳过
+// 路由按请求方法和注册的完整路径匹配，如 GET /api/v1/collections/:address
+// 缓存key不区分登录用户，返回用户相关数据的路由不能配置缓存
+// handler用于在后台重新执行请求刷新过期的缓存，传入gin.Engine
+func RouteCache(store *xkv.Store, cfg *config.ApiCacheCfg, handler http.Handler) gin.HandlerFunc {
+	routes := make(map[string]apiCacheOptions)
+	if cfg != nil && cfg.Enable {
+		stale, negativeTtl := defaultApiCacheStale, defaultApiCacheNegativeTtl
+		if cfg.Stale > 0 {
+			stale = cfg.Stale
 		}
-		//尝试获取缓存数据
-		cacheData, err := (*store).Get(cacheKey)
-		if err == nil && cacheData != "" {
-			//将缓存数据解析成对象
-			cache := unserialize(cacheData)
-			//如果有缓存，则直接返回缓存的响应
-			if cache != nil {
-				//设置响应状态码
-				bodyLogWrite.ResponseWriter.WriteHeader(cache.Status)
-				//设置响应头
-				for k, vals := range cache.Header {
-					for _, v := range vals {
-						bodyLogWrite.ResponseWriter.Header().Set(k, v)
-					}
-				}
-				//解析并返回响应体
-				//将缓存数据解析成json格式
-				err := json.Unmarshal(cache.Data, &data)
-				if err == nil {
-					//检查状态码是否为200 OK
-					if data.Code == http.StatusOK {
-						//写入响应体
-						bodyLogWrite.ResponseWriter.Write(cache.Data)
-						//终止后续处理
-						c.Abort()
-					}
+		if cfg.NegativeTtl > 0 {
+			negativeTtl = cfg.NegativeTtl
+		}
+		for _, route := range cfg.Routes {
+			if route.Ttl > 0 {
+				routes[strings.ToUpper(route.Method)+" "+route.Path] = apiCacheOptions{
+					ttl:         route.Ttl,
+					stale:       stale,
+					negativeTtl: negativeTtl,
 				}
 			}
 		}
-		//若缓存中没有，则继续处理请求
+	}
+	cacher := newApiCacher(store, handler)
+	return func(c *gin.Context) {
+		opts, ok := routes[c.Request.Method+" "+c.FullPath()]
+		//强制读主库的请求需要最新数据，不使用缓存
+		if !ok || dao.IsPrimaryForced(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		cacher.handle(c, opts)
+	}
+}
+
+func (a *apiCacher) handle(c *gin.Context, opts apiCacheOptions) {
+	//生成缓存key
+	cacheKey := CreateKey(c)
+	if cacheKey == "" {
+		xhttp.Error(c, errcode.NewCustomErr("cache error:no cache"))
+		c.Abort() //中断请求
+		return
+	}
+	//1、后台刷新的请求直接计算并覆盖缓存
+	if c.Request.Context().Value(revalidateCtxKey{}) != nil {
+		a.compute(c, cacheKey, opts)
+		return
+	}
+
+	//2、尝试获取缓存数据，新鲜数据直接返回
+	cache := a.load(cacheKey)
+	if cache != nil && cache.FreshUntil > time.Now().Unix() {
+		writeResponseCache(c, cache)
+		return
+	}
+	//3、过期数据直接返回，同时只触发一次刷新
+	if cache != nil {
+		if a.handler != nil {
+			writeResponseCache(c, cache)
+			a.revalidate(c, cacheKey)
+			return
+		}
+		//无法后台刷新时由获得锁的请求同步刷新，其余请求返回旧数据
+		lock := cached.NewRedisLock(a.store, genApiCacheLockKey(cacheKey), apiCacheLockExpire)
+		if ok, err := lock.Acquire(); err != nil || !ok {
+			writeResponseCache(c, cache)
+			return
+		}
+		defer lock.Release()
+		a.compute(c, cacheKey, opts)
+		return
+	}
+	//4、未命中，合并同一key的并发请求
+	a.coalesce(c, cacheKey, opts)
+}
+
+// 同一key只由一个请求计算，其余请求等待并返回其结果
+func (a *apiCacher) coalesce(c *gin.Context, cacheKey string, opts apiCacheOptions) {
+	a.mu.Lock()
+	if call, ok := a.calls[cacheKey]; ok {
+		a.mu.Unlock()
+		timeout := time.NewTimer(apiCacheCoalesceTimeout)
+		defer timeout.Stop()
+		select {
+		case <-call.done:
+		case <-timeout.C:
+			//计算请求过慢时不再等待，自行处理且不写缓存
+			c.Next()
+			return
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+		if call.cache != nil {
+			writeResponseCache(c, call.cache)
+			return
+		}
+		//结果不可缓存(如出错)时自行处理
 		c.Next()
-		//获取响应数据
-		responseBody := bodyLogWrite.body.Bytes()
-		// 如果响应状态码为200,则缓存响应数据
-		err = json.Unmarshal(responseBody, &data)
-		if err == nil {
-			if data.Code == http.StatusOK {
-				storeCache := responseCache{
-					Header: bodyLogWrite.Header().Clone(),
-					Status: bodyLogWrite.ResponseWriter.Status(),
-					Data:   responseBody,
-				}
-				store.SetnxEx(cacheKey, serialize(storeCache), expireSeconds)
+		return
+	}
+	call := &apiCacheCall{done: make(chan struct{})}
+	a.calls[cacheKey] = call
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.calls, cacheKey)
+		a.mu.Unlock()
+		close(call.done)
+	}()
+
+	//其他实例正在计算时等待其写入缓存，超时后自行计算
+	lock := cached.NewRedisLock(a.store, genApiCacheLockKey(cacheKey), apiCacheLockExpire)
+	if ok, err := lock.Acquire(); err == nil && !ok {
+		if cache := a.wait(c, cacheKey); cache != nil {
+			call.cache = cache
+			writeResponseCache(c, cache)
+			return
+		}
+	} else if err == nil {
+		defer lock.Release()
+	}
+	call.cache = a.compute(c, cacheKey, opts)
+}
+
+// 在后台重新执行请求刷新缓存，同一key同时只有一个刷新
+func (a *apiCacher) revalidate(c *gin.Context, cacheKey string) {
+	a.mu.Lock()
+	if _, ok := a.calls[cacheKey]; ok {
+		a.mu.Unlock()
+		return
+	}
+	call := &apiCacheCall{done: make(chan struct{})}
+	a.calls[cacheKey] = call
+	a.mu.Unlock()
+	finish := func() {
+		a.mu.Lock()
+		delete(a.calls, cacheKey)
+		a.mu.Unlock()
+		close(call.done)
+	}
+
+	lock := cached.NewRedisLock(a.store, genApiCacheLockKey(cacheKey), apiCacheLockExpire)
+	if ok, err := lock.Acquire(); err != nil || !ok {
+		finish()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), revalidateCtxKey{}, true), apiCacheRevalidateTimeout)
+	req := c.Request.Clone(ctx)
+	req.Body = ioutil.NopCloser(bytes.NewReader(readRequestBody(c)))
+	go func() {
+		defer func() {
+			cancel()
+			_ = lock.Release()
+			finish()
+		}()
+		a.handler.ServeHTTP(newBufferResponseWriter(), req)
+	}()
+}
+
+// 执行后续处理并缓存结果，返回写入的缓存，不可缓存时返回nil
+func (a *apiCacher) compute(c *gin.Context, cacheKey string, opts apiCacheOptions) *responseCache {
+	var data xhttp.Response
+	//创建响应体写入器，用于获取相应内容
+	bodyLogWrite := &BodyLogWrite{ResponseWriter: c.Writer, body: bytes.NewBufferString("")}
+	c.Writer = bodyLogWrite
+	c.Next()
+
+	//获取响应数据，状态码为200时按ttl缓存，资源不存在时按negativeTtl缓存
+	responseBody := bodyLogWrite.body.Bytes()
+	if err := json.Unmarshal(responseBody, &data); err != nil {
+		return nil
+	}
+	status := bodyLogWrite.ResponseWriter.Status()
+	ttl, stale, ok := responseCacheTtl(status, data.Code, opts)
+	if !ok {
+		return nil
+	}
+	storeCache := responseCache{
+		Header:     bodyLogWrite.Header().Clone(),
+		Status:     status,
+		Data:       responseBody,
+		FreshUntil: time.Now().Unix() + int64(ttl),
+	}
+	//并按链、集合、item打上tag
+	if err := a.store.Setex(cacheKey, serialize(storeCache), ttl+stale); err != nil {
+		return nil
+	}
+	_ = cached.TagApiCache(a.store, cacheKey, apiCacheTags(c))
+	return &storeCache
+}
+
+// 按响应状态码和业务错误码返回缓存时间，不可缓存时ok为false
+func responseCacheTtl(status, code int, opts apiCacheOptions) (ttl, stale int, ok bool) {
+	switch {
+	case status == http.StatusOK && code == http.StatusOK:
+		return opts.ttl, opts.stale, true
+	case status == http.StatusNotFound || entity.IsNotFoundCode(code):
+		return opts.negativeTtl, 0, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// 后台刷新请求的响应写入器，响应已由compute写入缓存，这里只保留在内存中丢弃
+type bufferResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferResponseWriter() *bufferResponseWriter {
+	return &bufferResponseWriter{header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *bufferResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// 等待其他实例写入缓存
+func (a *apiCacher) wait(c *gin.Context, cacheKey string) *responseCache {
+	timeout := time.NewTimer(apiCacheWaitTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(apiCacheWaitInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return nil
+		case <-timeout.C:
+			return nil
+		case <-ticker.C:
+			if cache := a.load(cacheKey); cache != nil {
+				return cache
 			}
 		}
 	}
 }
 
+func (a *apiCacher) load(cacheKey string) *responseCache {
+	cacheData, err := a.store.Get(cacheKey)
+	if err != nil || cacheData == "" {
+		return nil
+	}
+	//将缓存数据解析成对象
+	return unserialize(cacheData)
+}
+
+// 跨实例计算锁 apicache:lock:<缓存key>
+func genApiCacheLockKey(cacheKey string) string {
+	return CacheApiPrefix + "lock:" + strings.TrimPrefix(cacheKey, CacheApiPrefix)
+}
+
+// 返回缓存的响应并终止后续处理
+func writeResponseCache(c *gin.Context, cache *responseCache) {
+	//设置响应头
+	for k, vals := range cache.Header {
+		for _, v := range vals {
+			c.Writer.Header().Set(k, v)
+		}
+	}
+	//设置响应状态码并写入响应体
+	c.Writer.WriteHeader(cache.Status)
+	c.Writer.Write(cache.Data)
+	c.Abort()
+}
+
+// 读取请求体并重置，使后续处理仍可读取
+func readRequestBody(c *gin.Context) []byte {
+	if c.Request.Body == nil {
+		return nil
+	}
+	reqBody, _ := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	return reqBody
+}
+
 // 生成缓存的key
-// 1. 将路径、查询参数和请求体组合成缓存key
+// 1. 将请求方法、路径、规范化后的查询参数和请求体组合成缓存key
 // 2. 如果key长度超过128,使用SHA512进行哈希
 // 3. 添加缓存前缀并返回最终的key
 func CreateKey(c *gin.Context) string {
-	var buf bytes.Buffer
-	reader := io.TeeReader(c.Request.Body, &buf)
-	reqBody, _ := ioutil.ReadAll(reader)
-	c.Request.Body = ioutil.NopCloser(&buf)
+	reqBody := readRequestBody(c)
 
 	path := c.Request.URL.Path
-	query := c.Request.URL.RawQuery
+	query := normalizeQuery(c.Request.URL.Query())
 	// 组合缓存key
-	cacheKey := path + "," + query + string(reqBody)
+	cacheKey := c.Request.Method + "," + path + "," + query + string(reqBody)
 	//如果key太长则进行哈希
 	if len(cacheKey) > 128 {
 		hash := sha512.New()                    // 创建SHA-512哈希对象
@@ -115,6 +399,59 @@ func CreateKey(c *gin.Context) string {
 	return cacheKey
 }
 
+// 规范化查询参数，参数按名称排序，json格式的参数(如filters)按字段名重新序列化
+// 使 ?a=1&b=2 与 ?b=2&a=1 得到相同的key
+func normalizeQuery(values url.Values) string {
+	for _, vals := range values {
+		for i, v := range vals {
+			vals[i] = normalizeJSON(v)
+		}
+	}
+	return values.Encode()
+}
+
+func normalizeJSON(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return value
+	}
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return value
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return value
+	}
+	return string(normalized)
+}
+
+// 响应缓存的tag：链id取自chain_id参数或filters中的chain_id，集合和item取自路由参数
+func apiCacheTags(c *gin.Context) []string {
+	var tags []string
+	chainId := c.Query("chain_id")
+	if chainId == "" {
+		var filter struct {
+			ChainID json.Number `json:"chain_id"`
+		}
+		if filters := c.Query("filters"); filters != "" && json.Unmarshal([]byte(filters), &filter) == nil {
+			chainId = filter.ChainID.String()
+		}
+	}
+	if chainId != "" {
+		tags = append(tags, cached.ApiCacheChainTag(chainId))
+	}
+	if collectionAddr := c.Param("address"); collectionAddr != "" {
+		tags = append(tags, cached.ApiCacheCollectionTag(collectionAddr))
+		if tokenId := c.Param("token_id"); tokenId != "" {
+			tags = append(tags, cached.ApiCacheTokenTag(collectionAddr, tokenId))
+		}
+	}
+	return tags
+}
+
 // 将结构体数据序列化
 func serialize(cache responseCache) string {
 	//创建缓冲区
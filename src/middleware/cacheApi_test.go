@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestResponseCacheTtl(t *testing.T) {
+	opts := apiCacheOptions{ttl: 10, stale: 30, negativeTtl: 5}
+	tests := []struct {
+		name      string
+		status    int
+		code      int
+		wantTtl   int
+		wantStale int
+		wantOk    bool
+	}{
+		{name: "ok", status: http.StatusOK, code: http.StatusOK, wantTtl: 10, wantStale: 30, wantOk: true},
+		{name: "http not found", status: http.StatusNotFound, wantTtl: 5, wantOk: true},
+		{name: "collection not found", status: http.StatusOK, code: entity.ErrCollectionNotFound.Code, wantTtl: 5, wantOk: true},
+		{name: "item not found", status: http.StatusOK, code: entity.ErrItemNotFound.Code, wantTtl: 5, wantOk: true},
+		{name: "business error", status: http.StatusOK, code: 10000},
+		{name: "server error", status: http.StatusInternalServerError, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, stale, ok := responseCacheTtl(tt.status, tt.code, opts)
+			if ttl != tt.wantTtl || stale != tt.wantStale || ok != tt.wantOk {
+				t.Errorf("got (%d, %d, %v), want (%d, %d, %v)", ttl, stale, ok, tt.wantTtl, tt.wantStale, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	a := url.Values{"b": {"2"}, "a": {"1"}, "filters": {`{"z":1, "a":[2]}`}}
+	b := url.Values{"filters": {`{"a":[2],"z":1}`}, "a": {"1"}, "b": {"2"}}
+	if normalizeQuery(a) != normalizeQuery(b) {
+		t.Errorf("%s != %s", normalizeQuery(a), normalizeQuery(b))
+	}
+}
+
+func TestBufferResponseWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/ping", func(c *gin.Context) {
+		c.Header("X-Test", "1")
+		c.String(http.StatusTeapot, "pong")
+	})
+	w := newBufferResponseWriter()
+	req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+	engine.ServeHTTP(w, req)
+	if w.status != http.StatusTeapot || w.body.String() != "pong" || w.Header().Get("X-Test") != "1" {
+		t.Errorf("got status %d body %q header %v", w.status, w.body.String(), w.Header())
+	}
+}
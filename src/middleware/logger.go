@@ -8,6 +8,7 @@ import (
 	"go.uber.org/zap/zapcore"
 	"io"
 	"io/ioutil"
+	"strings"
 	"time"
 )
 
@@ -17,15 +18,24 @@ type BodyLogWrite struct {
 }
 
 func (w *BodyLogWrite) Write(b []byte) (int, error) {
-	w.body.Write(b)
+	if !w.isStream() {
+		w.body.Write(b)
+	}
 	return w.ResponseWriter.Write(b)
 }
 
 func (w *BodyLogWrite) WriteString(s string) (int, error) {
-	w.body.WriteString(s)
+	if !w.isStream() {
+		w.body.WriteString(s)
+	}
 	return w.ResponseWriter.WriteString(s)
 }
 
+// SSE长连接的响应不记录，避免缓冲无限增长
+func (w *BodyLogWrite) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
 // RLog 请求响应日志打印处理
 // RLog() 是一个中间件函数,用于记录HTTP请求和响应的详细日志
 // 主要功能包括:
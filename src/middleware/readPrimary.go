@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"github.com/gin-gonic/gin"
+)
+
+// 强制读主库的请求头，写入后立即读取时携带，避免从库延迟读到旧数据
+const ReadPrimaryHeader = "X-Read-Primary"
+
+// ReadPrimary 请求头X-Read-Primary为1或true时，该请求的查询都使用主库
+func ReadPrimary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.GetHeader(ReadPrimaryHeader) {
+		case "1", "true":
+			c.Request = c.Request.WithContext(dao.WithPrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
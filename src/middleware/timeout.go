@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"EasySwapBackend-test/src/config"
+	"context"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 请求超时的错误码，HTTP状态码为504
+var ErrRequestTimeout = &errcode.Err{Code: 50400, Msg: "request timeout"}
+
+// 超时时由中间件立即返回超时错误，之后丢弃处理函数写入的响应
+// 处理函数和超时协程可能同时写入，写入都通过mu串行；处理函数设置的header先写入本地，实际写入响应时才复制
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu       sync.Mutex
+	header   http.Header
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// 首次写入响应前把处理函数设置的header复制到实际的响应，需持有mu
+func (w *timeoutWriter) syncHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	dst := w.ResponseWriter.Header()
+	for k := range dst {
+		if _, ok := w.header[k]; !ok {
+			dst.Del(k)
+		}
+	}
+	for k, v := range w.header {
+		dst[k] = v
+	}
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.syncHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(b), nil
+	}
+	w.syncHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(s), nil
+	}
+	w.syncHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.syncHeader()
+	w.ResponseWriter.Flush()
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
+
+// 处理函数还未写入响应时返回504和超时错误，返回是否已超时
+func (w *timeoutWriter) timeout() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.ResponseWriter.Written() {
+		return false
+	}
+	w.timedOut = true
+	body, _ := json.Marshal(xhttp.Response{Code: ErrRequestTimeout.Code, Msg: ErrRequestTimeout.Msg})
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	_, _ = w.ResponseWriter.Write(body)
+	w.ResponseWriter.Flush()
+	return true
+}
+
+// 处理函数返回后调用，未超时时把还未写入的header复制到实际的响应，gin随后写入状态码，返回是否已超时
+func (w *timeoutWriter) finish() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.syncHeader()
+	}
+	return w.timedOut
+}
+
+// Timeout 按路由设置请求的超时
+// 1. 请求context在超时后取消，通过context执行的数据库查询随之取消
+// 2. 到达超时时间时处理函数还未写入响应，立即返回504和超时错误，丢弃处理函数之后写入的响应
+// 3. 超时小于0的路由和SSE长连接不限制
+func Timeout(cfg *config.TimeoutCfg) gin.HandlerFunc {
+	if cfg == nil || !cfg.Enable {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	routes := make(map[string]int)
+	for _, route := range cfg.Routes {
+		routes[strings.ToUpper(route.Method)+" "+route.Path] = route.Timeout
+	}
+	return func(c *gin.Context) {
+		timeout, ok := routes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			timeout = cfg.Default
+		}
+		if timeout <= 0 || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		writer := newTimeoutWriter(c.Writer)
+		c.Writer = writer
+
+		//超时协程在到达超时时间时写入响应，处理函数返回后退出
+		method, path := c.Request.Method, c.Request.URL.Path
+		done, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-done:
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded && writer.timeout() {
+					xzap.WithContext(ctx).Warn("request timeout", zap.String("method", method),
+						zap.String("path", path), zap.Int("timeout", timeout))
+				}
+			}
+		}()
+		c.Next()
+		close(done)
+		<-exited
+
+		c.Writer = writer.ResponseWriter
+		if writer.finish() {
+			c.Abort()
+		}
+	}
+}
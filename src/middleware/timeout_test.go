@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"EasySwapBackend-test/src/config"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTimeoutEngine(handlerDelay time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Timeout(&config.TimeoutCfg{
+		Enable:  true,
+		Default: 50,
+		Routes:  []*config.TimeoutRoute{{Method: "get", Path: "/unlimited", Timeout: -1}},
+	}))
+	handler := func(c *gin.Context) {
+		time.Sleep(handlerDelay)
+		c.Header("X-Handler", "1")
+		c.String(http.StatusOK, "ok")
+	}
+	engine.GET("/slow", handler)
+	engine.GET("/unlimited", handler)
+	engine.GET("/no-body", func(c *gin.Context) {
+		c.Header("X-Handler", "1")
+		c.Status(http.StatusNoContent)
+	})
+	return engine
+}
+
+func TestTimeoutRespondsAtDeadline(t *testing.T) {
+	server := httptest.NewServer(newTimeoutEngine(500 * time.Millisecond))
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Errorf("response took %s, want about the 50ms deadline", elapsed)
+	}
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+	}
+	if resp.Header.Get("X-Handler") != "" {
+		t.Error("handler headers should be dropped after timeout")
+	}
+	var data xhttp.Response
+	if err := json.Unmarshal(body, &data); err != nil || data.Code != ErrRequestTimeout.Code {
+		t.Errorf("body = %s, want code %d", body, ErrRequestTimeout.Code)
+	}
+}
+
+func TestTimeoutPassThrough(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		delay      time.Duration
+		wantStatus int
+	}{
+		{name: "fast handler", path: "/slow", wantStatus: http.StatusOK},
+		{name: "unlimited route", path: "/unlimited", delay: 80 * time.Millisecond, wantStatus: http.StatusOK},
+		{name: "headers without body", path: "/no-body", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			newTimeoutEngine(tt.delay).ServeHTTP(w, req)
+			if w.Code != tt.wantStatus || w.Header().Get("X-Handler") != "1" {
+				t.Errorf("status = %d header = %v, want %d with handler header", w.Code, w.Header(), tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package price
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Converter 将不同币种的价格换算为链原生币和美元
+type Converter struct {
+	registry *Registry
+	oracle   Oracle
+}
+
+func NewConverter(registry *Registry, oracle Oracle) *Converter {
+	return &Converter{
+		registry: registry,
+		oracle:   oracle,
+	}
+}
+
+// 换算为链原生币
+// 未配置Converter时按原值返回，与未支持多币种前的结果保持一致
+// 未注册的币种或缺少价格时返回错误，调用方需排除该金额，不能按原生币累加
+func (c *Converter) ToNative(ctx context.Context, chain, currencyAddr string, amount decimal.Decimal) (decimal.Decimal, error) {
+	if c == nil || amount.IsZero() {
+		return amount, nil
+	}
+	currency, ok := c.registry.Lookup(chain, currencyAddr)
+	if !ok {
+		return decimal.Zero, errors.Wrapf(ErrCurrencyNotSupported, "currency %s on %s", currencyAddr, chain)
+	}
+	if currency.Native {
+		return amount, nil
+	}
+	native, ok := c.registry.Native(chain)
+	if !ok {
+		return decimal.Zero, errors.Wrapf(ErrCurrencyNotSupported, "native currency on %s", chain)
+	}
+	currencyUsd, err := c.oracle.UsdPrice(ctx, currency.Symbol)
+	if err != nil {
+		return decimal.Zero, errors.Wrapf(err, "failed on get %s usd price", currency.Symbol)
+	}
+	nativeUsd, err := c.oracle.UsdPrice(ctx, native.Symbol)
+	if err != nil {
+		return decimal.Zero, errors.Wrapf(err, "failed on get %s usd price", native.Symbol)
+	}
+	if nativeUsd.IsZero() {
+		return decimal.Zero, errors.Wrapf(ErrPriceNotFound, "zero %s usd price", native.Symbol)
+	}
+	return amount.Mul(currencyUsd).Div(nativeUsd), nil
+}
+
+// 链原生币换算为美元
+func (c *Converter) NativeToUsd(ctx context.Context, chain string, amount decimal.Decimal) (decimal.Decimal, error) {
+	if c == nil {
+		return decimal.Zero, errors.New("price converter not configured")
+	}
+	native, ok := c.registry.Native(chain)
+	if !ok {
+		return decimal.Zero, errors.New("native currency not configured")
+	}
+	nativeUsd, err := c.oracle.UsdPrice(ctx, native.Symbol)
+	if err != nil {
+		return decimal.Zero, errors.Wrap(err, "failed on get native usd price")
+	}
+	return amount.Mul(nativeUsd), nil
+}
+
+// 可选的美元价格字段，无法换算时返回nil
+func (c *Converter) OptionalUsd(ctx context.Context, chain string, amount decimal.Decimal) *decimal.Decimal {
+	usd, err := c.NativeToUsd(ctx, chain, amount)
+	if err != nil {
+		return nil
+	}
+	return &usd
+}
@@ -0,0 +1,65 @@
+package price
+
+import (
+	"EasySwapBackend-test/src/config"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestConverterToNative(t *testing.T) {
+	const (
+		chainId = 11155111
+		chain   = "sepolia"
+		weth    = "0xfff9976782d46cc05630d1f6ebab18b2324d6b14"
+		usdc    = "0x1c7d4b196cb0c7b01d743fbc6116a902379c7238"
+		unknown = "0x00000000000000000000000000000000000000ff"
+	)
+	registry := NewRegistry([]*config.CurrencyCfg{
+		{ChainId: chainId, Address: ZeroAddress, Symbol: "ETH", Native: true},
+		{ChainId: chainId, Address: weth, Symbol: "WETH"},
+		{ChainId: chainId, Address: usdc, Symbol: "USDC"},
+	})
+	oracle, err := NewStaticOracle(map[string]string{"ETH": "2000", "WETH": "2000"})
+	if err != nil {
+		t.Fatalf("NewStaticOracle: %v", err)
+	}
+	converter := NewConverter(registry, oracle)
+
+	tests := []struct {
+		name      string
+		converter *Converter
+		chain     string
+		currency  string
+		amount    string
+		want      string
+		wantErr   error
+	}{
+		{name: "native by zero address", converter: converter, chain: chain, currency: ZeroAddress, amount: "1.5", want: "1.5"},
+		{name: "native by empty address", converter: converter, chain: chain, currency: "", amount: "2", want: "2"},
+		{name: "erc20 with price", converter: converter, chain: chain, currency: weth, amount: "3", want: "3"},
+		{name: "zero amount", converter: converter, chain: chain, currency: unknown, amount: "0", want: "0"},
+		{name: "unknown currency", converter: converter, chain: chain, currency: unknown, amount: "100", wantErr: ErrCurrencyNotSupported},
+		{name: "unknown chain", converter: converter, chain: "mainnet", currency: weth, amount: "1", wantErr: ErrCurrencyNotSupported},
+		{name: "missing price", converter: converter, chain: chain, currency: usdc, amount: "100", wantErr: ErrPriceNotFound},
+		{name: "converter not configured", converter: nil, chain: chain, currency: usdc, amount: "100", want: "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.converter.ToNative(context.Background(), tt.chain, tt.currency, decimal.RequireFromString(tt.amount))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package price
+
+import (
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/utils"
+	"strings"
+)
+
+// 零地址，activity中原生币的currency_address
+const ZeroAddress = "0x0000000000000000000000000000000000000000"
+
+// 币种信息，订单和成交记录中的价格已是币的单位，不需要再按精度换算
+type Currency struct {
+	Chain   string
+	Address string
+	Symbol  string
+	Native  bool
+}
+
+// Registry 各链支持的币种
+type Registry struct {
+	currencies map[string]map[string]*Currency // chain -> address -> currency
+	natives    map[string]*Currency            // chain -> 原生币
+}
+
+func NewRegistry(cfgs []*config.CurrencyCfg) *Registry {
+	r := &Registry{
+		currencies: make(map[string]map[string]*Currency),
+		natives:    make(map[string]*Currency),
+	}
+	for _, cfg := range cfgs {
+		chain, ok := utils.ChainIdToChain[cfg.ChainId]
+		if !ok {
+			continue
+		}
+		currency := &Currency{
+			Chain:   chain,
+			Address: strings.ToLower(cfg.Address),
+			Symbol:  strings.ToUpper(cfg.Symbol),
+			Native:  cfg.Native,
+		}
+		if _, ok := r.currencies[chain]; !ok {
+			r.currencies[chain] = make(map[string]*Currency)
+		}
+		r.currencies[chain][currency.Address] = currency
+		if currency.Native {
+			r.natives[chain] = currency
+		}
+	}
+	return r
+}
+
+// 查询币种，地址为空或零地址时返回原生币
+func (r *Registry) Lookup(chain, address string) (*Currency, bool) {
+	address = strings.ToLower(address)
+	if address == "" || address == ZeroAddress {
+		native, ok := r.natives[chain]
+		return native, ok
+	}
+	currency, ok := r.currencies[chain][address]
+	return currency, ok
+}
+
+// 查询链的原生币
+func (r *Registry) Native(chain string) (*Currency, bool) {
+	native, ok := r.natives[chain]
+	return native, ok
+}
@@ -0,0 +1,83 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrPriceNotFound        = errors.New("price not found")
+	ErrCurrencyNotSupported = errors.New("currency not supported")
+)
+
+// Oracle 币种美元价格查询接口
+type Oracle interface {
+	UsdPrice(ctx context.Context, symbol string) (decimal.Decimal, error)
+}
+
+// StaticOracle 固定价格的Oracle，价格来自配置或本地文件，用于离线环境
+type StaticOracle struct {
+	mu     sync.RWMutex
+	prices map[string]decimal.Decimal
+}
+
+// 根据配置创建，key为币种符号，value为美元价格
+func NewStaticOracle(prices map[string]string) (*StaticOracle, error) {
+	o := &StaticOracle{}
+	if err := o.set(prices); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// 从json文件创建，文件格式 {"ETH": "3000.5", "USDC": "1"}
+func NewFileOracle(path string) (*StaticOracle, error) {
+	o := &StaticOracle{}
+	if err := o.Reload(path); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// 重新加载价格文件
+func (o *StaticOracle) Reload(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed on read price file")
+	}
+	var prices map[string]string
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return errors.Wrap(err, "failed on parse price file")
+	}
+	return o.set(prices)
+}
+
+func (o *StaticOracle) set(prices map[string]string) error {
+	parsed := make(map[string]decimal.Decimal)
+	for symbol, p := range prices {
+		v, err := decimal.NewFromString(p)
+		if err != nil {
+			return errors.Wrapf(err, "invalid price of %s", symbol)
+		}
+		parsed[strings.ToUpper(symbol)] = v
+	}
+	o.mu.Lock()
+	o.prices = parsed
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *StaticOracle) UsdPrice(ctx context.Context, symbol string) (decimal.Decimal, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	p, ok := o.prices[strings.ToUpper(symbol)]
+	if !ok {
+		return decimal.Zero, ErrPriceNotFound
+	}
+	return p, nil
+}
@@ -0,0 +1,79 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// Handler 处理频道消息，同一频道的消息按顺序回调
+type Handler func(payload []byte)
+
+// Broker 基于Redis pub/sub的消息分发，多副本部署时每个实例都会收到全部消息
+type Broker struct {
+	client   redis.UniversalClient
+	pubsub   *redis.PubSub
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBroker(client redis.UniversalClient) *Broker {
+	return &Broker{
+		client:   client,
+		pubsub:   client.Subscribe(context.Background()),
+		handlers: make(map[string][]Handler),
+	}
+}
+
+// 发布消息，消息体序列化为json
+func (b *Broker) Publish(ctx context.Context, channel string, message interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal message")
+	}
+	if err := b.client.Publish(ctx, channel, payload).Err(); err != nil {
+		return errors.Wrap(err, "failed on publish message")
+	}
+	return nil
+}
+
+// 注册频道处理函数，首次注册时订阅该频道
+func (b *Broker) Handle(ctx context.Context, channel string, handler Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.handlers[channel]; !ok {
+		if err := b.pubsub.Subscribe(ctx, channel); err != nil {
+			return errors.Wrap(err, "failed on subscribe channel")
+		}
+	}
+	b.handlers[channel] = append(b.handlers[channel], handler)
+	return nil
+}
+
+// 接收订阅的消息并分发给处理函数，连接断开时由redis客户端自动重连并重新订阅
+func (b *Broker) Run(ctx context.Context) {
+	ch := b.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.pubsub.Close(); err != nil {
+				xzap.WithContext(ctx).Error("failed on close pubsub", zap.Error(err))
+			}
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			b.mu.RLock()
+			handlers := b.handlers[msg.Channel]
+			b.mu.RUnlock()
+			for _, handler := range handlers {
+				handler([]byte(msg.Payload))
+			}
+		}
+	}
+}
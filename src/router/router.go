@@ -22,6 +22,7 @@ func NewRouter(serverCtx *svc.ServerCtx) *gin.Engine {
 	router.Use(middleware.RecoverMiddleware()) //配置自定义的恢复中间件
 	router.Use(middleware.RLog())              //配置自定义的日志中间件
 	router.Use(middleware.Cors())              //配置自定义的cors跨域中间件
+	router.Use(middleware.ReadPrimary())       //请求头要求时查询使用主库
 	initV1Route(router, serverCtx)             //加载业务api路由
 	pprof.Register(router)                     // 注册pprof路由
 	return router
@@ -9,12 +9,19 @@ import (
 
 func initV1Route(router *gin.Engine, serverCtx *svc.ServerCtx) {
 	apiV1 := router.Group("/api/v1")
+	apiV1.Use(middleware.Timeout(serverCtx.C.Timeout))                                // 按路由设置请求超时，超时后取消查询
+	apiV1.Use(middleware.RouteCache(serverCtx.KvStore, serverCtx.C.ApiCache, router)) // 按配置缓存接口响应
 
 	user := apiV1.Group("/user")
 	user.GET("/:address/login-message", controller.GetLoginMessageHandler(serverCtx)) // 生成login签名信息
 	user.GET("/login", controller.UserLoginHandler(serverCtx))                        // 登录
 	user.GET("/:address/sig-status", controller.GetUserSignStatusHandler(serverCtx))  // 获取用户签名状态
 
+	user.GET("/alerts", middleware.AuthMiddleWare(serverCtx.KvStore), controller.UserPriceAlertsHandler(serverCtx))         // 查询价格提醒
+	user.POST("/alerts", middleware.AuthMiddleWare(serverCtx.KvStore), controller.CreatePriceAlertHandler(serverCtx))       // 新增价格提醒
+	user.PUT("/alerts/:id", middleware.AuthMiddleWare(serverCtx.KvStore), controller.UpdatePriceAlertHandler(serverCtx))    // 修改价格提醒
+	user.DELETE("/alerts/:id", middleware.AuthMiddleWare(serverCtx.KvStore), controller.DeletePriceAlertHandler(serverCtx)) // 删除价格提醒
+
 	collections := apiV1.Group("/collections")
 	collections.GET("/:address", controller.CollectionDetailHandler(serverCtx))                 //指定Collection详情
 	collections.GET("/:address/bids", controller.CollectionBidsHandler(serverCtx))              //指定Collection的bids信息
@@ -23,15 +30,19 @@ func initV1Route(router *gin.Engine, serverCtx *svc.ServerCtx) {
 	collections.GET("/:address/:token_id", controller.ItemDetailHandler(serverCtx))             //item详情
 	collections.GET("/:address/:token_id/trait", controller.ItemTraitsHandler(serverCtx))       //查询item特性信息
 	collections.GET("/:address/top-trait", controller.ItemTopTraitPriceHandler(serverCtx))      //获取指定 item的Trait的最高价格信息
-	collections.GET("/:address/:token_id/image", middleware.CacheApi(serverCtx.KvStore, 60),
-		controller.ItemImageHandler(serverCtx)) // 获取NFT Item的图片信息
+	collections.GET("/:address/:token_id/image",
+		controller.ItemImageHandler(serverCtx)) // 获取NFT Item的图片信息，缓存见api_cache配置
 	collections.GET("/:address/history-sales", controller.HistorySalesHandler(serverCtx))             //查询指定时间段 NFT的历史销售价格
 	collections.GET("/:address/:token_id/owner", controller.ItemOwnerHandler(serverCtx))              //获取NFT所有者信息
 	collections.GET("/:address/:token_id/metadata", controller.RefreshItemMetadataHandler(serverCtx)) //刷新NFT的元数据信息
 	collections.GET("/ranking", controller.TopRankingHandler(serverCtx))                              // 获取NFT集合排名信息
+	collections.GET("/:address/stream", controller.CollectionStreamHandler(serverCtx))                // 实时推送集合地板价、上架数量等数据(SSE)
+	collections.POST("/:address/refresh-metadata", middleware.AuthMiddleWare(serverCtx.KvStore),
+		controller.RefreshCollectionMetadataHandler(serverCtx)) // 刷新集合全部或指定token的元数据
 
 	activities := apiV1.Group("/activities")
-	activities.GET("", controller.ActivityMultiChainHandler(serverCtx)) //批量获取activity信息
+	activities.GET("", controller.ActivityMultiChainHandler(serverCtx))    //批量获取activity信息
+	activities.GET("/stream", controller.ActivityStreamHandler(serverCtx)) //实时推送activity信息(SSE)
 
 	portfolio := apiV1.Group("/portfolio")
 	portfolio.GET("/collections", controller.UserMultiChainCollectionsHandler(serverCtx)) //获取用户拥有Collection信息
@@ -40,5 +51,36 @@ func initV1Route(router *gin.Engine, serverCtx *svc.ServerCtx) {
 	portfolio.GET("/bids", controller.UserMultiChainBidsHandler(serverCtx))               //查询用户出价的Bid信息
 
 	orders := apiV1.Group("/bid-orders")
-	orders.GET("", controller.OrderInfosHandler(serverCtx)) //批量查询出价信息
+	orders.GET("", controller.OrderInfosHandler(serverCtx))                                                       //批量查询出价信息
+	orders.POST("/trait", middleware.AuthMiddleWare(serverCtx.KvStore), controller.AddTraitBidHandler(serverCtx)) //保存trait出价
+
+	fees := apiV1.Group("/fees")
+	fees.POST("/preview", controller.FeePreviewHandler(serverCtx)) //挂单手续费预览
+
+	webhooks := apiV1.Group("/webhooks", middleware.AuthMiddleWare(serverCtx.KvStore))
+	webhooks.POST("", controller.RegisterWebhookHandler(serverCtx))                 //注册webhook
+	webhooks.GET("", controller.UserWebhooksHandler(serverCtx))                     //查询用户的webhook
+	webhooks.DELETE("/:id", controller.DeleteWebhookHandler(serverCtx))             //删除webhook
+	webhooks.GET("/:id/deliveries", controller.WebhookDeliveriesHandler(serverCtx)) //查询webhook投递记录
+
+	jobs := apiV1.Group("/jobs", middleware.AuthMiddleWare(serverCtx.KvStore))
+	jobs.GET("/:id", controller.MetadataRefreshJobHandler(serverCtx))          //查询元数据刷新任务进度
+	jobs.DELETE("/:id", controller.CancelMetadataRefreshJobHandler(serverCtx)) //取消元数据刷新任务
+
+	watchlist := apiV1.Group("/watchlist", middleware.AuthMiddleWare(serverCtx.KvStore))
+	watchlist.GET("", controller.WatchlistHandler(serverCtx))          //查询关注列表
+	watchlist.POST("", controller.AddWatchlistHandler(serverCtx))      //关注集合或item
+	watchlist.DELETE("", controller.RemoveWatchlistHandler(serverCtx)) //取消关注
+
+	admin := apiV1.Group("/admin", middleware.AuthMiddleWare(serverCtx.KvStore),
+		middleware.AdminMiddleWare(serverCtx.KvStore, serverCtx.C.ProjectCfg.Admins))
+	admin.GET("/owner-discrepancies", controller.OwnerDiscrepanciesHandler(serverCtx)) //查询NFT所有者对账报告
+	admin.GET("/local-cache", controller.LocalCacheStatsHandler(serverCtx))            //查询本实例进程内缓存命中统计
+	admin.GET("/replicas", controller.ReplicaStatusHandler(serverCtx))                 //查询本实例从库复制延迟
+
+	notifications := apiV1.Group("/notifications", middleware.AuthMiddleWare(serverCtx.KvStore))
+	notifications.GET("", controller.NotificationsHandler(serverCtx))                        //分页查询用户通知
+	notifications.GET("/unread-count", controller.NotificationUnreadCountHandler(serverCtx)) //查询未读通知数
+	notifications.POST("/:id/read", controller.ReadNotificationHandler(serverCtx))           //标记通知已读
+	notifications.POST("/read-all", controller.ReadAllNotificationsHandler(serverCtx))       //全部标记已读
 }
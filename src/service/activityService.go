@@ -1,6 +1,7 @@
 package service
 
 import (
+	"EasySwapBackend-test/src/dao"
 	"EasySwapBackend-test/src/entity"
 	"EasySwapBackend-test/src/svc"
 	"context"
@@ -14,10 +15,12 @@ func GetMultiChainActivity(ctx context.Context, serverCtx *svc.ServerCtx, chains
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on query multi-chain activity")
 	}
-	if len(activities) == 0 || total == 0 {
+	approximate := total != entity.CountSkipped && dao.IsApproximateActivityCount(filter)
+	if len(activities) == 0 {
 		return &entity.ActivityResp{
-			Result: nil,
-			Count:  0,
+			Result:      nil,
+			Count:       total,
+			Approximate: approximate,
 		}, nil
 	}
 	//查询多链活动的外部信息
@@ -26,7 +29,9 @@ func GetMultiChainActivity(ctx context.Context, serverCtx *svc.ServerCtx, chains
 		return nil, errors.Wrap(err, "failed on query activity external info")
 	}
 	return &entity.ActivityResp{
-		Result: results,
-		Count:  total,
+		Result:      results,
+		Count:       total,
+		NextCursor:  dao.NextActivityCursor(activities, filter.PageSize),
+		Approximate: approximate,
 	}, nil
 }
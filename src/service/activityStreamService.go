@@ -0,0 +1,369 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStreamPollInterval = 2
+	defaultStreamBuffer       = 64
+	defaultStreamMaxDropped   = 256
+	activityStreamBatchSize   = 200
+	// 游标之前需要重新检查的空缺id范围，indexer的事务提交顺序与id顺序不一致时会出现空缺
+	activityCursorGapWindow = 1000
+)
+
+// 影响挂单或出价的activity类型对应的订单事件类型
+var activityTradeEventTypes = map[int]ordermanager.EventType{
+	multi.Sale:                ordermanager.Buy,
+	multi.Buy:                 ordermanager.Buy,
+	multi.Listing:             ordermanager.Listing,
+	multi.CancelListing:       ordermanager.Cancel,
+	multi.MakeOffer:           ordermanager.UpdateCollection,
+	multi.CancelOffer:         ordermanager.Cancel,
+	multi.CollectionBid:       ordermanager.UpdateCollection,
+	multi.ItemBid:             ordermanager.UpdateCollection,
+	multi.CancelCollectionBid: ordermanager.Cancel,
+	multi.CancelItemBid:       ordermanager.Cancel,
+}
+
+// 实时activity频道 <项目名>:stream:activity
+func genActivityStreamChannel(project string) string {
+	return fmt.Sprintf("%s:stream:activity", strings.ToLower(project))
+}
+
+// 已推送的activity游标 cache:<项目名>:<链名>:activity:stream:last-id
+func genActivityStreamLastIdKey(project, chain string) string {
+	return fmt.Sprintf("cache:%s:%s:activity:stream:last-id", strings.ToLower(project), chain)
+}
+
+// 实时activity推送的进程内订阅管理
+var activityHub = newActivityHub(defaultStreamBuffer, defaultStreamMaxDropped)
+
+// ActivityHub 管理当前实例上的activity订阅连接，buffer和maxDropped只在持有锁时读写
+type ActivityHub struct {
+	mu         sync.RWMutex
+	clients    map[*ActivitySubscriber]struct{}
+	buffer     int
+	maxDropped int
+}
+
+func newActivityHub(buffer, maxDropped int) *ActivityHub {
+	return &ActivityHub{
+		clients:    make(map[*ActivitySubscriber]struct{}),
+		buffer:     buffer,
+		maxDropped: maxDropped,
+	}
+}
+
+// 更新缓冲大小和最大连续丢弃数量，只对之后的订阅和分发生效
+func (h *ActivityHub) configure(buffer, maxDropped int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if buffer > 0 {
+		h.buffer = buffer
+	}
+	if maxDropped > 0 {
+		h.maxDropped = maxDropped
+	}
+}
+
+// ActivitySubscriber 单个订阅连接
+// 消息通过带缓冲的C发送，客户端消费过慢导致缓冲满时丢弃消息，连续丢弃过多时关闭Done断开连接
+type ActivitySubscriber struct {
+	C       chan entity.ActivityInfo
+	Done    chan struct{}
+	filter  entity.ActivityStreamFilter
+	dropped int
+	once    sync.Once
+}
+
+func (s *ActivitySubscriber) match(activity *entity.ActivityInfo) bool {
+	if s.filter.ChainID != 0 && s.filter.ChainID != activity.ChainID {
+		return false
+	}
+	if s.filter.CollectionAddress != "" && !strings.EqualFold(s.filter.CollectionAddress, activity.CollectionAddress) {
+		return false
+	}
+	if s.filter.TokenID != "" && s.filter.TokenID != activity.TokenID {
+		return false
+	}
+	if s.filter.UserAddress != "" && !strings.EqualFold(s.filter.UserAddress, activity.Maker) &&
+		!strings.EqualFold(s.filter.UserAddress, activity.Taker) {
+		return false
+	}
+	return true
+}
+
+func (s *ActivitySubscriber) close() {
+	s.once.Do(func() {
+		close(s.Done)
+	})
+}
+
+// 分发activity到匹配的订阅连接，不阻塞，仅在Broker的消息循环中调用
+func (h *ActivityHub) dispatch(activity *entity.ActivityInfo) {
+	var slow []*ActivitySubscriber
+	h.mu.RLock()
+	for s := range h.clients {
+		if !s.match(activity) {
+			continue
+		}
+		select {
+		case s.C <- *activity:
+			s.dropped = 0
+		default:
+			s.dropped++
+			if s.dropped > h.maxDropped {
+				slow = append(slow, s)
+			}
+		}
+	}
+	h.mu.RUnlock()
+	for _, s := range slow {
+		h.remove(s)
+	}
+}
+
+func (h *ActivityHub) remove(s *ActivitySubscriber) {
+	h.mu.Lock()
+	delete(h.clients, s)
+	h.mu.Unlock()
+	s.close()
+}
+
+func (h *ActivityHub) subscribe(filter entity.ActivityStreamFilter) *ActivitySubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &ActivitySubscriber{
+		C:      make(chan entity.ActivityInfo, h.buffer),
+		Done:   make(chan struct{}),
+		filter: filter,
+	}
+	h.clients[s] = struct{}{}
+	return s
+}
+
+// SubscribeActivities 订阅实时activity，返回的订阅需调用UnsubscribeActivities释放
+func SubscribeActivities(filter entity.ActivityStreamFilter) *ActivitySubscriber {
+	return activityHub.subscribe(filter)
+}
+
+// UnsubscribeActivities 取消订阅
+func UnsubscribeActivities(s *ActivitySubscriber) {
+	activityHub.remove(s)
+}
+
+// StartActivityStream 启动实时activity推送
+// 1. 订阅Redis频道，将收到的activity分发给本实例的订阅连接
+// 2. 定时拉取各链新增的activity并发布到Redis频道，通过Redis锁保证每条链只有一个实例在拉取
+// 3. 拉取时同时递增activity计数版本号，未配置Broker时不订阅和推送，仍定时拉取以使计数缓存失效
+func StartActivityStream(ctx context.Context, serverCtx *svc.ServerCtx) {
+	pollInterval := defaultStreamPollInterval
+	if cfg := serverCtx.C.Stream; cfg != nil {
+		if cfg.PollInterval > 0 {
+			pollInterval = cfg.PollInterval
+		}
+		activityHub.configure(cfg.Buffer, cfg.MaxDropped)
+	}
+
+	//1、订阅频道
+	channel := genActivityStreamChannel(serverCtx.C.ProjectCfg.Name)
+	if serverCtx.Broker != nil {
+		err := serverCtx.Broker.Handle(ctx, channel, func(payload []byte) {
+			var activity entity.ActivityInfo
+			if err := json.Unmarshal(payload, &activity); err != nil {
+				xzap.WithContext(ctx).Error("failed on unmarshal activity", zap.Error(err))
+				return
+			}
+			activityHub.dispatch(&activity)
+		})
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on subscribe activity stream", zap.Error(err))
+			return
+		}
+	}
+
+	//2、定时拉取并发布新activity
+	ticker := time.NewTicker(time.Duration(pollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, supported := range serverCtx.C.ChainSupported {
+				lock := cached.NewRedisLock(serverCtx.KvStore,
+					genActivityStreamLastIdKey(serverCtx.C.ProjectCfg.Name, supported.Name)+":lock", pollInterval*3)
+				ok, err := lock.Acquire()
+				if err != nil || !ok {
+					continue
+				}
+				if err := publishNewActivities(ctx, serverCtx, channel, supported.Name, supported.ChainId); err != nil {
+					xzap.WithContext(ctx).Error("failed on publish activities", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+				if err := lock.Release(); err != nil {
+					xzap.WithContext(ctx).Error("failed on release activity stream lock", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// 拉取指定链上新增的activity并发布
+func publishNewActivities(ctx context.Context, serverCtx *svc.ServerCtx, channel, chain string, chainId int) error {
+	//1、读取游标，首次运行时从当前最大id开始，不推送历史数据
+	lastIdKey := genActivityStreamLastIdKey(serverCtx.C.ProjectCfg.Name, chain)
+	cursor, err := loadActivityCursor(ctx, serverCtx, chain, lastIdKey)
+	if err != nil || cursor == nil {
+		return err
+	}
+
+	//2、查询新增activity和之前空缺、现已提交的activity，挂单、出价、成交相关的activity先发布订单事件，驱动集合实时数据推送。
+	// 订单事件只用于标记集合需要刷新，后续步骤失败重新拉取时重复发布不影响结果
+	activities, next, err := readActivitiesAfterCursor(ctx, serverCtx, chain, cursor, activityStreamBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(activities) == 0 {
+		return nil
+	}
+	for _, event := range activityTradeEvents(activities) {
+		if err := publishTradeEvent(ctx, serverCtx, chain, event); err != nil {
+			xzap.WithContext(ctx).Error("failed on publish trade event", zap.Error(err))
+		}
+	}
+
+	//3、递增相关链和集合的计数版本号，使activity总数缓存失效
+	var collectionAddrs []string
+	for _, activity := range activities {
+		collectionAddrs = append(collectionAddrs, activity.CollectionAddress)
+	}
+	if err := serverCtx.Dao.IncrActivityCountVersions(ctx, chain, collectionAddrs); err != nil {
+		xzap.WithContext(ctx).Error("failed on incr activity count versions", zap.Error(err))
+	}
+
+	//4、补充item、collection信息后发布到频道并保存游标，未配置Broker时只保存游标
+	if serverCtx.Broker != nil {
+		infos, err := serverCtx.Dao.QueryMultiChainActivityExternalInfo(ctx, []int{chainId}, []string{chain}, activities)
+		if err != nil {
+			return errors.Wrap(err, "failed on query activity external info")
+		}
+		for i := range infos {
+			if err := serverCtx.Broker.Publish(ctx, channel, infos[i]); err != nil {
+				return errors.Wrap(err, "failed on publish activity")
+			}
+		}
+	}
+	return saveActivityCursor(serverCtx, lastIdKey, next)
+}
+
+// 按id顺序读取activity的游标
+// indexer的事务提交顺序与id顺序不一致时，LastId之前可能还有未提交的activity，这些空缺id记录在Gaps中之后重新检查
+type activityCursor struct {
+	LastId int64   `json:"last_id"`
+	Gaps   []int64 `json:"gaps,omitempty"`
+}
+
+// 解析游标，兼容只保存最大id的旧格式
+func parseActivityCursor(value string) (*activityCursor, error) {
+	if lastId, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return &activityCursor{LastId: lastId}, nil
+	}
+	var cursor activityCursor
+	if err := json.Unmarshal([]byte(value), &cursor); err != nil {
+		return nil, errors.Wrap(err, "invalid activity cursor")
+	}
+	return &cursor, nil
+}
+
+// 读取保存在Redis中的游标，首次运行时以当前最大id初始化游标并返回nil
+func loadActivityCursor(ctx context.Context, serverCtx *svc.ServerCtx, chain, key string) (*activityCursor, error) {
+	value, err := serverCtx.KvStore.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get activity cursor")
+	}
+	if value != "" {
+		return parseActivityCursor(value)
+	}
+	maxId, err := serverCtx.Dao.QueryMaxActivityId(ctx, chain)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query max activity id")
+	}
+	return nil, saveActivityCursor(serverCtx, key, &activityCursor{LastId: maxId})
+}
+
+func saveActivityCursor(serverCtx *svc.ServerCtx, key string, cursor *activityCursor) error {
+	value, err := json.Marshal(cursor)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal activity cursor")
+	}
+	if err := serverCtx.KvStore.Set(key, string(value)); err != nil {
+		return errors.Wrap(err, "failed on save activity cursor")
+	}
+	return nil
+}
+
+// 读取游标之后的新activity和之前空缺、现已提交的activity，返回按id升序的activity和推进后的游标
+func readActivitiesAfterCursor(ctx context.Context, serverCtx *svc.ServerCtx, chain string, cursor *activityCursor, batchSize int) ([]dao.ActivityMultiChainInfo, *activityCursor, error) {
+	found, err := serverCtx.Dao.QueryActivitiesByIds(ctx, chain, cursor.Gaps)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed on query gap activities")
+	}
+	activities, err := serverCtx.Dao.QueryActivitiesAfter(ctx, chain, cursor.LastId, batchSize)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed on query new activities")
+	}
+	merged, next := advanceActivityCursor(cursor, found, activities)
+	return merged, next, nil
+}
+
+// 合并找到的空缺activity和新activity并计算新的游标，空缺id都小于新activity的id，合并后仍按id升序
+func advanceActivityCursor(cursor *activityCursor, found, activities []dao.ActivityMultiChainInfo) ([]dao.ActivityMultiChainInfo, *activityCursor) {
+	foundIds := make(map[int64]bool, len(found))
+	for _, activity := range found {
+		foundIds[activity.Id] = true
+	}
+	ids := make([]int64, 0, len(activities))
+	for _, activity := range activities {
+		ids = append(ids, activity.Id)
+	}
+	gaps, lastId := nextTradeStatsGaps(cursor.Gaps, foundIds, cursor.LastId, ids, activityCursorGapWindow)
+	return append(found, activities...), &activityCursor{LastId: lastId, Gaps: gaps}
+}
+
+// 挂单、出价、成交相关的activity对应的订单事件，其他类型的activity忽略
+func activityTradeEvents(activities []dao.ActivityMultiChainInfo) []*ordermanager.TradeEvent {
+	var events []*ordermanager.TradeEvent
+	for _, activity := range activities {
+		eventType, ok := activityTradeEventTypes[activity.ActivityType]
+		if !ok {
+			continue
+		}
+		events = append(events, &ordermanager.TradeEvent{
+			EventType:      eventType,
+			CollectionAddr: activity.CollectionAddress,
+			TokenID:        activity.TokenId,
+			From:           activity.Maker,
+			To:             activity.Taker,
+			Price:          activity.Price,
+		})
+	}
+	return events
+}
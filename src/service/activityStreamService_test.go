@@ -0,0 +1,169 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestActivitySubscriberMatch(t *testing.T) {
+	activity := &entity.ActivityInfo{
+		ChainID:           11155111,
+		CollectionAddress: "0xAbC",
+		TokenID:           "1",
+		Maker:             "0xMaker",
+		Taker:             "0xTaker",
+	}
+	tests := []struct {
+		name   string
+		filter entity.ActivityStreamFilter
+		want   bool
+	}{
+		{name: "empty filter", want: true},
+		{name: "chain matches", filter: entity.ActivityStreamFilter{ChainID: 11155111}, want: true},
+		{name: "chain differs", filter: entity.ActivityStreamFilter{ChainID: 1}, want: false},
+		{name: "collection ignores case", filter: entity.ActivityStreamFilter{CollectionAddress: "0xabc"}, want: true},
+		{name: "token differs", filter: entity.ActivityStreamFilter{TokenID: "2"}, want: false},
+		{name: "user as taker", filter: entity.ActivityStreamFilter{UserAddress: "0xtaker"}, want: true},
+		{name: "user not involved", filter: entity.ActivityStreamFilter{UserAddress: "0xother"}, want: false},
+	}
+	for _, tt := range tests {
+		s := &ActivitySubscriber{filter: tt.filter}
+		if got := s.match(activity); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestActivityHubDropsSlowSubscriber(t *testing.T) {
+	hub := newActivityHub(1, 2)
+	s := hub.subscribe(entity.ActivityStreamFilter{})
+	if cap(s.C) != 1 {
+		t.Fatalf("buffer = %d, want 1", cap(s.C))
+	}
+	activity := &entity.ActivityInfo{TokenID: "1"}
+	// 第一条进入缓冲，之后连续丢弃超过2条时断开
+	for i := 0; i < 4; i++ {
+		hub.dispatch(activity)
+	}
+	select {
+	case <-s.Done:
+	default:
+		t.Fatal("slow subscriber should be closed")
+	}
+	hub.mu.RLock()
+	_, ok := hub.clients[s]
+	hub.mu.RUnlock()
+	if ok {
+		t.Fatal("slow subscriber should be removed")
+	}
+}
+
+// 分发只在Broker的消息循环中执行，订阅和更新配置与分发并发执行，配合-race检查
+func TestActivityHubConfigureConcurrently(t *testing.T) {
+	hub := newActivityHub(defaultStreamBuffer, defaultStreamMaxDropped)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			hub.dispatch(&entity.ActivityInfo{})
+		}
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			hub.remove(hub.subscribe(entity.ActivityStreamFilter{}))
+		}()
+		go func(i int) {
+			defer wg.Done()
+			hub.configure(i+1, i+1)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestActivityTradeEvents(t *testing.T) {
+	activity := func(activityType int) dao.ActivityMultiChainInfo {
+		return dao.ActivityMultiChainInfo{Activity: multi.Activity{ActivityType: activityType, CollectionAddress: "0xabc", TokenId: "1"}}
+	}
+	tests := []struct {
+		name       string
+		activities []dao.ActivityMultiChainInfo
+		want       []ordermanager.EventType
+	}{
+		{name: "sale", activities: []dao.ActivityMultiChainInfo{activity(multi.Sale)}, want: []ordermanager.EventType{ordermanager.Buy}},
+		{name: "listing and cancel", activities: []dao.ActivityMultiChainInfo{activity(multi.Listing), activity(multi.CancelListing)},
+			want: []ordermanager.EventType{ordermanager.Listing, ordermanager.Cancel}},
+		{name: "collection bid", activities: []dao.ActivityMultiChainInfo{activity(multi.CollectionBid)}, want: []ordermanager.EventType{ordermanager.UpdateCollection}},
+		{name: "transfer is ignored", activities: []dao.ActivityMultiChainInfo{activity(multi.Transfer)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := activityTradeEvents(tt.activities)
+			if len(events) != len(tt.want) {
+				t.Fatalf("events = %d, want %d", len(events), len(tt.want))
+			}
+			for i, event := range events {
+				if event.EventType != tt.want[i] {
+					t.Errorf("event %d type = %d, want %d", i, event.EventType, tt.want[i])
+				}
+				if event.CollectionAddr != "0xabc" || event.TokenID != "1" {
+					t.Errorf("event %d = %+v", i, event)
+				}
+			}
+		})
+	}
+}
+
+func TestParseActivityCursor(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    activityCursor
+		wantErr bool
+	}{
+		{value: "42", want: activityCursor{LastId: 42}},
+		{value: `{"last_id":42,"gaps":[40,41]}`, want: activityCursor{LastId: 42, Gaps: []int64{40, 41}}},
+		{value: "not a cursor", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseActivityCursor(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseActivityCursor(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if err == nil && !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("parseActivityCursor(%q) = %+v, want %+v", tt.value, *got, tt.want)
+		}
+	}
+}
+
+func TestAdvanceActivityCursor(t *testing.T) {
+	activity := func(id int64) dao.ActivityMultiChainInfo {
+		return dao.ActivityMultiChainInfo{Activity: multi.Activity{Id: id}}
+	}
+	// 空缺7已提交，5仍未提交，10和12之间的空缺11加入游标
+	cursor := &activityCursor{LastId: 9, Gaps: []int64{5, 7}}
+	merged, next := advanceActivityCursor(cursor, []dao.ActivityMultiChainInfo{activity(7)},
+		[]dao.ActivityMultiChainInfo{activity(10), activity(12)})
+	var ids []int64
+	for _, a := range merged {
+		ids = append(ids, a.Id)
+	}
+	if want := []int64{7, 10, 12}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("merged ids = %v, want %v", ids, want)
+	}
+	if want := (activityCursor{LastId: 12, Gaps: []int64{5, 11}}); !reflect.DeepEqual(*next, want) {
+		t.Errorf("next cursor = %+v, want %+v", *next, want)
+	}
+
+	// 没有新activity时游标不变
+	merged, next = advanceActivityCursor(&activityCursor{LastId: 12, Gaps: []int64{11}}, nil, nil)
+	if len(merged) != 0 || next.LastId != 12 || !reflect.DeepEqual(next.Gaps, []int64{11}) {
+		t.Errorf("empty advance = %v, %+v", merged, *next)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const defaultApiCachePurgeDebounce = 500
+
+// 待清除的接口缓存tag
+type apiCachePurger struct {
+	mu   sync.Mutex
+	tags map[string]struct{}
+}
+
+func (p *apiCachePurger) add(tag string) {
+	p.mu.Lock()
+	p.tags[tag] = struct{}{}
+	p.mu.Unlock()
+}
+
+func (p *apiCachePurger) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tags := make([]string, 0, len(p.tags))
+	for tag := range p.tags {
+		tags = append(tags, tag)
+	}
+	p.tags = make(map[string]struct{})
+	return tags
+}
+
+// StartApiCachePurge 启动接口缓存清除
+// 订阅订单事件和activity频道，收到事件后按集合tag清除相关的接口缓存，
+// 同一集合在合并间隔内的多次事件只清除一次
+func StartApiCachePurge(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.ApiCache
+	if cfg == nil || !cfg.Enable || serverCtx.Broker == nil {
+		return
+	}
+	debounce := cfg.Debounce
+	if debounce <= 0 {
+		debounce = defaultApiCachePurgeDebounce
+	}
+	purger := &apiCachePurger{tags: make(map[string]struct{})}
+
+	//1、订阅订单事件和activity频道
+	err := serverCtx.Broker.Handle(ctx, genTradeEventChannel(serverCtx.C.ProjectCfg.Name), func(payload []byte) {
+		var event tradeEventMessage
+		if err := json.Unmarshal(payload, &event); err != nil {
+			xzap.WithContext(ctx).Error("failed on unmarshal trade event", zap.Error(err))
+			return
+		}
+		purger.add(cached.ApiCacheCollectionTag(event.CollectionAddr))
+	})
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on subscribe trade event", zap.Error(err))
+		return
+	}
+	err = serverCtx.Broker.Handle(ctx, genActivityStreamChannel(serverCtx.C.ProjectCfg.Name), func(payload []byte) {
+		var activity entity.ActivityInfo
+		if err := json.Unmarshal(payload, &activity); err != nil {
+			xzap.WithContext(ctx).Error("failed on unmarshal activity", zap.Error(err))
+			return
+		}
+		purger.add(cached.ApiCacheCollectionTag(activity.CollectionAddress))
+	})
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on subscribe activity stream", zap.Error(err))
+		return
+	}
+
+	//2、合并清除
+	ticker := time.NewTicker(time.Duration(debounce) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tags := purger.take()
+			if len(tags) == 0 {
+				continue
+			}
+			if err := serverCtx.Cached.PurgeApiCache(tags...); err != nil {
+				xzap.WithContext(ctx).Error("failed on purge api cache", zap.Error(err), zap.Strings("tags", tags))
+			}
+		}
+	}
+}
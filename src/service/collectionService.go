@@ -5,11 +5,11 @@ import (
 	"EasySwapBackend-test/src/entity"
 	"EasySwapBackend-test/src/service/mq"
 	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
 	"context"
 	"fmt"
 	"github.com/ProjectsTask/EasySwapBase/evm/eip"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
-	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
@@ -25,9 +25,12 @@ func GetCollectionDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain, a
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get collection info")
 	}
+	if collectionInfo.Address == "" {
+		return nil, entity.ErrCollectionNotFound
+	}
 
 	//2、获取集合24小时内交易信息
-	tradeInfos, err := serverCtx.Dao.GetTradeInfoByCollection(chain, address, "1d")
+	tradeInfos, err := serverCtx.Dao.GetTradeInfoByCollection(ctx, chain, address, "1d")
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on get collection trade info", zap.Error(err))
 		//return nil, errcode.NewCustomErr("cache error")
@@ -35,9 +38,13 @@ func GetCollectionDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain, a
 	//2.1 获取24小时交易量和销售数量
 	var volume24h decimal.Decimal
 	var sold int64
+	var maxPrice24h decimal.Decimal
+	var skippedCurrencies []string
 	if tradeInfos != nil {
 		volume24h = tradeInfos.Volume
 		sold = tradeInfos.ItemCount
+		maxPrice24h = tradeInfos.MaxPrice
+		skippedCurrencies = append(skippedCurrencies, tradeInfos.SkippedCurrencies...)
 	}
 
 	//3、查询上架数量
@@ -45,30 +52,14 @@ func GetCollectionDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain, a
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on get listed count", zap.Error(err))
 		//return nil, errcode.NewCustomErr("cache error")
-	} else {
-		//缓存集合的上架数量
-		err := serverCtx.Cached.CacheCollectionsListed(chain, address, int(listedAmount))
-		if err != nil {
-			xzap.WithContext(ctx).Error("failed on cache collection listed", zap.Error(err))
-		}
 	}
 
 	//4、查询指定集合地板价
-	floorPrice, err := serverCtx.Dao.QueryFloorPrice(ctx, chain, address)
+	floorPrice, floorSkipped, err := serverCtx.Dao.QueryFloorPrice(ctx, chain, address)
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on get floor price", zap.Error(err))
 	}
-	//4.1、如果地板价发生变化，则更新价格事件
-	if !floorPrice.Equals(collectionInfo.FloorPrice) {
-		err := ordermanager.AddUpdatePriceEvent(serverCtx.KvStore, &ordermanager.TradeEvent{
-			EventType:      ordermanager.UpdateCollection,
-			CollectionAddr: address,
-			Price:          floorPrice,
-		}, chain)
-		if err != nil {
-			xzap.WithContext(ctx).Error("failed on update floor price", zap.Error(err))
-		}
-	}
+	skippedCurrencies = append(skippedCurrencies, floorSkipped...)
 
 	//5、查询指定集合最高卖单价格
 	collectionSell, err := serverCtx.Dao.QueryCollectionSellPrice(ctx, chain, address)
@@ -78,11 +69,12 @@ func GetCollectionDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain, a
 
 	//6、查询指定集合的总交易量
 	var allVol decimal.Decimal
-	collectionVolume, err := serverCtx.Dao.QueryCollectionVolume(ctx, chain, address)
+	collectionVolume, volumeSkipped, err := serverCtx.Dao.QueryCollectionVolume(ctx, chain, address)
 	if err != nil {
 		xzap.WithContext(ctx).Error("failed on query collection all volume", zap.Error(err))
 	} else {
 		allVol = collectionVolume
+		skippedCurrencies = append(skippedCurrencies, volumeSkipped...)
 	}
 
 	//7、构建返回结果
@@ -96,10 +88,17 @@ func GetCollectionDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain, a
 		VolumeTotal: allVol,
 		Volume24h:   volume24h,
 		Sold24h:     sold,
+		MaxPrice24h: maxPrice24h,
 		ListAmount:  listedAmount,
 		TotalSupply: collectionInfo.ItemAmount,
 		OwnerAmount: collectionInfo.OwnerAmount,
+		// 同一币种可能在地板价、交易量中都被跳过，去重后返回
+		SkippedCurrencies: utils.RemoveRepeatedElement(skippedCurrencies),
 	}
+	//7.1、换算美元价格
+	detail.FloorPriceUsd = serverCtx.Prices.OptionalUsd(ctx, chain, floorPrice)
+	detail.VolumeTotalUsd = serverCtx.Prices.OptionalUsd(ctx, chain, allVol)
+	detail.Volume24hUsd = serverCtx.Prices.OptionalUsd(ctx, chain, volume24h)
 
 	return &entity.CollectionDetailRes{
 		Result: detail,
@@ -112,12 +111,43 @@ func GetBids(ctx context.Context, serverCtx *svc.ServerCtx, chain, collectionAdd
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get item info")
 	}
+	// 查询trait出价信息，并按trait、trait值分组
+	traitBids, err := serverCtx.Dao.QueryCollectionTraitBids(ctx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get trait bids")
+	}
 	return &entity.CollectionBidsRes{
-		Result: bids,
-		Count:  count,
+		Result:    bids,
+		Count:     count,
+		TraitBids: groupTraitBids(traitBids),
 	}, nil
 }
 
+// 按trait、trait值分组，分组顺序和组内出价顺序与查询结果一致
+func groupTraitBids(traitBids []entity.CollectionTraitBid) []entity.TraitBids {
+	var groups []entity.TraitBids
+	groupIndex := make(map[string]int)
+	for _, bid := range traitBids {
+		key := bid.Trait + ":" + bid.TraitValue
+		idx, ok := groupIndex[key]
+		if !ok {
+			idx = len(groups)
+			groupIndex[key] = idx
+			groups = append(groups, entity.TraitBids{
+				Trait:      bid.Trait,
+				TraitValue: bid.TraitValue,
+			})
+		}
+		groups[idx].Bids = append(groups[idx].Bids, entity.CollectionBids{
+			Price:   bid.Price,
+			Size:    bid.Size,
+			Total:   bid.Total,
+			Bidders: bid.Bidders,
+		})
+	}
+	return groups
+}
+
 // GetItems 获取NFT Item列表信息：Item基本信息、订单信息、图片信息、用户持有数量、最近成交价格、最高出价信息
 func GetCollectionItems(ctx context.Context, serverCtx *svc.ServerCtx, chain, collectionAddr string, filter entity.CollectionItemFilterParam) (*entity.NFTListInfoRes, error) {
 	//1、查询item基础信息和订单信息
@@ -125,20 +155,17 @@ func GetCollectionItems(ctx context.Context, serverCtx *svc.ServerCtx, chain, co
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get item info")
 	}
-	//2、提取需要查询的itemID和所有者地址
-	var itemIds []string
+	//2、添加需要加载扩展信息的item，提取所有者地址
+	loader := newItemLoader(ctx, serverCtx, filter.UserAddress)
 	var itemOwners []string
-	var itemPrice []entity.ItemPriceInfo
 	for _, item := range items {
-		if item.TokenId != "" {
-			itemIds = append(itemIds, item.TokenId)
-		}
+		loader.Add(chain, item.CollectionAddress, item.TokenId)
 		if item.Owner != "" {
 			itemOwners = append(itemOwners, item.Owner)
 		}
 		// 记录已上架Item的价格信息
 		if item.Listing {
-			itemPrice = append(itemPrice, entity.ItemPriceInfo{
+			loader.AddListing(chain, entity.ItemPriceInfo{
 				CollectionAddress: item.CollectionAddress,
 				TokenId:           item.TokenId,
 				Maker:             item.Owner,
@@ -148,117 +175,38 @@ func GetCollectionItems(ctx context.Context, serverCtx *svc.ServerCtx, chain, co
 		}
 	}
 	//3、并发查询各种扩展信息
-	var queryErr error
-	var wg sync.WaitGroup
-
-	//3.1、查询订单详情
-	ordersInfo := make(map[string]multi.Order)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(itemPrice) > 0 {
-			orders, err := serverCtx.Dao.QueryListingInfo(ctx, chain, itemPrice)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on get orders time info")
-				return
-			}
-			for _, order := range orders {
-				ordersInfo[strings.ToLower(order.CollectionAddress+order.TokenId)] = order
-			}
-		}
-	}()
-	//3.2、查询item图片信息和视频信息
-	itemsExternal := make(map[string]multi.ItemExternal)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(itemIds) > 0 {
-			images, err := serverCtx.Dao.QueryCollectionItemImage(ctx, chain, collectionAddr, itemIds)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on get items image info")
-				return
-			}
-			for _, image := range images {
-				itemsExternal[strings.ToLower(image.TokenId)] = image
-			}
-		}
-	}()
-	//3.3、查询用户持有数量
+	group := newLoaderGroup(2)
+	//3.1、批量加载订单详情、图片和视频信息、最近成交价格、最高出价
+	group.Go(func() error {
+		return loader.Load(loadItemImage | loadItemLastSale | loadItemBestBid | loadItemListing)
+	})
+	//3.2、查询用户持有数量
 	userItemCount := make(map[string]int64)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(itemOwners) > 0 {
-			userCount, err := serverCtx.Dao.QueryUserItemCount(ctx, chain, collectionAddr, itemOwners)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on get user item count")
-				return
-			}
-			for _, v := range userCount {
-				userItemCount[strings.ToLower(v.Owner)] = v.Counts
-			}
+	group.Go(func() error {
+		if len(itemOwners) == 0 {
+			return nil
 		}
-	}()
-	//3.4、查询最近成交价格
-	lastSales := make(map[string]decimal.Decimal)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(itemIds) > 0 {
-			lastSalePrice, err := serverCtx.Dao.QueryLastSalePrice(ctx, chain, collectionAddr, itemIds)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on get items last sale info")
-				return
-			}
-			for _, v := range lastSalePrice {
-				lastSales[v.TokenId] = v.Price
-			}
-		}
-	}()
-	//3.5、查询item级别的最高出价
-	bestBids := make(map[string]multi.Order)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(itemIds) > 0 {
-			bids, err := serverCtx.Dao.QueryBestBids(ctx, chain, collectionAddr, filter.UserAddress, itemIds)
-			if err != nil {
-				queryErr = errors.Wrap(err, "")
-				return
-			}
-			for _, bid := range bids {
-				//1、先从map中获取一下，判断是否已存在
-				order, ok := bestBids[strings.ToLower(bid.TokenId)]
-				//若不存在，则写入map
-				if !ok {
-					bestBids[strings.ToLower(bid.TokenId)] = bid
-					continue
-				}
-				//若存在，并且新的出价比map中的出价高，则更新
-				if bid.Price.GreaterThan(order.Price) {
-					bestBids[strings.ToLower(bid.TokenId)] = bid
-				}
-			}
-		}
-	}()
-	//3.6、查询集合级别的最高出价
-	var collectionBestBid multi.Order
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		collectionBestBid, err = serverCtx.Dao.QueryCollectionBestBid(ctx, chain, collectionAddr, filter.UserAddress)
+		userCount, err := serverCtx.Dao.QueryUserItemCount(ctx, chain, collectionAddr, itemOwners)
 		if err != nil {
-			queryErr = errors.Wrap(err, "failed on get items last sale info")
-			return
+			return errors.Wrap(err, "failed on get user item count")
 		}
-	}()
+		for _, v := range userCount {
+			userItemCount[strings.ToLower(v.Owner)] = v.Counts
+		}
+		return nil
+	})
 	//4、等待所有查询完成
-	wg.Wait()
-	if queryErr != nil {
-		return nil, errors.Wrap(queryErr, "failed on get items info")
+	if err := group.Wait(); err != nil {
+		return nil, errors.Wrap(err, "failed on get items info")
+	}
+
+	//5、加载手续费模型，用于计算扫货时的手续费
+	model, err := loadFeeModel(ctx, serverCtx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on load fee model")
 	}
 
-	//5、整合所有信息
+	//6、整合所有信息
 	var resItems []*entity.NFTListInfo
 	for _, item := range items {
 		//设置item名称
@@ -274,41 +222,24 @@ func GetCollectionItems(ctx context.Context, serverCtx *svc.ServerCtx, chain, co
 			OwnerAddress:      item.Owner,
 			ListPrice:         item.ListPrice,
 			MarketID:          item.MarketID,
-			BidExpireTime:     collectionBestBid.ExpireTime,
-			BidMaker:          collectionBestBid.Maker,
-			BidOrderID:        collectionBestBid.OrderID,
-			BidPrice:          collectionBestBid.Price,
-			BidSalt:           collectionBestBid.Salt,
-			BidTime:           collectionBestBid.EventTime,
-			BidType:           getBidType(collectionBestBid.OrderType),
-			BidSize:           collectionBestBid.Size,
-			BidUnfilled:       collectionBestBid.QuantityRemaining,
 		}
 		//添加订单信息
-		order, ok := ordersInfo[strings.ToLower(item.CollectionAddress+item.TokenId)]
+		order, ok := loader.ListingOrder(chain, item.CollectionAddress, item.TokenId)
 		if ok {
 			resItem.ListExpireTime = order.ExpireTime
 			resItem.ListOrderID = order.OrderID
 			resItem.ListSalt = order.Salt
 			resItem.ListTime = order.EventTime
+			fee := model.breakdown(item.MarketID, item.ListPrice)
+			resItem.ListFee = &fee
 		}
 		//添加图片信息和视频信息
-		itemExternal, ok := itemsExternal[strings.ToLower(item.TokenId)]
+		itemExternal, ok := loader.Image(chain, item.CollectionAddress, item.TokenId)
 		if ok {
-			//图片信息
-			if itemExternal.IsUploadedOss {
-				resItem.ImageURI = itemExternal.OssUri
-			} else {
-				resItem.ImageURI = itemExternal.ImageUri
-			}
-			//视频信息
+			resItem.ImageURI = itemImageURI(itemExternal)
 			if len(itemExternal.VideoUri) > 0 {
 				resItem.VideoType = itemExternal.VideoType
-				if itemExternal.IsVideoUploaded {
-					resItem.VideoURI = itemExternal.VideoOssUri
-				} else {
-					resItem.VideoURI = itemExternal.VideoUri
-				}
+				resItem.VideoURI = itemVideoURI(itemExternal)
 			}
 		}
 		//添加用户持有数量
@@ -317,167 +248,93 @@ func GetCollectionItems(ctx context.Context, serverCtx *svc.ServerCtx, chain, co
 			resItem.OwnerOwnedAmount = ownerCount
 		}
 		//添加最近成交价格
-		lastPrice, ok := lastSales[strings.ToLower(item.TokenId)]
+		lastPrice, ok := loader.LastSale(chain, item.CollectionAddress, item.TokenId)
 		if ok {
 			resItem.LastSellPrice = lastPrice
 		}
-		//添加最高出价信息
-		bidOrder, ok := bestBids[strings.ToLower(item.TokenId)]
+		//添加最高出价信息，item级别的出价高于集合出价时使用item出价
+		bidOrder, ok := loader.BestBid(chain, item.CollectionAddress, item.TokenId)
 		if ok {
-			if bidOrder.Price.GreaterThan(collectionBestBid.Price) {
-				resItem.BidTime = bidOrder.EventTime
-				resItem.BidType = getBidType(bidOrder.OrderType)
-				resItem.BidUnfilled = bidOrder.QuantityRemaining
-				resItem.BidSalt = bidOrder.Salt
-				resItem.BidPrice = bidOrder.Price
-				resItem.BidOrderID = bidOrder.OrderID
-				resItem.BidMaker = bidOrder.Maker
-				resItem.BidExpireTime = bidOrder.ExpireTime
-				resItem.BidSize = bidOrder.Size
-			}
-		}
+			resItem.BidTime = bidOrder.EventTime
+			resItem.BidType = getBidType(bidOrder.OrderType)
+			resItem.BidUnfilled = bidOrder.QuantityRemaining
+			resItem.BidSalt = bidOrder.Salt
+			resItem.BidPrice = bidOrder.Price
+			resItem.BidOrderID = bidOrder.OrderID
+			resItem.BidMaker = bidOrder.Maker
+			resItem.BidExpireTime = bidOrder.ExpireTime
+			resItem.BidSize = bidOrder.Size
+		}
+		//扩展信息加载失败时降级返回该item
+		resItem.Incomplete = loader.Err(chain, item.CollectionAddress, item.TokenId) != nil
 		resItems = append(resItems, resItem)
 	}
-	//6、包装返回结果
+	//7、包装返回结果
 	return &entity.NFTListInfoRes{
-		Result: resItems,
-		Count:  count,
+		Result:     resItems,
+		Count:      count,
+		NextCursor: dao.NextItemCursor(items, filter),
 	}, nil
 }
 
 // GetItemDetail 获取单个NFT的详细信息
 func GetItemDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId int, collectionAddr, tokenId string) (*entity.ItemDetailInfoResp, error) {
-	var queryErr error
-	var wg sync.WaitGroup
+	group := newLoaderGroup(4)
 
 	//并发查询以下信息
 	//1、查询collection信息
 	var collection *multi.Collection
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		collection, queryErr = serverCtx.Dao.QueryCollectionInfo(ctx, chain, collectionAddr)
-		if queryErr != nil {
-			return
-		}
-	}()
+	group.Go(func() error {
+		var err error
+		collection, err = serverCtx.Dao.QueryCollectionInfo(ctx, chain, collectionAddr)
+		return err
+	})
 	//2、查询item基本信息
 	var item *multi.Item
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		item, queryErr = serverCtx.Dao.QueryItemInfo(ctx, chain, collectionAddr, tokenId)
-		if queryErr != nil {
-			return
-		}
-	}()
+	group.Go(func() error {
+		var err error
+		item, err = serverCtx.Dao.QueryItemInfo(ctx, chain, collectionAddr, tokenId)
+		return err
+	})
 	//3、查询item挂单信息
 	var itemListInfo *dao.CollectionItem
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		itemListInfo, queryErr = serverCtx.Dao.QueryItemListInfo(ctx, chain, collectionAddr, tokenId)
-		if queryErr != nil {
-			return
-		}
-	}()
-	//4、查询item的图片和视频信息
-	itemExternal := make(map[string]multi.ItemExternal)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		images, err := serverCtx.Dao.QueryCollectionItemImage(ctx, chain, collectionAddr, []string{tokenId})
-		if err != nil {
-			queryErr = errors.Wrap(err, "failed on get items image info")
-			return
-		}
-		for _, image := range images {
-			itemExternal[strings.ToLower(image.TokenId)] = image
-		}
-	}()
-	//5、查询最近成交价格
-	lastSales := make(map[string]decimal.Decimal)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		activitys, err := serverCtx.Dao.QueryLastSalePrice(ctx, chain, collectionAddr, []string{tokenId})
-		if err != nil {
-			queryErr = errors.Wrap(err, "failed on get last price info")
-			return
-		}
-		for _, v := range activitys {
-			lastSales[strings.ToLower(v.TokenId)] = v.Price
-		}
-	}()
-	//6、查询item维度最高出价
-	bestBids := make(map[string]multi.Order)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		bids, err := serverCtx.Dao.QueryBestBids(ctx, chain, collectionAddr, "", []string{tokenId})
-		if err != nil {
-			queryErr = errors.Wrap(err, "failed on get items last sale info")
-			return
-		}
-		for _, v := range bids {
-			order, ok := bestBids[strings.ToLower(v.TokenId)]
-			if !ok {
-				bestBids[strings.ToLower(v.TokenId)] = order
-				continue
-			}
-			if v.Price.GreaterThan(order.Price) {
-				bestBids[strings.ToLower(v.TokenId)] = order
-			}
-		}
-	}()
-	//7、查询collection维度的最高出价
-	var collectionBestBid multi.Order
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		collectionBestBid, queryErr = serverCtx.Dao.QueryCollectionBestBid(ctx, chain, collectionAddr, "")
-		if queryErr != nil {
-			return
-		}
-	}()
-	//8、等待所有查询完成
-	wg.Wait()
-	if queryErr != nil {
-		return nil, errors.Wrap(queryErr, "failed on get items info")
-	}
-	//9、组装返回数据
+	group.Go(func() error {
+		var err error
+		itemListInfo, err = serverCtx.Dao.QueryItemListInfo(ctx, chain, collectionAddr, tokenId)
+		return err
+	})
+	//4、批量加载item的图片和视频信息、最近成交价格、最高出价
+	loader := newItemLoader(ctx, serverCtx, "")
+	loader.Add(chain, collectionAddr, tokenId)
+	group.Go(func() error {
+		return loader.Load(loadItemImage | loadItemLastSale | loadItemBestBid)
+	})
+	//5、等待所有查询完成
+	if err := group.Wait(); err != nil {
+		return nil, errors.Wrap(err, "failed on get items info")
+	}
+	if item == nil || item.TokenId == "" {
+		return nil, entity.ErrItemNotFound
+	}
+	//6、组装返回数据
 	var itemDetail entity.ItemDetailInfo
 	itemDetail.ChainID = chainId
-	if item != nil {
-		itemDetail.Name = item.Name
-		itemDetail.CollectionAddress = item.CollectionAddress
-		itemDetail.TokenID = item.TokenId
-		itemDetail.OwnerAddress = item.Owner
-		//设置collection级别的最高出价信息
-		itemDetail.BidMaker = collectionBestBid.Maker
-		itemDetail.BidSize = collectionBestBid.Size
-		itemDetail.BidExpireTime = collectionBestBid.ExpireTime
-		itemDetail.BidOrderID = collectionBestBid.OrderID
-		itemDetail.BidPrice = collectionBestBid.Price
-		itemDetail.BidSalt = collectionBestBid.Salt
-		itemDetail.BidUnfilled = collectionBestBid.QuantityRemaining
-		itemDetail.BidType = getBidType(collectionBestBid.OrderType)
-		itemDetail.BidTime = collectionBestBid.EventTime
-	}
-	// 如果item级别的最高出价大于collection级别的最高出价,则使用item级别的出价信息
-	bidOrder, ok := bestBids[strings.ToLower(item.TokenId)]
+	itemDetail.Name = item.Name
+	itemDetail.CollectionAddress = item.CollectionAddress
+	itemDetail.TokenID = item.TokenId
+	itemDetail.OwnerAddress = item.Owner
+	// 设置最高出价信息，item或trait级别的出价高于collection级别的出价时使用该出价
+	bidOrder, ok := loader.BestBid(chain, collectionAddr, tokenId)
 	if ok {
-		if bidOrder.Price.GreaterThan(collectionBestBid.Price) {
-			itemDetail.BidMaker = bidOrder.Maker
-			itemDetail.BidSize = bidOrder.Size
-			itemDetail.BidExpireTime = bidOrder.ExpireTime
-			itemDetail.BidOrderID = bidOrder.OrderID
-			itemDetail.BidPrice = bidOrder.Price
-			itemDetail.BidSalt = bidOrder.Salt
-			itemDetail.BidUnfilled = bidOrder.QuantityRemaining
-			itemDetail.BidType = getBidType(bidOrder.OrderType)
-			itemDetail.BidTime = bidOrder.EventTime
-		}
+		itemDetail.BidMaker = bidOrder.Maker
+		itemDetail.BidSize = bidOrder.Size
+		itemDetail.BidExpireTime = bidOrder.ExpireTime
+		itemDetail.BidOrderID = bidOrder.OrderID
+		itemDetail.BidPrice = bidOrder.Price
+		itemDetail.BidSalt = bidOrder.Salt
+		itemDetail.BidUnfilled = bidOrder.QuantityRemaining
+		itemDetail.BidType = getBidType(bidOrder.OrderType)
+		itemDetail.BidTime = bidOrder.EventTime
 	}
 	//设置挂单信息
 	if itemListInfo != nil {
@@ -499,29 +356,20 @@ func GetItemDetail(ctx context.Context, serverCtx *svc.ServerCtx, chain string,
 		}
 	}
 	//设置最近成交价格
-	price, ok := lastSales[strings.ToLower(tokenId)]
+	price, ok := loader.LastSale(chain, collectionAddr, tokenId)
 	if ok {
 		itemDetail.LastSellPrice = price
 	}
 	//设置图片和视频信息
-	external, ok := itemExternal[strings.ToLower(tokenId)]
+	external, ok := loader.Image(chain, collectionAddr, tokenId)
 	if ok {
-		//图片信息
-		if external.IsUploadedOss {
-			itemDetail.ImageURI = external.OssUri
-		} else {
-			itemDetail.ImageURI = external.ImageUri
-		}
-		//视频信息
+		itemDetail.ImageURI = itemImageURI(external)
 		if len(external.VideoUri) > 0 {
 			itemDetail.VideoType = external.VideoType
-			if external.IsVideoUploaded {
-				itemDetail.VideoURI = external.VideoOssUri
-			} else {
-				itemDetail.VideoURI = external.VideoUri
-			}
+			itemDetail.VideoURI = itemVideoURI(external)
 		}
 	}
+	itemDetail.Incomplete = loader.Err(chain, collectionAddr, tokenId) != nil
 	return &entity.ItemDetailInfoResp{
 		Result: itemDetail,
 	}, nil
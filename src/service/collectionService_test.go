@@ -0,0 +1,68 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestGroupTraitBids(t *testing.T) {
+	bid := func(trait, value string, price int64, size int) entity.CollectionTraitBid {
+		return entity.CollectionTraitBid{
+			Trait:      trait,
+			TraitValue: value,
+			Price:      decimal.NewFromInt(price),
+			Size:       size,
+			Total:      decimal.NewFromInt(price * int64(size)),
+			Bidders:    1,
+		}
+	}
+	tests := []struct {
+		name   string
+		bids   []entity.CollectionTraitBid
+		groups []string // trait:trait_value
+		prices [][]int64
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "single group keeps price order",
+			bids:   []entity.CollectionTraitBid{bid("Background", "Gold", 3, 1), bid("Background", "Gold", 2, 2)},
+			groups: []string{"Background:Gold"},
+			prices: [][]int64{{3, 2}},
+		},
+		{
+			name: "groups keep query order",
+			bids: []entity.CollectionTraitBid{
+				bid("Background", "Blue", 1, 1),
+				bid("Background", "Gold", 5, 1),
+				bid("Background", "Gold", 4, 1),
+				bid("Eyes", "Laser", 9, 1),
+			},
+			groups: []string{"Background:Blue", "Background:Gold", "Eyes:Laser"},
+			prices: [][]int64{{1}, {5, 4}, {9}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupTraitBids(tt.bids)
+			if len(got) != len(tt.groups) {
+				t.Fatalf("got %d groups, want %d", len(got), len(tt.groups))
+			}
+			for i, group := range got {
+				if key := group.Trait + ":" + group.TraitValue; key != tt.groups[i] {
+					t.Errorf("group %d = %s, want %s", i, key, tt.groups[i])
+				}
+				if len(group.Bids) != len(tt.prices[i]) {
+					t.Fatalf("group %d has %d bids, want %d", i, len(group.Bids), len(tt.prices[i]))
+				}
+				for j, b := range group.Bids {
+					if !b.Price.Equal(decimal.NewFromInt(tt.prices[i][j])) {
+						t.Errorf("group %d bid %d price = %s, want %d", i, j, b.Price, tt.prices[i][j])
+					}
+				}
+			}
+		})
+	}
+}
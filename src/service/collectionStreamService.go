@@ -0,0 +1,258 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCollectionStreamDebounce = 1000
+
+// 集合实时数据推送的进程内订阅管理
+var collectionHub = newCollectionHub(defaultStreamBuffer, defaultStreamMaxDropped)
+
+// CollectionHub 管理当前实例上按集合订阅的连接，buffer和maxDropped只在持有锁时读写
+// 订单事件只标记集合需要刷新，由刷新循环合并后统一重新计算，避免短时间内大量事件重复查库
+type CollectionHub struct {
+	mu         sync.Mutex
+	groups     map[string]*collectionGroup
+	buffer     int
+	maxDropped int
+}
+
+// 同一集合的订阅连接
+type collectionGroup struct {
+	chain   string
+	chainId int
+	address string
+	dirty   bool
+	clients map[*CollectionSubscriber]struct{}
+}
+
+// CollectionSubscriber 单个集合订阅连接
+// 消息通过带缓冲的C发送，缓冲满时丢弃消息，连续丢弃过多时关闭Done断开连接
+type CollectionSubscriber struct {
+	C       chan entity.CollectionLiveStats
+	Done    chan struct{}
+	key     string
+	dropped int
+	once    sync.Once
+}
+
+func (s *CollectionSubscriber) close() {
+	s.once.Do(func() {
+		close(s.Done)
+	})
+}
+
+func newCollectionHub(buffer, maxDropped int) *CollectionHub {
+	return &CollectionHub{
+		groups:     make(map[string]*collectionGroup),
+		buffer:     buffer,
+		maxDropped: maxDropped,
+	}
+}
+
+// 更新缓冲大小和最大连续丢弃数量，只对之后的订阅和分发生效
+func (h *CollectionHub) configure(buffer, maxDropped int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if buffer > 0 {
+		h.buffer = buffer
+	}
+	if maxDropped > 0 {
+		h.maxDropped = maxDropped
+	}
+}
+
+func genCollectionGroupKey(chain, collectionAddr string) string {
+	return chain + ":" + strings.ToLower(collectionAddr)
+}
+
+// 标记集合需要刷新，当前实例没有该集合的订阅时忽略
+func (h *CollectionHub) markDirty(chain, collectionAddr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if group, ok := h.groups[genCollectionGroupKey(chain, collectionAddr)]; ok {
+		group.dirty = true
+	}
+}
+
+// 取出需要刷新的集合并清除标记
+func (h *CollectionHub) takeDirty() []collectionGroup {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var groups []collectionGroup
+	for _, group := range h.groups {
+		if !group.dirty {
+			continue
+		}
+		group.dirty = false
+		groups = append(groups, collectionGroup{chain: group.chain, chainId: group.chainId, address: group.address})
+	}
+	return groups
+}
+
+// 推送集合实时数据到该集合的订阅连接，不阻塞
+func (h *CollectionHub) dispatch(chain string, stats *entity.CollectionLiveStats) {
+	var slow []*CollectionSubscriber
+	h.mu.Lock()
+	if group, ok := h.groups[genCollectionGroupKey(chain, stats.CollectionAddress)]; ok {
+		for s := range group.clients {
+			select {
+			case s.C <- *stats:
+				s.dropped = 0
+			default:
+				s.dropped++
+				if s.dropped > h.maxDropped {
+					slow = append(slow, s)
+				}
+			}
+		}
+	}
+	h.mu.Unlock()
+	for _, s := range slow {
+		h.remove(s)
+	}
+}
+
+func (h *CollectionHub) remove(s *CollectionSubscriber) {
+	h.mu.Lock()
+	if group, ok := h.groups[s.key]; ok {
+		delete(group.clients, s)
+		if len(group.clients) == 0 {
+			delete(h.groups, s.key)
+		}
+	}
+	h.mu.Unlock()
+	s.close()
+}
+
+func (h *CollectionHub) subscribe(chain string, chainId int, collectionAddr string) *CollectionSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := genCollectionGroupKey(chain, collectionAddr)
+	s := &CollectionSubscriber{
+		C:    make(chan entity.CollectionLiveStats, h.buffer),
+		Done: make(chan struct{}),
+		key:  key,
+	}
+	group, ok := h.groups[key]
+	if !ok {
+		group = &collectionGroup{
+			chain:   chain,
+			chainId: chainId,
+			address: strings.ToLower(collectionAddr),
+			clients: make(map[*CollectionSubscriber]struct{}),
+		}
+		h.groups[key] = group
+	}
+	group.clients[s] = struct{}{}
+	return s
+}
+
+// SubscribeCollection 订阅集合实时数据，返回的订阅需调用UnsubscribeCollection释放
+func SubscribeCollection(chain string, chainId int, collectionAddr string) *CollectionSubscriber {
+	return collectionHub.subscribe(chain, chainId, collectionAddr)
+}
+
+// UnsubscribeCollection 取消订阅
+func UnsubscribeCollection(s *CollectionSubscriber) {
+	collectionHub.remove(s)
+}
+
+// GetCollectionLiveStats 查询集合当前的地板价、最高出价、上架数量和24小时交易额
+func GetCollectionLiveStats(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId int, collectionAddr string) (*entity.CollectionLiveStats, error) {
+	//1、地板价
+	floorPrice, _, err := serverCtx.Dao.QueryFloorPrice(ctx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query floor price")
+	}
+	//2、最高出价
+	bestBid, err := serverCtx.Dao.QueryCollectionBestBid(ctx, chain, collectionAddr, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query best bid")
+	}
+	//3、上架数量
+	listedAmount, err := serverCtx.Dao.QueryListedAmount(ctx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query listed amount")
+	}
+	//4、24小时交易额
+	tradeInfo, err := serverCtx.Dao.GetTradeInfoByCollection(ctx, chain, collectionAddr, "1d")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query trade info")
+	}
+
+	return &entity.CollectionLiveStats{
+		ChainID:           chainId,
+		CollectionAddress: strings.ToLower(collectionAddr),
+		FloorPrice:        floorPrice,
+		BestBid:           bestBid.Price,
+		ListedCount:       listedAmount,
+		Volume24h:         tradeInfo.Volume,
+		UpdateTime:        time.Now().Unix(),
+	}, nil
+}
+
+// StartCollectionStream 启动集合实时数据推送
+// 1. 订阅订单事件频道，收到挂单、出价、成交等事件时标记对应集合需要刷新
+// 2. 按debounce间隔重新计算被标记的集合并推送给订阅连接
+//
+// EasySwapBase的ordermanager只提供AddUpdatePriceEvent写入自身消费的工作队列，没有可订阅的更新流，
+// 所以在写入侧镜像：本服务发送给ordermanager的事件由addUpdatePriceEvent同时发布到订单事件频道，
+// 订单事件频道即为ordermanager的更新流；indexer直接写入ordermanager的挂单、出价、成交没有经过本服务，
+// 由activity流在查询到新activity后发布对应的订单事件。
+// 未配置Broker时不订阅频道，订单事件由publishTradeEvent直接标记本实例的集合
+func StartCollectionStream(ctx context.Context, serverCtx *svc.ServerCtx) {
+	debounce := defaultCollectionStreamDebounce
+	if cfg := serverCtx.C.Stream; cfg != nil {
+		if cfg.Debounce > 0 {
+			debounce = cfg.Debounce
+		}
+		collectionHub.configure(cfg.Buffer, cfg.MaxDropped)
+	}
+
+	//1、订阅订单事件频道
+	if serverCtx.Broker != nil {
+		err := serverCtx.Broker.Handle(ctx, genTradeEventChannel(serverCtx.C.ProjectCfg.Name), func(payload []byte) {
+			var event tradeEventMessage
+			if err := json.Unmarshal(payload, &event); err != nil {
+				xzap.WithContext(ctx).Error("failed on unmarshal trade event", zap.Error(err))
+				return
+			}
+			collectionHub.markDirty(event.Chain, event.CollectionAddr)
+		})
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on subscribe trade event", zap.Error(err))
+			return
+		}
+	}
+
+	//2、合并刷新被标记的集合
+	ticker := time.NewTicker(time.Duration(debounce) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, group := range collectionHub.takeDirty() {
+				stats, err := GetCollectionLiveStats(ctx, serverCtx, group.chain, group.chainId, group.address)
+				if err != nil {
+					xzap.WithContext(ctx).Error("failed on get collection live stats", zap.Error(err),
+						zap.String("chain", group.chain), zap.String("collection_address", group.address))
+					continue
+				}
+				collectionHub.dispatch(group.chain, stats)
+			}
+		}
+	}
+}
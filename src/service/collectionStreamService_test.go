@@ -0,0 +1,102 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"sync"
+	"testing"
+)
+
+func TestCollectionHubMarkDirty(t *testing.T) {
+	hub := newCollectionHub(defaultStreamBuffer, defaultStreamMaxDropped)
+	s := hub.subscribe("sepolia", 11155111, "0xAbC")
+	defer hub.remove(s)
+
+	// 没有订阅的集合不标记
+	hub.markDirty("sepolia", "0xdef")
+	hub.markDirty("sepolia", "0xabc")
+	hub.markDirty("sepolia", "0xABC")
+	groups := hub.takeDirty()
+	if len(groups) != 1 {
+		t.Fatalf("dirty groups = %d, want 1", len(groups))
+	}
+	if groups[0].address != "0xabc" || groups[0].chainId != 11155111 {
+		t.Errorf("dirty group = %+v", groups[0])
+	}
+	if groups := hub.takeDirty(); len(groups) != 0 {
+		t.Errorf("dirty flag should be cleared, got %d groups", len(groups))
+	}
+}
+
+func TestCollectionHubDropsSlowSubscriber(t *testing.T) {
+	hub := newCollectionHub(1, 2)
+	s := hub.subscribe("sepolia", 11155111, "0xabc")
+	other := hub.subscribe("sepolia", 11155111, "0xdef")
+	if cap(s.C) != 1 {
+		t.Fatalf("buffer = %d, want 1", cap(s.C))
+	}
+	stats := &entity.CollectionLiveStats{CollectionAddress: "0xabc"}
+	// 第一条进入缓冲，之后连续丢弃超过2条时断开
+	for i := 0; i < 4; i++ {
+		hub.dispatch("sepolia", stats)
+	}
+	select {
+	case <-s.Done:
+	default:
+		t.Fatal("slow subscriber should be closed")
+	}
+	select {
+	case <-other.Done:
+		t.Fatal("subscriber of another collection should stay open")
+	default:
+	}
+	hub.mu.Lock()
+	_, ok := hub.groups[genCollectionGroupKey("sepolia", "0xabc")]
+	hub.mu.Unlock()
+	if ok {
+		t.Fatal("empty group should be removed")
+	}
+}
+
+// 分发只在刷新循环中执行，订阅和更新配置与分发并发执行，配合-race检查
+func TestCollectionHubConfigureConcurrently(t *testing.T) {
+	hub := newCollectionHub(defaultStreamBuffer, defaultStreamMaxDropped)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			hub.dispatch("sepolia", &entity.CollectionLiveStats{CollectionAddress: "0xabc"})
+		}
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			hub.remove(hub.subscribe("sepolia", 11155111, "0xabc"))
+		}()
+		go func(i int) {
+			defer wg.Done()
+			hub.configure(i+1, i+1)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPublishTradeEventWithoutBroker(t *testing.T) {
+	s := SubscribeCollection("sepolia", 11155111, "0xLocal")
+	defer UnsubscribeCollection(s)
+
+	// 未配置Broker时直接标记本实例的集合
+	err := publishTradeEvent(context.Background(), &svc.ServerCtx{}, "sepolia",
+		&ordermanager.TradeEvent{CollectionAddr: "0xlocal"})
+	if err != nil {
+		t.Fatalf("publishTradeEvent: %v", err)
+	}
+	groups := collectionHub.takeDirty()
+	if len(groups) != 1 || groups[0].address != "0xlocal" {
+		t.Errorf("dirty groups = %+v, want 0xlocal", groups)
+	}
+}
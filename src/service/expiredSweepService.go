@@ -0,0 +1,149 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExpiredSweepInterval   = 60
+	defaultExpiredSweepBatchSize  = 500
+	defaultExpiredSweepMaxBatches = 20
+	// 锁的过期时间为清理间隔的倍数，实例异常退出未释放锁时，其他实例在若干个间隔后接管
+	expiredSweepLockIntervals = 5
+)
+
+// 过期订单清理锁 cache:<项目名>:<链名>:lock:expired-sweep
+func genExpiredSweepLockKey(project, chain string) string {
+	return fmt.Sprintf("cache:%s:%s:lock:expired-sweep", strings.ToLower(project), chain)
+}
+
+// StartExpiredSweep 后台过期订单清理任务
+// 定时处理已过期但仍为活跃状态的订单，重新计算受影响集合的地板价和上架数量。
+// 订单表由indexer维护，清理任务不修改订单状态，只在过期订单表中记录已处理的订单。
+// 多副本部署时通过Redis锁保证同一条链同一时刻只有一个实例在清理
+func StartExpiredSweep(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.ExpiredSweep
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultExpiredSweepInterval
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultExpiredSweepBatchSize
+	}
+	maxBatches := cfg.MaxBatches
+	if maxBatches <= 0 {
+		maxBatches = defaultExpiredSweepMaxBatches
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, supported := range serverCtx.C.ChainSupported {
+				lock := cached.NewRedisLock(serverCtx.KvStore,
+					genExpiredSweepLockKey(serverCtx.C.ProjectCfg.Name, supported.Name), interval*expiredSweepLockIntervals)
+				ok, err := lock.Acquire()
+				if err != nil {
+					xzap.WithContext(ctx).Error("failed on acquire expired sweep lock", zap.Error(err))
+					continue
+				}
+				if !ok {
+					continue
+				}
+				if err := sweepExpiredOrders(ctx, serverCtx, supported.Name, batchSize, maxBatches); err != nil {
+					xzap.WithContext(ctx).Error("failed on sweep expired orders", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+				if err := lock.Release(); err != nil {
+					xzap.WithContext(ctx).Error("failed on release expired sweep lock", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// 分批清理指定链上的过期订单
+func sweepExpiredOrders(ctx context.Context, serverCtx *svc.ServerCtx, chain string, batchSize, maxBatches int) error {
+	affected := make(map[string]bool)
+	// 无论清理是否中途失败，已处理批次涉及的集合都需要刷新上架数量
+	defer func() {
+		for collectionAddr := range affected {
+			refreshCollectionListing(ctx, serverCtx, chain, collectionAddr)
+		}
+	}()
+
+	//1、移除indexer已更新状态的订单记录
+	if err := serverCtx.Dao.RemoveClosedExpiredOrders(ctx, chain); err != nil {
+		return errors.Wrap(err, "failed on remove closed expired orders")
+	}
+
+	for i := 0; i < maxBatches; i++ {
+		//2、查询一批未处理的过期订单
+		orders, err := serverCtx.Dao.QueryExpiredOrders(ctx, chain, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed on query expired orders")
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		orderIds, listingAddrs := expiredBatchListingAddrs(orders)
+
+		//3、记录已处理的过期订单，受影响集合的地板价事件在同一事务中写入发件箱
+		err = serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			d := serverCtx.Dao.WithTx(tx)
+			if err := d.MarkOrdersExpired(ctx, chain, orders); err != nil {
+				return errors.Wrap(err, "failed on mark orders expired")
+			}
+			// 过期订单不再需要有效性校验记录
+			if err := d.RemoveInvalidOrders(ctx, chain, orderIds); err != nil {
+				return errors.Wrap(err, "failed on remove invalid orders")
+			}
+			return enqueueFloorPriceEvents(ctx, serverCtx, d, chain, listingAddrs)
+		})
+		if err != nil {
+			return err
+		}
+		for _, addr := range listingAddrs {
+			affected[addr] = true
+		}
+		if len(orders) < batchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 返回一批过期订单的订单id和挂单涉及的集合地址(小写、去重、按首次出现的顺序)
+// 只有挂单过期才会影响地板价和上架数量
+func expiredBatchListingAddrs(orders []multi.Order) ([]string, []string) {
+	var orderIds []string
+	var listingAddrs []string
+	seen := make(map[string]bool)
+	for _, order := range orders {
+		orderIds = append(orderIds, order.OrderID)
+		addr := strings.ToLower(order.CollectionAddress)
+		if order.OrderType == multi.ListingOrder && !seen[addr] {
+			seen[addr] = true
+			listingAddrs = append(listingAddrs, addr)
+		}
+	}
+	return orderIds, listingAddrs
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"reflect"
+	"testing"
+)
+
+func TestExpiredBatchListingAddrs(t *testing.T) {
+	tests := []struct {
+		name          string
+		orders        []multi.Order
+		wantOrderIds  []string
+		wantListAddrs []string
+	}{
+		{name: "empty"},
+		{
+			name: "bids do not affect floor",
+			orders: []multi.Order{
+				{OrderID: "1", CollectionAddress: "0xA", OrderType: multi.CollectionBidOrder},
+				{OrderID: "2", CollectionAddress: "0xB", OrderType: multi.ItemBidOrder},
+			},
+			wantOrderIds: []string{"1", "2"},
+		},
+		{
+			name: "listings deduplicated case-insensitively in first-seen order",
+			orders: []multi.Order{
+				{OrderID: "1", CollectionAddress: "0xB", OrderType: multi.ListingOrder},
+				{OrderID: "2", CollectionAddress: "0xa", OrderType: multi.ListingOrder},
+				{OrderID: "3", CollectionAddress: "0xb", OrderType: multi.ListingOrder},
+				{OrderID: "4", CollectionAddress: "0xC", OrderType: multi.CollectionBidOrder},
+			},
+			wantOrderIds:  []string{"1", "2", "3", "4"},
+			wantListAddrs: []string{"0xb", "0xa"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderIds, listingAddrs := expiredBatchListingAddrs(tt.orders)
+			if !reflect.DeepEqual(orderIds, tt.wantOrderIds) {
+				t.Errorf("order ids = %v, want %v", orderIds, tt.wantOrderIds)
+			}
+			if !reflect.DeepEqual(listingAddrs, tt.wantListAddrs) {
+				t.Errorf("listing addrs = %v, want %v", listingAddrs, tt.wantListAddrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 数据库覆盖配置的缓存时间
+const feeOverrideCacheTTL = 60 * time.Second
+
+// 手续费覆盖配置的key，集合地址为空表示所有集合，市场为dao.AllMarketplaces表示所有市场
+type feeOverrideKey struct {
+	CollectionAddress string
+	MarketplaceId     int
+}
+
+// 按链缓存数据库中的全部手续费覆盖配置，过期后下次使用时重新加载
+type feeOverrideCache struct {
+	mu     sync.Mutex
+	chains map[string]*feeOverrideSet
+}
+
+type feeOverrideSet struct {
+	overrides map[feeOverrideKey]dao.FeeOverride
+	expireAt  time.Time
+}
+
+var feeOverrides = &feeOverrideCache{chains: make(map[string]*feeOverrideSet)}
+
+// 获取指定链的覆盖配置，返回的map只读
+func (c *feeOverrideCache) get(ctx context.Context, serverCtx *svc.ServerCtx, chain string) (map[feeOverrideKey]dao.FeeOverride, error) {
+	c.mu.Lock()
+	set, ok := c.chains[chain]
+	c.mu.Unlock()
+	if ok && time.Now().Before(set.expireAt) {
+		return set.overrides, nil
+	}
+
+	rows, err := serverCtx.Dao.QueryFeeOverrides(ctx, chain)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query fee overrides")
+	}
+	overrides := make(map[feeOverrideKey]dao.FeeOverride, len(rows))
+	for _, o := range rows {
+		overrides[feeOverrideKey{CollectionAddress: strings.ToLower(o.CollectionAddress), MarketplaceId: o.MarketplaceId}] = o
+	}
+	c.mu.Lock()
+	c.chains[chain] = &feeOverrideSet{overrides: overrides, expireAt: time.Now().Add(feeOverrideCacheTTL)}
+	c.mu.Unlock()
+	return overrides, nil
+}
+
+// 指定集合的手续费模型
+// 优先级(低->高): 配置市场费率 < 配置集合+市场费率 < 数据库覆盖(全局 < 市场 < 集合 < 集合+市场)
+// 未配置的市场费率为0
+type feeModel struct {
+	collectionAddr      string
+	marketplaceFeeRates map[int]decimal.Decimal
+	royaltyFeeRate      decimal.Decimal
+	overrides           map[feeOverrideKey]dao.FeeOverride
+}
+
+// 加载指定集合的手续费模型
+func loadFeeModel(ctx context.Context, serverCtx *svc.ServerCtx, chain, collectionAddr string) (*feeModel, error) {
+	overrides, err := feeOverrides.get(ctx, serverCtx, chain)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on load fee overrides")
+	}
+	return newFeeModel(serverCtx.C.Fee, chain, collectionAddr, overrides)
+}
+
+// 根据配置文件和数据库覆盖配置构建手续费模型
+func newFeeModel(cfg *config.FeeCfg, chain, collectionAddr string, overrides map[feeOverrideKey]dao.FeeOverride) (*feeModel, error) {
+	model := &feeModel{
+		collectionAddr:      strings.ToLower(collectionAddr),
+		marketplaceFeeRates: make(map[int]decimal.Decimal),
+		royaltyFeeRate:      decimal.Zero,
+		overrides:           overrides,
+	}
+	if cfg == nil {
+		return model, nil
+	}
+
+	//1、应用配置文件中的市场费率和默认版税
+	if cfg.DefaultRoyaltyFeeRate != "" {
+		rate, err := decimal.NewFromString(cfg.DefaultRoyaltyFeeRate)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid default royalty fee rate")
+		}
+		model.royaltyFeeRate = rate
+	}
+	for _, market := range cfg.Marketplaces {
+		rate, err := decimal.NewFromString(market.FeeRate)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid marketplace fee rate")
+		}
+		model.marketplaceFeeRates[market.MarketplaceId] = rate
+	}
+
+	//2、应用配置文件中的集合费率，市场费率只覆盖配置的市场
+	for _, collection := range cfg.Collections {
+		if utils.ChainIdToChain[collection.ChainId] != chain ||
+			!strings.EqualFold(collection.Address, collectionAddr) {
+			continue
+		}
+		if collection.MarketplaceFeeRate != "" {
+			rate, err := decimal.NewFromString(collection.MarketplaceFeeRate)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid collection marketplace fee rate")
+			}
+			model.marketplaceFeeRates[collection.MarketplaceId] = rate
+		}
+		if collection.RoyaltyFeeRate != "" {
+			rate, err := decimal.NewFromString(collection.RoyaltyFeeRate)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid collection royalty fee rate")
+			}
+			model.royaltyFeeRate = rate
+		}
+	}
+	return model, nil
+}
+
+// 计算指定市场、指定价格的手续费及到手金额
+func (m *feeModel) breakdown(marketplaceId int, price decimal.Decimal) entity.FeeBreakdown {
+	marketplaceFeeRate := m.marketplaceFeeRates[marketplaceId]
+	royaltyFeeRate := m.royaltyFeeRate
+	// 数据库覆盖配置按范围从大到小依次应用，范围越小优先级越高
+	keys := []feeOverrideKey{
+		{MarketplaceId: dao.AllMarketplaces},
+		{MarketplaceId: marketplaceId},
+		{CollectionAddress: m.collectionAddr, MarketplaceId: dao.AllMarketplaces},
+		{CollectionAddress: m.collectionAddr, MarketplaceId: marketplaceId},
+	}
+	for _, key := range keys {
+		o, ok := m.overrides[key]
+		if !ok {
+			continue
+		}
+		if o.MarketplaceFeeRate.Valid {
+			marketplaceFeeRate = o.MarketplaceFeeRate.Decimal
+		}
+		if o.RoyaltyFeeRate.Valid {
+			royaltyFeeRate = o.RoyaltyFeeRate.Decimal
+		}
+	}
+
+	marketplaceFee := price.Mul(marketplaceFeeRate)
+	royaltyFee := price.Mul(royaltyFeeRate)
+	return entity.FeeBreakdown{
+		MarketplaceId:      marketplaceId,
+		Price:              price,
+		MarketplaceFeeRate: marketplaceFeeRate,
+		MarketplaceFee:     marketplaceFee,
+		RoyaltyFeeRate:     royaltyFeeRate,
+		RoyaltyFee:         royaltyFee,
+		NetProceeds:        price.Sub(marketplaceFee).Sub(royaltyFee),
+	}
+}
+
+// 挂单手续费预览：按市场返回手续费、版税和到手金额
+func PreviewFees(ctx context.Context, serverCtx *svc.ServerCtx, chain string, param entity.FeePreviewParam) ([]entity.FeeBreakdown, error) {
+	model, err := loadFeeModel(ctx, serverCtx, chain, param.CollectionAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on load fee model")
+	}
+
+	markets := param.Markets
+	if len(markets) == 0 {
+		markets = []int{multi.OrderBookDex}
+	}
+	var result []entity.FeeBreakdown
+	for _, marketplaceId := range markets {
+		result = append(result, model.breakdown(marketplaceId, param.Price))
+	}
+	return result, nil
+}
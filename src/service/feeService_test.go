@@ -0,0 +1,117 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"github.com/shopspring/decimal"
+	"strings"
+	"testing"
+)
+
+func TestFeeModelBreakdown(t *testing.T) {
+	const (
+		chain      = "sepolia"
+		chainId    = 11155111
+		collection = "0xAbC0000000000000000000000000000000000001"
+	)
+	rate := func(v string) decimal.NullDecimal {
+		return decimal.NewNullDecimal(decimal.RequireFromString(v))
+	}
+	cfg := &config.FeeCfg{
+		DefaultRoyaltyFeeRate: "0.01",
+		Marketplaces: []*config.MarketplaceFee{
+			{MarketplaceId: 0, FeeRate: "0.02"},
+			{MarketplaceId: 1, FeeRate: "0.025"},
+		},
+	}
+	tests := []struct {
+		name           string
+		collections    []*config.CollectionFee
+		overrides      []dao.FeeOverride
+		marketplaceId  int
+		wantMarketRate string
+		wantRoyalty    string
+		wantProceeds   string
+	}{
+		{
+			name:           "config marketplace rate",
+			marketplaceId:  0,
+			wantMarketRate: "0.02",
+			wantRoyalty:    "0.01",
+			wantProceeds:   "97",
+		},
+		{
+			name:           "unknown marketplace has no fee",
+			marketplaceId:  3,
+			wantMarketRate: "0",
+			wantRoyalty:    "0.01",
+			wantProceeds:   "99",
+		},
+		{
+			name: "config collection rate only targets its marketplace",
+			collections: []*config.CollectionFee{
+				{ChainId: chainId, Address: collection, MarketplaceId: 1, MarketplaceFeeRate: "0.005"},
+			},
+			marketplaceId:  0,
+			wantMarketRate: "0.02",
+			wantRoyalty:    "0.01",
+			wantProceeds:   "97",
+		},
+		{
+			name: "config collection rate applies to its marketplace",
+			collections: []*config.CollectionFee{
+				{ChainId: chainId, Address: collection, MarketplaceId: 1, MarketplaceFeeRate: "0.005", RoyaltyFeeRate: "0.05"},
+			},
+			marketplaceId:  1,
+			wantMarketRate: "0.005",
+			wantRoyalty:    "0.05",
+			wantProceeds:   "94.5",
+		},
+		{
+			name: "narrower db override wins",
+			overrides: []dao.FeeOverride{
+				{MarketplaceId: dao.AllMarketplaces, MarketplaceFeeRate: rate("0.03"), RoyaltyFeeRate: rate("0.02")},
+				{CollectionAddress: collection, MarketplaceId: dao.AllMarketplaces, MarketplaceFeeRate: rate("0.04")},
+				{CollectionAddress: collection, MarketplaceId: 0, MarketplaceFeeRate: rate("0.01")},
+			},
+			marketplaceId:  0,
+			wantMarketRate: "0.01",
+			wantRoyalty:    "0.02",
+			wantProceeds:   "97",
+		},
+		{
+			name: "db override for another marketplace is ignored",
+			overrides: []dao.FeeOverride{
+				{CollectionAddress: collection, MarketplaceId: 1, MarketplaceFeeRate: rate("0.1")},
+			},
+			marketplaceId:  0,
+			wantMarketRate: "0.02",
+			wantRoyalty:    "0.01",
+			wantProceeds:   "97",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *cfg
+			c.Collections = tt.collections
+			overrides := make(map[feeOverrideKey]dao.FeeOverride)
+			for _, o := range tt.overrides {
+				overrides[feeOverrideKey{CollectionAddress: strings.ToLower(o.CollectionAddress), MarketplaceId: o.MarketplaceId}] = o
+			}
+			model, err := newFeeModel(&c, chain, collection, overrides)
+			if err != nil {
+				t.Fatalf("newFeeModel: %v", err)
+			}
+			got := model.breakdown(tt.marketplaceId, decimal.NewFromInt(100))
+			if !got.MarketplaceFeeRate.Equal(decimal.RequireFromString(tt.wantMarketRate)) {
+				t.Errorf("marketplace fee rate = %s, want %s", got.MarketplaceFeeRate, tt.wantMarketRate)
+			}
+			if !got.RoyaltyFeeRate.Equal(decimal.RequireFromString(tt.wantRoyalty)) {
+				t.Errorf("royalty fee rate = %s, want %s", got.RoyaltyFeeRate, tt.wantRoyalty)
+			}
+			if !got.NetProceeds.Equal(decimal.RequireFromString(tt.wantProceeds)) {
+				t.Errorf("net proceeds = %s, want %s", got.NetProceeds, tt.wantProceeds)
+			}
+		})
+	}
+}
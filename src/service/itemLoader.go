@@ -0,0 +1,348 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"strings"
+	"sync"
+)
+
+// 批量加载时同时执行的查询数量
+const itemLoaderConcurrency = 8
+
+// 需要加载的item扩展信息
+const (
+	loadItemImage    = 1 << iota // 图片和视频信息
+	loadItemLastSale             // 最近成交价格
+	loadItemBestBid              // item和trait级别的最高出价，以及集合级别的最高出价
+	loadItemListing              // 挂单订单信息，需通过AddListing添加挂单价格
+)
+
+// 批量加载时item的唯一标识，地址和token id统一小写
+type itemKey struct {
+	Chain             string
+	CollectionAddress string
+	TokenId           string
+}
+
+func newItemKey(chain, collectionAddr, tokenId string) itemKey {
+	return itemKey{
+		Chain:             strings.ToLower(chain),
+		CollectionAddress: strings.ToLower(collectionAddr),
+		TokenId:           strings.ToLower(tokenId),
+	}
+}
+
+// 批量加载时集合的唯一标识
+type collectionKey struct {
+	Chain             string
+	CollectionAddress string
+}
+
+// 并发执行一组查询，最多同时执行concurrency个，Go在获得执行名额后才启动goroutine
+// Wait等待全部完成后返回第一个错误
+func newLoaderGroup(concurrency int) *errgroup.Group {
+	group := &errgroup.Group{}
+	group.SetLimit(concurrency)
+	return group
+}
+
+// 请求级别的item扩展信息批量加载器
+// 1. 通过Add/AddListing添加需要加载的item，相同的item只加载一次
+// 2. Load时按(链, 集合)合并为批量查询并发执行，挂单订单按链合并
+// 3. 查询结果和错误都按item记录，Load返回后通过Image、BestBid等方法读取，
+// 查询失败时通过Err获取item的错误，调用方对该item降级返回，不影响其他item
+// 仅在单个请求内使用，不可在Load之后继续添加item
+type itemLoader struct {
+	ctx       context.Context
+	serverCtx *svc.ServerCtx
+	userAddr  string // 查询出价时排除该用户的出价
+
+	keys        []itemKey
+	seen        map[itemKey]struct{}
+	listings    map[string][]entity.ItemPriceInfo // 按链分组的挂单价格
+	listingSeen map[itemKey]struct{}
+
+	mu             sync.Mutex
+	group          *errgroup.Group
+	images         map[itemKey]multi.ItemExternal
+	lastSales      map[itemKey]decimal.Decimal
+	bestBids       map[itemKey]multi.Order
+	collectionBids map[collectionKey]multi.Order
+	orders         map[itemKey]multi.Order
+	errs           map[itemKey]error
+}
+
+func newItemLoader(ctx context.Context, serverCtx *svc.ServerCtx, userAddr string) *itemLoader {
+	return &itemLoader{
+		ctx:            ctx,
+		serverCtx:      serverCtx,
+		userAddr:       userAddr,
+		seen:           make(map[itemKey]struct{}),
+		listings:       make(map[string][]entity.ItemPriceInfo),
+		listingSeen:    make(map[itemKey]struct{}),
+		group:          newLoaderGroup(itemLoaderConcurrency),
+		images:         make(map[itemKey]multi.ItemExternal),
+		lastSales:      make(map[itemKey]decimal.Decimal),
+		bestBids:       make(map[itemKey]multi.Order),
+		collectionBids: make(map[collectionKey]multi.Order),
+		orders:         make(map[itemKey]multi.Order),
+		errs:           make(map[itemKey]error),
+	}
+}
+
+// Add 添加需要加载的item
+func (l *itemLoader) Add(chain, collectionAddr, tokenId string) {
+	if collectionAddr == "" || tokenId == "" {
+		return
+	}
+	key := newItemKey(chain, collectionAddr, tokenId)
+	if _, ok := l.seen[key]; ok {
+		return
+	}
+	l.seen[key] = struct{}{}
+	l.keys = append(l.keys, key)
+}
+
+// AddListing 添加需要加载挂单订单的item
+func (l *itemLoader) AddListing(chain string, price entity.ItemPriceInfo) {
+	l.Add(chain, price.CollectionAddress, price.TokenId)
+	key := newItemKey(chain, price.CollectionAddress, price.TokenId)
+	if _, ok := l.listingSeen[key]; ok {
+		return
+	}
+	l.listingSeen[key] = struct{}{}
+	l.listings[key.Chain] = append(l.listings[key.Chain], price)
+}
+
+// Load 加载已添加item的扩展信息，fields为loadItem*的组合
+// 查询失败时只记录相关item的错误，仅在请求已取消时返回错误
+func (l *itemLoader) Load(fields int) error {
+	//1、按(链, 集合)和链对item分组
+	collectionItems := make(map[collectionKey][]itemKey)
+	chainCollections := make(map[string][]string)
+	for _, key := range l.keys {
+		coll := collectionKey{Chain: key.Chain, CollectionAddress: key.CollectionAddress}
+		if _, ok := collectionItems[coll]; !ok {
+			chainCollections[key.Chain] = append(chainCollections[key.Chain], key.CollectionAddress)
+		}
+		collectionItems[coll] = append(collectionItems[coll], key)
+	}
+
+	//2、按集合批量查询item维度的信息
+	for coll, keys := range collectionItems {
+		tokenIds := make([]string, 0, len(keys))
+		for _, key := range keys {
+			tokenIds = append(tokenIds, key.TokenId)
+		}
+		if fields&loadItemImage != 0 {
+			l.run(keys, func() error { return l.loadImages(coll, tokenIds) })
+		}
+		if fields&loadItemLastSale != 0 {
+			l.run(keys, func() error { return l.loadLastSales(coll, tokenIds) })
+		}
+		if fields&loadItemBestBid != 0 {
+			l.run(keys, func() error { return l.loadBestBids(coll, tokenIds) })
+		}
+	}
+
+	//3、按链批量查询集合出价和挂单订单
+	if fields&loadItemBestBid != 0 {
+		for chain, collectionAddrs := range chainCollections {
+			var keys []itemKey
+			for _, collectionAddr := range collectionAddrs {
+				keys = append(keys, collectionItems[collectionKey{Chain: chain, CollectionAddress: collectionAddr}]...)
+			}
+			l.run(keys, func() error { return l.loadCollectionBids(chain, collectionAddrs) })
+		}
+	}
+	if fields&loadItemListing != 0 {
+		for chain, prices := range l.listings {
+			keys := make([]itemKey, 0, len(prices))
+			for _, price := range prices {
+				keys = append(keys, newItemKey(chain, price.CollectionAddress, price.TokenId))
+			}
+			l.run(keys, func() error { return l.loadOrders(chain, prices) })
+		}
+	}
+	_ = l.group.Wait()
+
+	//4、记录加载失败的item数量，请求已取消时不再降级返回
+	l.mu.Lock()
+	failed := len(l.errs)
+	l.mu.Unlock()
+	if failed == 0 {
+		return nil
+	}
+	if err := l.ctx.Err(); err != nil {
+		return errors.Wrap(err, "items info loading canceled")
+	}
+	xzap.WithContext(l.ctx).Warn("failed on load part of items info", zap.Int("failed", failed), zap.Int("total", len(l.keys)))
+	return nil
+}
+
+// 执行一个查询，查询失败时keys中的每个item都记录该错误，已有错误的item保留第一个错误
+func (l *itemLoader) run(keys []itemKey, fn func() error) {
+	l.group.Go(func() error {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		xzap.WithContext(l.ctx).Error("failed on load items info", zap.Int("items", len(keys)), zap.Error(err))
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, key := range keys {
+			if _, ok := l.errs[key]; !ok {
+				l.errs[key] = err
+			}
+		}
+		return nil
+	})
+}
+
+func (l *itemLoader) loadImages(coll collectionKey, tokenIds []string) error {
+	images, err := l.serverCtx.Dao.QueryCollectionItemImage(l.ctx, coll.Chain, coll.CollectionAddress, tokenIds)
+	if err != nil {
+		return errors.Wrap(err, "failed on get items image info")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, image := range images {
+		l.images[newItemKey(coll.Chain, coll.CollectionAddress, image.TokenId)] = image
+	}
+	return nil
+}
+
+func (l *itemLoader) loadLastSales(coll collectionKey, tokenIds []string) error {
+	lastSales, err := l.serverCtx.Dao.QueryLastSalePrice(l.ctx, coll.Chain, coll.CollectionAddress, tokenIds)
+	if err != nil {
+		return errors.Wrap(err, "failed on get items last sale info")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, v := range lastSales {
+		l.lastSales[newItemKey(coll.Chain, coll.CollectionAddress, v.TokenId)] = v.Price
+	}
+	return nil
+}
+
+// 查询结果中同时包含item出价和trait出价，每个item取价格最高的一个
+func (l *itemLoader) loadBestBids(coll collectionKey, tokenIds []string) error {
+	bids, err := l.serverCtx.Dao.QueryBestBids(l.ctx, coll.Chain, coll.CollectionAddress, l.userAddr, tokenIds)
+	if err != nil {
+		return errors.Wrap(err, "failed on get items best bids")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, bid := range bids {
+		key := newItemKey(coll.Chain, coll.CollectionAddress, bid.TokenId)
+		order, ok := l.bestBids[key]
+		if !ok || bid.Price.GreaterThan(order.Price) {
+			l.bestBids[key] = bid
+		}
+	}
+	return nil
+}
+
+func (l *itemLoader) loadCollectionBids(chain string, collectionAddrs []string) error {
+	bids, err := l.serverCtx.Dao.QueryCollectionsBestBid(l.ctx, chain, l.userAddr, collectionAddrs)
+	if err != nil {
+		return errors.Wrap(err, "failed on get collections best bid")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, bid := range bids {
+		key := collectionKey{Chain: chain, CollectionAddress: strings.ToLower(bid.CollectionAddress)}
+		if _, ok := l.collectionBids[key]; !ok {
+			l.collectionBids[key] = *bid
+		}
+	}
+	return nil
+}
+
+func (l *itemLoader) loadOrders(chain string, prices []entity.ItemPriceInfo) error {
+	orders, err := l.serverCtx.Dao.QueryListingInfo(l.ctx, chain, prices)
+	if err != nil {
+		return errors.Wrap(err, "failed on get orders time info")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, order := range orders {
+		l.orders[newItemKey(chain, order.CollectionAddress, order.TokenId)] = order
+	}
+	return nil
+}
+
+// Err 获取item的加载错误，为空时item的扩展信息完整
+func (l *itemLoader) Err(chain, collectionAddr, tokenId string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.errs[newItemKey(chain, collectionAddr, tokenId)]
+}
+
+// Image 获取item的图片和视频信息
+func (l *itemLoader) Image(chain, collectionAddr, tokenId string) (multi.ItemExternal, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	image, ok := l.images[newItemKey(chain, collectionAddr, tokenId)]
+	return image, ok
+}
+
+// LastSale 获取item的最近成交价格
+func (l *itemLoader) LastSale(chain, collectionAddr, tokenId string) (decimal.Decimal, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	price, ok := l.lastSales[newItemKey(chain, collectionAddr, tokenId)]
+	return price, ok
+}
+
+// CollectionBestBid 获取集合级别的最高出价
+func (l *itemLoader) CollectionBestBid(chain, collectionAddr string) (multi.Order, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bid, ok := l.collectionBids[collectionKey{Chain: strings.ToLower(chain), CollectionAddress: strings.ToLower(collectionAddr)}]
+	return bid, ok
+}
+
+// BestBid 获取item的最高出价，item和trait级别的出价不高于集合级别的出价时返回集合出价
+func (l *itemLoader) BestBid(chain, collectionAddr, tokenId string) (multi.Order, bool) {
+	collectionBid, collectionOk := l.CollectionBestBid(chain, collectionAddr)
+	l.mu.Lock()
+	itemBid, itemOk := l.bestBids[newItemKey(chain, collectionAddr, tokenId)]
+	l.mu.Unlock()
+	if itemOk && (!collectionOk || itemBid.Price.GreaterThan(collectionBid.Price)) {
+		return itemBid, true
+	}
+	return collectionBid, collectionOk
+}
+
+// ListingOrder 获取item的挂单订单信息
+func (l *itemLoader) ListingOrder(chain, collectionAddr, tokenId string) (multi.Order, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	order, ok := l.orders[newItemKey(chain, collectionAddr, tokenId)]
+	return order, ok
+}
+
+// 设置图片信息，优先使用已上传oss的地址
+func itemImageURI(external multi.ItemExternal) string {
+	if external.IsUploadedOss {
+		return external.OssUri
+	}
+	return external.ImageUri
+}
+
+// 设置视频信息，优先使用已上传oss的地址
+func itemVideoURI(external multi.ItemExternal) string {
+	if external.IsVideoUploaded {
+		return external.VideoOssUri
+	}
+	return external.VideoUri
+}
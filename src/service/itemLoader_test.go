@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoaderGroupLimit(t *testing.T) {
+	group := newLoaderGroup(2)
+	errFailed := errors.New("failed")
+	var running, maxRunning int32
+	for i := 0; i < 10; i++ {
+		group.Go(func() error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			if i == 3 {
+				return errFailed
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); !errors.Is(err, errFailed) {
+		t.Fatalf("err = %v, want %v", err, errFailed)
+	}
+	if maxRunning > 2 {
+		t.Errorf("max running = %d, want <= 2", maxRunning)
+	}
+}
+
+func TestNewItemKey(t *testing.T) {
+	if newItemKey("Sepolia", "0xABC", "1") != newItemKey("sepolia", "0xabc", "1") {
+		t.Error("item key should ignore case")
+	}
+}
+
+func TestItemLoaderPerItemErrors(t *testing.T) {
+	l := newItemLoader(context.Background(), nil, "")
+	l.Add("sepolia", "0xAAA", "1")
+	l.Add("sepolia", "0xaaa", "2")
+	l.Add("sepolia", "0xbbb", "1")
+	a1 := newItemKey("sepolia", "0xaaa", "1")
+	a2 := newItemKey("sepolia", "0xaaa", "2")
+	b1 := newItemKey("sepolia", "0xbbb", "1")
+
+	errImages := errors.New("images failed")
+	errBids := errors.New("bids failed")
+	l.run([]itemKey{a1, a2}, func() error { return errImages })
+	l.run([]itemKey{b1}, func() error { return nil })
+	if err := l.group.Wait(); err != nil {
+		t.Fatalf("group should not fail, got %v", err)
+	}
+	// 已有错误的item保留第一个错误
+	l.run([]itemKey{a1, b1}, func() error { return errBids })
+	_ = l.group.Wait()
+
+	tests := []struct {
+		chain, addr, tokenId string
+		want                 error
+	}{
+		{"sepolia", "0xaaa", "1", errImages},
+		{"Sepolia", "0xAAA", "2", errImages},
+		{"sepolia", "0xbbb", "1", errBids},
+		{"sepolia", "0xccc", "1", nil},
+	}
+	for _, tt := range tests {
+		if got := l.Err(tt.chain, tt.addr, tt.tokenId); got != tt.want {
+			t.Errorf("Err(%s, %s, %s) = %v, want %v", tt.chain, tt.addr, tt.tokenId, got, tt.want)
+		}
+	}
+}
+
+func TestItemLoaderLoadDegrades(t *testing.T) {
+	// 没有需要加载的item时不查询
+	l := newItemLoader(context.Background(), nil, "")
+	if err := l.Load(loadItemImage | loadItemBestBid); err != nil {
+		t.Errorf("Load() = %v, want nil", err)
+	}
+
+	// 请求已取消且有item加载失败时返回错误，否则降级返回
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = newItemLoader(ctx, nil, "")
+	l.Add("sepolia", "0xaaa", "1")
+	l.run([]itemKey{newItemKey("sepolia", "0xaaa", "1")}, func() error { return ctx.Err() })
+	if err := l.Load(0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Load() = %v, want context canceled", err)
+	}
+}
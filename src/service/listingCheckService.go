@@ -0,0 +1,187 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/chain"
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListingCheckInterval   = 60
+	defaultListingCheckSampleSize = 200
+)
+
+// StartListingCheck 后台挂单有效性校验任务
+// 定时抽样各链的活跃挂单，通过链上ownerOf和isApprovedForAll校验挂单是否仍可成交，
+// 无效挂单记录到无效订单表并从地板价、上架数量和立即购买结果中排除
+func StartListingCheck(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.ListingCheck
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultListingCheckInterval
+	}
+	sampleSize := cfg.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = defaultListingCheckSampleSize
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, supported := range serverCtx.C.ChainSupported {
+				if err := checkChainListings(ctx, serverCtx, supported, sampleSize); err != nil {
+					xzap.WithContext(ctx).Error("failed on check listings", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+			}
+		}
+	}
+}
+
+// 校验指定链上抽样的挂单
+func checkChainListings(ctx context.Context, serverCtx *svc.ServerCtx, supported *config.ChainSupported, sampleSize int) error {
+	client, ok := serverCtx.Chains[int64(supported.ChainId)]
+	if !ok {
+		return errors.New("chain client not found")
+	}
+	//1、移除已成交、已取消或已过期挂单的无效记录
+	if err := serverCtx.Dao.RemoveClosedInvalidOrders(ctx, supported.Name); err != nil {
+		return errors.Wrap(err, "failed on remove closed invalid orders")
+	}
+
+	//2、抽样活跃挂单
+	orders, err := serverCtx.Dao.QuerySampleListings(ctx, supported.Name, sampleSize)
+	if err != nil {
+		return errors.Wrap(err, "failed on query sample listings")
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+
+	//3、逐个校验挂单，链上查询失败的挂单保持原状态
+	now := time.Now().Unix()
+	var invalidOrders []dao.InvalidOrder
+	var validOrderIds []string
+	var orderIds []string
+	affected := make(map[string]bool)
+	for _, order := range orders {
+		reason, err := checkListing(ctx, client, supported.VaultAddress, order)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on check listing", zap.Error(err),
+				zap.String("chain", supported.Name), zap.String("order_id", order.OrderID))
+			continue
+		}
+		orderIds = append(orderIds, order.OrderID)
+		if reason == "" {
+			validOrderIds = append(validOrderIds, order.OrderID)
+			continue
+		}
+		invalidOrders = append(invalidOrders, dao.InvalidOrder{
+			OrderID:           order.OrderID,
+			CollectionAddress: order.CollectionAddress,
+			TokenId:           order.TokenId,
+			Maker:             order.Maker,
+			Reason:            reason,
+			CheckTime:         now,
+			CreateTime:        now,
+			UpdateTime:        now,
+		})
+		affected[strings.ToLower(order.CollectionAddress)] = true
+	}
+
+	//4、之前被标记为无效、本次校验有效的挂单需要恢复
+	marked, err := serverCtx.Dao.QueryInvalidOrders(ctx, supported.Name, validOrderIds)
+	if err != nil {
+		return errors.Wrap(err, "failed on query invalid orders")
+	}
+	var restoredOrderIds []string
+	for _, order := range marked {
+		restoredOrderIds = append(restoredOrderIds, order.OrderID)
+		affected[strings.ToLower(order.CollectionAddress)] = true
+	}
+
+	//5、保存校验结果，受影响集合的地板价事件在同一事务中写入发件箱
+	var affectedAddrs []string
+	for collectionAddr := range affected {
+		affectedAddrs = append(affectedAddrs, collectionAddr)
+	}
+	err = serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		d := serverCtx.Dao.WithTx(tx)
+		if err := d.MarkOrdersInvalid(ctx, supported.Name, invalidOrders); err != nil {
+			return errors.Wrap(err, "failed on mark orders invalid")
+		}
+		if err := d.RemoveInvalidOrders(ctx, supported.Name, restoredOrderIds); err != nil {
+			return errors.Wrap(err, "failed on remove invalid orders")
+		}
+		return enqueueFloorPriceEvents(ctx, serverCtx, d, supported.Name, affectedAddrs)
+	})
+	if err != nil {
+		return err
+	}
+
+	//6、刷新受影响集合的上架数量
+	for _, collectionAddr := range affectedAddrs {
+		refreshCollectionListing(ctx, serverCtx, supported.Name, collectionAddr)
+	}
+	return nil
+}
+
+// 校验单个挂单，返回无效原因，有效时返回空字符串
+// ownerOf revert时无法确定原因，返回错误，挂单保持原状态
+func checkListing(ctx context.Context, client chain.NftClient, operator string, order multi.Order) (string, error) {
+	//1、ERC721的挂单者需为NFT当前所有者，ERC1155等合约不支持ownerOf，不校验所有者
+	isErc721, err := client.SupportsErc721(ctx, order.CollectionAddress)
+	if err != nil {
+		return "", errors.Wrap(err, "failed on check erc721")
+	}
+	if isErc721 {
+		owner, err := client.OwnerOf(ctx, order.CollectionAddress, order.TokenId)
+		if err != nil {
+			return "", errors.Wrap(err, "failed on fetch nft owner")
+		}
+		if strings.EqualFold(owner, zeroAddress) {
+			return dao.InvalidReasonTokenBurned, nil
+		}
+		if !strings.EqualFold(owner, order.Maker) {
+			return dao.InvalidReasonOwnerChanged, nil
+		}
+	}
+	//2、本平台挂单需保持对合约的授权
+	if operator == "" || order.MarketplaceId != multi.OrderBookDex {
+		return "", nil
+	}
+	approved, err := client.IsApprovedForAll(ctx, order.CollectionAddress, order.Maker, operator)
+	if err != nil {
+		return "", errors.Wrap(err, "failed on fetch approval")
+	}
+	if !approved {
+		return dao.InvalidReasonNotApproved, nil
+	}
+	return "", nil
+}
+
+// 重新计算集合的上架数量缓存，地板价变化通过发件箱通知ordermanager
+func refreshCollectionListing(ctx context.Context, serverCtx *svc.ServerCtx, chain, collectionAddr string) {
+	listedAmount, err := serverCtx.Dao.QueryListedAmount(ctx, chain, collectionAddr)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get listed count", zap.Error(err))
+	} else if err := serverCtx.Cached.CacheCollectionsListed(chain, collectionAddr, int(listedAmount)); err != nil {
+		xzap.WithContext(ctx).Error("failed on cache collection listed", zap.Error(err))
+	}
+}
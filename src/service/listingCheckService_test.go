@@ -0,0 +1,124 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/chain"
+	"EasySwapBackend-test/src/dao"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"strings"
+	"testing"
+)
+
+// 测试用的链上查询客户端，owners的key为token id
+type fakeNftClient struct {
+	erc721   bool
+	owners   map[string]string
+	ownerErr error
+	approved bool
+}
+
+func (c *fakeNftClient) SupportsErc721(ctx context.Context, collectionAddr string) (bool, error) {
+	return c.erc721, nil
+}
+
+func (c *fakeNftClient) OwnerOf(ctx context.Context, collectionAddr, tokenId string) (string, error) {
+	if c.ownerErr != nil {
+		return "", c.ownerErr
+	}
+	return c.owners[tokenId], nil
+}
+
+func (c *fakeNftClient) IsApprovedForAll(ctx context.Context, collectionAddr, owner, operator string) (bool, error) {
+	return c.approved, nil
+}
+
+func (c *fakeNftClient) TokenURI(ctx context.Context, collectionAddr, tokenId string) (string, error) {
+	return "", nil
+}
+
+func (c *fakeNftClient) OwnersOf(ctx context.Context, collectionAddr string, tokenIds []string) ([]chain.OwnerResult, error) {
+	results := make([]chain.OwnerResult, len(tokenIds))
+	for i, tokenId := range tokenIds {
+		results[i].Owner, results[i].Err = c.OwnerOf(ctx, collectionAddr, tokenId)
+	}
+	return results, nil
+}
+
+func TestCheckListing(t *testing.T) {
+	const (
+		maker    = "0x00000000000000000000000000000000000000aa"
+		operator = "0x00000000000000000000000000000000000000bb"
+	)
+	order := multi.Order{
+		CollectionAddress: "0x0000000000000000000000000000000000000c01",
+		TokenId:           "1",
+		Maker:             maker,
+		MarketplaceId:     multi.OrderBookDex,
+	}
+	tests := []struct {
+		name       string
+		client     *fakeNftClient
+		operator   string
+		order      multi.Order
+		wantReason string
+		wantErr    bool
+	}{
+		{
+			name:     "valid listing",
+			client:   &fakeNftClient{erc721: true, owners: map[string]string{"1": strings.ToUpper(maker)}, approved: true},
+			operator: operator,
+			order:    order,
+		},
+		{
+			name:       "owner changed",
+			client:     &fakeNftClient{erc721: true, owners: map[string]string{"1": operator}, approved: true},
+			operator:   operator,
+			order:      order,
+			wantReason: dao.InvalidReasonOwnerChanged,
+		},
+		{
+			name:       "burned token returns zero address",
+			client:     &fakeNftClient{erc721: true, owners: map[string]string{"1": zeroAddress}, approved: true},
+			operator:   operator,
+			order:      order,
+			wantReason: dao.InvalidReasonTokenBurned,
+		},
+		{
+			name:     "ownerOf revert is not treated as burned",
+			client:   &fakeNftClient{erc721: true, ownerErr: errors.Wrap(chain.ErrExecutionReverted, "revert")},
+			operator: operator,
+			order:    order,
+			wantErr:  true,
+		},
+		{
+			name:     "erc1155 skips owner check",
+			client:   &fakeNftClient{erc721: false, ownerErr: chain.ErrExecutionReverted, approved: true},
+			operator: operator,
+			order:    order,
+		},
+		{
+			name:       "approval revoked",
+			client:     &fakeNftClient{erc721: true, owners: map[string]string{"1": maker}, approved: false},
+			operator:   operator,
+			order:      order,
+			wantReason: dao.InvalidReasonNotApproved,
+		},
+		{
+			name:   "no vault address skips approval check",
+			client: &fakeNftClient{erc721: true, owners: map[string]string{"1": maker}, approved: false},
+			order:  order,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := checkListing(context.Background(), tt.client, tt.operator, tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
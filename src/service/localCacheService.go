@@ -0,0 +1,67 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/localcache"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// 进程内缓存失效频道 <项目名>:stream:local-cache:invalidate
+func genLocalCacheInvalidateChannel(project string) string {
+	return fmt.Sprintf("%s:stream:local-cache:invalidate", strings.ToLower(project))
+}
+
+// StartLocalCacheInvalidation 启动进程内缓存的跨实例失效
+// 1. 本实例使缓存失效时通过Redis pub/sub通知所有实例删除对应条目
+// 2. 收到订单事件时删除相关集合的信息和上架数量，集合数据由ordermanager在其他进程中更新
+func StartLocalCacheInvalidation(ctx context.Context, serverCtx *svc.ServerCtx) {
+	if serverCtx.Local == nil || serverCtx.Broker == nil {
+		return
+	}
+	channel := genLocalCacheInvalidateChannel(serverCtx.C.ProjectCfg.Name)
+
+	//1、订阅失效通知，自己发布的通知也会收到，重复删除不影响
+	err := serverCtx.Broker.Handle(ctx, channel, func(payload []byte) {
+		var keys []string
+		if err := json.Unmarshal(payload, &keys); err != nil {
+			xzap.WithContext(ctx).Error("failed on unmarshal local cache keys", zap.Error(err))
+			return
+		}
+		serverCtx.Local.Remove(keys...)
+	})
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on subscribe local cache invalidation", zap.Error(err))
+		return
+	}
+	serverCtx.Local.SetPublisher(func(keys []string) error {
+		return serverCtx.Broker.Publish(ctx, channel, keys)
+	})
+
+	//2、订阅订单事件，所有实例都会收到，只删除本实例的条目
+	err = serverCtx.Broker.Handle(ctx, genTradeEventChannel(serverCtx.C.ProjectCfg.Name), func(payload []byte) {
+		var event tradeEventMessage
+		if err := json.Unmarshal(payload, &event); err != nil {
+			xzap.WithContext(ctx).Error("failed on unmarshal trade event", zap.Error(err))
+			return
+		}
+		serverCtx.Local.Remove(
+			dao.GenCollectionInfoLocalKey(event.Chain, event.CollectionAddr),
+			ordermanager.GenCollectionListedKey(event.Chain, event.CollectionAddr),
+		)
+	})
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on subscribe trade event", zap.Error(err))
+	}
+}
+
+// GetLocalCacheStats 查询本实例进程内缓存的条目数和命中统计，未启用时全部为0
+func GetLocalCacheStats(serverCtx *svc.ServerCtx) localcache.Stats {
+	return serverCtx.Local.Stats()
+}
@@ -0,0 +1,398 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/service/mq"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMetadataUserCooldown       = 60
+	defaultMetadataCollectionCooldown = 300
+	defaultMetadataBatchSize          = 500
+	defaultMetadataMaxTokens          = 1000
+	metadataJobFailuresLimit          = 100
+	metadataMaxReasonLength           = 512
+	metadataStaleJobSeconds           = 300
+	metadataStaleJobCheckInterval     = 60
+	metadataStaleJobsLimit            = 20
+)
+
+// 用户刷新集合元数据冷却 cache:<项目名>:metadata:refresh:cooldown:user:<用户地址>
+func genMetadataUserCooldownKey(project, userAddr string) string {
+	return fmt.Sprintf("cache:%s:metadata:refresh:cooldown:user:%s", strings.ToLower(project), strings.ToLower(userAddr))
+}
+
+// 集合元数据刷新冷却 cache:<项目名>:metadata:refresh:cooldown:collection:<链id>:<集合地址>
+func genMetadataCollectionCooldownKey(project string, chainId int, collectionAddr string) string {
+	return fmt.Sprintf("cache:%s:metadata:refresh:cooldown:collection:%d:%s", strings.ToLower(project), chainId, strings.ToLower(collectionAddr))
+}
+
+// 后台入队任务的运行上下文，由StartMetadataRefreshJobs绑定到应用生命周期
+var metadataJobs = &metadataJobRunner{ctx: context.Background()}
+
+// 管理当前实例上正在入队的刷新任务
+// ctx结束时所有任务停止入队，保持入队中状态由其他实例继续，Wait等待这些任务退出
+type metadataJobRunner struct {
+	mu  sync.Mutex
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func (r *metadataJobRunner) setContext(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+}
+
+func (r *metadataJobRunner) run(fn func(ctx context.Context)) {
+	r.mu.Lock()
+	ctx := r.ctx
+	r.wg.Add(1)
+	r.mu.Unlock()
+	go func() {
+		defer r.wg.Done()
+		fn(ctx)
+	}()
+}
+
+// StartMetadataRefreshJobs 将后台入队任务绑定到ctx，ctx结束后等待正在运行的任务退出
+// 启动时和之后定期继续入队中但长时间没有进度的任务，这些任务所在的实例已退出
+func StartMetadataRefreshJobs(ctx context.Context, serverCtx *svc.ServerCtx) {
+	metadataJobs.setContext(ctx)
+	defer metadataJobs.wg.Wait()
+	ticker := time.NewTicker(metadataStaleJobCheckInterval * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := resumeStaleMetadataRefreshJobs(ctx, serverCtx); err != nil {
+			xzap.WithContext(ctx).Error("failed on resume stale metadata refresh jobs", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 认领没有进度的入队任务，从记录的入队位置继续入队
+func resumeStaleMetadataRefreshJobs(ctx context.Context, serverCtx *svc.ServerCtx) error {
+	jobs, err := serverCtx.Dao.QueryStaleMetadataRefreshJobs(ctx, time.Now().Unix()-metadataStaleJobSeconds, metadataStaleJobsLimit)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		chain, ok := utils.ChainIdToChain[job.ChainId]
+		if !ok {
+			continue
+		}
+		claimed, err := serverCtx.Dao.ClaimMetadataRefreshJob(ctx, job)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		xzap.WithContext(ctx).Info("resume metadata refresh job", zap.Int64("job_id", job.Id),
+			zap.Int64("queue_cursor", job.QueueCursor))
+		metadataJobs.run(func(ctx context.Context) {
+			queueMetadataRefreshJob(ctx, serverCtx, chain, job)
+		})
+	}
+	return nil
+}
+
+// RefreshCollectionMetadata 创建集合元数据刷新任务
+// 1. 未指定token_ids时刷新集合中的全部token，否则只刷新指定的token
+// 2. 同一集合、同一用户在冷却时间内只能创建一次任务
+// 3. 任务创建后在后台分批加入刷新队列，可通过任务id查询进度
+func RefreshCollectionMetadata(ctx context.Context, serverCtx *svc.ServerCtx, userAddr, collectionAddr string, param entity.MetadataRefreshParam) (*entity.MetadataRefreshJobInfo, error) {
+	cfg := serverCtx.C.Metadata
+	userCooldown, collectionCooldown := defaultMetadataUserCooldown, defaultMetadataCollectionCooldown
+	maxTokens := defaultMetadataMaxTokens
+	if cfg != nil {
+		if cfg.UserCooldown > 0 {
+			userCooldown = cfg.UserCooldown
+		}
+		if cfg.CollectionCooldown > 0 {
+			collectionCooldown = cfg.CollectionCooldown
+		}
+		if cfg.MaxTokens > 0 {
+			maxTokens = cfg.MaxTokens
+		}
+	}
+
+	//1、校验参数
+	chain, ok := utils.ChainIdToChain[param.ChainID]
+	if !ok {
+		return nil, errors.Errorf("unsupported chain id: %d", param.ChainID)
+	}
+	collectionAddr = strings.ToLower(collectionAddr)
+	collection, err := serverCtx.Dao.QueryCollectionInfo(ctx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection info")
+	}
+	if collection.Address == "" {
+		return nil, errors.New("collection not exist")
+	}
+	tokenIds := utils.RemoveRepeatedElement(param.TokenIds)
+	if len(tokenIds) > maxTokens {
+		return nil, errors.Errorf("too many token ids, max %d", maxTokens)
+	}
+
+	//2、冷却检查，先占集合再占用户，用户冷却中时释放集合
+	collectionKey := genMetadataCollectionCooldownKey(serverCtx.C.ProjectCfg.Name, param.ChainID, collectionAddr)
+	ok, err = serverCtx.KvStore.SetnxEx(collectionKey, userAddr, collectionCooldown)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on check collection cooldown")
+	}
+	if !ok {
+		return nil, errors.New("collection metadata was refreshed recently, please try again later")
+	}
+	ok, err = serverCtx.KvStore.SetnxEx(genMetadataUserCooldownKey(serverCtx.C.ProjectCfg.Name, userAddr), collectionAddr, userCooldown)
+	if err != nil || !ok {
+		_, _ = serverCtx.KvStore.Del(collectionKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on check user cooldown")
+		}
+		return nil, errors.New("refresh too frequently, please try again later")
+	}
+
+	//3、创建任务
+	now := time.Now().Unix()
+	job := &dao.MetadataRefreshJob{
+		Owner:             strings.ToLower(userAddr),
+		ChainId:           param.ChainID,
+		CollectionAddress: collectionAddr,
+		TokenIds:          strings.Join(tokenIds, ","),
+		Status:            dao.MetadataRefreshQueuing,
+		Total:             int64(len(tokenIds)),
+		CreateTime:        now,
+		UpdateTime:        now,
+	}
+	if err := serverCtx.Dao.AddMetadataRefreshJob(ctx, job); err != nil {
+		return nil, errors.Wrap(err, "failed on add metadata refresh job")
+	}
+
+	//4、后台分批加入刷新队列，不受请求结束影响，随应用退出或用户取消停止
+	metadataJobs.run(func(ctx context.Context) {
+		queueMetadataRefreshJob(ctx, serverCtx, chain, job)
+	})
+
+	info := toMetadataRefreshJobInfo(job, nil)
+	return &info, nil
+}
+
+// 任务指定的token，为空表示集合中全部token
+func metadataJobTokenIds(job *dao.MetadataRefreshJob) []string {
+	if job.TokenIds == "" {
+		return nil
+	}
+	return strings.Split(job.TokenIds, ",")
+}
+
+// 将任务中的token从记录的入队位置开始分批加入刷新队列，每批记录进度和新的入队位置
+// 每批入队前检查任务是否已被取消以及ctx是否结束。ctx结束时保持入队中状态，由其他实例继续；
+// 查询集合token失败时标记任务失败
+func queueMetadataRefreshJob(ctx context.Context, serverCtx *svc.ServerCtx, chain string, job *dao.MetadataRefreshJob) {
+	batchSize := defaultMetadataBatchSize
+	if cfg := serverCtx.C.Metadata; cfg != nil && cfg.BatchSize > 0 {
+		batchSize = cfg.BatchSize
+	}
+	// 任务状态更新不受ctx结束影响，保证已入队的批次能记录进度
+	updateCtx := context.WithoutCancel(ctx)
+	tokenIds := metadataJobTokenIds(job)
+
+	// 已入队的token数，指定token时为入队位置，否则累加在total中
+	total := job.Total
+	if len(tokenIds) > 0 {
+		total = job.QueueCursor
+	}
+	fail := func(cause error) {
+		reason := truncateReason(cause.Error(), metadataMaxReasonLength)
+		if err := serverCtx.Dao.FailMetadataRefreshJob(updateCtx, job.Id, total, reason); err != nil {
+			xzap.WithContext(ctx).Error("failed on fail metadata refresh job", zap.Error(err), zap.Int64("job_id", job.Id))
+		}
+	}
+	// 返回false时停止入队
+	proceed := func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		status, err := serverCtx.Dao.QueryMetadataRefreshJobStatus(ctx, job.Id)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on query metadata refresh job status", zap.Error(err), zap.Int64("job_id", job.Id))
+			return true
+		}
+		return status == dao.MetadataRefreshQueuing
+	}
+	// entered为累加到任务total的数量，指定token时total在创建任务时已确定
+	queueBatch := func(batch []string, entered, cursor int64) {
+		total += int64(len(batch))
+		queued, err := mq.AddItemsToRefreshMetadataQueue(serverCtx.KvStore, serverCtx.C.ProjectCfg.Name, chain,
+			int64(job.ChainId), job.CollectionAddress, batch, job.Id)
+		var failed int64
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on add items to refresh queue", zap.Error(err),
+				zap.Int64("job_id", job.Id), zap.String("collection_address", job.CollectionAddress))
+			failed = int64(len(batch))
+			addMetadataRefreshFailures(updateCtx, serverCtx, job.Id, batch, err)
+		}
+		skipped := int64(len(batch)) - int64(len(queued)) - failed
+		if err := serverCtx.Dao.IncrMetadataRefreshJobQueued(updateCtx, job.Id, int64(len(queued)), skipped, failed, entered, cursor); err != nil {
+			xzap.WithContext(ctx).Error("failed on update metadata refresh job", zap.Error(err), zap.Int64("job_id", job.Id))
+		}
+	}
+
+	if len(tokenIds) > 0 {
+		//1、指定token时从入队位置开始按批次加入队列
+		for start := int(job.QueueCursor); start < len(tokenIds); start += batchSize {
+			if !proceed() {
+				return
+			}
+			end := start + batchSize
+			if end > len(tokenIds) {
+				end = len(tokenIds)
+			}
+			queueBatch(tokenIds[start:end], 0, int64(end))
+		}
+	} else {
+		//2、未指定时从入队位置开始按id顺序遍历集合中的全部token
+		lastId := job.QueueCursor
+		for {
+			if !proceed() {
+				return
+			}
+			items, err := serverCtx.Dao.QueryCollectionTokenIds(ctx, chain, job.CollectionAddress, lastId, batchSize)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				xzap.WithContext(ctx).Error("failed on query collection token ids", zap.Error(err), zap.Int64("job_id", job.Id))
+				fail(errors.Wrap(err, "failed on query collection token ids"))
+				return
+			}
+			if len(items) == 0 {
+				break
+			}
+			batch := make([]string, 0, len(items))
+			for _, item := range items {
+				batch = append(batch, item.TokenId)
+			}
+			lastId = items[len(items)-1].Id
+			queueBatch(batch, int64(len(batch)), lastId)
+			if len(items) < batchSize {
+				break
+			}
+		}
+	}
+
+	//3、更新任务总数和状态
+	if err := serverCtx.Dao.FinishMetadataRefreshJobQueuing(updateCtx, job.Id, total); err != nil {
+		xzap.WithContext(ctx).Error("failed on finish metadata refresh job queuing", zap.Error(err), zap.Int64("job_id", job.Id))
+	}
+}
+
+func truncateReason(reason string, maxLength int) string {
+	if len(reason) > maxLength {
+		return reason[:maxLength]
+	}
+	return reason
+}
+
+// 记录刷新失败的token
+func addMetadataRefreshFailures(ctx context.Context, serverCtx *svc.ServerCtx, jobId int64, tokenIds []string, cause error) {
+	reason := truncateReason(cause.Error(), metadataMaxReasonLength)
+	now := time.Now().Unix()
+	failures := make([]dao.MetadataRefreshFailure, 0, len(tokenIds))
+	for _, tokenId := range tokenIds {
+		failures = append(failures, dao.MetadataRefreshFailure{
+			JobId:      jobId,
+			TokenId:    tokenId,
+			Reason:     reason,
+			CreateTime: now,
+		})
+	}
+	if err := serverCtx.Dao.AddMetadataRefreshFailures(ctx, failures); err != nil {
+		xzap.WithContext(ctx).Error("failed on add metadata refresh failures", zap.Error(err), zap.Int64("job_id", jobId))
+	}
+}
+
+// CancelMetadataRefreshJob 取消用户未完成的元数据刷新任务
+// 正在入队的任务在下一批入队前停止，已加入队列的token仍会刷新
+func CancelMetadataRefreshJob(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, id int64) error {
+	job, err := serverCtx.Dao.QueryUserMetadataRefreshJob(ctx, lowerAddresses(userAddrs), id)
+	if err != nil {
+		return errors.Wrap(err, "failed on query metadata refresh job")
+	}
+	if job == nil {
+		return errors.New("job not exist")
+	}
+	ok, err := serverCtx.Dao.CancelMetadataRefreshJob(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed on cancel metadata refresh job")
+	}
+	if !ok {
+		return errors.New("job already finished")
+	}
+	return nil
+}
+
+// GetMetadataRefreshJob 查询用户的元数据刷新任务进度和最近的失败记录
+func GetMetadataRefreshJob(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, id int64) (*entity.MetadataRefreshJobInfo, error) {
+	job, err := serverCtx.Dao.QueryUserMetadataRefreshJob(ctx, lowerAddresses(userAddrs), id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query metadata refresh job")
+	}
+	if job == nil {
+		return nil, errors.New("job not exist")
+	}
+	failures, err := serverCtx.Dao.QueryMetadataRefreshFailures(ctx, id, metadataJobFailuresLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query metadata refresh failures")
+	}
+	info := toMetadataRefreshJobInfo(job, failures)
+	return &info, nil
+}
+
+func toMetadataRefreshJobInfo(job *dao.MetadataRefreshJob, failures []dao.MetadataRefreshFailure) entity.MetadataRefreshJobInfo {
+	info := entity.MetadataRefreshJobInfo{
+		Id:                job.Id,
+		ChainID:           job.ChainId,
+		CollectionAddress: job.CollectionAddress,
+		Status:            job.Status,
+		Total:             job.Total,
+		Queued:            job.Queued,
+		Skipped:           job.Skipped,
+		Processed:         job.Processed,
+		Failed:            job.Failed,
+		LastError:         job.LastError,
+		Failures:          make([]entity.MetadataRefreshFailure, 0, len(failures)),
+		CreateTime:        job.CreateTime,
+		UpdateTime:        job.UpdateTime,
+	}
+	if job.Status == dao.MetadataRefreshCompleted {
+		info.Progress = 1
+	} else if job.Total > 0 && job.Status != dao.MetadataRefreshQueuing {
+		info.Progress = float64(job.Skipped+job.Processed+job.Failed) / float64(job.Total)
+	}
+	for _, failure := range failures {
+		info.Failures = append(info.Failures, entity.MetadataRefreshFailure{
+			TokenId:    failure.TokenId,
+			Reason:     failure.Reason,
+			CreateTime: failure.CreateTime,
+		})
+	}
+	return info
+}
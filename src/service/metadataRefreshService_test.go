@@ -0,0 +1,86 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/service/mq"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadataRefreshJobProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		job  dao.MetadataRefreshJob
+		want float64
+	}{
+		{name: "queuing has no progress", job: dao.MetadataRefreshJob{Status: dao.MetadataRefreshQueuing, Total: 10, Processed: 5}},
+		{name: "queued counts skipped processed and failed", job: dao.MetadataRefreshJob{Status: dao.MetadataRefreshQueued, Total: 10, Skipped: 1, Processed: 2, Failed: 1}, want: 0.4},
+		{name: "completed", job: dao.MetadataRefreshJob{Status: dao.MetadataRefreshCompleted}, want: 1},
+		{name: "failed keeps partial progress", job: dao.MetadataRefreshJob{Status: dao.MetadataRefreshFailed, Total: 4, Processed: 1, LastError: "scan error"}, want: 0.25},
+	}
+	for _, tt := range tests {
+		info := toMetadataRefreshJobInfo(&tt.job, nil)
+		if info.Progress != tt.want {
+			t.Errorf("%s: progress = %v, want %v", tt.name, info.Progress, tt.want)
+		}
+		if info.LastError != tt.job.LastError {
+			t.Errorf("%s: last error = %q, want %q", tt.name, info.LastError, tt.job.LastError)
+		}
+	}
+}
+
+func TestTruncateReason(t *testing.T) {
+	if got := truncateReason("abcdef", 3); got != "abc" {
+		t.Errorf("truncateReason = %q, want abc", got)
+	}
+	if got := truncateReason("ab", 3); got != "ab" {
+		t.Errorf("truncateReason = %q, want ab", got)
+	}
+}
+
+func TestMetadataJobRunnerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &metadataJobRunner{ctx: context.Background()}
+	runner.setContext(ctx)
+	stopped := make(chan struct{})
+	runner.run(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("job should stop when runner context is cancelled")
+	}
+	runner.wg.Wait()
+}
+
+func TestMetadataJobTokenIds(t *testing.T) {
+	if got := metadataJobTokenIds(&dao.MetadataRefreshJob{}); got != nil {
+		t.Errorf("whole collection job token ids = %v, want nil", got)
+	}
+	if got, want := metadataJobTokenIds(&dao.MetadataRefreshJob{TokenIds: "1,2,3"}), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("token ids = %v, want %v", got, want)
+	}
+}
+
+func TestRefreshItemMember(t *testing.T) {
+	// 同一token不同任务、不同大小写的集合地址在队列中是同一个成员
+	a, err := mq.RefreshItemMember(1, "0xAbC", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mq.RefreshItemMember(1, "0xabc", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("member differs by address case: %s != %s", a, b)
+	}
+	if want := `{"chain_id":1,"collection_address":"0xabc","token_id":"7"}`; a != want {
+		t.Errorf("member = %s, want %s", a, want)
+	}
+}
@@ -0,0 +1,500 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/chain"
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/service/mq"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMetadataWorkers     = 8
+	defaultMetadataInterval    = 2
+	defaultMetadataTimeout     = 15
+	defaultMetadataMaxAttempts = 3
+	metadataRetryBaseBackoff   = 1
+	metadataRetryMaxBackoff    = 30
+	metadataMaxBodySize        = 5 << 20
+	arweaveGateway             = "https://arweave.net/"
+)
+
+var defaultIpfsGateways = []string{"https://ipfs.io/ipfs/"}
+
+// 元数据内容无效或地址不支持，重试也不会成功
+var errInvalidMetadata = errors.New("invalid metadata")
+
+// 元数据刷新worker
+type metadataWorker struct {
+	serverCtx   *svc.ServerCtx
+	client      *http.Client
+	parse       config.MetadataParse
+	gateways    []string
+	workers     int
+	interval    int
+	maxAttempts int
+	lease       int64
+}
+
+// 认领一个item后的最长处理时间，按每次尝试请求所有网关的超时加上最大退避计算，到期未确认时放回队列
+func metadataClaimLease(maxAttempts, timeout, gateways int) int64 {
+	return int64(maxAttempts * (timeout*(gateways+1) + metadataRetryMaxBackoff))
+}
+
+// 解析后的元数据
+type parsedMetadata struct {
+	name   string
+	image  string
+	traits []multi.ItemTrait
+}
+
+// StartMetadataWorker 启动内置的元数据刷新worker
+// 1. 每条链从刷新队列中取出item，按配置的并发数刷新
+// 2. 通过合约tokenURI获取元数据地址，支持http、ipfs、arweave和data URI
+// 3. 按配置的tag解析名称、图片和属性，写入item、item_external和item_trait表
+// 4. 失败时按指数退避重试，超过最大次数后记录到所属任务的失败记录中
+// 元数据地址只允许解析到公网地址，防止通过tokenURI访问内网。
+// 所有者通过nftchainservice查询；nftchainservice目前没有tokenURI和元数据接口，tokenURI仍通过节点eth_call查询
+func StartMetadataWorker(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.Metadata
+	if cfg == nil || !cfg.WorkerEnable {
+		return
+	}
+	worker := &metadataWorker{
+		serverCtx:   serverCtx,
+		gateways:    cfg.IpfsGateways,
+		workers:     cfg.Workers,
+		interval:    cfg.Interval,
+		maxAttempts: cfg.MaxAttempts,
+	}
+	if serverCtx.C.MetadataParse != nil {
+		worker.parse = *serverCtx.C.MetadataParse
+	}
+	if len(worker.gateways) == 0 {
+		worker.gateways = defaultIpfsGateways
+	}
+	if worker.workers <= 0 {
+		worker.workers = defaultMetadataWorkers
+	}
+	if worker.interval <= 0 {
+		worker.interval = defaultMetadataInterval
+	}
+	if worker.maxAttempts <= 0 {
+		worker.maxAttempts = defaultMetadataMaxAttempts
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultMetadataTimeout
+	}
+	worker.client = utils.NewPublicHttpClient(time.Duration(timeout) * time.Second)
+	worker.lease = metadataClaimLease(worker.maxAttempts, timeout, len(worker.gateways))
+
+	var wg sync.WaitGroup
+	for _, supported := range serverCtx.C.ChainSupported {
+		client, ok := serverCtx.Chains[int64(supported.ChainId)]
+		if !ok {
+			xzap.WithContext(ctx).Error("chain client not found", zap.String("chain", supported.Name))
+			continue
+		}
+		wg.Add(1)
+		go func(chainName string, client chain.NftClient) {
+			defer wg.Done()
+			worker.run(ctx, chainName, client)
+		}(supported.Name, client)
+	}
+	wg.Wait()
+}
+
+// 持续消费指定链的刷新队列
+// item取出时移入处理中集合，刷新结束后确认移除，worker中途退出时认领到期后重新入队
+func (w *metadataWorker) run(ctx context.Context, chainName string, client chain.NftClient) {
+	project := w.serverCtx.C.ProjectCfg.Name
+	sem := make(chan struct{}, w.workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var nextRequeue time.Time
+	for {
+		//1、等待空闲的并发数
+		select {
+		case <-ctx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		//2、将认领到期的item放回队列
+		if now := time.Now(); now.After(nextRequeue) {
+			nextRequeue = now.Add(time.Duration(w.interval) * time.Second)
+			if count, err := mq.RequeueExpiredRefreshItems(w.serverCtx.KvStore, project, chainName); err != nil {
+				xzap.WithContext(ctx).Error("failed on requeue refresh items", zap.Error(err), zap.String("chain", chainName))
+			} else if count > 0 {
+				xzap.WithContext(ctx).Info("requeue expired refresh items", zap.Int64("count", count), zap.String("chain", chainName))
+			}
+		}
+		//3、从队列中认领一个item，队列为空时等待
+		raw, err := mq.ClaimRefreshItem(w.serverCtx.KvStore, project, chainName, w.lease)
+		if err != nil || raw == "" {
+			<-sem
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on claim refresh item", zap.Error(err), zap.String("chain", chainName))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(w.interval) * time.Second):
+			}
+			continue
+		}
+		var item entity.RefreshItem
+		if err := json.Unmarshal([]byte(raw), &item); err != nil {
+			<-sem
+			xzap.WithContext(ctx).Error("failed on unmarshal refresh item", zap.Error(err), zap.String("item", raw))
+			w.ack(ctx, chainName, raw)
+			continue
+		}
+		//4、查询item所属的任务，查询失败时等待认领到期后重新处理
+		if item.JobId == 0 {
+			if item.JobId, err = mq.QueryRefreshItemJob(w.serverCtx.KvStore, project, chainName, raw); err != nil {
+				<-sem
+				xzap.WithContext(ctx).Error("failed on query refresh item job", zap.Error(err), zap.String("chain", chainName))
+				continue
+			}
+		}
+		//5、异步刷新，刷新结束后确认，ctx结束导致中断时不确认，等待重新入队
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if w.refreshWithRetry(ctx, chainName, client, item) {
+				w.ack(ctx, chainName, raw)
+			}
+		}()
+	}
+}
+
+func (w *metadataWorker) ack(ctx context.Context, chainName, raw string) {
+	if err := mq.AckRefreshItem(w.serverCtx.KvStore, w.serverCtx.C.ProjectCfg.Name, chainName, raw); err != nil {
+		xzap.WithContext(ctx).Error("failed on ack refresh item", zap.Error(err), zap.String("chain", chainName))
+	}
+}
+
+// 刷新单个item，失败时重试并记录任务进度，ctx结束导致中断时返回false
+func (w *metadataWorker) refreshWithRetry(ctx context.Context, chainName string, client chain.NftClient, item entity.RefreshItem) bool {
+	var err error
+	for attempt := 1; attempt <= w.maxAttempts; attempt++ {
+		err = w.refreshItem(ctx, chainName, client, item)
+		if err == nil || errors.Is(err, errInvalidMetadata) || attempt == w.maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Duration(retryBackoff(attempt, metadataRetryBaseBackoff, metadataRetryMaxBackoff)) * time.Second):
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on refresh item metadata", zap.Error(err), zap.String("chain", chainName),
+			zap.String("collection_address", item.CollectionAddress), zap.String("token_id", item.TokenId))
+	}
+	if item.JobId == 0 {
+		return true
+	}
+
+	var processed, failed int64 = 1, 0
+	if err != nil {
+		processed, failed = 0, 1
+		addMetadataRefreshFailures(ctx, w.serverCtx, item.JobId, []string{item.TokenId}, err)
+	}
+	if err := w.serverCtx.Dao.IncrMetadataRefreshJobProgress(ctx, item.JobId, processed, failed); err != nil {
+		xzap.WithContext(ctx).Error("failed on update metadata refresh job progress", zap.Error(err), zap.Int64("job_id", item.JobId))
+	}
+	return true
+}
+
+// 刷新单个item的元数据
+func (w *metadataWorker) refreshItem(ctx context.Context, chainName string, client chain.NftClient, item entity.RefreshItem) error {
+	collectionAddr := strings.ToLower(item.CollectionAddress)
+	//1、查询元数据地址并获取内容
+	uri, err := client.TokenURI(ctx, collectionAddr, item.TokenId)
+	if err != nil {
+		if errors.Is(err, chain.ErrExecutionReverted) {
+			return errors.Wrap(errInvalidMetadata, err.Error())
+		}
+		return errors.Wrap(err, "failed on query token uri")
+	}
+	raw, err := w.fetchMetadata(ctx, uri)
+	if err != nil {
+		return errors.Wrap(err, "failed on fetch metadata")
+	}
+
+	//2、解析名称、图片和属性
+	metadata, err := w.parseMetadata(raw)
+	if err != nil {
+		return err
+	}
+	for i := range metadata.traits {
+		metadata.traits[i].CollectionAddress = collectionAddr
+		metadata.traits[i].TokenId = item.TokenId
+	}
+
+	//3、元数据没有名称时保留原名称，item不存在时查询链上所有者一并写入，所有者与indexer一致使用checksum格式
+	exist, err := w.serverCtx.Dao.QueryItemInfo(ctx, chainName, collectionAddr, item.TokenId)
+	if err != nil {
+		return errors.Wrap(err, "failed on query item info")
+	}
+	now := time.Now().Unix()
+	newItem := &multi.Item{
+		ChainId:           int(item.ChainId),
+		CollectionAddress: collectionAddr,
+		TokenId:           item.TokenId,
+		Name:              metadata.name,
+		Supply:            1,
+		CreateTime:        now,
+		UpdateTime:        now,
+	}
+	if newItem.Name == "" {
+		newItem.Name = exist.Name
+	}
+	if newItem.Name == "" {
+		newItem.Name = "#" + item.TokenId
+	}
+	if exist.TokenId == "" {
+		owner, err := client.OwnerOf(ctx, collectionAddr, item.TokenId)
+		if err != nil {
+			return errors.Wrap(err, "failed on query item owner")
+		}
+		newItem.Owner = owner
+	}
+
+	//4、在同一事务中写入item、item_external和item_trait
+	err = w.serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		d := w.serverCtx.Dao.WithTx(tx)
+		if err := d.UpsertItemName(ctx, chainName, newItem); err != nil {
+			return err
+		}
+		err := d.UpsertItemExternal(ctx, chainName, &multi.ItemExternal{
+			CollectionAddress: collectionAddr,
+			TokenId:           item.TokenId,
+			MetaDataUri:       uri,
+			ImageUri:          metadata.image,
+		})
+		if err != nil {
+			return err
+		}
+		return d.ReplaceItemTraits(ctx, chainName, collectionAddr, item.TokenId, metadata.traits)
+	})
+	if err != nil {
+		return err
+	}
+
+	//5、清除item相关的接口缓存
+	if err := w.serverCtx.Cached.PurgeApiCache(cached.ApiCacheTokenTag(collectionAddr, item.TokenId)); err != nil {
+		xzap.WithContext(ctx).Error("failed on purge api cache", zap.Error(err))
+	}
+	return nil
+}
+
+// 获取元数据内容
+// 1. data URI直接解码，部分合约直接返回json内容
+// 2. ipfs地址依次尝试配置的网关，arweave地址使用arweave网关
+func (w *metadataWorker) fetchMetadata(ctx context.Context, uri string) ([]byte, error) {
+	uri = strings.TrimSpace(uri)
+	if strings.HasPrefix(uri, "data:") {
+		return decodeDataUri(uri)
+	}
+	if strings.HasPrefix(uri, "{") {
+		return []byte(uri), nil
+	}
+	urls := w.resolveUri(uri)
+	if len(urls) == 0 {
+		return nil, errors.Wrapf(errInvalidMetadata, "unsupported uri: %s", uri)
+	}
+	var lastErr error
+	for _, u := range urls {
+		body, err := w.httpGet(ctx, u)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// 将ipfs、arweave地址转换为http地址，ipfs地址按网关顺序返回多个
+func (w *metadataWorker) resolveUri(uri string) []string {
+	lower := strings.ToLower(uri)
+	switch {
+	case strings.HasPrefix(lower, "ipfs://"):
+		path := strings.TrimPrefix(uri[len("ipfs://"):], "ipfs/")
+		urls := make([]string, 0, len(w.gateways))
+		for _, gateway := range w.gateways {
+			urls = append(urls, strings.TrimSuffix(gateway, "/")+"/"+path)
+		}
+		return urls
+	case strings.HasPrefix(lower, "ar://"):
+		return []string{arweaveGateway + uri[len("ar://"):]}
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"):
+		return []string{uri}
+	}
+	return nil
+}
+
+func (w *metadataWorker) httpGet(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidMetadata, err.Error())
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if errors.Is(err, utils.ErrNonPublicAddress) {
+			return nil, errors.Wrap(errInvalidMetadata, err.Error())
+		}
+		return nil, errors.Wrap(err, "failed on request metadata")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status code %d from %s", resp.StatusCode, u)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, metadataMaxBodySize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on read metadata")
+	}
+	if len(body) > metadataMaxBodySize {
+		return nil, errors.Wrap(errInvalidMetadata, "metadata too large")
+	}
+	return body, nil
+}
+
+// 解码 data:[<mediatype>][;base64],<data> 格式的地址
+func decodeDataUri(uri string) ([]byte, error) {
+	idx := strings.Index(uri, ",")
+	if idx < 0 {
+		return nil, errors.Wrap(errInvalidMetadata, "invalid data uri")
+	}
+	header, data := uri[len("data:"):idx], uri[idx+1:]
+	if strings.HasSuffix(header, ";base64") {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+		}
+		if err != nil {
+			return nil, errors.Wrap(errInvalidMetadata, "invalid base64 data uri")
+		}
+		return decoded, nil
+	}
+	if decoded, err := url.PathUnescape(data); err == nil {
+		return []byte(decoded), nil
+	}
+	return []byte(data), nil
+}
+
+// 按配置的tag解析元数据
+func (w *metadataWorker) parseMetadata(raw []byte) (*parsedMetadata, error) {
+	var meta map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&meta); err != nil {
+		return nil, errors.Wrap(errInvalidMetadata, err.Error())
+	}
+	metadata := &parsedMetadata{
+		name:  firstMetadataString(meta, w.parse.NameTags),
+		image: w.normalizeImage(firstMetadataString(meta, w.parse.ImageTags)),
+	}
+	for _, tag := range w.parse.AttributesTags {
+		if value, ok := meta[tag]; ok && value != nil {
+			metadata.traits = w.parseTraits(value)
+			break
+		}
+	}
+	return metadata, nil
+}
+
+// 解析属性，支持 [{"trait_type": "x", "value": "y"}] 和 {"x": "y"} 两种格式
+func (w *metadataWorker) parseTraits(value interface{}) []multi.ItemTrait {
+	var traits []multi.ItemTrait
+	switch attrs := value.(type) {
+	case []interface{}:
+		for _, attr := range attrs {
+			attrMap, ok := attr.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			trait := firstMetadataString(attrMap, w.parse.TraitNameTags)
+			var traitValue string
+			for _, tag := range w.parse.TraitValueTags {
+				if traitValue = formatTraitValue(attrMap[tag]); traitValue != "" {
+					break
+				}
+			}
+			if trait != "" && traitValue != "" {
+				traits = append(traits, multi.ItemTrait{Trait: trait, TraitValue: traitValue})
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(attrs))
+		for key := range attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if traitValue := formatTraitValue(attrs[key]); traitValue != "" {
+				traits = append(traits, multi.ItemTrait{Trait: key, TraitValue: traitValue})
+			}
+		}
+	}
+	return traits
+}
+
+// 图片地址转换为可直接访问的地址，svg内容转换为data URI
+func (w *metadataWorker) normalizeImage(image string) string {
+	if strings.HasPrefix(image, "<svg") {
+		return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(image))
+	}
+	if urls := w.resolveUri(image); len(urls) > 0 {
+		return urls[0]
+	}
+	return image
+}
+
+func firstMetadataString(meta map[string]interface{}, tags []string) string {
+	for _, tag := range tags {
+		if value, ok := meta[tag].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func formatTraitValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
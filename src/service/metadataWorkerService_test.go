@@ -0,0 +1,139 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/utils"
+	"context"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestMetadataWorker() *metadataWorker {
+	return &metadataWorker{
+		client:   utils.NewPublicHttpClient(time.Second),
+		gateways: []string{"https://ipfs.io/ipfs/", "https://gw.example/ipfs"},
+		parse: config.MetadataParse{
+			NameTags:       []string{"name"},
+			ImageTags:      []string{"image", "image_url"},
+			AttributesTags: []string{"attributes", "traits"},
+			TraitNameTags:  []string{"trait_type"},
+			TraitValueTags: []string{"value"},
+		},
+	}
+}
+
+func TestResolveUri(t *testing.T) {
+	w := newTestMetadataWorker()
+	tests := []struct {
+		uri  string
+		want []string
+	}{
+		{uri: "ipfs://Qm/1.json", want: []string{"https://ipfs.io/ipfs/Qm/1.json", "https://gw.example/ipfs/Qm/1.json"}},
+		{uri: "ipfs://ipfs/Qm/1.json", want: []string{"https://ipfs.io/ipfs/Qm/1.json", "https://gw.example/ipfs/Qm/1.json"}},
+		{uri: "ar://tx", want: []string{"https://arweave.net/tx"}},
+		{uri: "https://example.com/1", want: []string{"https://example.com/1"}},
+		{uri: "file:///etc/passwd"},
+		{uri: "gopher://example.com"},
+	}
+	for _, tt := range tests {
+		if got := w.resolveUri(tt.uri); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolveUri(%s) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeDataUri(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{uri: "data:application/json;base64,eyJuYW1lIjoiYSJ9", want: `{"name":"a"}`},
+		{uri: "data:application/json;base64,eyJuYW1lIjoiYSJ9==", want: `{"name":"a"}`},
+		{uri: "data:application/json,%7B%22name%22%3A%22a%22%7D", want: `{"name":"a"}`},
+		{uri: "data:application/json;base64", wantErr: true},
+		{uri: "data:application/json;base64,!!!", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := decodeDataUri(tt.uri)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("decodeDataUri(%s) err = %v, wantErr %v", tt.uri, err, tt.wantErr)
+		}
+		if err == nil && string(got) != tt.want {
+			t.Errorf("decodeDataUri(%s) = %s, want %s", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	w := newTestMetadataWorker()
+	tests := []struct {
+		name       string
+		raw        string
+		wantName   string
+		wantImage  string
+		wantTraits map[string]string
+		wantErr    bool
+	}{
+		{
+			name:       "opensea attributes",
+			raw:        `{"name":" Ape #1 ","image":"ipfs://Qm/1.png","attributes":[{"trait_type":"Fur","value":"Gold"},{"trait_type":"Level","value":3},{"value":"no type"}]}`,
+			wantName:   "Ape #1",
+			wantImage:  "https://ipfs.io/ipfs/Qm/1.png",
+			wantTraits: map[string]string{"Fur": "Gold", "Level": "3"},
+		},
+		{
+			name:       "map traits and fallback image tag",
+			raw:        `{"image_url":"https://example.com/1.png","traits":{"Eyes":"Blue","Rare":true}}`,
+			wantImage:  "https://example.com/1.png",
+			wantTraits: map[string]string{"Eyes": "Blue", "Rare": "true"},
+		},
+		{name: "invalid json", raw: `{"name":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := w.parseMetadata([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, errInvalidMetadata) {
+					t.Errorf("err = %v, want %v", err, errInvalidMetadata)
+				}
+				return
+			}
+			if got.name != tt.wantName || got.image != tt.wantImage {
+				t.Errorf("name = %q image = %q, want %q %q", got.name, got.image, tt.wantName, tt.wantImage)
+			}
+			traits := make(map[string]string)
+			for _, trait := range got.traits {
+				traits[trait.Trait] = trait.TraitValue
+			}
+			if !reflect.DeepEqual(traits, tt.wantTraits) {
+				t.Errorf("traits = %v, want %v", traits, tt.wantTraits)
+			}
+		})
+	}
+}
+
+// 元数据地址指向内网时不请求，且视为无效元数据不再重试
+func TestFetchMetadataRejectsPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"internal"}`))
+	}))
+	defer server.Close()
+	_, err := newTestMetadataWorker().fetchMetadata(context.Background(), server.URL)
+	if !errors.Is(err, errInvalidMetadata) {
+		t.Fatalf("err = %v, want %v", err, errInvalidMetadata)
+	}
+}
+
+func TestMetadataClaimLease(t *testing.T) {
+	if got := metadataClaimLease(3, 15, 1); got != 3*(15*2+metadataRetryMaxBackoff) {
+		t.Errorf("metadataClaimLease = %d", got)
+	}
+}
@@ -9,41 +9,109 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"strconv"
+	"strings"
 )
 
-const CacheRefreshPreventReentranceKeyPrefix = "cache:es:item:refresh:prevent:reentrancy:%d:%s:%s"
+const CacheRefreshPreventReentranceKeyPrefix = "cache:es:item:refresh:prevent:reentrancy:%d:%s:%s:%s"
 const CacheRefreshSingleItemMetadataKey = "cache:%s:%s:item:refresh:metadata"
 const PreventReentrancyPeriod = 10 //second
 
 func AddSingleItemToRefreshMetadataQueue(kvStore *xkv.Store, project, chain string, chainId int64,
 	collectionAddr, tokenId string) error {
-	//1、从redis中获取
-	reentKey := fmt.Sprintf(CacheRefreshPreventReentranceKeyPrefix, chainId, collectionAddr, chain)
-	isRefreshed, err := kvStore.Get(reentKey)
+	queued, err := AddItemsToRefreshMetadataQueue(kvStore, project, chain, chainId, collectionAddr, []string{tokenId}, 0)
 	if err != nil {
-		return errors.Wrap(err, "failed on check reentrancy status")
+		return err
 	}
-	if isRefreshed != "" {
+	if len(queued) == 0 {
 		xzap.WithContext(context.Background()).Info("refresh within 10s",
 			zap.String("collectionAddr", collectionAddr), zap.String("tokenId", tokenId))
-		return nil
 	}
-	//构建参数
-	item := entity.RefreshItem{
+	return nil
+}
+
+// 将token加入刷新队列，队列中已有或正在刷新时跳过
+// KEYS[1] 刷新队列 ARGV[1] 处理中集合 ARGV[2] 所属任务 ARGV[3] 任务id ARGV[4...] item
+// 返回每个item是否加入队列，1为加入
+const addRefreshItemsScript = `local added = {}
+for i = 4, #ARGV do
+	local item = ARGV[i]
+	added[i - 3] = 0
+	if not redis.call("ZSCORE", ARGV[1], item) and redis.call("SADD", KEYS[1], item) == 1 then
+		added[i - 3] = 1
+		if ARGV[3] ~= "0" then
+			redis.call("HSET", ARGV[2], item, ARGV[3])
+		end
+	end
+end
+return added`
+
+// 刷新队列中的item，只包含链、集合和token，同一token在队列中只有一个成员
+// 所属任务记录在genRefreshJobKey中，多个任务刷新同一token时只计入最先加入队列的任务
+func RefreshItemMember(chainId int64, collectionAddr, tokenId string) (string, error) {
+	rawInfo, err := json.Marshal(&entity.RefreshItem{
 		ChainId:           chainId,
-		CollectionAddress: collectionAddr,
+		CollectionAddress: strings.ToLower(collectionAddr),
 		TokenId:           tokenId,
-	}
-	rawInfo, err := json.Marshal(&item)
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed on marshal item info")
+		return "", errors.Wrap(err, "failed on marshal item info")
 	}
-	//向reids中写入数据
+	return string(rawInfo), nil
+}
+
+// 批量将集合中的item加入元数据刷新队列，返回实际加入队列的tokenId
+// 每个token单独防重入，PreventReentrancyPeriod内已加入过队列的token跳过，已在队列中或正在刷新的token也跳过
+func AddItemsToRefreshMetadataQueue(kvStore *xkv.Store, project, chain string, chainId int64,
+	collectionAddr string, tokenIds []string, jobId int64) ([]string, error) {
+	var candidates, reentKeys []string
+	var members []interface{}
+	// 出错时释放本批已占用的防重入key，否则这些token在周期内无法重新入队
+	release := func() {
+		if len(reentKeys) > 0 {
+			_, _ = kvStore.Del(reentKeys...)
+		}
+	}
+	for _, tokenId := range tokenIds {
+		//1、防重入，SetnxEx保证同一token在周期内只入队一次
+		reentKey := fmt.Sprintf(CacheRefreshPreventReentranceKeyPrefix, chainId, strings.ToLower(collectionAddr), chain, tokenId)
+		ok, err := kvStore.SetnxEx(reentKey, "true", PreventReentrancyPeriod)
+		if err != nil {
+			release()
+			return nil, errors.Wrap(err, "failed on check reentrancy status")
+		}
+		if !ok {
+			continue
+		}
+		reentKeys = append(reentKeys, reentKey)
+		//2、构建参数
+		member, err := RefreshItemMember(chainId, collectionAddr, tokenId)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		members = append(members, member)
+		candidates = append(candidates, tokenId)
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	//3、向redis中写入数据并记录所属任务，失败时释放防重入key以便重试
 	metadataKey := fmt.Sprintf(CacheRefreshSingleItemMetadataKey, project, chain)
-	_, err = kvStore.Sadd(metadataKey, string(rawInfo))
+	args := append([]interface{}{genRefreshProcessingKey(project, chain), genRefreshJobKey(project, chain),
+		strconv.FormatInt(jobId, 10)}, members...)
+	result, err := kvStore.Eval(addRefreshItemsScript, metadataKey, args...)
 	if err != nil {
-		return errors.Wrap(err, "failed on push item to refresh metadata queue")
+		release()
+		return nil, errors.Wrap(err, "failed on push item to refresh metadata queue")
 	}
-	_ = kvStore.Setex(reentKey, "true", PreventReentrancyPeriod)
-	return nil
+	added, _ := result.([]interface{})
+	var queued []string
+	for i, flag := range added {
+		if v, _ := flag.(int64); v == 1 && i < len(candidates) {
+			queued = append(queued, candidates[i])
+		}
+	}
+	return queued, nil
 }
@@ -0,0 +1,99 @@
+package mq
+
+import (
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"strconv"
+	"time"
+)
+
+// 每次重新入队的最大数量
+const requeueRefreshItemsLimit = 100
+
+// 从刷新队列取出一个item，同时以到期时间为score加入处理中集合
+// KEYS[1] 刷新队列 ARGV[1] 处理中集合 ARGV[2] 到期时间
+const claimRefreshItemScript = `local item = redis.call("SPOP", KEYS[1])
+if item then
+	redis.call("ZADD", ARGV[1], ARGV[2], item)
+end
+return item`
+
+// 将处理中集合里已到期的item放回刷新队列
+// KEYS[1] 处理中集合 ARGV[1] 刷新队列 ARGV[2] 当前时间 ARGV[3] 最大数量
+const requeueRefreshItemsScript = `local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[2], "LIMIT", 0, ARGV[3])
+for _, item in ipairs(items) do
+	redis.call("ZREM", KEYS[1], item)
+	redis.call("SADD", ARGV[1], item)
+end
+return #items`
+
+// 从处理中集合移除item并清除所属任务
+// KEYS[1] 处理中集合 ARGV[1] 所属任务 ARGV[2] item
+const ackRefreshItemScript = `redis.call("ZREM", KEYS[1], ARGV[2])
+redis.call("HDEL", ARGV[1], ARGV[2])
+return 1`
+
+// 处理中的刷新item cache:<项目名>:<链名>:item:refresh:metadata:processing
+func genRefreshProcessingKey(project, chain string) string {
+	return fmt.Sprintf(CacheRefreshSingleItemMetadataKey, project, chain) + ":processing"
+}
+
+// 刷新item所属的任务 cache:<项目名>:<链名>:item:refresh:metadata:job
+func genRefreshJobKey(project, chain string) string {
+	return fmt.Sprintf(CacheRefreshSingleItemMetadataKey, project, chain) + ":job"
+}
+
+// QueryRefreshItemJob 查询item所属的任务id，不属于任何任务时返回0
+func QueryRefreshItemJob(kvStore *xkv.Store, project, chain, item string) (int64, error) {
+	value, err := kvStore.Hget(genRefreshJobKey(project, chain), item)
+	if err == redis.Nil || value == "" {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on query refresh item job")
+	}
+	jobId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid refresh item job")
+	}
+	return jobId, nil
+}
+
+// ClaimRefreshItem 认领一个待刷新的item，队列为空时返回空字符串
+// 认领的item在lease秒内未确认时由RequeueExpiredRefreshItems放回队列，worker中途退出时item不会丢失
+func ClaimRefreshItem(kvStore *xkv.Store, project, chain string, lease int64) (string, error) {
+	deadline := time.Now().Unix() + lease
+	result, err := kvStore.Eval(claimRefreshItemScript, fmt.Sprintf(CacheRefreshSingleItemMetadataKey, project, chain),
+		genRefreshProcessingKey(project, chain), strconv.FormatInt(deadline, 10))
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed on claim refresh item")
+	}
+	item, _ := result.(string)
+	return item, nil
+}
+
+// AckRefreshItem 刷新完成(成功或最终失败)后从处理中集合移除，并清除所属任务
+func AckRefreshItem(kvStore *xkv.Store, project, chain, item string) error {
+	_, err := kvStore.Eval(ackRefreshItemScript, genRefreshProcessingKey(project, chain), genRefreshJobKey(project, chain), item)
+	if err != nil && err != redis.Nil {
+		return errors.Wrap(err, "failed on ack refresh item")
+	}
+	return nil
+}
+
+// RequeueExpiredRefreshItems 将认领已到期仍未确认的item放回刷新队列，返回放回的数量
+func RequeueExpiredRefreshItems(kvStore *xkv.Store, project, chain string) (int64, error) {
+	result, err := kvStore.Eval(requeueRefreshItemsScript, genRefreshProcessingKey(project, chain),
+		fmt.Sprintf(CacheRefreshSingleItemMetadataKey, project, chain),
+		strconv.FormatInt(time.Now().Unix(), 10), strconv.Itoa(requeueRefreshItemsLimit))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on requeue refresh items")
+	}
+	count, _ := result.(int64)
+	return count, nil
+}
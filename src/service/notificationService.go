@@ -0,0 +1,371 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNotificationInterval       = 5
+	defaultNotificationExpiringWindow = 3600
+	defaultNotificationBatchSize      = 1000
+	defaultNotificationOutbidWindow   = 3600
+	notificationOutbidLimit           = 100
+)
+
+// 通知生成任务锁 cache:<项目名>:lock:notification
+func genNotificationLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:notification", strings.ToLower(project))
+}
+
+// 通知已处理的activity游标 cache:<项目名>:<链名>:notification:last-id
+func genNotificationLastIdKey(project, chain string) string {
+	return fmt.Sprintf("cache:%s:%s:notification:last-id", strings.ToLower(project), chain)
+}
+
+// 出价被超过通知的去重key，同一用户在同一item(集合出价为同一集合)上每个时间窗口内只通知一次
+func outbidDedupKey(chainId int, collectionAddr, tokenId string, orderType int, eventTime int64, window int) string {
+	if orderType == multi.CollectionBidOrder {
+		tokenId = ""
+	}
+	return fmt.Sprintf("%s:%d:%d:%s:%s:%d", dao.NotificationOutbid, chainId, orderType,
+		strings.ToLower(collectionAddr), tokenId, eventTime/int64(window))
+}
+
+// 保存新增的通知，只清除确实收到新通知的用户的未读数缓存
+// 出价被超过等通知按时间窗口合并，大部分重复生成的通知已存在，不应使这些用户的缓存失效
+func addNotifications(ctx context.Context, serverCtx *svc.ServerCtx, notifications []dao.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	existing, err := serverCtx.Dao.QueryExistingNotificationKeys(ctx, notifications)
+	if err != nil {
+		return errors.Wrap(err, "failed on query existing notifications")
+	}
+	notifications = newNotifications(notifications, existing)
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := serverCtx.Dao.AddNotifications(ctx, notifications); err != nil {
+		return errors.Wrap(err, "failed on add notifications")
+	}
+	addrMap := make(map[string]bool)
+	var addrs []string
+	for _, n := range notifications {
+		if !addrMap[n.Address] {
+			addrMap[n.Address] = true
+			addrs = append(addrs, n.Address)
+		}
+	}
+	if err := serverCtx.Cached.DelNotificationUnread(addrs...); err != nil {
+		xzap.WithContext(ctx).Error("failed on delete notification unread cache", zap.Error(err))
+	}
+	return nil
+}
+
+// 过滤已存在和同一批次中重复的通知，保持原有顺序
+func newNotifications(notifications []dao.Notification, existing map[string]bool) []dao.Notification {
+	seen := make(map[string]bool, len(notifications))
+	var result []dao.Notification
+	for _, n := range notifications {
+		key := dao.NotificationKey(n.Address, n.DedupKey)
+		if existing[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, n)
+	}
+	return result
+}
+
+// GetNotifications 分页查询用户通知，同时返回未读数
+func GetNotifications(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, filter entity.NotificationFilterParam) (*entity.NotificationResp, error) {
+	addrs := lowerAddresses(userAddrs)
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = 20
+	}
+	//1、查询通知
+	notifications, count, err := serverCtx.Dao.QueryNotifications(ctx, addrs, filter.UnreadOnly, filter.Page, filter.PageSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query notifications")
+	}
+	//2、查询未读数
+	unread, err := GetUnreadNotificationCount(ctx, serverCtx, addrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get unread count")
+	}
+
+	infos := make([]entity.NotificationInfo, 0, len(notifications))
+	for _, n := range notifications {
+		infos = append(infos, entity.NotificationInfo{
+			Id:                n.Id,
+			Address:           n.Address,
+			ChainID:           n.ChainId,
+			NotifyType:        n.NotifyType,
+			CollectionAddress: n.CollectionAddress,
+			TokenID:           n.TokenId,
+			OrderID:           n.OrderId,
+			Price:             n.Price,
+			Counterparty:      n.Counterparty,
+			IsRead:            n.IsRead,
+			EventTime:         n.EventTime,
+		})
+	}
+	return &entity.NotificationResp{Result: infos, Count: count, Unread: unread}, nil
+}
+
+// GetUnreadNotificationCount 查询用户所有地址的未读通知数，优先读取缓存
+func GetUnreadNotificationCount(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string) (int64, error) {
+	var total int64
+	for _, addr := range lowerAddresses(userAddrs) {
+		count, ok, err := serverCtx.Cached.GetNotificationUnread(addr)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on get notification unread cache", zap.Error(err))
+		}
+		if !ok {
+			count, err = serverCtx.Dao.CountUnreadNotifications(ctx, addr)
+			if err != nil {
+				return 0, errors.Wrap(err, "failed on count unread notifications")
+			}
+			if err := serverCtx.Cached.CacheNotificationUnread(addr, count); err != nil {
+				xzap.WithContext(ctx).Error("failed on cache notification unread", zap.Error(err))
+			}
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// MarkNotificationsRead 将用户的通知标记为已读，id为0时标记全部
+func MarkNotificationsRead(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, id int64) error {
+	addrs := lowerAddresses(userAddrs)
+	affected, err := serverCtx.Dao.MarkNotificationsRead(ctx, addrs, id)
+	if err != nil {
+		return errors.Wrap(err, "failed on mark notifications read")
+	}
+	if affected == 0 {
+		return nil
+	}
+	if err := serverCtx.Cached.DelNotificationUnread(addrs...); err != nil {
+		xzap.WithContext(ctx).Error("failed on delete notification unread cache", zap.Error(err))
+	}
+	return nil
+}
+
+// StartNotification 启动站内通知生成任务
+// 1. 根据新增activity生成收到出价、出价被超过、item售出通知
+// 2. 根据订单状态生成挂单即将过期通知
+// 多副本部署时通过Redis锁保证同一时刻只有一个实例在生成
+func StartNotification(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.Notification
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultNotificationInterval
+	}
+	expiringWindow := cfg.ExpiringWindow
+	if expiringWindow <= 0 {
+		expiringWindow = defaultNotificationExpiringWindow
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultNotificationBatchSize
+	}
+	outbidWindow := cfg.OutbidWindow
+	if outbidWindow <= 0 {
+		outbidWindow = defaultNotificationOutbidWindow
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lock := cached.NewRedisLock(serverCtx.KvStore, genNotificationLockKey(serverCtx.C.ProjectCfg.Name), interval*3)
+			ok, err := lock.Acquire()
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on acquire notification lock", zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			for _, supported := range serverCtx.C.ChainSupported {
+				if err := generateActivityNotifications(ctx, serverCtx, supported.Name, supported.ChainId, outbidWindow); err != nil {
+					xzap.WithContext(ctx).Error("failed on generate activity notifications", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+				if err := generateExpiringNotifications(ctx, serverCtx, supported.Name, supported.ChainId, expiringWindow, batchSize); err != nil {
+					xzap.WithContext(ctx).Error("failed on generate expiring notifications", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+			}
+			if err := lock.Release(); err != nil {
+				xzap.WithContext(ctx).Error("failed on release notification lock", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 根据指定链新增的activity生成通知
+func generateActivityNotifications(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId, outbidWindow int) error {
+	//1、读取游标，首次运行时从当前最大id开始，不生成历史通知
+	lastIdKey := genNotificationLastIdKey(serverCtx.C.ProjectCfg.Name, chain)
+	cursor, err := loadActivityCursor(ctx, serverCtx, chain, lastIdKey)
+	if err != nil || cursor == nil {
+		return err
+	}
+
+	//2、查询新增activity和之前空缺、现已提交的activity
+	activities, next, err := readActivitiesAfterCursor(ctx, serverCtx, chain, cursor, activityStreamBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(activities) == 0 {
+		return nil
+	}
+
+	//3、按规则生成通知
+	var notifications []dao.Notification
+	for i := range activities {
+		n, err := activityNotifications(ctx, serverCtx, chain, chainId, outbidWindow, &activities[i].Activity)
+		if err != nil {
+			return errors.Wrap(err, "failed on build activity notifications")
+		}
+		notifications = append(notifications, n...)
+	}
+
+	//4、保存通知并保存游标
+	if err := addNotifications(ctx, serverCtx, notifications); err != nil {
+		return err
+	}
+	return saveActivityCursor(serverCtx, lastIdKey, next)
+}
+
+// 单个activity触发的通知
+// 1. 成交：通知卖方(maker)item已售出
+// 2. item出价：通知item持有者收到出价
+// 3. item出价和集合出价：通知价格更低的其他出价者出价已被超过，同一用户在同一item或集合上按outbidWindow合并
+func activityNotifications(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId, outbidWindow int, activity *multi.Activity) ([]dao.Notification, error) {
+	now := time.Now().Unix()
+	newNotification := func(address, notifyType, dedupKey, counterparty string) dao.Notification {
+		return dao.Notification{
+			Address:           strings.ToLower(address),
+			ChainId:           chainId,
+			NotifyType:        notifyType,
+			CollectionAddress: strings.ToLower(activity.CollectionAddress),
+			TokenId:           activity.TokenId,
+			Price:             activity.Price,
+			Counterparty:      strings.ToLower(counterparty),
+			DedupKey:          dedupKey,
+			EventTime:         activity.EventTime,
+			CreateTime:        now,
+			UpdateTime:        now,
+		}
+	}
+
+	var notifications []dao.Notification
+	switch activity.ActivityType {
+	case multi.Sale, multi.Buy:
+		if activity.Maker != "" {
+			notifications = append(notifications, newNotification(activity.Maker, dao.NotificationItemSold,
+				fmt.Sprintf("%s:%d:%d", dao.NotificationItemSold, chainId, activity.Id), activity.Taker))
+		}
+	case multi.ItemBid, multi.CollectionBid:
+		orderType := multi.CollectionBidOrder
+		if activity.ActivityType == multi.ItemBid {
+			orderType = multi.ItemBidOrder
+			//1、通知item持有者
+			item, err := serverCtx.Dao.QueryItemInfo(ctx, chain, activity.CollectionAddress, activity.TokenId)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed on query item info")
+			}
+			if item != nil && item.Owner != "" && !strings.EqualFold(item.Owner, activity.Maker) {
+				notifications = append(notifications, newNotification(item.Owner, dao.NotificationBidReceived,
+					fmt.Sprintf("%s:%d:%d", dao.NotificationBidReceived, chainId, activity.Id), activity.Maker))
+			}
+		}
+		//2、通知被超过的出价者
+		outbids, err := serverCtx.Dao.QueryOutbidOrders(ctx, chain, &multi.Order{
+			CollectionAddress: activity.CollectionAddress,
+			TokenId:           activity.TokenId,
+			Maker:             activity.Maker,
+			Price:             activity.Price,
+			OrderType:         int64(orderType),
+		}, notificationOutbidLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on query outbid orders")
+		}
+		dedupKey := outbidDedupKey(chainId, activity.CollectionAddress, activity.TokenId, orderType, activity.EventTime, outbidWindow)
+		notified := make(map[string]bool)
+		for _, order := range outbids {
+			maker := strings.ToLower(order.Maker)
+			if notified[maker] {
+				continue
+			}
+			notified[maker] = true
+			n := newNotification(order.Maker, dao.NotificationOutbid, dedupKey, activity.Maker)
+			n.OrderId = order.OrderID
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+// 根据即将过期的挂单生成通知，按id游标分批扫描，每个挂单只通知一次
+// 已通知的挂单在查询时排除，每轮只读取新进入过期窗口的挂单
+func generateExpiringNotifications(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId, expiringWindow, batchSize int) error {
+	now := time.Now().Unix()
+	var afterId int64
+	for {
+		orders, err := serverCtx.Dao.QueryExpiringListings(ctx, chain, chainId, now+int64(expiringWindow), afterId, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed on query expiring listings")
+		}
+		var notifications []dao.Notification
+		for _, order := range orders {
+			notifications = append(notifications, expiringNotification(chainId, order, now))
+		}
+		if err := addNotifications(ctx, serverCtx, notifications); err != nil {
+			return err
+		}
+		if len(orders) < batchSize {
+			return nil
+		}
+		afterId = orders[len(orders)-1].Id
+	}
+}
+
+// 挂单即将过期的通知，去重key为 listing_expiring:<链id>:<订单id>
+func expiringNotification(chainId int, order multi.Order, now int64) dao.Notification {
+	return dao.Notification{
+		Address:           strings.ToLower(order.Maker),
+		ChainId:           chainId,
+		NotifyType:        dao.NotificationListingExpiring,
+		CollectionAddress: strings.ToLower(order.CollectionAddress),
+		TokenId:           order.TokenId,
+		OrderId:           order.OrderID,
+		Price:             order.Price,
+		DedupKey:          dao.ListingExpiringDedupPrefix(chainId) + order.OrderID,
+		EventTime:         order.ExpireTime,
+		CreateTime:        now,
+		UpdateTime:        now,
+	}
+}
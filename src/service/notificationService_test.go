@@ -0,0 +1,115 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"reflect"
+	"testing"
+)
+
+func TestOutbidDedupKey(t *testing.T) {
+	const (
+		chainId    = 11155111
+		collection = "0xAbC"
+		window     = 3600
+	)
+	base := outbidDedupKey(chainId, collection, "1", multi.ItemBidOrder, 7200, window)
+	tests := []struct {
+		name      string
+		tokenId   string
+		orderType int
+		eventTime int64
+		same      bool
+	}{
+		{name: "same item in window", tokenId: "1", orderType: multi.ItemBidOrder, eventTime: 7200 + window - 1, same: true},
+		{name: "next window", tokenId: "1", orderType: multi.ItemBidOrder, eventTime: 7200 + window, same: false},
+		{name: "another item", tokenId: "2", orderType: multi.ItemBidOrder, eventTime: 7200, same: false},
+		{name: "collection bid", tokenId: "1", orderType: multi.CollectionBidOrder, eventTime: 7200, same: false},
+	}
+	for _, tt := range tests {
+		got := outbidDedupKey(chainId, collection, tt.tokenId, tt.orderType, tt.eventTime, window)
+		if (got == base) != tt.same {
+			t.Errorf("%s: key = %s, base = %s, want same %v", tt.name, got, base, tt.same)
+		}
+	}
+	// 集合出价不区分token
+	if outbidDedupKey(chainId, collection, "1", multi.CollectionBidOrder, 0, window) !=
+		outbidDedupKey(chainId, "0xabc", "2", multi.CollectionBidOrder, 0, window) {
+		t.Error("collection bid key should ignore token id and address case")
+	}
+}
+
+func TestActivityNotificationsItemSold(t *testing.T) {
+	const chainId = 11155111
+	tests := []struct {
+		name     string
+		activity multi.Activity
+		want     []string
+	}{
+		{
+			name:     "sale notifies maker",
+			activity: multi.Activity{Id: 7, ActivityType: multi.Sale, Maker: "0xSeller", Taker: "0xBuyer"},
+			want:     []string{"0xseller:item_sold:11155111:7"},
+		},
+		{
+			name:     "buy notifies maker",
+			activity: multi.Activity{Id: 8, ActivityType: multi.Buy, Maker: "0xSeller"},
+			want:     []string{"0xseller:item_sold:11155111:8"},
+		},
+		{name: "sale without maker", activity: multi.Activity{Id: 9, ActivityType: multi.Sale}},
+		{name: "listing ignored", activity: multi.Activity{Id: 10, ActivityType: multi.Listing, Maker: "0xSeller"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 成交通知不查询数据库
+			got, err := activityNotifications(context.Background(), nil, "sepolia", chainId, 3600, &tt.activity)
+			if err != nil {
+				t.Fatalf("activityNotifications: %v", err)
+			}
+			var keys []string
+			for _, n := range got {
+				keys = append(keys, dao.NotificationKey(n.Address, n.DedupKey))
+				if n.NotifyType != dao.NotificationItemSold {
+					t.Errorf("notify type = %s, want %s", n.NotifyType, dao.NotificationItemSold)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("notifications = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiringNotification(t *testing.T) {
+	order := multi.Order{OrderID: "0xorder", Maker: "0xMaker", CollectionAddress: "0xAbC", TokenId: "1", ExpireTime: 100}
+	n := expiringNotification(11155111, order, 50)
+	if n.Address != "0xmaker" || n.CollectionAddress != "0xabc" || n.EventTime != 100 {
+		t.Errorf("notification = %+v", n)
+	}
+	// 去重key与查询即将过期挂单时排除已通知挂单的条件一致
+	if want := dao.ListingExpiringDedupPrefix(11155111) + "0xorder"; n.DedupKey != want {
+		t.Errorf("dedup key = %s, want %s", n.DedupKey, want)
+	}
+}
+
+func TestNewNotifications(t *testing.T) {
+	n := func(address, dedupKey string) dao.Notification {
+		return dao.Notification{Address: address, DedupKey: dedupKey}
+	}
+	notifications := []dao.Notification{
+		n("0xa", "outbid:1"),
+		n("0xb", "outbid:1"),
+		n("0xa", "outbid:1"),
+		n("0xa", "item_sold:1"),
+	}
+	existing := map[string]bool{dao.NotificationKey("0xb", "outbid:1"): true}
+	var keys []string
+	for _, got := range newNotifications(notifications, existing) {
+		keys = append(keys, dao.NotificationKey(got.Address, got.DedupKey))
+	}
+	want := []string{"0xa:outbid:1", "0xa:item_sold:1"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("new notifications = %v, want %v", keys, want)
+	}
+}
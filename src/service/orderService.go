@@ -7,6 +7,7 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/pkg/errors"
 	"sort"
+	"strings"
 )
 
 /*
@@ -53,8 +54,19 @@ func GetOrderInfos(ctx context.Context, serverCtx *svc.ServerCtx, chain string,
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on query collection top n bid")
 	}
-	// 5. 处理并返回最终的出价信息
-	return processBids(tokenIds, itemBestBids, collectionBids, collectionAddr), nil
+	// 5. 处理最终的出价信息
+	bids := processBids(tokenIds, itemBestBids, collectionBids, collectionAddr)
+
+	// 6. 计算接受出价时的手续费和到手金额
+	model, err := loadFeeModel(ctx, serverCtx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on load fee model")
+	}
+	for i := range bids {
+		fee := model.breakdown(bids[i].MarketplaceId, bids[i].Price)
+		bids[i].Fee = &fee
+	}
+	return bids, nil
 }
 
 // 处理NFT的出价信息,返回每个NFT的最高出价
@@ -167,3 +179,48 @@ func processBids(tokenIds []string, itemBestBids map[string]multi.Order, collect
 	}
 	return resultBids
 }
+
+// 保存trait出价
+// 订单需为当前登录用户创建的collection出价，trait需为集合中item拥有的trait
+// 合约不校验trait，订单仍按collection出价展示和成交，trait只作为出价意向
+func AddTraitBid(ctx context.Context, serverCtx *svc.ServerCtx, chain string, userAddrs []string, param entity.TraitBidParam) error {
+	// 1. 查询订单信息
+	order, err := serverCtx.Dao.QueryOrderInfo(ctx, chain, param.OrderId)
+	if err != nil {
+		return errors.Wrap(err, "failed on query order info")
+	}
+	if order.OrderID == "" {
+		return errors.New("order not exist")
+	}
+	// 2. 校验订单类型和状态
+	if order.OrderType != multi.CollectionBidOrder {
+		return errors.New("order is not a collection bid")
+	}
+	if order.OrderStatus != multi.OrderStatusActive {
+		return errors.New("order is not active")
+	}
+	// 3. 校验订单创建者
+	isMaker := false
+	for _, addr := range userAddrs {
+		if strings.EqualFold(addr, order.Maker) {
+			isMaker = true
+			break
+		}
+	}
+	if !isMaker {
+		return errors.New("user is not order maker")
+	}
+	// 4. 校验trait存在于该集合
+	exists, err := serverCtx.Dao.QueryTraitExists(ctx, chain, order.CollectionAddress, param.Trait, param.TraitValue)
+	if err != nil {
+		return errors.Wrap(err, "failed on query trait")
+	}
+	if !exists {
+		return errors.New("trait not exist in collection")
+	}
+	// 5. 保存trait出价
+	if err := serverCtx.Dao.AddTraitBid(ctx, chain, order, param.Trait, param.TraitValue); err != nil {
+		return errors.Wrap(err, "failed on add trait bid")
+	}
+	return nil
+}
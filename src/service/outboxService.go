@@ -0,0 +1,271 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOutboxInterval    = 1
+	defaultOutboxBatchSize   = 200
+	defaultOutboxMaxAttempts = 10
+	defaultOutboxBaseBackoff = 2
+	defaultOutboxMaxBackoff  = 300
+	outboxMaxErrorLength     = 512
+)
+
+// 发件箱relay锁 cache:<项目名>:lock:outbox
+func genOutboxLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:outbox", strings.ToLower(project))
+}
+
+// 发件箱地板价事件的去重key，每个集合只保留一条未发送事件
+func outboxFloorDedupKey(chain, collectionAddr string) string {
+	return fmt.Sprintf("%s:%d:%s", chain, ordermanager.UpdateCollection, strings.ToLower(collectionAddr))
+}
+
+// 为集合写入地板价事件，需传入事务中的Dao，与引起地板价变化的数据变更一起提交
+// 事件只记录需要更新地板价的集合，relay发送时再查询最新地板价，未启用发件箱时不写入
+func enqueueFloorPriceEvents(ctx context.Context, serverCtx *svc.ServerCtx, d *dao.Dao, chain string, collectionAddrs []string) error {
+	if serverCtx.C.Outbox == nil || !serverCtx.C.Outbox.Enable {
+		return nil
+	}
+	now := time.Now().Unix()
+	var events []dao.OutboxEvent
+	for _, collectionAddr := range collectionAddrs {
+		events = append(events, dao.OutboxEvent{
+			Chain:             chain,
+			EventType:         int(ordermanager.UpdateCollection),
+			CollectionAddress: strings.ToLower(collectionAddr),
+			DedupKey:          outboxFloorDedupKey(chain, collectionAddr),
+			Status:            dao.OutboxPending,
+			NextRetryTime:     now,
+			CreateTime:        now,
+			UpdateTime:        now,
+		})
+	}
+	return d.AddOutboxEvents(ctx, events)
+}
+
+// 影响挂单的activity类型，挂单、取消挂单和成交都会改变地板价
+var floorActivityTypes = map[int]bool{
+	multi.Listing:       true,
+	multi.CancelListing: true,
+	multi.Sale:          true,
+	multi.Buy:           true,
+}
+
+// 一批activity中挂单发生变化的集合，去重并保持首次出现的顺序
+func floorActivityCollections(activities []dao.ActivityMultiChainInfo) []string {
+	seen := make(map[string]bool)
+	var collectionAddrs []string
+	for _, activity := range activities {
+		if !floorActivityTypes[activity.ActivityType] {
+			continue
+		}
+		addr := strings.ToLower(activity.CollectionAddress)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		collectionAddrs = append(collectionAddrs, addr)
+	}
+	return collectionAddrs
+}
+
+// 读取链的发件箱activity游标，首次运行时从当前最大id开始并返回nil
+func loadOutboxCursor(ctx context.Context, serverCtx *svc.ServerCtx, chain string) (*activityCursor, error) {
+	saved, err := serverCtx.Dao.QueryOutboxCursor(ctx, chain)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query outbox cursor")
+	}
+	if saved == nil {
+		maxId, err := serverCtx.Dao.QueryMaxActivityId(ctx, chain)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on query max activity id")
+		}
+		return nil, serverCtx.Dao.SaveOutboxCursor(ctx, chain, maxId, "")
+	}
+	cursor := &activityCursor{LastId: saved.LastActivityId}
+	if saved.Gaps != "" {
+		if err := json.Unmarshal([]byte(saved.Gaps), &cursor.Gaps); err != nil {
+			return nil, errors.Wrap(err, "invalid outbox cursor gaps")
+		}
+	}
+	return cursor, nil
+}
+
+// 保存链的发件箱activity游标，需传入事务中的Dao
+func saveOutboxCursor(ctx context.Context, d *dao.Dao, chain string, cursor *activityCursor) error {
+	var gaps string
+	if len(cursor.Gaps) > 0 {
+		data, err := json.Marshal(cursor.Gaps)
+		if err != nil {
+			return errors.Wrap(err, "failed on marshal outbox cursor gaps")
+		}
+		gaps = string(data)
+	}
+	return d.SaveOutboxCursor(ctx, chain, cursor.LastId, gaps)
+}
+
+// 根据indexer写入的新activity为挂单发生变化的集合写入地板价事件
+// 事件与activity游标在同一事务中提交，事务失败时下次从原游标重新处理，不会丢失也不会重复推进
+// 游标之前尚未出现的id会在之后重新检查，晚提交的activity不会被跳过
+func enqueueActivityFloorEvents(ctx context.Context, serverCtx *svc.ServerCtx, chain string, batchSize int) error {
+	//1、读取游标，首次运行时从当前最大id开始
+	cursor, err := loadOutboxCursor(ctx, serverCtx, chain)
+	if err != nil || cursor == nil {
+		return err
+	}
+
+	//2、查询新增activity和之前缺失的activity
+	activities, next, err := readActivitiesAfterCursor(ctx, serverCtx, chain, cursor, batchSize)
+	if err != nil {
+		return err
+	}
+	if next.LastId == cursor.LastId && len(next.Gaps) == len(cursor.Gaps) {
+		return nil
+	}
+
+	//3、写入地板价事件并推进游标
+	collectionAddrs := floorActivityCollections(activities)
+	return serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		d := serverCtx.Dao.WithTx(tx)
+		if err := enqueueFloorPriceEvents(ctx, serverCtx, d, chain, collectionAddrs); err != nil {
+			return errors.Wrap(err, "failed on enqueue floor price events")
+		}
+		return saveOutboxCursor(ctx, d, chain, next)
+	})
+}
+
+// StartOutboxRelay 启动发件箱relay
+// 1. 根据indexer新增的挂单、取消挂单和成交activity写入地板价事件
+// 2. 将到期的事件发送给ordermanager，失败后按指数退避重试，超过最大次数标记为失败。
+// 每个集合只有一条未发送事件，发送时查询最新地板价，事件之间的发送顺序不影响结果。
+// 多副本部署时通过Redis锁保证同一时刻只有一个实例在处理
+func StartOutboxRelay(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.Outbox
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultOutboxInterval
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lock := cached.NewRedisLock(serverCtx.KvStore, genOutboxLockKey(serverCtx.C.ProjectCfg.Name), interval*10)
+			ok, err := lock.Acquire()
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on acquire outbox lock", zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			for _, supported := range serverCtx.C.ChainSupported {
+				if err := enqueueActivityFloorEvents(ctx, serverCtx, supported.Name, activityStreamBatchSize); err != nil {
+					xzap.WithContext(ctx).Error("failed on enqueue activity floor events", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+			}
+			if err := relayOutboxEvents(ctx, serverCtx); err != nil {
+				xzap.WithContext(ctx).Error("failed on relay outbox events", zap.Error(err))
+			}
+			if err := lock.Release(); err != nil {
+				xzap.WithContext(ctx).Error("failed on release outbox lock", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 发送一批到期的事件
+func relayOutboxEvents(ctx context.Context, serverCtx *svc.ServerCtx) error {
+	cfg := serverCtx.C.Outbox
+	batchSize, maxAttempts := cfg.BatchSize, cfg.MaxAttempts
+	baseBackoff, maxBackoff := cfg.BaseBackoff, cfg.MaxBackoff
+	if batchSize <= 0 {
+		batchSize = defaultOutboxBatchSize
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultOutboxMaxAttempts
+	}
+	if baseBackoff <= 0 {
+		baseBackoff = defaultOutboxBaseBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultOutboxMaxBackoff
+	}
+
+	events, err := serverCtx.Dao.QueryPendingOutboxEvents(ctx, batchSize)
+	if err != nil {
+		return errors.Wrap(err, "failed on query pending outbox events")
+	}
+	for i := range events {
+		event := &events[i]
+		//1、查询最新地板价并发送给ordermanager
+		err := sendOutboxEvent(ctx, serverCtx, event)
+
+		//2、记录发送结果
+		now := time.Now().Unix()
+		event.Attempts++
+		event.UpdateTime = now
+		event.LastError = ""
+		if err == nil {
+			event.Status = dao.OutboxSent
+		} else {
+			event.LastError = err.Error()
+			if len(event.LastError) > outboxMaxErrorLength {
+				event.LastError = event.LastError[:outboxMaxErrorLength]
+			}
+			if event.Attempts >= maxAttempts {
+				event.Status = dao.OutboxFailed
+				xzap.WithContext(ctx).Error("outbox event failed", zap.Error(err),
+					zap.Int64("event_id", event.Id), zap.String("dedup_key", event.DedupKey))
+			} else {
+				event.NextRetryTime = now + int64(retryBackoff(event.Attempts, baseBackoff, maxBackoff))
+			}
+		}
+		//3、发送期间事件被再次写入时保持待发送，下一轮以最新地板价重新发送
+		if _, err := serverCtx.Dao.UpdateOutboxEvent(ctx, event); err != nil {
+			return errors.Wrap(err, "failed on update outbox event")
+		}
+	}
+	return nil
+}
+
+// 发送单个事件，地板价事件在发送前查询最新地板价并记录到事件中
+func sendOutboxEvent(ctx context.Context, serverCtx *svc.ServerCtx, event *dao.OutboxEvent) error {
+	if ordermanager.EventType(event.EventType) == ordermanager.UpdateCollection {
+		floorPrice, _, err := serverCtx.Dao.QueryFloorPrice(ctx, event.Chain, event.CollectionAddress)
+		if err != nil {
+			return errors.Wrap(err, "failed on query floor price")
+		}
+		event.Price = floorPrice
+	}
+	return addUpdatePriceEvent(ctx, serverCtx, event.Chain, &ordermanager.TradeEvent{
+		OrderId:        event.OrderId,
+		CollectionAddr: event.CollectionAddress,
+		EventType:      ordermanager.EventType(event.EventType),
+		TokenID:        event.TokenId,
+		Price:          event.Price,
+	})
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"reflect"
+	"testing"
+)
+
+func TestFloorActivityCollections(t *testing.T) {
+	activity := func(activityType int, collectionAddr string) dao.ActivityMultiChainInfo {
+		return dao.ActivityMultiChainInfo{Activity: multi.Activity{ActivityType: activityType, CollectionAddress: collectionAddr}}
+	}
+	tests := []struct {
+		name       string
+		activities []dao.ActivityMultiChainInfo
+		want       []string
+	}{
+		{name: "no activity"},
+		{
+			name:       "listing cancel and sale",
+			activities: []dao.ActivityMultiChainInfo{activity(multi.Listing, "0xA"), activity(multi.CancelListing, "0xb"), activity(multi.Sale, "0xc")},
+			want:       []string{"0xa", "0xb", "0xc"},
+		},
+		{
+			name:       "deduplicated ignoring case",
+			activities: []dao.ActivityMultiChainInfo{activity(multi.Listing, "0xA"), activity(multi.Buy, "0xa")},
+			want:       []string{"0xa"},
+		},
+		{
+			name:       "bids and transfers do not change floor",
+			activities: []dao.ActivityMultiChainInfo{activity(multi.CollectionBid, "0xa"), activity(multi.ItemBid, "0xb"), activity(multi.Transfer, "0xc")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := floorActivityCollections(tt.activities); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutboxFloorDedupKey(t *testing.T) {
+	// 同一集合的地板价事件不区分价格和地址大小写，只保留一条未发送事件
+	if got, want := outboxFloorDedupKey("sepolia", "0xAbC"), outboxFloorDedupKey("sepolia", "0xabc"); got != want {
+		t.Errorf("dedup key differs by case: %s != %s", got, want)
+	}
+	if outboxFloorDedupKey("sepolia", "0xabc") == outboxFloorDedupKey("eth", "0xabc") {
+		t.Error("dedup key should differ between chains")
+	}
+}
+
+func TestEnqueueFloorPriceEventsDisabled(t *testing.T) {
+	// 未启用发件箱时不写入事件，不访问Dao
+	for _, cfg := range []*config.OutboxCfg{nil, {Enable: false}} {
+		serverCtx := &svc.ServerCtx{C: &config.Config{Outbox: cfg}}
+		if err := enqueueFloorPriceEvents(context.Background(), serverCtx, nil, "sepolia", []string{"0xabc"}); err != nil {
+			t.Errorf("enqueueFloorPriceEvents() error = %v", err)
+		}
+	}
+}
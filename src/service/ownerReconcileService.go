@@ -0,0 +1,306 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/chain"
+	"EasySwapBackend-test/src/config"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/evm/eip"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReconcileInterval  = 60
+	defaultReconcileBatchSize = 100
+	defaultReconcileBatches   = 10
+	maxDiscrepancyPageSize    = 100
+	zeroAddress               = "0x0000000000000000000000000000000000000000"
+)
+
+// 所有者对账锁 cache:<项目名>:lock:owner-reconcile
+func genReconcileLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:owner-reconcile", strings.ToLower(project))
+}
+
+// 所有者对账已处理的最大item id cache:<项目名>:<链名>:owner-reconcile:last-id
+func genReconcileLastIdKey(project, chain string) string {
+	return fmt.Sprintf("cache:%s:%s:owner-reconcile:last-id", strings.ToLower(project), chain)
+}
+
+// StartOwnerReconcile 启动NFT所有者对账
+// 1. 每条链按item id顺序分批遍历，到末尾后从头开始下一轮
+// 2. 只对账ERC721集合，同一集合的item通过JSON-RPC批量请求查询链上所有者，revert的item原因未知不处理
+// 3. 不一致且数据库中的所有者未被indexer更新时修正所有者，挂单者已不是所有者的挂单标记为无效，并记录不一致报告
+// 4. 受影响集合的地板价事件写入发件箱，并刷新上架数量缓存
+func StartOwnerReconcile(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.Reconcile
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval, batchSize, batches := cfg.Interval, cfg.BatchSize, cfg.Batches
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultReconcileBatchSize
+	}
+	if batches <= 0 {
+		batches = defaultReconcileBatches
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lock := cached.NewRedisLock(serverCtx.KvStore, genReconcileLockKey(serverCtx.C.ProjectCfg.Name), interval*10)
+			ok, err := lock.Acquire()
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on acquire owner reconcile lock", zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			for _, supported := range serverCtx.C.ChainSupported {
+				if err := reconcileChainOwners(ctx, serverCtx, supported, batchSize, batches); err != nil {
+					xzap.WithContext(ctx).Error("failed on reconcile owners", zap.Error(err),
+						zap.String("chain", supported.Name))
+				}
+			}
+			if err := lock.Release(); err != nil {
+				xzap.WithContext(ctx).Error("failed on release owner reconcile lock", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 对账指定链上的一段item
+func reconcileChainOwners(ctx context.Context, serverCtx *svc.ServerCtx, supported *config.ChainSupported, batchSize, batches int) error {
+	client, ok := serverCtx.Chains[int64(supported.ChainId)]
+	if !ok {
+		return errors.New("chain client not found")
+	}
+	lastIdKey := genReconcileLastIdKey(serverCtx.C.ProjectCfg.Name, supported.Name)
+	value, err := serverCtx.KvStore.Get(lastIdKey)
+	if err != nil {
+		return errors.Wrap(err, "failed on get reconcile last id")
+	}
+	var lastId int64
+	if value != "" {
+		if lastId, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return errors.Wrap(err, "invalid reconcile last id")
+		}
+	}
+
+	for i := 0; i < batches; i++ {
+		//1、读取下一批item，到末尾后从头开始
+		items, err := serverCtx.Dao.QueryItemsAfter(ctx, supported.Name, lastId, batchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed on query items")
+		}
+		if len(items) == 0 {
+			lastId = 0
+			break
+		}
+		//2、按集合分组对账
+		groups := make(map[string][]multi.Item)
+		var collectionAddrs []string
+		for _, item := range items {
+			collectionAddr := strings.ToLower(item.CollectionAddress)
+			if _, ok := groups[collectionAddr]; !ok {
+				collectionAddrs = append(collectionAddrs, collectionAddr)
+			}
+			groups[collectionAddr] = append(groups[collectionAddr], item)
+		}
+		for _, collectionAddr := range collectionAddrs {
+			if err := reconcileCollectionOwners(ctx, serverCtx, client, supported, collectionAddr, groups[collectionAddr]); err != nil {
+				xzap.WithContext(ctx).Error("failed on reconcile collection owners", zap.Error(err),
+					zap.String("chain", supported.Name), zap.String("collection_address", collectionAddr))
+			}
+		}
+		lastId = items[len(items)-1].Id
+		if len(items) < batchSize {
+			lastId = 0
+			break
+		}
+	}
+	return serverCtx.KvStore.Set(lastIdKey, strconv.FormatInt(lastId, 10))
+}
+
+// 对账同一集合中的一批item
+func reconcileCollectionOwners(ctx context.Context, serverCtx *svc.ServerCtx, client chain.NftClient,
+	supported *config.ChainSupported, collectionAddr string, items []multi.Item) error {
+	//1、非ERC721合约的ownerOf语义不确定，不参与对账
+	isErc721, err := client.SupportsErc721(ctx, collectionAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed on check erc721")
+	}
+	if !isErc721 {
+		return nil
+	}
+
+	//2、批量查询链上所有者，找出不一致的item
+	tokenIds := make([]string, 0, len(items))
+	for _, item := range items {
+		tokenIds = append(tokenIds, item.TokenId)
+	}
+	results, err := client.OwnersOf(ctx, collectionAddr, tokenIds)
+	if err != nil {
+		return errors.Wrap(err, "failed on fetch nft owners")
+	}
+	now := time.Now().Unix()
+	chainOwners, discrepancies, changedTokenIds := findOwnerDiscrepancies(supported.ChainId, collectionAddr, items, results, now)
+	if len(changedTokenIds) == 0 {
+		return nil
+	}
+
+	//3、挂单者已不是链上所有者的挂单标记为无效
+	listings, err := serverCtx.Dao.QueryActiveListingsByTokens(ctx, supported.Name, collectionAddr, changedTokenIds)
+	if err != nil {
+		return errors.Wrap(err, "failed on query active listings")
+	}
+	var invalidOrders []dao.InvalidOrder
+	for _, order := range listings {
+		discrepancy := discrepancies[order.TokenId]
+		if discrepancy == nil || strings.EqualFold(order.Maker, chainOwners[order.TokenId]) {
+			continue
+		}
+		reason := dao.InvalidReasonOwnerChanged
+		if discrepancy.Reason == dao.DiscrepancyTokenBurned {
+			reason = dao.InvalidReasonTokenBurned
+		}
+		invalidOrders = append(invalidOrders, dao.InvalidOrder{
+			OrderID:           order.OrderID,
+			CollectionAddress: order.CollectionAddress,
+			TokenId:           order.TokenId,
+			Maker:             order.Maker,
+			Reason:            reason,
+			CheckTime:         now,
+			CreateTime:        now,
+			UpdateTime:        now,
+		})
+		discrepancy.InvalidOrders++
+	}
+
+	//4、修正所有者、记录无效挂单和不一致报告，地板价事件在同一事务中写入发件箱
+	// 所有者只在仍为查询时的值时修正，期间已被indexer更新的item不记录报告也不标记挂单
+	var reports []dao.OwnerDiscrepancy
+	var appliedOrders []dao.InvalidOrder
+	err = serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		d := serverCtx.Dao.WithTx(tx)
+		reports, appliedOrders = nil, nil
+		updated := make(map[string]bool)
+		for _, tokenId := range changedTokenIds {
+			ok, err := d.UpdateItemOwnerIfMatch(ctx, supported.Name, collectionAddr, tokenId,
+				discrepancies[tokenId].DbOwner, chainOwners[tokenId])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			updated[tokenId] = true
+			reports = append(reports, *discrepancies[tokenId])
+		}
+		for _, order := range invalidOrders {
+			if updated[order.TokenId] {
+				appliedOrders = append(appliedOrders, order)
+			}
+		}
+		if err := d.AddOwnerDiscrepancies(ctx, reports); err != nil {
+			return err
+		}
+		if len(appliedOrders) == 0 {
+			return nil
+		}
+		if err := d.MarkOrdersInvalid(ctx, supported.Name, appliedOrders); err != nil {
+			return errors.Wrap(err, "failed on mark orders invalid")
+		}
+		return enqueueFloorPriceEvents(ctx, serverCtx, d, supported.Name, []string{collectionAddr})
+	})
+	if err != nil {
+		return err
+	}
+
+	//5、刷新上架数量缓存，清除集合相关的接口缓存
+	if len(appliedOrders) > 0 {
+		refreshCollectionListing(ctx, serverCtx, supported.Name, collectionAddr)
+	}
+	if err := serverCtx.Cached.PurgeApiCache(cached.ApiCacheCollectionTag(collectionAddr)); err != nil {
+		xzap.WithContext(ctx).Error("failed on purge api cache", zap.Error(err))
+	}
+	xzap.WithContext(ctx).Info("reconciled item owners", zap.String("chain", supported.Name),
+		zap.String("collection_address", collectionAddr), zap.Int("discrepancies", len(reports)),
+		zap.Int("invalid_orders", len(appliedOrders)))
+	return nil
+}
+
+// 比对数据库与链上的所有者，返回链上所有者、不一致记录和有变化的token id
+// ownerOf revert的原因无法确定(token不存在、合约暂停等)，视为未知跳过；只有返回零地址时才记为已销毁
+func findOwnerDiscrepancies(chainId int, collectionAddr string, items []multi.Item, results []chain.OwnerResult,
+	now int64) (map[string]string, map[string]*dao.OwnerDiscrepancy, []string) {
+	chainOwners := make(map[string]string)
+	discrepancies := make(map[string]*dao.OwnerDiscrepancy)
+	var changedTokenIds []string
+	for i, item := range items {
+		result := results[i]
+		if result.Err != nil || result.Owner == "" {
+			continue
+		}
+		chainOwner, reason := result.Owner, dao.DiscrepancyOwnerChanged
+		if strings.EqualFold(chainOwner, zeroAddress) {
+			chainOwner, reason = zeroAddress, dao.DiscrepancyTokenBurned
+		}
+		if strings.EqualFold(chainOwner, item.Owner) {
+			continue
+		}
+		if checksum, err := eip.ToCheckSumAddress(chainOwner); err == nil {
+			chainOwner = checksum
+		}
+		chainOwners[item.TokenId] = chainOwner
+		discrepancies[item.TokenId] = &dao.OwnerDiscrepancy{
+			ChainId:           chainId,
+			CollectionAddress: collectionAddr,
+			TokenId:           item.TokenId,
+			DbOwner:           item.Owner,
+			ChainOwner:        chainOwner,
+			Reason:            reason,
+			CreateTime:        now,
+		}
+		changedTokenIds = append(changedTokenIds, item.TokenId)
+	}
+	return chainOwners, discrepancies, changedTokenIds
+}
+
+// GetOwnerDiscrepancies 分页查询所有者不一致报告
+func GetOwnerDiscrepancies(ctx context.Context, serverCtx *svc.ServerCtx, filter entity.OwnerDiscrepancyFilterParam) (*entity.OwnerDiscrepancyResp, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = 20
+	}
+	if filter.PageSize > maxDiscrepancyPageSize {
+		filter.PageSize = maxDiscrepancyPageSize
+	}
+	discrepancies, count, err := serverCtx.Dao.QueryOwnerDiscrepancies(ctx, filter.ChainID,
+		strings.ToLower(filter.CollectionAddress), filter.Page, filter.PageSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query owner discrepancies")
+	}
+	return &entity.OwnerDiscrepancyResp{Result: discrepancies, Count: count}, nil
+}
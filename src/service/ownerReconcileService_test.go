@@ -0,0 +1,53 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/chain"
+	"EasySwapBackend-test/src/dao"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"strings"
+	"testing"
+)
+
+func TestFindOwnerDiscrepancies(t *testing.T) {
+	const (
+		owner = "0x00000000000000000000000000000000000000aa"
+		other = "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+	)
+	tests := []struct {
+		name       string
+		result     chain.OwnerResult
+		wantOwner  string
+		wantReason string
+	}{
+		{name: "same owner ignores case", result: chain.OwnerResult{Owner: "0x00000000000000000000000000000000000000AA"}},
+		{name: "owner changed", result: chain.OwnerResult{Owner: other}, wantOwner: other,
+			wantReason: dao.DiscrepancyOwnerChanged},
+		{name: "zero address is burned", result: chain.OwnerResult{Owner: zeroAddress}, wantOwner: zeroAddress,
+			wantReason: dao.DiscrepancyTokenBurned},
+		{name: "revert is unknown", result: chain.OwnerResult{Err: errors.Wrap(chain.ErrExecutionReverted, "paused")}},
+		{name: "rpc error is skipped", result: chain.OwnerResult{Err: errors.New("timeout")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []multi.Item{{TokenId: "1", Owner: owner}}
+			owners, discrepancies, changed := findOwnerDiscrepancies(11155111, "0xc01", items, []chain.OwnerResult{tt.result}, 100)
+			if tt.wantReason == "" {
+				if len(changed) != 0 || len(discrepancies) != 0 {
+					t.Fatalf("unexpected discrepancies: %v", changed)
+				}
+				return
+			}
+			if len(changed) != 1 || changed[0] != "1" {
+				t.Fatalf("changed = %v, want [1]", changed)
+			}
+			if !strings.EqualFold(owners["1"], tt.wantOwner) {
+				t.Errorf("chain owner = %s, want %s", owners["1"], tt.wantOwner)
+			}
+			d := discrepancies["1"]
+			if d.Reason != tt.wantReason || d.DbOwner != owner || d.ChainId != 11155111 || d.CreateTime != 100 {
+				t.Errorf("discrepancy = %+v", d)
+			}
+		})
+	}
+}
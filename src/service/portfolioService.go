@@ -81,6 +81,7 @@ func GetMultiChainUserCollection(ctx context.Context, serverCtx *svc.ServerCtx,
 	//6、组装最终结果
 	var result entity.UserCollectionsData
 	chainInfoMap := make(map[int]entity.ChainInfo)
+	var chainIdOrder []int
 	for _, collection := range collections {
 		//6.1 添加collection信息
 		result.CollectionInfos = append(result.CollectionInfos, entity.CollectionInfo{
@@ -105,8 +106,14 @@ func GetMultiChainUserCollection(ctx context.Context, serverCtx *svc.ServerCtx,
 				ItemOwned: collection.ItemCount,
 				ItemValue: decimal.New(collection.ItemCount, 0).Mul(collection.FloorPrice),
 			}
+			chainIdOrder = append(chainIdOrder, collection.ChainID)
 		}
-		result.ChainInfos = append(result.ChainInfos, chainInfoMap[collection.ChainID])
+	}
+	//6.3 每条链一条汇总信息，并换算美元价值
+	for _, chainId := range chainIdOrder {
+		chainInfo := chainInfoMap[chainId]
+		chainInfo.ItemValueUsd = serverCtx.Prices.OptionalUsd(ctx, chainIdToChainNameMap[chainId], chainInfo.ItemValue)
+		result.ChainInfos = append(result.ChainInfos, chainInfo)
 	}
 
 	return &entity.UserCollectionsResp{Result: result}, nil
@@ -122,12 +129,13 @@ func GetMultiChainUserItems(ctx context.Context, serverCtx *svc.ServerCtx, chain
 	pageSize := filter.PageSize
 
 	//1、查询用户拥有nft的Item基本信息
-	items, total, err := serverCtx.Dao.QueryMultiChainUserItemInfos(ctx, chainNames, userAddrs, collAddrs, page, pageSize)
+	items, total, err := serverCtx.Dao.QueryMultiChainUserItemInfos(ctx, chainNames, userAddrs, collAddrs,
+		page, pageSize, filter.Cursor, filter.SkipCount)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get user items info")
 	}
-	//如果没有total，直接返回空结果
-	if total == 0 {
+	//如果没有item，直接返回空结果
+	if len(items) == 0 {
 		return &entity.UserItemsResp{Result: items, Count: total}, nil
 	}
 
@@ -138,12 +146,8 @@ func GetMultiChainUserItems(ctx context.Context, serverCtx *svc.ServerCtx, chain
 	}
 
 	//3、准备查询参数
-	var collectionAddrs [][]string                              // Collection地址和链名称对
-	var itemInfos []entity.MultiChainItemInfo                   // Item信息
-	var chainCollectionsMap = make(map[string][]string)         // 按链分组的Collection地址
-	var multichainItemsMap = make(map[string][]entity.ItemInfo) // 按链分组的Item信息
-
-	// 遍历Item,构建查询参数
+	var collectionAddrs [][]string            // Collection地址和链名称对
+	var itemInfos []entity.MultiChainItemInfo // Item信息
 	for _, item := range items {
 		collectionAddrs = append(collectionAddrs, []string{strings.ToLower(item.CollectionAddress), chainIdToChainNameMap[item.ChainID]})
 		itemInfos = append(itemInfos, entity.MultiChainItemInfo{
@@ -153,11 +157,6 @@ func GetMultiChainUserItems(ctx context.Context, serverCtx *svc.ServerCtx, chain
 			},
 			ChainName: chainIdToChainNameMap[item.ChainID],
 		})
-		chainCollectionsMap[strings.ToLower(chainIdToChainNameMap[item.ChainID])] = append(chainCollectionsMap[strings.ToLower(chainIdToChainNameMap[item.ChainID])], item.CollectionAddress)
-		multichainItemsMap[strings.ToLower(chainIdToChainNameMap[item.ChainID])] = append(multichainItemsMap[strings.ToLower(chainIdToChainNameMap[item.ChainID])], entity.ItemInfo{
-			CollectionAddress: item.CollectionAddress,
-			TokenID:           item.TokenID,
-		})
 	}
 
 	//4、获取用户地址
@@ -168,174 +167,69 @@ func GetMultiChainUserItems(ctx context.Context, serverCtx *svc.ServerCtx, chain
 		userAddr = ""
 	}
 
-	//5、并发查询collection最高出价信息
-	collectionBestBids := make(map[entity.MultichainCollection]multi.Order)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var queryErr error
-	for chain, collAddr := range chainCollectionsMap {
-		wg.Add(1)
-		go func(chain string, collAddrs []string) {
-			defer wg.Done()
-			bestBids, err := serverCtx.Dao.QueryCollectionsBestBid(ctx, chain, userAddr, collAddrs)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on query collections best bids")
-				return
-			}
-			mu.Lock()
-			defer mu.Unlock()
-			for _, bid := range bestBids {
-				collectionBestBids[entity.MultichainCollection{
-					CollectionAddress: bid.CollectionAddress,
-					Chain:             chain,
-				}] = *bid
-			}
-		}(chain, collAddr)
-	}
-	wg.Wait()
-	if queryErr != nil {
-		return nil, errors.Wrap(err, "failed on query collection bids")
-	}
-
-	//6、并发查询item的最高出价信息
-	itemBestBids := make(map[entity.MultiChainItemInfo]multi.Order)
-	wg.Add(1)
-	for chain, item := range multichainItemsMap {
-		go func(chain string, items []entity.ItemInfo) {
-			defer wg.Done()
-			bestBids, err := serverCtx.Dao.QueryItemsBestBids(ctx, chain, userAddr, items)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on query items best bids")
-				return
-			}
-
-			mu.Lock()
-			defer mu.Unlock()
-			for _, bid := range bestBids {
-				//先查是否map中已存在
-				order, ok := itemBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-					CollectionAddress: bid.CollectionAddress,
-					TokenID:           bid.TokenId,
-				}, ChainName: chain}]
-				//不存在，则新增
-				if !ok {
-					itemBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-						CollectionAddress: bid.CollectionAddress,
-						TokenID:           bid.TokenId,
-					}, ChainName: chain}] = bid
-					continue
-				}
-				//若存在，并且新的price>map中的price，则更新
-				if bid.Price.GreaterThan(order.Price) {
-					itemBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-						CollectionAddress: bid.CollectionAddress,
-						TokenID:           bid.TokenId,
-					}, ChainName: chain}] = bid
-				}
-			}
-		}(chain, item)
-	}
-	wg.Wait()
-	if queryErr != nil {
-		return nil, errors.Wrap(err, "failed on query item bids")
-	}
-
-	//7、查询collection信息
-	collections, err := serverCtx.Dao.QueryMultiChainCollectionsInfo(ctx, collectionAddrs)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on query collections info")
-	}
+	//5、并发查询collection信息和item挂单信息
+	group := newLoaderGroup(2)
 	collectionsMap := make(map[string]multi.Collection)
-	for _, coll := range collections {
-		collectionsMap[strings.ToLower(coll.Address)] = coll
-	}
-
-	//8、查询item挂单信息
-	listings, err := serverCtx.Dao.QueryMultiChainUserItemsListInfo(ctx, userAddrs, itemInfos)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on query item list info")
-	}
+	group.Go(func() error {
+		collections, err := serverCtx.Dao.QueryMultiChainCollectionsInfo(ctx, collectionAddrs)
+		if err != nil {
+			return errors.Wrap(err, "failed on query collections info")
+		}
+		for _, coll := range collections {
+			collectionsMap[strings.ToLower(coll.Address)] = coll
+		}
+		return nil
+	})
 	listingsMap := make(map[string]*dao.CollectionItem)
-	for _, list := range listings {
-		listingsMap[strings.ToLower(list.CollectionAddress+list.TokenId)] = list
+	group.Go(func() error {
+		listings, err := serverCtx.Dao.QueryMultiChainUserItemsListInfo(ctx, userAddrs, itemInfos)
+		if err != nil {
+			return errors.Wrap(err, "failed on query item list info")
+		}
+		for _, list := range listings {
+			listingsMap[strings.ToLower(list.CollectionAddress+list.TokenId)] = list
+		}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return nil, err
 	}
 
-	//9、获取挂单价格信息
-	var itemPrice []entity.MultiChainItemPriceInfo
+	//6、批量加载出价信息、挂单订单信息和图片信息
+	loader := newItemLoader(ctx, serverCtx, userAddr)
+	for _, item := range items {
+		loader.Add(chainIdToChainNameMap[item.ChainID], item.CollectionAddress, item.TokenID)
+	}
 	for _, item := range listingsMap {
 		if item.Listing {
-			itemPrice = append(itemPrice, entity.MultiChainItemPriceInfo{
-				ItemPriceInfo: entity.ItemPriceInfo{
-					CollectionAddress: item.CollectionAddress,
-					TokenId:           item.TokenId,
-					Maker:             item.Owner,
-					Price:             item.ListPrice,
-					OrderStatus:       multi.OrderStatusActive},
-				ChainName: chainIdToChainNameMap[item.ChainId],
+			loader.AddListing(chainIdToChainNameMap[item.ChainId], entity.ItemPriceInfo{
+				CollectionAddress: item.CollectionAddress,
+				TokenId:           item.TokenId,
+				Maker:             item.Owner,
+				Price:             item.ListPrice,
+				OrderStatus:       multi.OrderStatusActive,
 			})
 		}
 	}
-
-	//10、获取挂单订单信息
-	ordersMap := make(map[string]multi.Order)
-	if len(itemPrice) > 0 {
-		orders, err := serverCtx.Dao.QueryMultiChainListingInfo(ctx, itemPrice)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed on query item order id")
-		}
-		for _, order := range orders {
-			ordersMap[strings.ToLower(order.CollectionAddress+order.TokenId)] = order
-		}
-	}
-
-	//11、查询item图片信息
-	itemExternals, err := serverCtx.Dao.QueryMultiChainCollectionsItemsImage(ctx, itemInfos)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on query item image info")
-	}
-	itemExternalMap := make(map[string]multi.ItemExternal)
-	for _, item := range itemExternals {
-		itemExternalMap[strings.ToLower(item.CollectionAddress+item.TokenId)] = item
+	if err := loader.Load(loadItemImage | loadItemBestBid | loadItemListing); err != nil {
+		return nil, errors.Wrap(err, "failed on load items info")
 	}
 
-	//12、组装最终结果
+	//7、组装最终结果
 	for _, item := range items {
-		//设置出价信息
-		bidOrder, ok := itemBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-			CollectionAddress: item.CollectionAddress,
-			TokenID:           item.TokenID,
-		}, ChainName: chainIdToChainNameMap[item.ChainID]}]
+		chain := chainIdToChainNameMap[item.ChainID]
+		//设置出价信息，item出价高于collection出价时使用item出价
+		bidOrder, ok := loader.BestBid(chain, item.CollectionAddress, item.TokenID)
 		if ok {
-			if bidOrder.Price.GreaterThan(collectionBestBids[entity.MultichainCollection{
-				CollectionAddress: item.CollectionAddress,
-				Chain:             chainIdToChainNameMap[item.ChainID],
-			}].Price) {
-				item.BidOrderID = bidOrder.OrderID
-				item.BidExpireTime = bidOrder.ExpireTime
-				item.BidPrice = bidOrder.Price
-				item.BidTime = bidOrder.EventTime
-				item.BidSalt = bidOrder.Salt
-				item.BidMaker = bidOrder.Maker
-				item.BidType = getBidType(bidOrder.OrderType)
-				item.BidSize = bidOrder.Size
-				item.BidUnfilled = bidOrder.QuantityRemaining
-			}
-		} else {
-			cBid, ok := collectionBestBids[entity.MultichainCollection{
-				CollectionAddress: item.CollectionAddress,
-				Chain:             chainIdToChainNameMap[item.ChainID],
-			}]
-			if ok {
-				item.BidOrderID = cBid.OrderID
-				item.BidExpireTime = cBid.ExpireTime
-				item.BidPrice = cBid.Price
-				item.BidTime = cBid.EventTime
-				item.BidSalt = cBid.Salt
-				item.BidMaker = cBid.Maker
-				item.BidType = getBidType(cBid.OrderType)
-				item.BidSize = cBid.Size
-				item.BidUnfilled = cBid.QuantityRemaining
-			}
+			item.BidOrderID = bidOrder.OrderID
+			item.BidExpireTime = bidOrder.ExpireTime
+			item.BidPrice = bidOrder.Price
+			item.BidTime = bidOrder.EventTime
+			item.BidSalt = bidOrder.Salt
+			item.BidMaker = bidOrder.Maker
+			item.BidType = getBidType(bidOrder.OrderType)
+			item.BidSize = bidOrder.Size
+			item.BidUnfilled = bidOrder.QuantityRemaining
 		}
 		//设置collection信息
 		collection, ok := collectionsMap[strings.ToLower(item.CollectionAddress)]
@@ -355,7 +249,7 @@ func GetMultiChainUserItems(ctx context.Context, serverCtx *svc.ServerCtx, chain
 			item.MarketplaceID = listing.MarketID
 		}
 		//设置挂单订单信息
-		order, ok := ordersMap[strings.ToLower(item.CollectionAddress+item.TokenID)]
+		order, ok := loader.ListingOrder(chain, item.CollectionAddress, item.TokenID)
 		if ok {
 			item.ListOrderID = order.OrderID
 			item.ListExpireTime = order.ExpireTime
@@ -364,19 +258,18 @@ func GetMultiChainUserItems(ctx context.Context, serverCtx *svc.ServerCtx, chain
 			item.ListSalt = order.Salt
 		}
 		//设置item图片信息
-		image, ok := itemExternalMap[strings.ToLower(item.CollectionAddress+item.TokenID)]
+		image, ok := loader.Image(chain, item.CollectionAddress, item.TokenID)
 		if ok {
-			if image.IsUploadedOss {
-				item.ImageURI = image.OssUri
-			} else {
-				item.ImageURI = image.ImageUri
-			}
+			item.ImageURI = itemImageURI(image)
 		}
+		//扩展信息加载失败时降级返回该item
+		item.Incomplete = loader.Err(chain, item.CollectionAddress, item.TokenID) != nil
 	}
-	//14 包装返回参数
+	//8、包装返回参数
 	return &entity.UserItemsResp{
-		Result: items,
-		Count:  total,
+		Result:     items,
+		Count:      total,
+		NextCursor: dao.NextPortfolioItemCursor(items, pageSize),
 	}, nil
 }
 
@@ -391,12 +284,13 @@ func GetMultiChainUserListings(ctx context.Context, serverCtx *svc.ServerCtx, ch
 	pageSize := filter.PageSize
 
 	//1、查询用户挂单的基本信息
-	items, count, err := serverCtx.Dao.QueryMultiChainUserListingItemInfos(ctx, chainNames, userAddrs, collAddrs, page, pageSize)
+	items, count, err := serverCtx.Dao.QueryMultiChainUserListingItemInfos(ctx, chainNames, userAddrs, collAddrs,
+		page, pageSize, filter.Cursor, filter.SkipCount)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get user items info")
 	}
 	// 如果没有挂单,直接返回空结果
-	if count == 0 {
+	if len(items) == 0 {
 		return &entity.UserListingsResp{
 			Result: result,
 			Count:  count,
@@ -415,11 +309,8 @@ func GetMultiChainUserListings(ctx context.Context, serverCtx *svc.ServerCtx, ch
 		userAddr = ""
 	}
 	//4、准备查询参数
-	var collectionAddrs [][]string                           // Collection地址和链名称对
-	var itemInfos []entity.MultiChainItemInfo                // Item信息
-	var chainCollections = make(map[string][]string)         // 按链分组的Collection地址
-	var multichainItems = make(map[string][]entity.ItemInfo) // 按链分组的Item信息
-
+	var collectionAddrs [][]string            // Collection地址和链名称对
+	var itemInfos []entity.MultiChainItemInfo // Item信息
 	for _, item := range items {
 		collectionAddrs = append(collectionAddrs, []string{strings.ToLower(item.CollectionAddress), chainIdToChainNameMap[item.ChainID]})
 		itemInfos = append(itemInfos, entity.MultiChainItemInfo{
@@ -429,149 +320,62 @@ func GetMultiChainUserListings(ctx context.Context, serverCtx *svc.ServerCtx, ch
 			},
 			ChainName: chainIdToChainNameMap[item.ChainID],
 		})
-
-		chainCollections[strings.ToLower(chainIdToChainNameMap[item.ChainID])] = append(chainCollections[strings.ToLower(chainIdToChainNameMap[item.ChainID])], item.CollectionAddress)
-		multichainItems[chainIdToChainNameMap[item.ChainID]] = append(multichainItems[chainIdToChainNameMap[item.ChainID]], entity.ItemInfo{
-			CollectionAddress: item.CollectionAddress,
-			TokenID:           item.TokenID,
-		})
 	}
 
 	//5、记录item最近成本
 	itemLastCost := make(map[entity.MultiChainItemInfo]decimal.Decimal)
 
-	//6、并发查询collection最高出价信息
-	collectionBestBids := make(map[entity.MultichainCollection]multi.Order)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var queryErr error
-
-	for chain, collAddrs := range chainCollections {
-		wg.Add(1)
-		go func(chain string, collAddrs []string) {
-			defer wg.Done()
-			bestBids, err := serverCtx.Dao.QueryCollectionsBestBid(ctx, chain, userAddr, collAddrs)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on query collections best bid")
-				return
-			}
-			mu.Lock()
-			defer mu.Unlock()
-			for _, bid := range bestBids {
-				collectionBestBids[entity.MultichainCollection{
-					CollectionAddress: bid.CollectionAddress,
-					Chain:             chain,
-				}] = *bid
-			}
-		}(chain, collAddrs)
-	}
-	wg.Wait()
-	if queryErr != nil {
-		return nil, errors.Wrap(err, "failed on query collection bids")
-	}
-
-	//7、并发查询item最高出价信息
-	itemsBestBids := make(map[entity.MultiChainItemInfo]multi.Order)
-	for chain, items := range multichainItems {
-		wg.Add(1)
-		go func(chain string, items []entity.ItemInfo) {
-			defer wg.Done()
-			bids, err := serverCtx.Dao.QueryItemsBestBids(ctx, chain, userAddr, items)
-			if err != nil {
-				queryErr = errors.Wrap(err, "failed on query items best bid")
-				return
-			}
-			mu.Lock()
-			defer mu.Unlock()
-			for _, bid := range bids {
-				//先查是否map中已存在
-				order, ok := itemsBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-					CollectionAddress: bid.CollectionAddress,
-					TokenID:           bid.TokenId,
-				}, ChainName: chain}]
-				//不存在，则新增
-				if !ok {
-					itemsBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-						CollectionAddress: bid.CollectionAddress,
-						TokenID:           bid.TokenId,
-					}, ChainName: chain}] = bid
-					continue
-				}
-				//若存在，并且新的price>map中的price，则更新
-				if bid.Price.GreaterThan(order.Price) {
-					itemsBestBids[entity.MultiChainItemInfo{ItemInfo: entity.ItemInfo{
-						CollectionAddress: bid.CollectionAddress,
-						TokenID:           bid.TokenId,
-					}, ChainName: chain}] = bid
-				}
-			}
-		}(chain, items)
-	}
-	wg.Wait()
-	if queryErr != nil {
-		return nil, errors.Wrap(err, "failed on query item bids")
-	}
-
-	//8、获取collection基本信息
-	collections, err := serverCtx.Dao.QueryMultiChainCollectionsInfo(ctx, collectionAddrs)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on query collections info")
-	}
+	//6、并发获取collection基本信息和用户item挂单信息
+	group := newLoaderGroup(2)
 	collcetionInfoMap := make(map[string]multi.Collection)
-	for _, coll := range collections {
-		collcetionInfoMap[strings.ToLower(coll.Address)] = coll
-	}
-
-	//9、获取用户item挂单信息
-	listings, err := serverCtx.Dao.QueryMultiChainUserItemsExpireListInfo(ctx, userAddrs, itemInfos)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on query item list info")
-	}
+	group.Go(func() error {
+		collections, err := serverCtx.Dao.QueryMultiChainCollectionsInfo(ctx, collectionAddrs)
+		if err != nil {
+			return errors.Wrap(err, "failed on query collections info")
+		}
+		for _, coll := range collections {
+			collcetionInfoMap[strings.ToLower(coll.Address)] = coll
+		}
+		return nil
+	})
 	listingInfoMap := make(map[string]*dao.CollectionItem)
-	for _, list := range listings {
-		listingInfoMap[strings.ToLower(list.CollectionAddress+list.TokenId)] = list
+	group.Go(func() error {
+		listings, err := serverCtx.Dao.QueryMultiChainUserItemsExpireListInfo(ctx, userAddrs, itemInfos)
+		if err != nil {
+			return errors.Wrap(err, "failed on query item list info")
+		}
+		for _, list := range listings {
+			listingInfoMap[strings.ToLower(list.CollectionAddress+list.TokenId)] = list
+		}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return nil, err
 	}
 
-	//10、查询挂单订单信息
-	var itemPrice []entity.MultiChainItemPriceInfo
+	//7、批量加载出价信息、挂单订单信息和图片信息
+	loader := newItemLoader(ctx, serverCtx, userAddr)
+	for _, item := range items {
+		loader.Add(chainIdToChainNameMap[item.ChainID], item.CollectionAddress, item.TokenID)
+	}
 	for _, item := range listingInfoMap {
 		if item.Listing {
-			itemPrice = append(itemPrice, entity.MultiChainItemPriceInfo{
-				ItemPriceInfo: entity.ItemPriceInfo{
-					CollectionAddress: item.CollectionAddress,
-					TokenId:           item.TokenId,
-					Maker:             item.Owner,
-					Price:             item.ListPrice,
-					OrderStatus:       item.OrderStatus,
-				},
-				ChainName: chainIdToChainNameMap[item.ChainId],
+			loader.AddListing(chainIdToChainNameMap[item.ChainId], entity.ItemPriceInfo{
+				CollectionAddress: item.CollectionAddress,
+				TokenId:           item.TokenId,
+				Maker:             item.Owner,
+				Price:             item.ListPrice,
+				OrderStatus:       item.OrderStatus,
 			})
 		}
 	}
-
-	orderIdMap := make(map[string]multi.Order)
-	if len(itemPrice) > 0 {
-		orders, err := serverCtx.Dao.QueryMultiChainListingInfo(ctx, itemPrice)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed on query item order id")
-		}
-		for _, order := range orders {
-			orderIdMap[strings.ToLower(order.CollectionAddress+order.TokenId)] = order
-		}
+	if err := loader.Load(loadItemImage | loadItemBestBid | loadItemListing); err != nil {
+		return nil, errors.Wrap(err, "failed on load items info")
 	}
 
-	//11、查询item图片信息
-	itemExternals, err := serverCtx.Dao.QueryMultiChainCollectionsItemsImage(ctx, itemInfos)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on query item external info")
-	}
-	itemExternalMap := make(map[string]multi.ItemExternal)
-	for _, item := range itemExternals {
-		itemExternalMap[strings.ToLower(item.CollectionAddress+item.TokenId)] = item
-	}
-
-	//12、组装最终结果
+	//8、组装最终结果
 	for _, item := range items {
+		chain := chainIdToChainNameMap[item.ChainID]
 		var resultlisting entity.Listing
 		listing, ok := listingInfoMap[strings.ToLower(item.CollectionAddress+item.TokenID)]
 		if ok {
@@ -589,49 +393,21 @@ func GetMultiChainUserListings(ctx context.Context, serverCtx *svc.ServerCtx, ch
 				CollectionAddress: item.CollectionAddress,
 				TokenID:           item.TokenID,
 			},
-			ChainName: chainIdToChainNameMap[item.ChainID],
+			ChainName: chain,
 		}]
 
 		// 设置出价信息 - 优先使用Item出价,如果没有则使用Collection出价
-		bidOrder, ok := itemsBestBids[entity.MultiChainItemInfo{
-			ItemInfo: entity.ItemInfo{
-				CollectionAddress: strings.ToLower(item.CollectionAddress),
-				TokenID:           item.TokenID,
-			},
-			ChainName: chainIdToChainNameMap[item.ChainID],
-		}]
+		bidOrder, ok := loader.BestBid(chain, item.CollectionAddress, item.TokenID)
 		if ok {
-			if bidOrder.Price.GreaterThan(collectionBestBids[entity.MultichainCollection{
-				CollectionAddress: strings.ToLower(item.CollectionAddress),
-				Chain:             chainIdToChainNameMap[item.ChainID],
-			}].Price) {
-				resultlisting.BidOrderID = bidOrder.OrderID
-				resultlisting.BidExpireTime = bidOrder.ExpireTime
-				resultlisting.BidPrice = bidOrder.Price
-				resultlisting.BidTime = bidOrder.EventTime
-				resultlisting.BidSalt = bidOrder.Salt
-				resultlisting.BidMaker = bidOrder.Maker
-				resultlisting.BidType = getBidType(bidOrder.OrderType)
-				resultlisting.BidSize = bidOrder.Size
-				resultlisting.BidUnfilled = bidOrder.QuantityRemaining
-			}
-		} else {
-			bidOrder, ok := collectionBestBids[entity.MultichainCollection{
-				CollectionAddress: strings.ToLower(item.CollectionAddress),
-				Chain:             chainIdToChainNameMap[item.ChainID],
-			}]
-
-			if ok {
-				resultlisting.BidOrderID = bidOrder.OrderID
-				resultlisting.BidExpireTime = bidOrder.ExpireTime
-				resultlisting.BidPrice = bidOrder.Price
-				resultlisting.BidTime = bidOrder.EventTime
-				resultlisting.BidSalt = bidOrder.Salt
-				resultlisting.BidMaker = bidOrder.Maker
-				resultlisting.BidType = getBidType(bidOrder.OrderType)
-				resultlisting.BidSize = bidOrder.Size
-				resultlisting.BidUnfilled = bidOrder.QuantityRemaining
-			}
+			resultlisting.BidOrderID = bidOrder.OrderID
+			resultlisting.BidExpireTime = bidOrder.ExpireTime
+			resultlisting.BidPrice = bidOrder.Price
+			resultlisting.BidTime = bidOrder.EventTime
+			resultlisting.BidSalt = bidOrder.Salt
+			resultlisting.BidMaker = bidOrder.Maker
+			resultlisting.BidType = getBidType(bidOrder.OrderType)
+			resultlisting.BidSize = bidOrder.Size
+			resultlisting.BidUnfilled = bidOrder.QuantityRemaining
 		}
 		//设置collection信息
 		collection, ok := collcetionInfoMap[strings.ToLower(item.CollectionAddress)]
@@ -643,7 +419,7 @@ func GetMultiChainUserListings(ctx context.Context, serverCtx *svc.ServerCtx, ch
 			}
 		}
 		//设置订单信息
-		order, ok := orderIdMap[strings.ToLower(item.CollectionAddress+item.TokenID)]
+		order, ok := loader.ListingOrder(chain, item.CollectionAddress, item.TokenID)
 		if ok {
 			resultlisting.ListOrderID = order.OrderID
 			resultlisting.ListExpireTime = order.ExpireTime
@@ -651,19 +427,17 @@ func GetMultiChainUserListings(ctx context.Context, serverCtx *svc.ServerCtx, ch
 			resultlisting.ListSalt = order.Salt
 		}
 		//设置图片信息
-		itemExternal, ok := itemExternalMap[strings.ToLower(item.CollectionAddress+item.TokenID)]
+		itemExternal, ok := loader.Image(chain, item.CollectionAddress, item.TokenID)
 		if ok {
-			if itemExternal.IsUploadedOss {
-				resultlisting.ImageURI = itemExternal.OssUri
-			} else {
-				resultlisting.ImageURI = itemExternal.ImageUri
-			}
+			resultlisting.ImageURI = itemImageURI(itemExternal)
 		}
+		resultlisting.Incomplete = loader.Err(chain, item.CollectionAddress, item.TokenID) != nil
 		result = append(result, resultlisting)
 	}
 	return &entity.UserListingsResp{
-		Result: result,
-		Count:  count,
+		Result:     result,
+		Count:      count,
+		NextCursor: dao.NextPortfolioItemCursor(items, pageSize),
 	}, nil
 }
 
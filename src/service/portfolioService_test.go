@@ -0,0 +1,22 @@
+package service
+
+import (
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"testing"
+)
+
+func TestGetBidType(t *testing.T) {
+	tests := []struct {
+		orderType int64
+		want      int64
+	}{
+		{orderType: multi.CollectionBidOrder, want: 0},
+		{orderType: multi.ItemBidOrder, want: 1},
+		{orderType: multi.ListingOrder, want: multi.ListingOrder},
+	}
+	for _, tt := range tests {
+		if got := getBidType(tt.orderType); got != tt.want {
+			t.Errorf("getBidType(%d) = %d, want %d", tt.orderType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPriceAlertInterval   = 30
+	defaultPriceAlertHysteresis = "0.02"
+	defaultPriceAlertMaxPerUser = 50
+)
+
+// 价格提醒任务锁 cache:<项目名>:lock:price-alert
+func genPriceAlertLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:price-alert", strings.ToLower(project))
+}
+
+var priceAlertTypes = map[string]bool{
+	dao.PriceAlertFloorAbove:      true,
+	dao.PriceAlertFloorBelow:      true,
+	dao.PriceAlertBidAbove:        true,
+	dao.PriceAlertBidBelow:        true,
+	dao.PriceAlertItemListedBelow: true,
+}
+
+func isAboveAlert(alertType string) bool {
+	return alertType == dao.PriceAlertFloorAbove || alertType == dao.PriceAlertBidAbove
+}
+
+func toPriceAlertInfo(alert *dao.PriceAlert) entity.PriceAlertInfo {
+	return entity.PriceAlertInfo{
+		Id:                alert.Id,
+		ChainID:           alert.ChainId,
+		CollectionAddress: alert.CollectionAddress,
+		TokenID:           alert.TokenId,
+		AlertType:         alert.AlertType,
+		Threshold:         alert.Threshold,
+		WebhookId:         alert.WebhookId,
+		Enable:            alert.Enable,
+		Triggered:         alert.Triggered,
+		LastValue:         alert.LastValue,
+		LastTriggerTime:   alert.LastTriggerTime,
+		CreateTime:        alert.CreateTime,
+	}
+}
+
+// 校验价格提醒参数
+func checkPriceAlertParam(ctx context.Context, serverCtx *svc.ServerCtx, owners []string, param *entity.PriceAlertParam) error {
+	if _, ok := utils.ChainIdToChain[param.ChainID]; !ok {
+		return errors.Errorf("unsupported chain id: %d", param.ChainID)
+	}
+	if param.CollectionAddress == "" {
+		return errors.New("collection address is empty")
+	}
+	if !priceAlertTypes[param.AlertType] {
+		return errors.Errorf("unsupported alert type: %s", param.AlertType)
+	}
+	if param.AlertType == dao.PriceAlertItemListedBelow && param.TokenID == "" {
+		return errors.New("token id is required for item alert")
+	}
+	if !param.Threshold.IsPositive() {
+		return errors.New("threshold must be positive")
+	}
+	if param.WebhookId > 0 {
+		webhook, err := serverCtx.Dao.QueryUserWebhook(ctx, owners, param.WebhookId)
+		if err != nil {
+			return errors.Wrap(err, "failed on query webhook")
+		}
+		if webhook == nil {
+			return errors.New("webhook not exist")
+		}
+	}
+	return nil
+}
+
+// CreatePriceAlert 新增价格提醒
+func CreatePriceAlert(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, param entity.PriceAlertParam) (*entity.PriceAlertInfo, error) {
+	owners := lowerAddresses(userAddrs)
+	//1、校验参数
+	if err := checkPriceAlertParam(ctx, serverCtx, owners, &param); err != nil {
+		return nil, err
+	}
+	//2、校验数量上限
+	maxPerUser := defaultPriceAlertMaxPerUser
+	if cfg := serverCtx.C.PriceAlert; cfg != nil && cfg.MaxPerUser > 0 {
+		maxPerUser = cfg.MaxPerUser
+	}
+	count, err := serverCtx.Dao.CountUserPriceAlerts(ctx, owners)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on count price alerts")
+	}
+	if count >= int64(maxPerUser) {
+		return nil, errors.New("too many price alerts")
+	}
+	//3、保存规则
+	now := time.Now().Unix()
+	alert := &dao.PriceAlert{
+		Owner:             owners[0],
+		ChainId:           param.ChainID,
+		CollectionAddress: strings.ToLower(param.CollectionAddress),
+		TokenId:           param.TokenID,
+		AlertType:         param.AlertType,
+		Threshold:         param.Threshold,
+		WebhookId:         param.WebhookId,
+		Enable:            param.Enable == nil || *param.Enable,
+		CreateTime:        now,
+		UpdateTime:        now,
+	}
+	if alert.AlertType != dao.PriceAlertItemListedBelow {
+		alert.TokenId = ""
+	}
+	if err := serverCtx.Dao.AddPriceAlert(ctx, alert); err != nil {
+		return nil, errors.Wrap(err, "failed on add price alert")
+	}
+	info := toPriceAlertInfo(alert)
+	return &info, nil
+}
+
+// GetUserPriceAlerts 查询用户的价格提醒
+func GetUserPriceAlerts(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string) ([]entity.PriceAlertInfo, error) {
+	alerts, err := serverCtx.Dao.QueryUserPriceAlerts(ctx, lowerAddresses(userAddrs))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query user price alerts")
+	}
+	infos := make([]entity.PriceAlertInfo, 0, len(alerts))
+	for i := range alerts {
+		infos = append(infos, toPriceAlertInfo(&alerts[i]))
+	}
+	return infos, nil
+}
+
+// UpdatePriceAlert 修改价格提醒的类型、阈值、webhook和开关，集合和item不可修改
+func UpdatePriceAlert(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, id int64, param entity.PriceAlertParam) error {
+	owners := lowerAddresses(userAddrs)
+	alert, err := serverCtx.Dao.QueryUserPriceAlert(ctx, owners, id)
+	if err != nil {
+		return errors.Wrap(err, "failed on query price alert")
+	}
+	if alert == nil {
+		return errors.New("price alert not exist")
+	}
+	param.ChainID = alert.ChainId
+	param.CollectionAddress = alert.CollectionAddress
+	param.TokenID = alert.TokenId
+	if err := checkPriceAlertParam(ctx, serverCtx, owners, &param); err != nil {
+		return err
+	}
+	alert.AlertType = param.AlertType
+	alert.Threshold = param.Threshold
+	alert.WebhookId = param.WebhookId
+	if param.Enable != nil {
+		alert.Enable = *param.Enable
+	}
+	alert.UpdateTime = time.Now().Unix()
+	return serverCtx.Dao.UpdatePriceAlert(ctx, alert)
+}
+
+// DeletePriceAlert 删除价格提醒
+func DeletePriceAlert(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, id int64) error {
+	alert, err := serverCtx.Dao.QueryUserPriceAlert(ctx, lowerAddresses(userAddrs), id)
+	if err != nil {
+		return errors.Wrap(err, "failed on query price alert")
+	}
+	if alert == nil {
+		return errors.New("price alert not exist")
+	}
+	return serverCtx.Dao.DeletePriceAlert(ctx, id)
+}
+
+// StartPriceAlert 启动价格提醒检查任务
+// 定时查询规则涉及的地板价、集合最高出价和item挂单价，价格越过阈值时触发一次，
+// 触发后价格需回到阈值另一侧超过回差比例才重新生效。触发结果写入站内通知，配置了webhook时同时推送
+func StartPriceAlert(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.PriceAlert
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultPriceAlertInterval
+	}
+	hysteresis, err := decimal.NewFromString(cfg.Hysteresis)
+	if err != nil {
+		hysteresis = decimal.RequireFromString(defaultPriceAlertHysteresis)
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lock := cached.NewRedisLock(serverCtx.KvStore, genPriceAlertLockKey(serverCtx.C.ProjectCfg.Name), interval*3)
+			ok, err := lock.Acquire()
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on acquire price alert lock", zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if err := evaluatePriceAlerts(ctx, serverCtx, hysteresis); err != nil {
+				xzap.WithContext(ctx).Error("failed on evaluate price alerts", zap.Error(err))
+			}
+			if err := lock.Release(); err != nil {
+				xzap.WithContext(ctx).Error("failed on release price alert lock", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 单次检查中查询到的价格，同一集合只查询一次
+type priceAlertValues struct {
+	values map[string]decimal.Decimal
+}
+
+func (v *priceAlertValues) get(ctx context.Context, serverCtx *svc.ServerCtx, chain string, alert *dao.PriceAlert) (decimal.Decimal, error) {
+	key := fmt.Sprintf("%s:%s:%s", chain, alert.CollectionAddress, alert.AlertType)
+	if alert.AlertType == dao.PriceAlertItemListedBelow {
+		key += ":" + alert.TokenId
+	}
+	if value, ok := v.values[key]; ok {
+		return value, nil
+	}
+	var value decimal.Decimal
+	switch alert.AlertType {
+	case dao.PriceAlertFloorAbove, dao.PriceAlertFloorBelow:
+		floorPrice, _, err := serverCtx.Dao.QueryFloorPrice(ctx, chain, alert.CollectionAddress)
+		if err != nil {
+			return value, errors.Wrap(err, "failed on query floor price")
+		}
+		value = floorPrice
+	case dao.PriceAlertBidAbove, dao.PriceAlertBidBelow:
+		bestBid, err := serverCtx.Dao.QueryCollectionBestBid(ctx, chain, alert.CollectionAddress, "")
+		if err != nil {
+			return value, errors.Wrap(err, "failed on query best bid")
+		}
+		value = bestBid.Price
+	case dao.PriceAlertItemListedBelow:
+		item, err := serverCtx.Dao.QueryItemListInfo(ctx, chain, alert.CollectionAddress, alert.TokenId)
+		if err != nil {
+			return value, errors.Wrap(err, "failed on query item list info")
+		}
+		if item.Listing {
+			value = item.ListPrice
+		}
+	}
+	v.values[key] = value
+	return value, nil
+}
+
+// 根据当前价格计算规则是否触发以及新的触发状态
+// 价格为0表示没有挂单或出价，此时不触发并重新生效
+func evaluatePriceAlert(alert *dao.PriceAlert, value, hysteresis decimal.Decimal) (fire bool, triggered bool) {
+	if value.IsZero() {
+		return false, false
+	}
+	var met, rearm bool
+	if isAboveAlert(alert.AlertType) {
+		met = value.GreaterThan(alert.Threshold)
+		rearm = value.LessThanOrEqual(alert.Threshold.Mul(decimal.NewFromInt(1).Sub(hysteresis)))
+	} else {
+		met = value.LessThan(alert.Threshold)
+		rearm = value.GreaterThanOrEqual(alert.Threshold.Mul(decimal.NewFromInt(1).Add(hysteresis)))
+	}
+	if !alert.Triggered {
+		return met, met
+	}
+	return false, !rearm
+}
+
+// 触发时生成的通知和webhook投递
+func buildPriceAlertEvents(alert *dao.PriceAlert, value decimal.Decimal, now int64) (*dao.Notification, *dao.WebhookDelivery, error) {
+	notification := &dao.Notification{
+		Address:           alert.Owner,
+		ChainId:           alert.ChainId,
+		NotifyType:        dao.NotificationPriceAlert,
+		CollectionAddress: alert.CollectionAddress,
+		TokenId:           alert.TokenId,
+		Price:             value,
+		DedupKey:          fmt.Sprintf("%s:%d:%d", dao.NotificationPriceAlert, alert.Id, now),
+		EventTime:         now,
+		CreateTime:        now,
+		UpdateTime:        now,
+	}
+	if alert.WebhookId <= 0 {
+		return notification, nil, nil
+	}
+	event := entity.WebhookEvent{
+		Id:        fmt.Sprintf("%s-%d-%d", dao.NotificationPriceAlert, alert.Id, now),
+		EventType: dao.NotificationPriceAlert,
+		ChainID:   alert.ChainId,
+		EventTime: now,
+		Data: entity.PriceAlertEvent{
+			AlertId:           alert.Id,
+			AlertType:         alert.AlertType,
+			ChainID:           alert.ChainId,
+			CollectionAddress: alert.CollectionAddress,
+			TokenID:           alert.TokenId,
+			Threshold:         alert.Threshold,
+			Value:             value,
+		},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed on marshal price alert event")
+	}
+	return notification, &dao.WebhookDelivery{
+		WebhookId:     alert.WebhookId,
+		EventId:       event.Id,
+		EventType:     event.EventType,
+		Payload:       string(payload),
+		Status:        dao.WebhookDeliveryPending,
+		NextRetryTime: now,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}, nil
+}
+
+// 检查所有生效的价格提醒，单条规则失败时跳过，不影响其他规则
+func evaluatePriceAlerts(ctx context.Context, serverCtx *svc.ServerCtx, hysteresis decimal.Decimal) error {
+	alerts, err := serverCtx.Dao.QueryEnabledPriceAlerts(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed on query enabled price alerts")
+	}
+	values := &priceAlertValues{values: make(map[string]decimal.Decimal)}
+	now := time.Now().Unix()
+	for i := range alerts {
+		alert := &alerts[i]
+		chain, ok := utils.ChainIdToChain[alert.ChainId]
+		if !ok {
+			continue
+		}
+		//1、查询当前价格并计算触发状态
+		value, err := values.get(ctx, serverCtx, chain, alert)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on get price alert value", zap.Error(err),
+				zap.Int64("alert_id", alert.Id))
+			continue
+		}
+		fire, triggered := evaluatePriceAlert(alert, value, hysteresis)
+		if triggered == alert.Triggered && !fire {
+			continue
+		}
+
+		//2、触发时生成通知和webhook投递
+		var notification *dao.Notification
+		var delivery *dao.WebhookDelivery
+		if fire {
+			notification, delivery, err = buildPriceAlertEvents(alert, value, now)
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on build price alert events", zap.Error(err),
+					zap.Int64("alert_id", alert.Id))
+				continue
+			}
+		}
+
+		//3、触发状态与通知、webhook投递在同一事务中保存，避免状态已更新但通知丢失
+		alert.Triggered = triggered
+		alert.LastValue = value
+		if fire {
+			alert.LastTriggerTime = now
+		}
+		err = serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			d := serverCtx.Dao.WithTx(tx)
+			if err := d.UpdatePriceAlertState(ctx, alert); err != nil {
+				return errors.Wrap(err, "failed on update price alert state")
+			}
+			if notification != nil {
+				if err := d.AddNotifications(ctx, []dao.Notification{*notification}); err != nil {
+					return errors.Wrap(err, "failed on add price alert notification")
+				}
+			}
+			if delivery != nil {
+				if err := d.AddWebhookDeliveries(ctx, []dao.WebhookDelivery{*delivery}); err != nil {
+					return errors.Wrap(err, "failed on add price alert webhook delivery")
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on save price alert state", zap.Error(err),
+				zap.Int64("alert_id", alert.Id))
+			continue
+		}
+		if notification != nil {
+			if err := serverCtx.Cached.DelNotificationUnread(notification.Address); err != nil {
+				xzap.WithContext(ctx).Error("failed on delete notification unread cache", zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
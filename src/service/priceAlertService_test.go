@@ -0,0 +1,61 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestEvaluatePriceAlert(t *testing.T) {
+	hysteresis := decimal.RequireFromString("0.02")
+	tests := []struct {
+		name          string
+		alertType     string
+		triggered     bool
+		value         string
+		wantFire      bool
+		wantTriggered bool
+	}{
+		{name: "below fires", alertType: dao.PriceAlertFloorBelow, value: "0.9", wantFire: true, wantTriggered: true},
+		{name: "below not met", alertType: dao.PriceAlertFloorBelow, value: "1.1"},
+		{name: "below stays triggered inside hysteresis", alertType: dao.PriceAlertFloorBelow, triggered: true, value: "1.01", wantTriggered: true},
+		{name: "below rearms past hysteresis", alertType: dao.PriceAlertFloorBelow, triggered: true, value: "1.02"},
+		{name: "below does not fire twice", alertType: dao.PriceAlertFloorBelow, triggered: true, value: "0.5", wantTriggered: true},
+		{name: "above fires", alertType: dao.PriceAlertBidAbove, value: "1.5", wantFire: true, wantTriggered: true},
+		{name: "above equal does not fire", alertType: dao.PriceAlertBidAbove, value: "1"},
+		{name: "above rearms past hysteresis", alertType: dao.PriceAlertBidAbove, triggered: true, value: "0.98"},
+		{name: "zero value rearms", alertType: dao.PriceAlertFloorBelow, triggered: true, value: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &dao.PriceAlert{AlertType: tt.alertType, Threshold: decimal.NewFromInt(1), Triggered: tt.triggered}
+			fire, triggered := evaluatePriceAlert(alert, decimal.RequireFromString(tt.value), hysteresis)
+			if fire != tt.wantFire || triggered != tt.wantTriggered {
+				t.Errorf("got fire=%v triggered=%v, want fire=%v triggered=%v", fire, triggered, tt.wantFire, tt.wantTriggered)
+			}
+		})
+	}
+}
+
+func TestBuildPriceAlertEvents(t *testing.T) {
+	alert := &dao.PriceAlert{Id: 7, Owner: "0xabc", ChainId: 11155111, AlertType: dao.PriceAlertFloorBelow}
+	notification, delivery, err := buildPriceAlertEvents(alert, decimal.NewFromInt(1), 100)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if notification.Address != "0xabc" || notification.DedupKey != "price_alert:7:100" {
+		t.Errorf("notification = %+v", notification)
+	}
+	if delivery != nil {
+		t.Error("alert without webhook should not produce delivery")
+	}
+
+	alert.WebhookId = 3
+	_, delivery, err = buildPriceAlertEvents(alert, decimal.NewFromInt(1), 100)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if delivery == nil || delivery.WebhookId != 3 || delivery.EventId != "price_alert-7-100" || delivery.Status != dao.WebhookDeliveryPending {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
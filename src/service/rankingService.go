@@ -10,126 +10,141 @@ import (
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 const MinuteSeconds = 60
 const HourSeconds = 60 * 60
 const DaySeconds = 3600 * 24
 
-// 获取指定链上的NFT集合排名信息
-func GetTopRanking(ctx context.Context, serverCtx *svc.ServerCtx, chain string, period string, limit int64) ([]*entity.CollectionRankingInfo, error) {
-	//1、获取集合交易排行榜信息
-	collectionTradeInfos, err := serverCtx.Dao.GetCollectionRankingByActivity(chain, period)
-	if err != nil {
-		xzap.WithContext(ctx).Error("failed on get collection trade info", zap.Error(err))
-	}
-	//将数据构建成map结构
-	collectionTradeMap := make(map[string]dao.CollectionTrade)
-	for _, trade := range collectionTradeInfos {
-		collectionTradeMap[strings.ToLower(trade.ContractAddress)] = *trade
-	}
+// 排行榜时间段对应的秒数
+var rankingPeriods = map[string]int64{
+	"15m": MinuteSeconds * 15,
+	"1h":  HourSeconds,
+	"6h":  HourSeconds * 6,
+	"1d":  DaySeconds,
+	"7d":  DaySeconds * 7,
+	"30d": DaySeconds * 30,
+}
 
-	//2、时间段映射
-	periodTime := map[string]int64{
-		"15m": MinuteSeconds * 15,
-		"1h":  HourSeconds,
-		"6h":  HourSeconds * 6,
-		"1d":  DaySeconds,
-		"7d":  DaySeconds * 7,
-		"30d": DaySeconds * 30,
-	}
+// 计算排行榜所需的集合数据，同一条链的各时间段共用
+type rankingChainData struct {
+	collections []multi.Collection
+	sellPrices  map[string]decimal.Decimal
+	listed      map[string]int
+}
 
-	//3、获取地板价变化信息
-	collectionFloorChangeMap, err := serverCtx.Dao.QueryCollectionFloorChange(chain, periodTime[period])
-	if err != nil {
-		xzap.WithContext(ctx).Error("failed on get collection floor change", zap.Error(err))
+// 查询链上所有集合的基本信息、最近成交价和上架数量
+func loadRankingChainData(ctx context.Context, serverCtx *svc.ServerCtx, chain string) (*rankingChainData, error) {
+	data := &rankingChainData{
+		sellPrices: make(map[string]decimal.Decimal),
+		listed:     make(map[string]int),
 	}
-	// 并发控制
-	var wg sync.WaitGroup
-	var queryErr error
+	group := &errgroup.Group{}
 
-	//4.1、并发获取集合销售价格信息
-	collectionSellsMap := make(map[string]multi.Collection)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		collections, err := serverCtx.Dao.QueryCollectionsSellPrice(ctx, chain)
+	//1、并发获取集合销售价格信息
+	group.Go(func() error {
+		collections, err := serverCtx.Dao.QueryCollectionsSellPrice(ctx, chain, nil)
 		if err != nil {
 			xzap.WithContext(ctx).Error("failed on get all collections info", zap.Error(err))
-			queryErr = errcode.NewCustomErr("failed on get all collections info")
-			return
+			return errcode.NewCustomErr("failed on get all collections info")
 		}
 		for _, collection := range collections {
-			collectionSellsMap[strings.ToLower(collection.Address)] = collection
+			data.sellPrices[strings.ToLower(collection.Address)] = collection.SalePrice
 		}
-	}()
-	//4.2、并发获取所有集合的基本信息
-	var allCollection []multi.Collection
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		allCollection, err = serverCtx.Dao.QueryAllCollectionInfo(ctx, chain)
+		return nil
+	})
+	//2、并发获取所有集合的基本信息
+	group.Go(func() error {
+		collections, err := serverCtx.Dao.QueryAllCollectionInfo(ctx, chain)
 		if err != nil {
 			xzap.WithContext(ctx).Error("failed on get all collections info", zap.Error(err))
-			queryErr = errcode.NewCustomErr("failed on get all collections info")
-			return
+			return errcode.NewCustomErr("failed on get all collections info")
 		}
-	}()
-	//等待所有查询结束
-	wg.Wait()
-	if queryErr != nil {
-		return nil, queryErr
+		data.collections = collections
+		return nil
+	})
+	//等待所有查询结束，返回第一个错误
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	//3、获取上架数量
+	addrs := make([]string, 0, len(data.collections))
+	for _, collection := range data.collections {
+		addrs = append(addrs, collection.Address)
+	}
+	listed, err := serverCtx.Dao.QueryCollectionsListed(ctx, chain, addrs)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on query collection listed", zap.Error(err))
+	}
+	for _, l := range listed {
+		data.listed[strings.ToLower(l.CollectionAddr)] = l.Count
+	}
+	return data, nil
+}
+
+// 计算指定时间段的排名信息，未按任何指标排序
+func computeRanking(ctx context.Context, serverCtx *svc.ServerCtx, chain, period string, data *rankingChainData) []*entity.CollectionRankingInfo {
+	//1、获取集合交易排行榜信息
+	collectionTradeInfos, err := serverCtx.Dao.GetCollectionRankingByActivity(ctx, chain, period)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get collection trade info", zap.Error(err))
+	}
+	//将数据构建成map结构
+	collectionTradeMap := make(map[string]dao.CollectionTrade)
+	for _, trade := range collectionTradeInfos {
+		collectionTradeMap[strings.ToLower(trade.ContractAddress)] = *trade
 	}
 
-	//5、构建返回结果
+	//2、获取地板价变化信息
+	collectionFloorChangeMap, err := serverCtx.Dao.QueryCollectionFloorChange(ctx, chain, nil, rankingPeriods[period])
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get collection floor change", zap.Error(err))
+	}
+
+	//3、构建返回结果
 	var result []*entity.CollectionRankingInfo
-	for _, collection := range allCollection {
+	for i := range data.collections {
+		collection := &data.collections[i]
+		key := strings.ToLower(collection.Address)
 		var floorPriceChange float64
 		var volume decimal.Decimal
-		var sellPrice decimal.Decimal
 		var sales int64
 		//获取集合交易信息
-		trade, ok := collectionTradeMap[strings.ToLower(collection.Address)]
+		trade, ok := collectionTradeMap[key]
 		if ok {
-			floorPriceChange = collectionFloorChangeMap[strings.ToLower(collection.Address)]
+			floorPriceChange = collectionFloorChangeMap[key]
 			volume = trade.Volume
 			sales = trade.ItemCount
 		}
-		//获取集合销售价格信息
-		sellInfo, ok := collectionSellsMap[strings.ToLower(collection.Address)]
-		if ok {
-			sellPrice = sellInfo.SalePrice
-		}
-		//获取上架数量
-		var listAmount int
-		listed, err := serverCtx.Dao.QueryCollectionsListed(chain, []string{collection.Address})
-		if err != nil {
-			xzap.WithContext(ctx).Error("failed on query collection listed", zap.Error(err))
-		} else {
-			listAmount = listed[0].Count
-		}
 		//构建单个集合的排名信息
-		result = append(result, &entity.CollectionRankingInfo{
-			Name:        collection.Name,
-			Address:     collection.Address,
-			ImageUri:    collection.ImageUri,
-			FloorPrice:  collection.FloorPrice.String(),
-			FloorChange: strconv.FormatFloat(floorPriceChange, 'f', 4, 32),
-			SellPrice:   sellPrice.String(),
-			Volume:      volume,
-			ItemSold:    sales,
-			ItemNum:     collection.ItemAmount,
-			ItemOwner:   collection.OwnerAmount,
-			ListAmount:  listAmount,
-			ChainID:     collection.ChainId,
-		})
+		result = append(result, toCollectionRankingInfo(ctx, serverCtx, chain, collection,
+			floorPriceChange, volume, data.sellPrices[key], sales, data.listed[key]))
 	}
-	//6、限制返回数量
-	if limit < int64(len(result)) {
-		result = result[:limit]
+	return result
+}
+
+// 构建单个集合的排名信息，排行榜和关注列表共用
+func toCollectionRankingInfo(ctx context.Context, serverCtx *svc.ServerCtx, chain string, collection *multi.Collection,
+	floorPriceChange float64, volume, sellPrice decimal.Decimal, sales int64, listAmount int) *entity.CollectionRankingInfo {
+	return &entity.CollectionRankingInfo{
+		Name:        collection.Name,
+		Address:     collection.Address,
+		ImageUri:    collection.ImageUri,
+		FloorPrice:  collection.FloorPrice.String(),
+		FloorChange: strconv.FormatFloat(floorPriceChange, 'f', 4, 32),
+		SellPrice:   sellPrice.String(),
+		Volume:      volume,
+		ItemSold:    sales,
+		ItemNum:     collection.ItemAmount,
+		ItemOwner:   collection.OwnerAmount,
+		ListAmount:  listAmount,
+		ChainID:     collection.ChainId,
+		// 美元价格
+		FloorPriceUsd: serverCtx.Prices.OptionalUsd(ctx, chain, collection.FloorPrice),
+		VolumeUsd:     serverCtx.Prices.OptionalUsd(ctx, chain, volume),
 	}
-	return result, err
 }
@@ -0,0 +1,320 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRankingInterval = 60
+	rankingWriteBatchSize  = 500
+	rankingSortVolume      = "volume"
+	rankingSortSales       = "sales"
+	rankingSortFloorChange = "floor_change"
+	rankingSortOwners      = "owners"
+	maxRankingScore        = 1<<53 - 1 // 有序集合的分数为双精度浮点数，超过2^53的整数无法精确表示
+
+	MaxRankingLimit = 100 // 排行榜每页最大数量
+	MaxRankingPage  = 100 // 排行榜最大页数，每条链最多读取MaxRankingLimit*MaxRankingPage个集合
+)
+
+// 排行榜排序指标，有序集合的分数为整数，成交额精确到1e-6，地板价变化精确到1e-4
+// 分数相同时按集合地址降序，与Zrevrange的顺序一致
+var rankingScores = map[string]func(info *entity.CollectionRankingInfo) int64{
+	rankingSortVolume: func(info *entity.CollectionRankingInfo) int64 {
+		return rankingVolumeScore(info.Volume)
+	},
+	rankingSortSales: func(info *entity.CollectionRankingInfo) int64 {
+		return info.ItemSold
+	},
+	rankingSortFloorChange: func(info *entity.CollectionRankingInfo) int64 {
+		change, _ := strconv.ParseFloat(info.FloorChange, 64)
+		return int64(change * 10000)
+	},
+	rankingSortOwners: func(info *entity.CollectionRankingInfo) int64 {
+		return info.ItemOwner
+	},
+}
+
+// 成交额精确到1e-6，超过2^53时截断，1e-6精度下约90亿ETH以内可精确排序
+func rankingVolumeScore(volume decimal.Decimal) int64 {
+	score := volume.Shift(6).IntPart()
+	if score > maxRankingScore {
+		return maxRankingScore
+	}
+	return score
+}
+
+// 按分数降序排序，分数相同时按集合地址降序
+func sortRankingInfos(infos []*entity.CollectionRankingInfo, score func(info *entity.CollectionRankingInfo) int64) {
+	sort.SliceStable(infos, func(i, j int) bool {
+		si, sj := score(infos[i]), score(infos[j])
+		if si != sj {
+			return si > sj
+		}
+		return strings.ToLower(infos[i].Address) > strings.ToLower(infos[j].Address)
+	})
+}
+
+// IsValidRankingSort 是否为支持的排行榜排序指标
+func IsValidRankingSort(sortBy string) bool {
+	_, ok := rankingScores[sortBy]
+	return ok
+}
+
+// 排行榜快照生成锁 cache:<项目名>:lock:ranking-snapshot
+func genRankingLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:ranking-snapshot", strings.ToLower(project))
+}
+
+// 当前快照版本 cache:<项目名>:ranking:<链名>:<时间段>:version
+func genRankingVersionKey(project, chain, period string) string {
+	return fmt.Sprintf("cache:%s:ranking:%s:%s:version", strings.ToLower(project), chain, period)
+}
+
+// 按指标排序的集合地址 cache:<项目名>:ranking:<链名>:<时间段>:<指标>:<版本>
+func genRankingScoreKey(project, chain, period, sortBy string, version int64) string {
+	return fmt.Sprintf("cache:%s:ranking:%s:%s:%s:%d", strings.ToLower(project), chain, period, sortBy, version)
+}
+
+// 集合的排名信息 cache:<项目名>:ranking:<链名>:<时间段>:info:<版本>
+func genRankingInfoKey(project, chain, period string, version int64) string {
+	return fmt.Sprintf("cache:%s:ranking:%s:%s:info:%d", strings.ToLower(project), chain, period, version)
+}
+
+// StartRankingSnapshot 启动排行榜快照生成
+// 定时按链和时间段计算集合排名，按成交额、成交数量、地板价变化、持有人数分别写入有序集合，
+// 排名信息写入hash。每次生成新版本的key，写完后切换版本，旧版本的key自动过期。
+// 多副本部署时通过Redis锁保证同一时刻只有一个实例在生成
+func StartRankingSnapshot(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.Ranking
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultRankingInterval
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		lock := cached.NewRedisLock(serverCtx.KvStore, genRankingLockKey(serverCtx.C.ProjectCfg.Name), interval*10)
+		ok, err := lock.Acquire()
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on acquire ranking snapshot lock", zap.Error(err))
+		} else if ok {
+			for _, chain := range serverCtx.C.ChainSupported {
+				if err := buildRankingSnapshots(ctx, serverCtx, chain.Name, interval*5); err != nil {
+					xzap.WithContext(ctx).Error("failed on build ranking snapshots", zap.Error(err), zap.String("chain", chain.Name))
+				}
+			}
+			if err := lock.Release(); err != nil {
+				xzap.WithContext(ctx).Error("failed on release ranking snapshot lock", zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 生成一条链所有时间段的排行榜快照
+func buildRankingSnapshots(ctx context.Context, serverCtx *svc.ServerCtx, chain string, expire int) error {
+	data, err := loadRankingChainData(ctx, serverCtx, chain)
+	if err != nil {
+		return errors.Wrap(err, "failed on load ranking data")
+	}
+	version := time.Now().Unix()
+	for period := range rankingPeriods {
+		infos := computeRanking(ctx, serverCtx, chain, period, data)
+		if err := writeRankingSnapshot(serverCtx, chain, period, infos, version, expire); err != nil {
+			return errors.Wrapf(err, "failed on write %s ranking snapshot", period)
+		}
+	}
+	return nil
+}
+
+// 写入新版本的快照并切换版本
+func writeRankingSnapshot(serverCtx *svc.ServerCtx, chain, period string, infos []*entity.CollectionRankingInfo, version int64, expire int) error {
+	project := serverCtx.C.ProjectCfg.Name
+	//1、写入排名信息
+	infoKey := genRankingInfoKey(project, chain, period, version)
+	fields := make(map[string]string)
+	for _, info := range infos {
+		value, err := json.Marshal(info)
+		if err != nil {
+			return errors.Wrap(err, "failed on marshal ranking info")
+		}
+		fields[strings.ToLower(info.Address)] = string(value)
+		if len(fields) >= rankingWriteBatchSize {
+			if err := serverCtx.KvStore.Hmset(infoKey, fields); err != nil {
+				return errors.Wrap(err, "failed on set ranking info")
+			}
+			fields = make(map[string]string)
+		}
+	}
+	if len(fields) > 0 {
+		if err := serverCtx.KvStore.Hmset(infoKey, fields); err != nil {
+			return errors.Wrap(err, "failed on set ranking info")
+		}
+	}
+	if err := serverCtx.KvStore.Expire(infoKey, expire); err != nil {
+		return errors.Wrap(err, "failed on expire ranking info")
+	}
+
+	//2、按各指标写入有序集合
+	for sortBy, score := range rankingScores {
+		scoreKey := genRankingScoreKey(project, chain, period, sortBy, version)
+		for i := 0; i < len(infos); i += rankingWriteBatchSize {
+			end := i + rankingWriteBatchSize
+			if end > len(infos) {
+				end = len(infos)
+			}
+			pairs := make([]redis.Pair, 0, end-i)
+			for _, info := range infos[i:end] {
+				pairs = append(pairs, redis.Pair{Key: strings.ToLower(info.Address), Score: score(info)})
+			}
+			if _, err := serverCtx.KvStore.Zadds(scoreKey, pairs...); err != nil {
+				return errors.Wrap(err, "failed on add ranking scores")
+			}
+		}
+		if err := serverCtx.KvStore.Expire(scoreKey, expire); err != nil {
+			return errors.Wrap(err, "failed on expire ranking scores")
+		}
+	}
+
+	//3、切换版本
+	versionKey := genRankingVersionKey(project, chain, period)
+	if err := serverCtx.KvStore.Setex(versionKey, strconv.FormatInt(version, 10), expire); err != nil {
+		return errors.Wrap(err, "failed on set ranking version")
+	}
+	return nil
+}
+
+// 读取快照中按指标排序的前count个集合，没有快照时返回false
+func readRankingSnapshot(serverCtx *svc.ServerCtx, chain, period, sortBy string, count int) ([]*entity.CollectionRankingInfo, int64, bool, error) {
+	project := serverCtx.C.ProjectCfg.Name
+	//1、获取当前版本
+	value, err := serverCtx.KvStore.Get(genRankingVersionKey(project, chain, period))
+	if err != nil {
+		return nil, 0, false, errors.Wrap(err, "failed on get ranking version")
+	}
+	if value == "" {
+		return nil, 0, false, nil
+	}
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, 0, false, nil
+	}
+
+	//2、按指标取前count个集合地址及其排名信息
+	addrs, err := serverCtx.KvStore.Zrevrange(genRankingScoreKey(project, chain, period, sortBy, version), 0, int64(count-1))
+	if err != nil {
+		return nil, 0, false, errors.Wrap(err, "failed on get ranking")
+	}
+	if len(addrs) == 0 {
+		return nil, version, true, nil
+	}
+	values, err := serverCtx.KvStore.Hmget(genRankingInfoKey(project, chain, period, version), addrs...)
+	if err != nil {
+		return nil, 0, false, errors.Wrap(err, "failed on get ranking info")
+	}
+	infos := make([]*entity.CollectionRankingInfo, 0, len(values))
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		var info entity.CollectionRankingInfo
+		if err := json.Unmarshal([]byte(value), &info); err != nil {
+			return nil, 0, false, errors.Wrap(err, "failed on unmarshal ranking info")
+		}
+		infos = append(infos, &info)
+	}
+	return infos, version, true, nil
+}
+
+// GetCollectionRanking 分页查询多条链合并的集合排行榜
+// 1. 优先读取排行榜快照，每条链只读取当前页及之前的数据
+// 2. 没有快照的链实时计算
+// 3. updated_at为参与排名的快照中最早的生成时间，全部实时计算时为0
+func GetCollectionRanking(ctx context.Context, serverCtx *svc.ServerCtx, chains []string, period, sortBy string, page, limit int) (*entity.CollectionRankingResp, error) {
+	if limit > MaxRankingLimit {
+		limit = MaxRankingLimit
+	}
+	if page > MaxRankingPage {
+		page = MaxRankingPage
+	}
+	count := page * limit
+	score := rankingScores[sortBy]
+
+	//1、并发获取每条链的前count个集合
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var queryErr error
+	var allResult []*entity.CollectionRankingInfo
+	var updatedAt int64
+	for _, chain := range chains {
+		wg.Add(1)
+		go func(chain string) {
+			defer wg.Done()
+			result, version, ok, err := readRankingSnapshot(serverCtx, chain, period, sortBy, count)
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on read ranking snapshot", zap.Error(err), zap.String("chain", chain))
+			}
+			if !ok {
+				//快照不存在或读取失败时实时计算
+				data, err := loadRankingChainData(ctx, serverCtx, chain)
+				if err != nil {
+					mu.Lock()
+					queryErr = err
+					mu.Unlock()
+					return
+				}
+				result = computeRanking(ctx, serverCtx, chain, period, data)
+			}
+			mu.Lock()
+			allResult = append(allResult, result...)
+			if ok && (updatedAt == 0 || version < updatedAt) {
+				updatedAt = version
+			}
+			mu.Unlock()
+		}(chain)
+	}
+	wg.Wait()
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	//2、合并后按指标降序排序并分页
+	sortRankingInfos(allResult, score)
+	offset := (page - 1) * limit
+	if offset > len(allResult) {
+		offset = len(allResult)
+	}
+	end := offset + limit
+	if end > len(allResult) {
+		end = len(allResult)
+	}
+	return &entity.CollectionRankingResp{
+		Result:    allResult[offset:end],
+		UpdatedAt: updatedAt,
+	}, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/entity"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestRankingVolumeScore(t *testing.T) {
+	tests := []struct {
+		volume string
+		want   int64
+	}{
+		{volume: "0", want: 0},
+		{volume: "1.5", want: 1500000},
+		{volume: "0.0000019", want: 1},
+		{volume: "9007199254.740991", want: maxRankingScore},
+		{volume: "100000000000", want: maxRankingScore},
+	}
+	for _, tt := range tests {
+		if got := rankingVolumeScore(decimal.RequireFromString(tt.volume)); got != tt.want {
+			t.Errorf("rankingVolumeScore(%s) = %d, want %d", tt.volume, got, tt.want)
+		}
+		// 分数写入有序集合后转为float64，必须可以精确还原
+		if got := rankingVolumeScore(decimal.RequireFromString(tt.volume)); int64(float64(got)) != got {
+			t.Errorf("rankingVolumeScore(%s) = %d loses precision as float64", tt.volume, got)
+		}
+	}
+}
+
+func TestSortRankingInfos(t *testing.T) {
+	infos := []*entity.CollectionRankingInfo{
+		{Address: "0xa", ItemSold: 1},
+		{Address: "0xB", ItemSold: 2},
+		{Address: "0xc", ItemSold: 2},
+		{Address: "0xd", ItemSold: 0},
+	}
+	sortRankingInfos(infos, rankingScores[rankingSortSales])
+	want := []string{"0xc", "0xB", "0xa", "0xd"}
+	for i, info := range infos {
+		if info.Address != want[i] {
+			t.Fatalf("position %d = %s, want %s", i, info.Address, want[i])
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"go.uber.org/zap"
+	"time"
+)
+
+const defaultReplicaInterval = 5
+
+// StartReplicaLagCheck 启动从库复制延迟检查
+// 每个实例各自检查，延迟超过阈值或检查失败的从库不再分配查询，恢复后自动重新分配
+func StartReplicaLagCheck(ctx context.Context, serverCtx *svc.ServerCtx) {
+	resolver := serverCtx.Dao.Replicas
+	if resolver == nil {
+		return
+	}
+	interval := serverCtx.C.Replica.Interval
+	if interval <= 0 {
+		interval = defaultReplicaInterval
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, time.Duration(interval)*time.Second)
+		if err := resolver.CheckLag(checkCtx); err != nil {
+			xzap.WithContext(ctx).Error("failed on check replica lag", zap.Error(err))
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetReplicaStatus 查询本实例各从库的复制延迟和是否参与分配
+func GetReplicaStatus(serverCtx *svc.ServerCtx) []dao.ReplicaStatus {
+	if serverCtx.Dao.Replicas == nil {
+		return []dao.ReplicaStatus{}
+	}
+	return serverCtx.Dao.Replicas.Status()
+}
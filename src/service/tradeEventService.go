@@ -0,0 +1,56 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+// 订单事件频道 <项目名>:stream:trade-event
+// 所有发送给ordermanager的事件同时发布到该频道，供实时推送等功能订阅
+func genTradeEventChannel(project string) string {
+	return fmt.Sprintf("%s:stream:trade-event", strings.ToLower(project))
+}
+
+// 频道中的订单事件
+type tradeEventMessage struct {
+	Chain          string                 `json:"chain"`
+	CollectionAddr string                 `json:"collection_address"`
+	EventType      ordermanager.EventType `json:"event_type"`
+	OrderId        string                 `json:"order_id"`
+	TokenID        string                 `json:"token_id"`
+	Price          decimal.Decimal        `json:"price"`
+}
+
+// 发送订单事件给ordermanager，并发布到订单事件频道
+func addUpdatePriceEvent(ctx context.Context, serverCtx *svc.ServerCtx, chain string, event *ordermanager.TradeEvent) error {
+	if err := ordermanager.AddUpdatePriceEvent(serverCtx.KvStore, event, chain); err != nil {
+		return errors.Wrap(err, "failed on add update price event")
+	}
+	return publishTradeEvent(ctx, serverCtx, chain, event)
+}
+
+// 仅发布订单事件到频道，不发送给ordermanager
+// 未配置Broker时直接标记本实例上的集合需要刷新，只在单实例部署时能覆盖所有订阅
+func publishTradeEvent(ctx context.Context, serverCtx *svc.ServerCtx, chain string, event *ordermanager.TradeEvent) error {
+	if serverCtx.Broker == nil {
+		collectionHub.markDirty(chain, event.CollectionAddr)
+		return nil
+	}
+	err := serverCtx.Broker.Publish(ctx, genTradeEventChannel(serverCtx.C.ProjectCfg.Name), tradeEventMessage{
+		Chain:          chain,
+		CollectionAddr: event.CollectionAddr,
+		EventType:      event.EventType,
+		OrderId:        event.OrderId,
+		TokenID:        event.TokenID,
+		Price:          event.Price,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on publish trade event")
+	}
+	return nil
+}
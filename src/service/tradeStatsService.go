@@ -0,0 +1,224 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/svc"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTradeStatsInterval  = 10
+	defaultTradeStatsBatchSize = 1000
+	defaultTradeStatsBatches   = 20
+	defaultTradeStatsGapWindow = 1000
+)
+
+// 汇总位置已被其他实例推进，本批不累加
+var errTradeStatsCursorMoved = errors.New("trade stats cursor moved by another instance")
+
+// 成交统计汇总锁 cache:<项目名>:lock:trade-stats
+func genTradeStatsLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:trade-stats", strings.ToLower(project))
+}
+
+// StartTradeStatsRollup 启动成交统计汇总
+// 按id顺序读取新的activity，成交按集合、币种累加到5分钟时间桶，时间桶和汇总位置在同一事务中更新，
+// 各时间段的成交统计和排行榜由时间桶求和得到。首次运行时从头汇总历史成交，汇总到最新之前统计直接读取activity表。
+// id自增但提交顺序不固定，汇总位置之前的空缺id在gap_window内每次重新检查，之后提交的成交仍会计入。
+// 多副本部署时通过Redis锁避免多个实例同时汇总；锁在一轮汇总结束前过期时，汇总位置按读取时的值条件更新，
+// 已被其他实例推进时回滚本批，时间桶不会重复累加
+func StartTradeStatsRollup(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.TradeStats
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval, batchSize, batches, gapWindow := cfg.Interval, cfg.BatchSize, cfg.Batches, int64(cfg.GapWindow)
+	if interval <= 0 {
+		interval = defaultTradeStatsInterval
+	}
+	if batchSize <= 0 {
+		batchSize = defaultTradeStatsBatchSize
+	}
+	if batches <= 0 {
+		batches = defaultTradeStatsBatches
+	}
+	if gapWindow <= 0 {
+		gapWindow = defaultTradeStatsGapWindow
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lock := cached.NewRedisLock(serverCtx.KvStore, genTradeStatsLockKey(serverCtx.C.ProjectCfg.Name), interval*10)
+			ok, err := lock.Acquire()
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on acquire trade stats lock", zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			for _, chain := range serverCtx.C.ChainSupported {
+				//每次最多汇总batches批，未追上时下次继续
+				for i := 0; i < batches; i++ {
+					count, err := rollupTradeStats(ctx, serverCtx, chain.Name, batchSize, gapWindow)
+					if err != nil {
+						xzap.WithContext(ctx).Error("failed on rollup trade stats", zap.Error(err), zap.String("chain", chain.Name))
+						break
+					}
+					if count < batchSize {
+						break
+					}
+				}
+			}
+			if err := lock.Release(); err != nil {
+				xzap.WithContext(ctx).Error("failed on release trade stats lock", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 汇总一批新的activity以及之前空缺的activity，返回读取的新activity数量
+func rollupTradeStats(ctx context.Context, serverCtx *svc.ServerCtx, chain string, batchSize int, gapWindow int64) (int, error) {
+	//1、读取汇总位置，重新检查之前空缺的id
+	cursor, err := serverCtx.Dao.QueryTradeStatsCursor(ctx, chain)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on query trade stats cursor")
+	}
+	var gaps []int64
+	if cursor.Gaps != "" {
+		if err := json.Unmarshal([]byte(cursor.Gaps), &gaps); err != nil {
+			return 0, errors.Wrap(err, "invalid trade stats gaps")
+		}
+	}
+	found, err := serverCtx.Dao.QueryTradeStatsActivitiesByIds(ctx, chain, gaps)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on query gap activities")
+	}
+
+	//2、读取汇总位置之后的activity，计算新的汇总位置和空缺
+	activities, err := serverCtx.Dao.QueryTradeStatsActivitiesAfter(ctx, chain, cursor.LastId, batchSize)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on query activities")
+	}
+	foundIds := make(map[int64]bool, len(found))
+	for _, activity := range found {
+		foundIds[activity.Id] = true
+	}
+	ids := make([]int64, 0, len(activities))
+	for _, activity := range activities {
+		ids = append(ids, activity.Id)
+	}
+	gaps, lastId := nextTradeStatsGaps(gaps, foundIds, cursor.LastId, ids, gapWindow)
+	gapsValue, err := json.Marshal(gaps)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on marshal trade stats gaps")
+	}
+	next := &dao.TradeStatsCursor{Chain: chain, LastId: lastId, Gaps: string(gapsValue), CaughtUp: len(activities) < batchSize}
+
+	//3、累加时间桶并更新汇总位置，没有新成交时也更新，表示汇总仍在运行
+	// 汇总位置已被其他实例推进时回滚，时间桶不会重复累加
+	buckets := aggregateTradeStats(chain, append(found, activities...), time.Now().Unix())
+	err = serverCtx.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		d := serverCtx.Dao.WithTx(tx)
+		if err := d.AddTradeStatsBuckets(ctx, buckets); err != nil {
+			return err
+		}
+		ok, err := d.CompareAndSaveTradeStatsCursor(ctx, cursor, next)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errTradeStatsCursorMoved
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on save trade stats buckets")
+	}
+	return len(activities), nil
+}
+
+// 计算新的汇总位置和仍需检查的空缺id
+// 已找到的空缺移除，新读取的id之间的空缺加入，只保留距离新汇总位置gapWindow以内的空缺
+func nextTradeStatsGaps(gaps []int64, found map[int64]bool, lastId int64, ids []int64, gapWindow int64) ([]int64, int64) {
+	newLastId := lastId
+	if len(ids) > 0 {
+		newLastId = ids[len(ids)-1]
+	}
+	floor := newLastId - gapWindow
+	next := make([]int64, 0, len(gaps))
+	for _, id := range gaps {
+		if !found[id] && id > floor {
+			next = append(next, id)
+		}
+	}
+	prev := lastId
+	for _, id := range ids {
+		from := prev + 1
+		if from <= floor {
+			from = floor + 1
+		}
+		for gap := from; gap < id; gap++ {
+			next = append(next, gap)
+		}
+		prev = id
+	}
+	return next, newLastId
+}
+
+// 将成交按集合、币种和时间桶聚合，其他类型的activity忽略
+func aggregateTradeStats(chain string, activities []multi.Activity, now int64) []dao.TradeStatsBucket {
+	index := make(map[string]int)
+	var buckets []dao.TradeStatsBucket
+	for _, activity := range activities {
+		if activity.ActivityType != multi.Sale {
+			continue
+		}
+		bucketTime := dao.TradeStatsBucketOf(activity.EventTime)
+		collectionAddr := strings.ToLower(activity.CollectionAddress)
+		currencyAddr := strings.ToLower(activity.CurrencyAddress)
+		key := fmt.Sprintf("%s:%s:%d", collectionAddr, currencyAddr, bucketTime)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(buckets)
+			buckets = append(buckets, dao.TradeStatsBucket{
+				Chain:             chain,
+				CollectionAddress: collectionAddr,
+				CurrencyAddress:   currencyAddr,
+				BucketTime:        bucketTime,
+				ItemCount:         1,
+				Volume:            activity.Price,
+				MinPrice:          activity.Price,
+				MaxPrice:          activity.Price,
+				CreateTime:        now,
+				UpdateTime:        now,
+			})
+			continue
+		}
+		bucket := &buckets[i]
+		bucket.ItemCount++
+		bucket.Volume = bucket.Volume.Add(activity.Price)
+		if activity.Price.LessThan(bucket.MinPrice) {
+			bucket.MinPrice = activity.Price
+		}
+		if activity.Price.GreaterThan(bucket.MaxPrice) {
+			bucket.MaxPrice = activity.Price
+		}
+	}
+	return buckets
+}
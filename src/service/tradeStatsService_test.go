@@ -0,0 +1,63 @@
+package service
+
+import (
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/shopspring/decimal"
+	"reflect"
+	"testing"
+)
+
+func TestNextTradeStatsGaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		gaps       []int64
+		found      map[int64]bool
+		lastId     int64
+		ids        []int64
+		window     int64
+		wantGaps   []int64
+		wantLastId int64
+	}{
+		{name: "contiguous ids", lastId: 10, ids: []int64{11, 12, 13}, window: 100, wantGaps: []int64{}, wantLastId: 13},
+		{name: "holes become gaps", lastId: 10, ids: []int64{12, 15}, window: 100, wantGaps: []int64{11, 13, 14}, wantLastId: 15},
+		{name: "found gap is removed", gaps: []int64{11, 13}, found: map[int64]bool{11: true}, lastId: 15, ids: []int64{16},
+			window: 100, wantGaps: []int64{13}, wantLastId: 16},
+		{name: "gaps outside window are dropped", gaps: []int64{3}, lastId: 10, ids: []int64{20}, window: 5,
+			wantGaps: []int64{16, 17, 18, 19}, wantLastId: 20},
+		{name: "no new ids keeps position", gaps: []int64{9}, lastId: 10, window: 100, wantGaps: []int64{9}, wantLastId: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gaps, lastId := nextTradeStatsGaps(tt.gaps, tt.found, tt.lastId, tt.ids, tt.window)
+			if !reflect.DeepEqual(gaps, tt.wantGaps) || lastId != tt.wantLastId {
+				t.Errorf("got (%v, %d), want (%v, %d)", gaps, lastId, tt.wantGaps, tt.wantLastId)
+			}
+		})
+	}
+}
+
+func TestAggregateTradeStats(t *testing.T) {
+	sale := func(id int64, collection, price string, eventTime int64) multi.Activity {
+		return multi.Activity{Id: id, ActivityType: multi.Sale, CollectionAddress: collection,
+			Price: decimal.RequireFromString(price), EventTime: eventTime}
+	}
+	activities := []multi.Activity{
+		sale(1, "0xABC", "2", 600),
+		sale(2, "0xabc", "1", 899),
+		sale(3, "0xabc", "5", 900),
+		{Id: 4, ActivityType: multi.Listing, CollectionAddress: "0xabc", Price: decimal.NewFromInt(1), EventTime: 600},
+	}
+	buckets := aggregateTradeStats("sepolia", activities, 1000)
+	if len(buckets) != 2 {
+		t.Fatalf("buckets = %d, want 2", len(buckets))
+	}
+	first := buckets[0]
+	if first.CollectionAddress != "0xabc" || first.BucketTime != 600 || first.ItemCount != 2 ||
+		!first.Volume.Equal(decimal.NewFromInt(3)) || !first.MinPrice.Equal(decimal.NewFromInt(1)) ||
+		!first.MaxPrice.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("first bucket = %+v", first)
+	}
+	if buckets[1].BucketTime != 900 || buckets[1].ItemCount != 1 || !buckets[1].MaxPrice.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("second bucket = %+v", buckets[1])
+	}
+}
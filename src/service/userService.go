@@ -1,6 +1,7 @@
 package service
 
 import (
+	"EasySwapBackend-test/src/dao"
 	"EasySwapBackend-test/src/entity"
 	"EasySwapBackend-test/src/middleware"
 	"EasySwapBackend-test/src/svc"
@@ -82,9 +83,9 @@ func UserLogin(ctx context.Context, serverCtx *svc.ServerCtx, req entity.LoginRe
 		return nil, errcode.ErrTokenExpire
 	}
 
-	//从数据库查询用户信息
+	//从主库查询用户信息，从库延迟时会重复创建用户
 	var user base.User
-	db := serverCtx.DB.WithContext(ctx).Table(base.UserTableName()).
+	db := serverCtx.DB.WithContext(dao.WithPrimary(ctx)).Table(base.UserTableName()).
 		Select("id,address,is_allowed").
 		Where("address = ?", req.Address).
 		Find(&user)
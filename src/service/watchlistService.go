@@ -0,0 +1,217 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"context"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	maxWatchlistSize        = 500
+	watchlistQueryParallels = 8
+)
+
+// AddWatchlist 关注集合或item
+func AddWatchlist(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, param entity.WatchlistParam) error {
+	owners := lowerAddresses(userAddrs)
+	//1、校验链和集合、item是否存在
+	chain, ok := utils.ChainIdToChain[param.ChainID]
+	if !ok {
+		return errors.Errorf("unsupported chain id: %d", param.ChainID)
+	}
+	collectionAddr := strings.ToLower(param.CollectionAddress)
+	collection, err := serverCtx.Dao.QueryCollectionInfo(ctx, chain, collectionAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed on query collection info")
+	}
+	if collection.Address == "" {
+		return errors.New("collection not exist")
+	}
+	if param.TokenID != "" {
+		item, err := serverCtx.Dao.QueryItemInfo(ctx, chain, collectionAddr, param.TokenID)
+		if err != nil {
+			return errors.Wrap(err, "failed on query item info")
+		}
+		if item.TokenId == "" {
+			return errors.New("item not exist")
+		}
+	}
+	//2、校验数量上限
+	count, err := serverCtx.Dao.CountUserWatchlist(ctx, owners)
+	if err != nil {
+		return errors.Wrap(err, "failed on count watchlist")
+	}
+	if count >= maxWatchlistSize {
+		return errors.New("too many watchlist entries")
+	}
+	//3、保存
+	now := time.Now().Unix()
+	return serverCtx.Dao.AddWatchlist(ctx, &dao.Watchlist{
+		Owner:             owners[0],
+		ChainId:           param.ChainID,
+		CollectionAddress: collectionAddr,
+		TokenId:           param.TokenID,
+		CreateTime:        now,
+		UpdateTime:        now,
+	})
+}
+
+// RemoveWatchlist 取消关注，未关注时直接返回
+func RemoveWatchlist(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, param entity.WatchlistParam) error {
+	_, err := serverCtx.Dao.RemoveWatchlist(ctx, lowerAddresses(userAddrs), param.ChainID,
+		strings.ToLower(param.CollectionAddress), param.TokenID)
+	if err != nil {
+		return errors.Wrap(err, "failed on remove watchlist")
+	}
+	return nil
+}
+
+// 关注列表中每条链共用的集合数据
+type watchlistChainData struct {
+	floorChange map[string]float64
+	sellPrices  map[string]decimal.Decimal
+}
+
+// GetWatchlist 查询用户的关注列表
+// 1. 关注的集合补充地板价、地板价变化、24小时交易额、上架数量等信息，与排行榜一致
+// 2. 关注的item补充挂单价、最高出价等信息，与item详情一致
+func GetWatchlist(ctx context.Context, serverCtx *svc.ServerCtx, userAddrs []string, filter entity.WatchlistFilterParam) (*entity.WatchlistResp, error) {
+	//1、查询关注列表
+	watchlist, err := serverCtx.Dao.QueryUserWatchlist(ctx, lowerAddresses(userAddrs), filter.ChainIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query watchlist")
+	}
+
+	//2、查询关注集合的地板价变化和最高出价，只统计关注的集合
+	chainData := make(map[string]*watchlistChainData)
+	for chain, collectionAddrs := range watchlistCollectionsByChain(watchlist) {
+		data := &watchlistChainData{sellPrices: make(map[string]decimal.Decimal)}
+		data.floorChange, err = serverCtx.Dao.QueryCollectionFloorChange(ctx, chain, collectionAddrs, DaySeconds)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on get collection floor change", zap.Error(err))
+		}
+		collections, err := serverCtx.Dao.QueryCollectionsSellPrice(ctx, chain, collectionAddrs)
+		if err != nil {
+			xzap.WithContext(ctx).Error("failed on get collections sell price", zap.Error(err))
+		}
+		for _, collection := range collections {
+			data.sellPrices[strings.ToLower(collection.Address)] = collection.SalePrice
+		}
+		chainData[chain] = data
+	}
+
+	//3、并发补充每一项的详细信息，单项失败时标记为不可用，不影响其他项
+	entries := fillWatchlistEntries(ctx, watchlist, func(chain string, entry *entity.WatchlistEntry) error {
+		var err error
+		if entry.TokenID == "" {
+			entry.Collection, err = getWatchlistCollection(ctx, serverCtx, chain, entry.CollectionAddress, chainData[chain])
+		} else {
+			entry.Item, err = getWatchlistItem(ctx, serverCtx, chain, entry.ChainID, entry.CollectionAddress, entry.TokenID)
+		}
+		return err
+	})
+	return &entity.WatchlistResp{Result: entries}, nil
+}
+
+// 按链汇总关注的集合地址，不支持的链和item关注不计入
+func watchlistCollectionsByChain(watchlist []dao.Watchlist) map[string][]string {
+	collections := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, watch := range watchlist {
+		chain, ok := utils.ChainIdToChain[watch.ChainId]
+		if !ok || watch.TokenId != "" {
+			continue
+		}
+		addr := strings.ToLower(watch.CollectionAddress)
+		if seen[chain+":"+addr] {
+			continue
+		}
+		seen[chain+":"+addr] = true
+		collections[chain] = append(collections[chain], addr)
+	}
+	return collections
+}
+
+// 并发补充关注列表每一项的详细信息
+// fill失败时记录日志并将该项标记为不可用，不支持的链直接标记为不可用
+func fillWatchlistEntries(ctx context.Context, watchlist []dao.Watchlist, fill func(chain string, entry *entity.WatchlistEntry) error) []entity.WatchlistEntry {
+	entries := make([]entity.WatchlistEntry, len(watchlist))
+	group := newLoaderGroup(watchlistQueryParallels)
+	for i, watch := range watchlist {
+		entries[i] = entity.WatchlistEntry{
+			Id:                watch.Id,
+			ChainID:           watch.ChainId,
+			CollectionAddress: watch.CollectionAddress,
+			TokenID:           watch.TokenId,
+			CreateTime:        watch.CreateTime,
+		}
+		chain, ok := utils.ChainIdToChain[watch.ChainId]
+		if !ok {
+			entries[i].Unavailable = true
+			continue
+		}
+		entry := &entries[i]
+		group.Go(func() error {
+			if err := fill(chain, entry); err != nil {
+				xzap.WithContext(ctx).Error("failed on get watchlist info",
+					zap.Int64("watchlist_id", entry.Id), zap.Error(err))
+				entry.Collection, entry.Item = nil, nil
+				entry.Unavailable = true
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+	return entries
+}
+
+// 查询关注集合的排行榜信息
+func getWatchlistCollection(ctx context.Context, serverCtx *svc.ServerCtx, chain, collectionAddr string, data *watchlistChainData) (*entity.CollectionRankingInfo, error) {
+	//1、集合基本信息
+	collection, err := serverCtx.Dao.QueryCollectionInfo(ctx, chain, collectionAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection info")
+	}
+	//2、24小时交易信息
+	var volume decimal.Decimal
+	var sales int64
+	tradeInfo, err := serverCtx.Dao.GetTradeInfoByCollection(ctx, chain, collectionAddr, "1d")
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get collection trade info", zap.Error(err))
+	} else {
+		volume = tradeInfo.Volume
+		sales = tradeInfo.ItemCount
+	}
+	//3、上架数量
+	var listAmount int
+	listed, err := serverCtx.Dao.QueryCollectionsListed(ctx, chain, []string{collectionAddr})
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on query collection listed", zap.Error(err))
+	} else {
+		listAmount = listed[0].Count
+	}
+	key := strings.ToLower(collectionAddr)
+	return toCollectionRankingInfo(ctx, serverCtx, chain, collection,
+		data.floorChange[key], volume, data.sellPrices[key], sales, listAmount), nil
+}
+
+// 查询关注item的详情
+func getWatchlistItem(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId int, collectionAddr, tokenId string) (*entity.ItemDetailInfo, error) {
+	res, err := GetItemDetail(ctx, serverCtx, chain, chainId, collectionAddr, tokenId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get item detail")
+	}
+	itemDetail, ok := res.Result.(entity.ItemDetailInfo)
+	if !ok {
+		return nil, errors.New("unexpected item detail")
+	}
+	return &itemDetail, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWatchlistCollectionsByChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		watchlist []dao.Watchlist
+		want      map[string][]string
+	}{
+		{name: "empty", want: map[string][]string{}},
+		{
+			name: "collections grouped per chain, deduplicated case-insensitively",
+			watchlist: []dao.Watchlist{
+				{ChainId: 1, CollectionAddress: "0xA"},
+				{ChainId: 11155111, CollectionAddress: "0xB"},
+				{ChainId: 1, CollectionAddress: "0xa"},
+				{ChainId: 1, CollectionAddress: "0xC"},
+			},
+			want: map[string][]string{"eth": {"0xa", "0xc"}, "sepolia": {"0xb"}},
+		},
+		{
+			name: "items and unsupported chains skipped",
+			watchlist: []dao.Watchlist{
+				{ChainId: 1, CollectionAddress: "0xA", TokenId: "1"},
+				{ChainId: 999, CollectionAddress: "0xB"},
+			},
+			want: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := watchlistCollectionsByChain(tt.watchlist); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("watchlistCollectionsByChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillWatchlistEntriesPartial(t *testing.T) {
+	watchlist := []dao.Watchlist{
+		{Id: 1, ChainId: 1, CollectionAddress: "0xa"},
+		{Id: 2, ChainId: 1, CollectionAddress: "0xb"},
+		{Id: 3, ChainId: 1, CollectionAddress: "0xa", TokenId: "7"},
+		{Id: 4, ChainId: 999, CollectionAddress: "0xc"},
+	}
+	entries := fillWatchlistEntries(context.Background(), watchlist, func(chain string, entry *entity.WatchlistEntry) error {
+		if chain != "eth" {
+			t.Errorf("chain = %s, want eth", chain)
+		}
+		if entry.TokenID != "" {
+			entry.Item = &entity.ItemDetailInfo{TokenID: entry.TokenID}
+			return nil
+		}
+		entry.Collection = &entity.CollectionRankingInfo{Address: entry.CollectionAddress}
+		if entry.CollectionAddress == "0xb" {
+			return errors.New("query failed")
+		}
+		return nil
+	})
+
+	if len(entries) != len(watchlist) {
+		t.Fatalf("len(entries) = %d, want %d", len(entries), len(watchlist))
+	}
+	for i, entry := range entries {
+		if entry.Id != watchlist[i].Id {
+			t.Errorf("entries[%d].Id = %d, want %d", i, entry.Id, watchlist[i].Id)
+		}
+	}
+	if entries[0].Unavailable || entries[0].Collection == nil {
+		t.Errorf("entries[0] = %+v, want collection filled", entries[0])
+	}
+	if !entries[1].Unavailable || entries[1].Collection != nil {
+		t.Errorf("entries[1] = %+v, want unavailable without partial collection", entries[1])
+	}
+	if entries[2].Unavailable || entries[2].Item == nil {
+		t.Errorf("entries[2] = %+v, want item filled", entries[2])
+	}
+	if !entries[3].Unavailable {
+		t.Errorf("entries[3] = %+v, want unavailable for unsupported chain", entries[3])
+	}
+}
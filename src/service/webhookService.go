@@ -0,0 +1,529 @@
+package service
+
+import (
+	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"EasySwapBackend-test/src/svc"
+	"EasySwapBackend-test/src/utils"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookInterval    = 5
+	defaultWebhookBatchSize   = 200
+	defaultWebhookWorkers     = 8
+	defaultWebhookTimeout     = 10
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookBaseBackoff = 30
+	defaultWebhookMaxBackoff  = 3600
+	webhookMaxErrorLength     = 512
+)
+
+// webhook任务锁 cache:<项目名>:lock:webhook
+func genWebhookLockKey(project string) string {
+	return fmt.Sprintf("cache:%s:lock:webhook", strings.ToLower(project))
+}
+
+// webhook已处理的activity游标 cache:<项目名>:<链名>:webhook:last-id
+func genWebhookLastIdKey(project, chain string) string {
+	return fmt.Sprintf("cache:%s:%s:webhook:last-id", strings.ToLower(project), chain)
+}
+
+// webhook签名：HMAC-SHA256(secret, "<timestamp>.<body>")的十六进制
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 一批投递记录的认领时长，按每个worker串行投递的最长耗时预留一轮余量
+func webhookClaimLease(batchSize, workers, timeout int) int64 {
+	rounds := (batchSize + workers - 1) / workers
+	return int64((rounds + 1) * timeout)
+}
+
+// 第attempts次失败后的重试间隔，按2的指数增长，不超过maxBackoff
+func retryBackoff(attempts, baseBackoff, maxBackoff int) int {
+	backoff := baseBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func splitWebhookFilter(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func toWebhookInfo(webhook *dao.Webhook) entity.WebhookInfo {
+	chainIds := []int{}
+	for _, id := range splitWebhookFilter(webhook.ChainIds) {
+		if chainId, err := strconv.Atoi(id); err == nil {
+			chainIds = append(chainIds, chainId)
+		}
+	}
+	return entity.WebhookInfo{
+		Id:                  webhook.Id,
+		Owner:               webhook.Owner,
+		Url:                 webhook.Url,
+		EventTypes:          splitWebhookFilter(webhook.EventTypes),
+		ChainIDs:            chainIds,
+		CollectionAddresses: splitWebhookFilter(webhook.CollectionAddresses),
+		WalletAddresses:     splitWebhookFilter(webhook.WalletAddresses),
+		Status:              webhook.Status,
+		CreateTime:          webhook.CreateTime,
+	}
+}
+
+// RegisterWebhook 注册webhook，返回的secret用于接收方校验签名，之后不再返回
+func RegisterWebhook(ctx context.Context, serverCtx *svc.ServerCtx, owner string, param entity.WebhookParam) (*entity.WebhookInfo, error) {
+	//1、校验参数，url只允许解析到公网地址，投递时连接前会再次校验
+	if err := utils.ValidatePublicUrl(ctx, param.Url); err != nil {
+		return nil, errors.Wrap(err, "invalid webhook url")
+	}
+	for _, eventType := range param.EventTypes {
+		if !dao.IsActivityEventType(eventType) {
+			return nil, errors.Errorf("unsupported event type: %s", eventType)
+		}
+	}
+	var chainIds []string
+	for _, chainId := range param.ChainIDs {
+		if _, ok := utils.ChainIdToChain[chainId]; !ok {
+			return nil, errors.Errorf("unsupported chain id: %d", chainId)
+		}
+		chainIds = append(chainIds, strconv.Itoa(chainId))
+	}
+	var collectionAddrs, walletAddrs []string
+	for _, addr := range param.CollectionAddresses {
+		collectionAddrs = append(collectionAddrs, strings.ToLower(addr))
+	}
+	for _, addr := range param.WalletAddresses {
+		walletAddrs = append(walletAddrs, strings.ToLower(addr))
+	}
+
+	//2、生成签名秘钥
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "failed on generate webhook secret")
+	}
+
+	//3、保存订阅
+	now := time.Now().Unix()
+	webhook := &dao.Webhook{
+		Owner:               strings.ToLower(owner),
+		Url:                 param.Url,
+		Secret:              hex.EncodeToString(secret),
+		EventTypes:          strings.Join(param.EventTypes, ","),
+		ChainIds:            strings.Join(chainIds, ","),
+		CollectionAddresses: strings.Join(collectionAddrs, ","),
+		WalletAddresses:     strings.Join(walletAddrs, ","),
+		Status:              dao.WebhookStatusActive,
+		CreateTime:          now,
+		UpdateTime:          now,
+	}
+	if err := serverCtx.Dao.AddWebhook(ctx, webhook); err != nil {
+		return nil, errors.Wrap(err, "failed on add webhook")
+	}
+	info := toWebhookInfo(webhook)
+	info.Secret = webhook.Secret
+	return &info, nil
+}
+
+// GetUserWebhooks 查询用户注册的webhook
+func GetUserWebhooks(ctx context.Context, serverCtx *svc.ServerCtx, owners []string) ([]entity.WebhookInfo, error) {
+	webhooks, err := serverCtx.Dao.QueryUserWebhooks(ctx, lowerAddresses(owners))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query user webhooks")
+	}
+	infos := make([]entity.WebhookInfo, 0, len(webhooks))
+	for i := range webhooks {
+		infos = append(infos, toWebhookInfo(&webhooks[i]))
+	}
+	return infos, nil
+}
+
+// DeleteWebhook 删除用户的webhook
+func DeleteWebhook(ctx context.Context, serverCtx *svc.ServerCtx, owners []string, id int64) error {
+	webhook, err := serverCtx.Dao.QueryUserWebhook(ctx, lowerAddresses(owners), id)
+	if err != nil {
+		return errors.Wrap(err, "failed on query webhook")
+	}
+	if webhook == nil {
+		return errors.New("webhook not exist")
+	}
+	return serverCtx.Dao.DeleteWebhook(ctx, id)
+}
+
+// GetWebhookDeliveries 分页查询用户webhook的投递记录
+func GetWebhookDeliveries(ctx context.Context, serverCtx *svc.ServerCtx, owners []string, id int64, filter entity.WebhookDeliveryFilterParam) (*entity.WebhookDeliveryResp, error) {
+	webhook, err := serverCtx.Dao.QueryUserWebhook(ctx, lowerAddresses(owners), id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query webhook")
+	}
+	if webhook == nil {
+		return nil, errors.New("webhook not exist")
+	}
+	status := -1
+	if filter.Status != nil {
+		status = *filter.Status
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = 20
+	}
+	deliveries, count, err := serverCtx.Dao.QueryWebhookDeliveries(ctx, id, status, filter.Page, filter.PageSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query webhook deliveries")
+	}
+	infos := make([]entity.WebhookDeliveryInfo, 0, len(deliveries))
+	for _, d := range deliveries {
+		infos = append(infos, entity.WebhookDeliveryInfo{
+			Id:             d.Id,
+			EventId:        d.EventId,
+			EventType:      d.EventType,
+			Payload:        d.Payload,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			NextRetryTime:  d.NextRetryTime,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			CreateTime:     d.CreateTime,
+			UpdateTime:     d.UpdateTime,
+		})
+	}
+	return &entity.WebhookDeliveryResp{Result: infos, Count: count}, nil
+}
+
+func lowerAddresses(addrs []string) []string {
+	var lower []string
+	for _, addr := range addrs {
+		lower = append(lower, strings.ToLower(addr))
+	}
+	return lower
+}
+
+// 解析后的webhook过滤条件
+type webhookMatcher struct {
+	webhook     dao.Webhook
+	eventTypes  map[string]bool
+	chainIds    map[string]bool
+	collections map[string]bool
+	wallets     map[string]bool
+}
+
+func toFilterSet(value string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range splitWebhookFilter(value) {
+		set[v] = true
+	}
+	return set
+}
+
+func newWebhookMatcher(webhook dao.Webhook) *webhookMatcher {
+	return &webhookMatcher{
+		webhook:     webhook,
+		eventTypes:  toFilterSet(webhook.EventTypes),
+		chainIds:    toFilterSet(webhook.ChainIds),
+		collections: toFilterSet(webhook.CollectionAddresses),
+		wallets:     toFilterSet(webhook.WalletAddresses),
+	}
+}
+
+func (m *webhookMatcher) match(activity *entity.ActivityInfo) bool {
+	if len(m.eventTypes) > 0 && !m.eventTypes[activity.EventType] {
+		return false
+	}
+	if len(m.chainIds) > 0 && !m.chainIds[strconv.Itoa(activity.ChainID)] {
+		return false
+	}
+	if len(m.collections) > 0 && !m.collections[strings.ToLower(activity.CollectionAddress)] {
+		return false
+	}
+	if len(m.wallets) > 0 && !m.wallets[strings.ToLower(activity.Maker)] && !m.wallets[strings.ToLower(activity.Taker)] {
+		return false
+	}
+	return true
+}
+
+// StartWebhook 启动webhook推送任务
+// 1. 拉取各链新增的activity，按订阅的过滤条件生成投递记录，多副本部署时通过Redis锁保证同一时刻只有一个实例在拉取
+// 2. 认领并投递到期的记录，失败后按指数退避重试，超过最大次数进入死信。认领在数据库中原子完成，各实例可同时投递
+func StartWebhook(ctx context.Context, serverCtx *svc.ServerCtx) {
+	cfg := serverCtx.C.Webhook
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultWebhookInterval
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	client := utils.NewPublicHttpClient(time.Duration(timeout) * time.Second)
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 锁只保护activity游标，投递不在锁内执行
+			lock := cached.NewRedisLock(serverCtx.KvStore, genWebhookLockKey(serverCtx.C.ProjectCfg.Name), interval*3)
+			ok, err := lock.Acquire()
+			if err != nil {
+				xzap.WithContext(ctx).Error("failed on acquire webhook lock", zap.Error(err))
+			} else if ok {
+				if err := enqueueWebhookEvents(ctx, serverCtx); err != nil {
+					xzap.WithContext(ctx).Error("failed on enqueue webhook events", zap.Error(err))
+				}
+				if err := lock.Release(); err != nil {
+					xzap.WithContext(ctx).Error("failed on release webhook lock", zap.Error(err))
+				}
+			}
+			if err := deliverWebhooks(ctx, serverCtx, client, timeout); err != nil {
+				xzap.WithContext(ctx).Error("failed on deliver webhooks", zap.Error(err))
+			}
+		}
+	}
+}
+
+// 拉取各链新增的activity并生成投递记录
+func enqueueWebhookEvents(ctx context.Context, serverCtx *svc.ServerCtx) error {
+	webhooks, err := serverCtx.Dao.QueryActiveWebhooks(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed on query active webhooks")
+	}
+	var matchers []*webhookMatcher
+	for _, webhook := range webhooks {
+		matchers = append(matchers, newWebhookMatcher(webhook))
+	}
+	for _, supported := range serverCtx.C.ChainSupported {
+		if err := enqueueChainWebhookEvents(ctx, serverCtx, supported.Name, supported.ChainId, matchers); err != nil {
+			xzap.WithContext(ctx).Error("failed on enqueue chain webhook events", zap.Error(err),
+				zap.String("chain", supported.Name))
+		}
+	}
+	return nil
+}
+
+// 拉取指定链新增的activity并生成投递记录
+func enqueueChainWebhookEvents(ctx context.Context, serverCtx *svc.ServerCtx, chain string, chainId int, matchers []*webhookMatcher) error {
+	//1、读取游标，首次运行时从当前最大id开始，不推送历史数据
+	lastIdKey := genWebhookLastIdKey(serverCtx.C.ProjectCfg.Name, chain)
+	cursor, err := loadActivityCursor(ctx, serverCtx, chain, lastIdKey)
+	if err != nil || cursor == nil {
+		return err
+	}
+
+	//2、查询新增activity和之前空缺、现已提交的activity
+	activities, next, err := readActivitiesAfterCursor(ctx, serverCtx, chain, cursor, activityStreamBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(activities) == 0 {
+		return nil
+	}
+	if len(matchers) == 0 {
+		return saveActivityCursor(serverCtx, lastIdKey, next)
+	}
+	infos, err := serverCtx.Dao.QueryMultiChainActivityExternalInfo(ctx, []int{chainId}, []string{chain}, activities)
+	if err != nil {
+		return errors.Wrap(err, "failed on query activity external info")
+	}
+
+	//3、按订阅过滤条件生成投递记录
+	now := time.Now().Unix()
+	var deliveries []dao.WebhookDelivery
+	for i := range infos {
+		if i >= len(activities) {
+			break
+		}
+		event := entity.WebhookEvent{
+			Id:        fmt.Sprintf("%d-%d", chainId, activities[i].Id),
+			EventType: infos[i].EventType,
+			ChainID:   chainId,
+			EventTime: infos[i].EventTime,
+			Data:      infos[i],
+		}
+		var payload []byte
+		for _, m := range matchers {
+			if !m.match(&infos[i]) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(event); err != nil {
+					return errors.Wrap(err, "failed on marshal webhook event")
+				}
+			}
+			deliveries = append(deliveries, dao.WebhookDelivery{
+				WebhookId:     m.webhook.Id,
+				EventId:       event.Id,
+				EventType:     event.EventType,
+				Payload:       string(payload),
+				Status:        dao.WebhookDeliveryPending,
+				NextRetryTime: now,
+				CreateTime:    now,
+				UpdateTime:    now,
+			})
+		}
+	}
+
+	//4、保存投递记录并保存游标
+	if err := serverCtx.Dao.AddWebhookDeliveries(ctx, deliveries); err != nil {
+		return errors.Wrap(err, "failed on add webhook deliveries")
+	}
+	return saveActivityCursor(serverCtx, lastIdKey, next)
+}
+
+// 认领并并发投递到期的记录
+func deliverWebhooks(ctx context.Context, serverCtx *svc.ServerCtx, client *http.Client, timeout int) error {
+	cfg := serverCtx.C.Webhook
+	batchSize, workers := cfg.BatchSize, cfg.Workers
+	if batchSize <= 0 {
+		batchSize = defaultWebhookBatchSize
+	}
+	if workers <= 0 {
+		workers = defaultWebhookWorkers
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return errors.Wrap(err, "failed on generate claim token")
+	}
+	deliveries, err := serverCtx.Dao.ClaimDueWebhookDeliveries(ctx, hex.EncodeToString(token),
+		webhookClaimLease(batchSize, workers, timeout), batchSize)
+	if err != nil {
+		return errors.Wrap(err, "failed on claim webhook deliveries")
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	webhooks, err := serverCtx.Dao.QueryActiveWebhooks(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed on query active webhooks")
+	}
+	webhookMap := make(map[int64]dao.Webhook)
+	for _, webhook := range webhooks {
+		webhookMap[webhook.Id] = webhook
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i := range deliveries {
+		webhook, ok := webhookMap[deliveries[i].WebhookId]
+		if !ok {
+			// 认领后订阅被停用，保留记录不投递，重新启用后认领到期时再投递
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(webhook dao.Webhook, delivery *dao.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			deliverWebhook(ctx, serverCtx, client, &webhook, delivery)
+		}(webhook, &deliveries[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// 投递单条记录并更新投递结果
+func deliverWebhook(ctx context.Context, serverCtx *svc.ServerCtx, client *http.Client, webhook *dao.Webhook, delivery *dao.WebhookDelivery) {
+	cfg := serverCtx.C.Webhook
+	maxAttempts, baseBackoff, maxBackoff := cfg.MaxAttempts, cfg.BaseBackoff, cfg.MaxBackoff
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+	if baseBackoff <= 0 {
+		baseBackoff = defaultWebhookBaseBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultWebhookMaxBackoff
+	}
+
+	//1、发送请求
+	statusCode, err := postWebhook(ctx, client, webhook, delivery)
+
+	//2、记录结果，失败时按指数退避重试，超过最大次数进入死信
+	now := time.Now().Unix()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.UpdateTime = now
+	delivery.LastError = ""
+	if err == nil {
+		delivery.Status = dao.WebhookDeliverySucceeded
+	} else {
+		delivery.LastError = err.Error()
+		if len(delivery.LastError) > webhookMaxErrorLength {
+			delivery.LastError = delivery.LastError[:webhookMaxErrorLength]
+		}
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = dao.WebhookDeliveryDead
+		} else {
+			delivery.Status = dao.WebhookDeliveryPending
+			delivery.NextRetryTime = now + int64(retryBackoff(delivery.Attempts, baseBackoff, maxBackoff))
+		}
+	}
+	if err := serverCtx.Dao.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		xzap.WithContext(ctx).Error("failed on update webhook delivery", zap.Error(err),
+			zap.Int64("delivery_id", delivery.Id))
+	}
+}
+
+// 发送签名后的事件，非2xx响应视为失败
+func postWebhook(ctx context.Context, client *http.Client, webhook *dao.Webhook, delivery *dao.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on build webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(webhook.Id, 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", delivery.EventId)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on post webhook")
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
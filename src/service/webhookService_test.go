@@ -0,0 +1,79 @@
+package service
+
+import (
+	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/entity"
+	"testing"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// echo -n '1700000000.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	got := signWebhookPayload("secret", 1700000000, []byte(`{"id":"1"}`))
+	if got != "086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54" {
+		t.Fatalf("signature = %s", got)
+	}
+	if got == signWebhookPayload("secret", 1700000001, []byte(`{"id":"1"}`)) {
+		t.Fatal("signature should cover timestamp")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     int
+	}{
+		{attempts: 1, want: 30},
+		{attempts: 2, want: 60},
+		{attempts: 4, want: 240},
+		{attempts: 20, want: 3600},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempts, 30, 3600); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %d, want %d", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookClaimLease(t *testing.T) {
+	tests := []struct {
+		batchSize, workers, timeout int
+		want                        int64
+	}{
+		{batchSize: 200, workers: 8, timeout: 10, want: 260},
+		{batchSize: 201, workers: 8, timeout: 10, want: 270},
+		{batchSize: 1, workers: 8, timeout: 10, want: 20},
+	}
+	for _, tt := range tests {
+		if got := webhookClaimLease(tt.batchSize, tt.workers, tt.timeout); got != tt.want {
+			t.Errorf("webhookClaimLease(%d, %d, %d) = %d, want %d", tt.batchSize, tt.workers, tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookMatcher(t *testing.T) {
+	activity := &entity.ActivityInfo{
+		EventType:         "sale",
+		ChainID:           11155111,
+		CollectionAddress: "0xAbC",
+		Maker:             "0xMaker",
+		Taker:             "0xTaker",
+	}
+	tests := []struct {
+		name    string
+		webhook dao.Webhook
+		want    bool
+	}{
+		{name: "no filter", want: true},
+		{name: "event type matches", webhook: dao.Webhook{EventTypes: "listing,sale"}, want: true},
+		{name: "event type differs", webhook: dao.Webhook{EventTypes: "listing"}, want: false},
+		{name: "chain differs", webhook: dao.Webhook{ChainIds: "1"}, want: false},
+		{name: "collection ignores case", webhook: dao.Webhook{CollectionAddresses: "0xabc"}, want: true},
+		{name: "wallet as taker", webhook: dao.Webhook{WalletAddresses: "0xother,0xtaker"}, want: true},
+		{name: "wallet not involved", webhook: dao.Webhook{WalletAddresses: "0xother"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := newWebhookMatcher(tt.webhook).match(activity); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package svc
 
 import (
 	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/chain"
 	"EasySwapBackend-test/src/dao"
 	"github.com/ProjectsTask/EasySwapBase/evm/erc"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
@@ -18,6 +19,7 @@ type CtxConfig struct {
 	KvStore *xkv.Store
 	Cached  *cached.Cached
 	Evm     erc.Erc
+	Chains  map[int64]chain.NftClient
 }
 
 // 这是一个函数类型，用于修改 CtxConfig
@@ -35,6 +37,7 @@ func NewServerCtx(options ...CtxOption) *ServerCtx {
 		Dao:     c.dao,
 		KvStore: c.KvStore,
 		Cached:  c.Cached,
+		Chains:  c.Chains,
 	}
 }
 
@@ -64,3 +67,9 @@ func WithCached(cached *cached.Cached) CtxOption {
 		conf.Cached = cached
 	}
 }
+
+func WithChains(chains map[int64]chain.NftClient) CtxOption {
+	return func(conf *CtxConfig) {
+		conf.Chains = chains
+	}
+}
@@ -2,18 +2,26 @@ package svc
 
 import (
 	cached "EasySwapBackend-test/src/cache"
+	"EasySwapBackend-test/src/chain"
 	"EasySwapBackend-test/src/config"
 	"EasySwapBackend-test/src/dao"
+	"EasySwapBackend-test/src/localcache"
+	"EasySwapBackend-test/src/price"
+	"EasySwapBackend-test/src/pubsub"
 	"context"
+	"fmt"
 	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/pkg/errors"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/core/stores/kv"
 	"github.com/zeromicro/go-zero/core/stores/redis"
 	"gorm.io/gorm"
+	"strings"
+	"time"
 )
 
 type ServerCtx struct {
@@ -24,6 +32,10 @@ type ServerCtx struct {
 	KvStore  *xkv.Store
 	RankKey  string
 	NodeSrvs map[int64]*nftchainservice.Service
+	Chains   map[int64]chain.NftClient // 链上NFT状态查询客户端，key为chainId
+	Prices   *price.Converter          // 多币种价格换算
+	Broker   *pubsub.Broker            // Redis pub/sub消息分发
+	Local    *localcache.Cache         // 进程内缓存，未启用时为nil
 }
 
 func NewServiceContext(c *config.Config) (*ServerCtx, error) {
@@ -46,12 +58,30 @@ func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 	}
 	store := xkv.NewStore(kvConf) // 初始化 Redis 客户端,创建 Redis 存储
 
+	//2.1、初始化go-redis客户端，用于kv.Store不支持的订阅和批量命令，使用第一个redis节点
+	var redisClient goredis.UniversalClient
+	var broker *pubsub.Broker
+	if len(c.Kv.Redis) > 0 {
+		redisClient = goredis.NewUniversalClient(&goredis.UniversalOptions{
+			Addrs:      strings.Split(c.Kv.Redis[0].Host, ","),
+			Password:   c.Kv.Redis[0].Pass,
+			MasterName: c.Kv.Redis[0].MasterName,
+		})
+		broker = pubsub.NewBroker(redisClient)
+	}
+
 	//3、初始化数据库
 	db, err := gdb.NewDB(&c.DB)
 	if err != nil {
 		return nil, err
 	}
 
+	//3.1、初始化只读从库，查询按复制延迟分配到从库
+	replicas, err := newReplicaResolver(c, db)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on init db replicas")
+	}
+
 	//4、区块链节点服务初始化
 	nodeSrvs := make(map[int64]*nftchainservice.Service)
 	for _, supported := range c.ChainSupported {
@@ -71,15 +101,96 @@ func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 		}
 	}
 
+	//4.1、链上NFT状态查询客户端初始化，基于节点服务
+	timeout := 10 * time.Second
+	if c.ListingCheck != nil && c.ListingCheck.Timeout > 0 {
+		timeout = time.Duration(c.ListingCheck.Timeout) * time.Second
+	}
+	chains := make(map[int64]chain.NftClient)
+	for _, supported := range c.ChainSupported {
+		chainId := int64(supported.ChainId)
+		chains[chainId] = chain.NewNodeClient(nodeSrvs[chainId], supported.Endpoint, timeout)
+	}
+
+	//4.2、币种和价格Oracle初始化
+	converter, err := newPriceConverter(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on init price oracle")
+	}
+
+	//4.3、进程内缓存初始化
+	var local *localcache.Cache
+	if c.LocalCache != nil && c.LocalCache.Enable {
+		maxEntries, ttl := 10000, time.Second
+		if c.LocalCache.MaxEntries > 0 {
+			maxEntries = c.LocalCache.MaxEntries
+		}
+		if c.LocalCache.Ttl > 0 {
+			ttl = time.Duration(c.LocalCache.Ttl) * time.Millisecond
+		}
+		local = localcache.New(maxEntries, ttl)
+	}
+
 	//5、dao层初始化
-	dao := dao.New(context.Background(), db, store)
+	dao := dao.New(db, store)
+	dao.Converter = converter
+	dao.Local = local
+	dao.Replicas = replicas
+	dao.Redis = redisClient
 
 	//6、初始化cache
 	cached := cached.NewCache(context.Background(), store)
+	cached.Local = local
+	cached.Project = c.ProjectCfg.Name
 
 	//7、创建服务上下文
-	serverCtx := NewServerCtx(WithDao(dao), WithDB(db), WithKv(store), WithCached(cached))
+	serverCtx := NewServerCtx(WithDao(dao), WithDB(db), WithKv(store), WithCached(cached), WithChains(chains))
 	serverCtx.C = c
 	serverCtx.NodeSrvs = nodeSrvs
+	serverCtx.Prices = converter
+	serverCtx.Broker = broker
+	serverCtx.Local = local
 	return serverCtx, nil
 }
+
+// 根据配置连接从库并在主库上注册读写分离，未配置从库时返回nil
+func newReplicaResolver(c *config.Config, db *gorm.DB) (*dao.ReplicaResolver, error) {
+	if c.Replica == nil || len(c.Replica.Nodes) == 0 {
+		return nil, nil
+	}
+	var names []string
+	var replicas []*gorm.DB
+	for i := range c.Replica.Nodes {
+		node := &c.Replica.Nodes[i]
+		replica, err := gdb.NewDB(node)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed on connect replica %s:%d", node.Host, node.Port)
+		}
+		names = append(names, fmt.Sprintf("%s:%d", node.Host, node.Port))
+		replicas = append(replicas, replica)
+	}
+	return dao.NewReplicaResolver(db, names, replicas, c.Replica.MaxLag)
+}
+
+// 根据配置创建价格换算器，未配置Oracle时返回nil
+func newPriceConverter(c *config.Config) (*price.Converter, error) {
+	if c.PriceOracle == nil {
+		return nil, nil
+	}
+	var oracle price.Oracle
+	switch c.PriceOracle.Type {
+	case "file":
+		fileOracle, err := price.NewFileOracle(c.PriceOracle.File)
+		if err != nil {
+			return nil, err
+		}
+		oracle = fileOracle
+	default:
+		staticOracle, err := price.NewStaticOracle(c.PriceOracle.Prices)
+		if err != nil {
+			return nil, err
+		}
+		oracle = staticOracle
+	}
+	return price.NewConverter(price.NewRegistry(c.Currencies), oracle), nil
+}
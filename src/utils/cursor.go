@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+)
+
+// EncodeCursor 将分页位置编码为不透明的游标
+func EncodeCursor(position interface{}) string {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor 将游标解析为分页位置
+func DecodeCursor(cursor string, position interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.Wrap(err, "failed on decode cursor")
+	}
+	if err := json.Unmarshal(data, position); err != nil {
+		return errors.Wrap(err, "failed on unmarshal cursor")
+	}
+	return nil
+}
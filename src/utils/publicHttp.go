@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const publicHttpMaxRedirects = 5
+
+var ErrNonPublicAddress = errors.New("non-public address")
+
+// 运营商级NAT地址段 100.64.0.0/10，net.IP.IsPrivate不包含
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP 是否为公网地址
+// 回环、私有、链路本地(包含云厂商元数据地址169.254.169.254)、组播、未指定和运营商级NAT地址均视为非公网
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip4[0] == 0 {
+			return false
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	return !sharedAddressSpace.Contains(ip)
+}
+
+// ValidatePublicUrl 校验url为http(s)且域名解析到的地址全部为公网地址
+// 只用于注册时提前拒绝，请求时仍需使用NewPublicHttpClient，防止解析结果之后发生变化
+func ValidatePublicUrl(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("invalid url")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if !IsPublicIP(ip) {
+			return errors.Wrap(ErrNonPublicAddress, u.Hostname())
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return errors.Wrap(err, "failed on resolve host")
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return errors.Wrap(ErrNonPublicAddress, u.Hostname())
+		}
+	}
+	return nil
+}
+
+// 在建立连接前校验实际连接的地址，覆盖重定向和DNS重绑定
+func publicDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(err, "invalid dial address")
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return errors.Wrap(ErrNonPublicAddress, host)
+	}
+	return nil
+}
+
+// NewPublicHttpClient 只允许连接公网地址的http客户端，用于请求用户提供的url
+// 不使用环境变量中的代理，否则校验的是代理地址；重定向只允许http(s)且不超过5次
+func NewPublicHttpClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   publicDialControl,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   timeout,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= publicHttpMaxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"0.1.2.3":          false,
+		"224.0.0.1":        false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+	for addr, want := range tests {
+		if got := IsPublicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestValidatePublicUrl(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://8.8.8.8/hook"},
+		{url: "ftp://8.8.8.8/hook", wantErr: true},
+		{url: "https:///hook", wantErr: true},
+		{url: "http://127.0.0.1:8080/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := ValidatePublicUrl(context.Background(), tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePublicUrl(%s) err = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPublicHttpClientRejectsLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, err := NewPublicHttpClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrNonPublicAddress) {
+		t.Fatalf("err = %v, want %v", err, ErrNonPublicAddress)
+	}
+}